@@ -4,6 +4,7 @@ package activity
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
@@ -35,15 +36,22 @@ type Info struct {
 	Name        string
 	Description string
 	Timeout     time.Duration
-	RetryPolicy *RetryPolicy
+	// HeartbeatTimeout, if set, fails an attempt that goes longer than this
+	// without calling RecordHeartbeat
+	HeartbeatTimeout time.Duration
+	RetryPolicy      *RetryPolicy
 }
 
-// RetryPolicy defines retry behavior for an activity
+// RetryPolicy defines retry behavior for an activity. Workers schedule the
+// next attempt of a failed activity after GetBackoffDuration and fail the
+// activity once MaxAttempts attempts, including the first, have failed.
 type RetryPolicy struct {
 	MaxAttempts        int
 	InitialInterval    time.Duration
 	BackoffCoefficient float64
 	MaxInterval        time.Duration
+	// NonRetryableErrors lists error messages that fail the activity without
+	// retrying, in addition to errors wrapped by NewNonRetryableError
 	NonRetryableErrors []string
 }
 
@@ -64,6 +72,11 @@ func (p *RetryPolicy) IsRetryable(err error) bool {
 		return false
 	}
 
+	var nonRetryable *NonRetryableError
+	if errors.As(err, &nonRetryable) {
+		return false
+	}
+
 	errStr := err.Error()
 	for _, nonRetryable := range p.NonRetryableErrors {
 		if errStr == nonRetryable {
@@ -83,10 +96,32 @@ func (p *RetryPolicy) GetBackoffDuration(attempt int) time.Duration {
 	duration := p.InitialInterval
 	for i := 0; i < attempt; i++ {
 		duration = time.Duration(float64(duration) * p.BackoffCoefficient)
-		if duration > p.MaxInterval {
+		if p.MaxInterval > 0 && duration > p.MaxInterval {
 			return p.MaxInterval
 		}
 	}
 
 	return duration
 }
+
+// NonRetryableError fails an activity without retrying it, regardless of its
+// retry policy
+type NonRetryableError struct {
+	Err error
+}
+
+// NewNonRetryableError wraps err so that returning it from an activity fails
+// the activity without retrying
+func NewNonRetryableError(err error) error {
+	return &NonRetryableError{Err: err}
+}
+
+// Error implements error
+func (e *NonRetryableError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error
+func (e *NonRetryableError) Unwrap() error {
+	return e.Err
+}
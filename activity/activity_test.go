@@ -2,6 +2,8 @@ package activity
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 )
@@ -76,6 +78,24 @@ func TestRetryPolicy(t *testing.T) {
 	}
 }
 
+func TestRetryPolicy_NonRetryableErrors(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 3, InitialInterval: time.Second, BackoffCoefficient: 2, NonRetryableErrors: []string{"quota exceeded"}}
+
+	if !policy.IsRetryable(errors.New("timeout")) {
+		t.Error("expected plain errors to be retryable")
+	}
+	if policy.IsRetryable(errors.New("quota exceeded")) {
+		t.Error("expected listed error message not to be retryable")
+	}
+	if policy.IsRetryable(fmt.Errorf("call failed: %w", NewNonRetryableError(errors.New("bad request")))) {
+		t.Error("expected wrapped NonRetryableError not to be retryable")
+	}
+	// Without MaxInterval the backoff is not capped
+	if d := policy.GetBackoffDuration(3); d != 8*time.Second {
+		t.Errorf("expected 8s for attempt 3, got %v", d)
+	}
+}
+
 // LLMActivity removed — dropping tests that referenced old types
 
 type mockTool struct{}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/KamdynS/marathon/agent"
+	"github.com/KamdynS/marathon/converter"
 	"github.com/KamdynS/marathon/state"
 )
 
@@ -45,13 +46,13 @@ func (a *AgentActivity) Execute(ctx context.Context, input interface{}) (interfa
 
 	// If a previous final message for this iteration exists, return it (idempotency on retry)
 	if aec.Store != nil && aec.WorkflowID != "" && iterationID != "" {
-		if prior := findFinalAssistantMessage(ctx, aec.Store, aec.WorkflowID, iterationID); prior != "" {
+		if prior := findFinalAssistantMessage(ctx, aec, iterationID); prior != "" {
 			return prior, nil
 		}
 	}
 	// Plan event
 	// Deduplicate planned event
-	if emit != nil && !eventExists(ctx, aec.Store, aec.WorkflowID, state.EventAgentStepPlanned, iterationID, "") {
+	if emit != nil && !eventExists(ctx, aec, state.EventAgentStepPlanned, iterationID, "") {
 		_ = emit(state.EventAgentStepPlanned, map[string]interface{}{
 			"iteration_id": iterationID,
 			"goal":         content,
@@ -88,7 +89,7 @@ func (a *AgentActivity) Execute(ctx context.Context, input interface{}) (interfa
 				}
 				// If tool_called already recorded for this iteration and name, skip duplicate emit
 				if aec.Store != nil && aec.WorkflowID != "" && iterationID != "" {
-					if alreadyToolCalled(ctx, aec.Store, aec.WorkflowID, iterationID, msg.Meta["name"]) {
+					if alreadyToolCalled(ctx, aec, iterationID, msg.Meta["name"]) {
 						break
 					}
 				}
@@ -103,7 +104,7 @@ func (a *AgentActivity) Execute(ctx context.Context, input interface{}) (interfa
 				toolResultEmitted = true
 				// If tool_result already exists for this iteration and name, skip duplicate emit
 				if aec.Store != nil && aec.WorkflowID != "" && iterationID != "" {
-					if alreadyToolResult(ctx, aec.Store, aec.WorkflowID, iterationID, msg.Meta["name"]) {
+					if alreadyToolResult(ctx, aec, iterationID, msg.Meta["name"]) {
 						break
 					}
 				}
@@ -158,11 +159,11 @@ func (a *AgentActivity) Execute(ctx context.Context, input interface{}) (interfa
 	}
 }
 
-func eventExists(ctx context.Context, store state.Store, workflowID string, t state.EventType, iterationID string, name string) bool {
-	if store == nil || workflowID == "" {
+func eventExists(ctx context.Context, aec ActivityEventContext, t state.EventType, iterationID string, name string) bool {
+	if aec.Store == nil || aec.WorkflowID == "" {
 		return false
 	}
-	evs, err := store.GetEventsSince(ctx, workflowID, 0)
+	evs, err := aec.Store.GetEventsSince(ctx, aec.WorkflowID, 0)
 	if err != nil {
 		return false
 	}
@@ -170,11 +171,11 @@ func eventExists(ctx context.Context, store state.Store, workflowID string, t st
 		if e.Type != t {
 			continue
 		}
-		if id, ok := e.Data["iteration_id"].(string); ok && id == iterationID {
+		if aec.eventString(e, "iteration_id") == iterationID {
 			if name == "" {
 				return true
 			}
-			if n, ok := e.Data["name"].(string); ok && n == name {
+			if aec.eventString(e, "name") == name {
 				return true
 			}
 		}
@@ -182,22 +183,24 @@ func eventExists(ctx context.Context, store state.Store, workflowID string, t st
 	return false
 }
 
-func findFinalAssistantMessage(ctx context.Context, store state.Store, workflowID string, iterationID string) string {
-	evs, err := store.GetEventsSince(ctx, workflowID, 0)
+func findFinalAssistantMessage(ctx context.Context, aec ActivityEventContext, iterationID string) string {
+	evs, err := aec.Store.GetEventsSince(ctx, aec.WorkflowID, 0)
 	if err != nil {
 		return ""
 	}
 	var last string
 	for _, e := range evs {
 		if e.Type == state.EventAgentMessage {
-			if id, ok := e.Data["iteration_id"].(string); ok && id == iterationID {
+			if aec.eventString(e, "iteration_id") == iterationID {
 				// consider final when streaming is empty
-				if s, ok := e.Data["streaming"].(string); ok && s != "" {
+				if aec.eventString(e, "streaming") != "" {
 					continue
 				}
-				if role, ok := e.Data["role"].(string); ok && role == "assistant" {
-					if c, ok := e.Data["content"].(string); ok {
-						last = c
+				if aec.eventString(e, "role") == "assistant" {
+					if c, err := converter.Value(aec.DataConverter, e.Data["content"]); err == nil {
+						if c, ok := c.(string); ok {
+							last = c
+						}
 					}
 				}
 			}
@@ -206,34 +209,30 @@ func findFinalAssistantMessage(ctx context.Context, store state.Store, workflowI
 	return last
 }
 
-func alreadyToolCalled(ctx context.Context, store state.Store, workflowID, iterationID, name string) bool {
-	evs, err := store.GetEventsSince(ctx, workflowID, 0)
+func alreadyToolCalled(ctx context.Context, aec ActivityEventContext, iterationID, name string) bool {
+	evs, err := aec.Store.GetEventsSince(ctx, aec.WorkflowID, 0)
 	if err != nil {
 		return false
 	}
 	for _, e := range evs {
 		if e.Type == state.EventAgentToolCalled {
-			if id, ok := e.Data["iteration_id"].(string); ok && id == iterationID {
-				if n, ok := e.Data["name"].(string); ok && n == name {
-					return true
-				}
+			if aec.eventString(e, "iteration_id") == iterationID && aec.eventString(e, "name") == name {
+				return true
 			}
 		}
 	}
 	return false
 }
 
-func alreadyToolResult(ctx context.Context, store state.Store, workflowID, iterationID, name string) bool {
-	evs, err := store.GetEventsSince(ctx, workflowID, 0)
+func alreadyToolResult(ctx context.Context, aec ActivityEventContext, iterationID, name string) bool {
+	evs, err := aec.Store.GetEventsSince(ctx, aec.WorkflowID, 0)
 	if err != nil {
 		return false
 	}
 	for _, e := range evs {
 		if e.Type == state.EventAgentToolResult {
-			if id, ok := e.Data["iteration_id"].(string); ok && id == iterationID {
-				if n, ok := e.Data["name"].(string); ok && n == name {
-					return true
-				}
+			if aec.eventString(e, "iteration_id") == iterationID && aec.eventString(e, "name") == name {
+				return true
 			}
 		}
 	}
@@ -0,0 +1,84 @@
+package activity
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrResultPending is returned by an activity whose result is delivered later
+// by an external system, for example a human reviewer or a webhook. The
+// worker releases the task and leaves the activity running until it is
+// completed or failed with the task token from GetTaskToken.
+var ErrResultPending = errors.New("not an error: activity result pending")
+
+// TaskToken identifies an activity attempt for asynchronous completion
+type TaskToken struct {
+	WorkflowID string `json:"workflow_id"`
+	ActivityID string `json:"activity_id"`
+	Attempt    int    `json:"attempt"`
+}
+
+// Sign encodes the token in a URL-safe form authenticated with an
+// HMAC-SHA256 keyed by secret, so holders cannot forge tokens for other
+// activities. Workers and engines must share the secret.
+func (t TaskToken) Sign(secret []byte) string {
+	b, _ := json.Marshal(t)
+	body := base64.RawURLEncoding.EncodeToString(b)
+	return body + "." + base64.RawURLEncoding.EncodeToString(taskTokenMAC(secret, body))
+}
+
+// ParseTaskToken decodes a token produced by TaskToken.Sign and verifies it
+// was signed with secret
+func ParseTaskToken(s string, secret []byte) (TaskToken, error) {
+	var t TaskToken
+	if len(secret) == 0 {
+		return t, fmt.Errorf("invalid task token: no secret configured to verify it")
+	}
+	body, sig, ok := strings.Cut(s, ".")
+	if !ok {
+		return t, fmt.Errorf("invalid task token: missing signature")
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, taskTokenMAC(secret, body)) {
+		return t, fmt.Errorf("invalid task token: bad signature")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return t, fmt.Errorf("invalid task token: %w", err)
+	}
+	if err := json.Unmarshal(b, &t); err != nil {
+		return t, fmt.Errorf("invalid task token: %w", err)
+	}
+	if t.WorkflowID == "" || t.ActivityID == "" {
+		return t, fmt.Errorf("invalid task token: missing workflow or activity ID")
+	}
+	return t, nil
+}
+
+// taskTokenMAC returns the HMAC-SHA256 of a token's encoded body
+func taskTokenMAC(secret []byte, body string) []byte {
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte(body))
+	return m.Sum(nil)
+}
+
+type taskTokenKey struct{}
+
+// WithTaskToken attaches an activity's task token to a context.
+func WithTaskToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, taskTokenKey{}, token)
+}
+
+// GetTaskToken returns the task token of the activity running with ctx, to
+// hand to the external system that completes it after the activity returns
+// ErrResultPending.
+func GetTaskToken(ctx context.Context) (string, bool) {
+	token, ok := ctx.Value(taskTokenKey{}).(string)
+	return token, ok
+}
@@ -3,10 +3,13 @@ package activity
 import (
 	"context"
 
+	"github.com/KamdynS/marathon/converter"
 	"github.com/KamdynS/marathon/state"
 )
 
 // EventEmitter is a function that appends an event with provided type and data.
+// The worker's emitter encodes each data value with its DataConverter, so
+// prompts and tool results are recorded like any other payload.
 type EventEmitter func(eventType state.EventType, data map[string]interface{}) error
 
 type eventEmitterKey struct{}
@@ -31,6 +34,20 @@ func GetEventEmitter(ctx context.Context) (EventEmitter, bool) {
 type ActivityEventContext struct {
 	Store      state.Store
 	WorkflowID string
+	// DataConverter decodes the data of events recorded by the EventEmitter;
+	// defaults to JSON
+	DataConverter converter.DataConverter
+}
+
+// eventString returns a string field of a recorded event, decoding it with
+// the context's DataConverter, or "" if absent
+func (aec ActivityEventContext) eventString(e *state.Event, key string) string {
+	v, err := converter.Value(aec.DataConverter, e.Data[key])
+	if err != nil {
+		return ""
+	}
+	s, _ := v.(string)
+	return s
 }
 
 // WithActivityEventContext attaches ActivityEventContext to context.
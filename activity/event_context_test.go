@@ -5,6 +5,7 @@ import (
 	"sync/atomic"
 	"testing"
 
+	"github.com/KamdynS/marathon/converter"
 	"github.com/KamdynS/marathon/state"
 )
 
@@ -45,3 +46,29 @@ func TestActivityEventContext_RoundTrip(t *testing.T) {
 }
 
 
+
+func TestActivityEventContext_DecodesEncodedEventData(t *testing.T) {
+	store := state.NewInMemoryStore()
+	ctx := context.Background()
+	dc := converter.NewCodecConverter(nil, &converter.GzipCodec{})
+	encode := func(data map[string]interface{}) map[string]interface{} {
+		for k, v := range data {
+			data[k], _ = converter.Normalize(dc, v)
+		}
+		return data
+	}
+	store.AppendEvent(ctx, state.NewEvent("wf-1", state.EventAgentToolCalled, encode(map[string]interface{}{
+		"iteration_id": "it-1", "name": "search", "arguments": `{"q":"x"}`,
+	})))
+	store.AppendEvent(ctx, state.NewEvent("wf-1", state.EventAgentMessage, encode(map[string]interface{}{
+		"iteration_id": "it-1", "role": "assistant", "content": "done", "streaming": "",
+	})))
+
+	aec := ActivityEventContext{Store: store, WorkflowID: "wf-1", DataConverter: dc}
+	if !alreadyToolCalled(ctx, aec, "it-1", "search") {
+		t.Fatal("expected encoded tool call to be found")
+	}
+	if got := findFinalAssistantMessage(ctx, aec, "it-1"); got != "done" {
+		t.Fatalf("expected decoded final message, got %q", got)
+	}
+}
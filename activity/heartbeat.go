@@ -0,0 +1,50 @@
+package activity
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrHeartbeatTimeout is the cause an activity's context is canceled with,
+// and the error its attempt fails with, when it stops heartbeating for longer
+// than Info.HeartbeatTimeout
+var ErrHeartbeatTimeout = errors.New("activity heartbeat timeout")
+
+// HeartbeatRecorder records that an activity is making progress, along with
+// optional details to resume from if the attempt fails.
+type HeartbeatRecorder func(details interface{})
+
+type heartbeatRecorderKey struct{}
+type heartbeatDetailsKey struct{}
+
+// WithHeartbeatRecorder attaches a HeartbeatRecorder to a context.
+func WithHeartbeatRecorder(ctx context.Context, record HeartbeatRecorder) context.Context {
+	return context.WithValue(ctx, heartbeatRecorderKey{}, record)
+}
+
+// RecordHeartbeat reports that the activity running with ctx is alive. The
+// details, if not nil, replace the checkpoint handed to the next attempt by
+// GetHeartbeatDetails. It is a no-op outside a worker.
+func RecordHeartbeat(ctx context.Context, details interface{}) {
+	if record, ok := ctx.Value(heartbeatRecorderKey{}).(HeartbeatRecorder); ok {
+		record(details)
+	}
+}
+
+// WithHeartbeatDetails attaches the details recorded by a previous attempt's
+// last heartbeat to a context.
+func WithHeartbeatDetails(ctx context.Context, details interface{}) context.Context {
+	return context.WithValue(ctx, heartbeatDetailsKey{}, details)
+}
+
+// GetHeartbeatDetails returns the details recorded by the last heartbeat of a
+// previous attempt of the activity, if any. Details come back in the generic
+// form the worker's DataConverter decodes them to, e.g. map[string]interface{}
+// for structs encoded as JSON.
+func GetHeartbeatDetails(ctx context.Context) (interface{}, bool) {
+	v := ctx.Value(heartbeatDetailsKey{})
+	if v == nil {
+		return nil, false
+	}
+	return v, true
+}
@@ -0,0 +1,59 @@
+//go:build adapters_postgres
+// +build adapters_postgres
+
+package postgres
+
+import (
+	"time"
+
+	"github.com/KamdynS/marathon/converter"
+)
+
+// defaultSchema is the schema holding the adapters' tables unless configured
+const defaultSchema = "marathon"
+
+// Config configures the PostgreSQL-backed Store.
+type Config struct {
+	// Schema holds the store's tables; defaults to "marathon"
+	Schema string
+	// SkipMigrations leaves the schema alone on New, for deployments that
+	// run Migrate separately
+	SkipMigrations bool
+	// DataConverter encodes workflow and activity inputs and outputs;
+	// defaults to JSON
+	DataConverter converter.DataConverter
+}
+
+// QueueConfig configures the PostgreSQL-backed Queue.
+type QueueConfig struct {
+	// Schema holds the queue's tables; defaults to "marathon", so the store
+	// and queue can share a schema
+	Schema string
+	// SkipMigrations leaves the schema alone on NewQueue
+	SkipMigrations bool
+	// VisibilityTimeout is how long a dequeued task stays invisible before
+	// it is delivered again if not Ack'ed; defaults to 30 seconds
+	VisibilityTimeout time.Duration
+	// MaxDeliveries is how many times a task is delivered before it moves to
+	// the dead-letter table; defaults to 10, and a negative value disables
+	// the limit
+	MaxDeliveries int
+	// PollInterval is how often an empty queue is polled while Dequeue
+	// waits; defaults to 250ms
+	PollInterval time.Duration
+	// PopTimeout is how long Dequeue waits for a task; defaults to 5 seconds
+	PopTimeout time.Duration
+	// DataConverter encodes task inputs; defaults to JSON
+	DataConverter converter.DataConverter
+}
+
+// DefaultQueueConfig provides sensible defaults.
+func DefaultQueueConfig() QueueConfig {
+	return QueueConfig{
+		Schema:            defaultSchema,
+		VisibilityTimeout: 30 * time.Second,
+		MaxDeliveries:     10,
+		PollInterval:      250 * time.Millisecond,
+		PopTimeout:        5 * time.Second,
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !adapters_postgres
+// +build !adapters_postgres
+
+// Package postgres provides PostgreSQL-backed state store and queue adapters.
+// This stub is built when the adapters_postgres build tag is not enabled so
+// that editors and linters can still recognize the package and avoid "no
+// packages found for open file" errors.
+package postgres
+
+const _adapterDisabled = true
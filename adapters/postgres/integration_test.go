@@ -0,0 +1,374 @@
+//go:build adapters_postgres
+// +build adapters_postgres
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/state"
+)
+
+// testDB opens the database named by POSTGRES_DSN with the driver named by
+// POSTGRES_DRIVER (default "pgx"), which the test binary must register, for
+// example by building with a file that imports github.com/jackc/pgx/v5/stdlib.
+// It returns a fresh schema that is dropped when the test ends.
+func testDB(t *testing.T) (*sql.DB, string) {
+	t.Helper()
+	dsn := os.Getenv("POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_DSN not set; skipping PostgreSQL integration tests")
+	}
+	driver := os.Getenv("POSTGRES_DRIVER")
+	if driver == "" {
+		driver = "pgx"
+	}
+	if !slices.Contains(sql.Drivers(), driver) {
+		t.Skipf("database/sql driver %q not registered; skipping PostgreSQL integration tests", driver)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	schema := fmt.Sprintf("marathon_test_%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		_, _ = db.Exec(`DROP SCHEMA IF EXISTS ` + quoteIdent(schema) + ` CASCADE`)
+		_ = db.Close()
+	})
+	return db, schema
+}
+
+func newTestStore(t *testing.T) *Store {
+	db, schema := testDB(t)
+	s, err := New(context.Background(), db, Config{Schema: schema})
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	return s
+}
+
+func newTestQueue(t *testing.T, cfg QueueConfig) *Queue {
+	db, schema := testDB(t)
+	cfg.Schema = schema
+	q, err := NewQueue(context.Background(), db, cfg)
+	if err != nil {
+		t.Fatalf("new queue: %v", err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func TestMigrate_Idempotent(t *testing.T) {
+	db, schema := testDB(t)
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := Migrate(ctx, db, schema); err != nil {
+			t.Fatalf("migrate run %d: %v", i+1, err)
+		}
+	}
+}
+
+func TestStore_WorkflowStateAndListing(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	start := time.Now().UTC().Truncate(time.Millisecond)
+
+	for i, status := range []state.WorkflowStatus{state.StatusRunning, state.StatusCompleted, state.StatusRunning} {
+		ws := &state.WorkflowState{
+			WorkflowID:   fmt.Sprintf("wf-%d", i),
+			WorkflowName: "demo",
+			Status:       status,
+			Input:        map[string]interface{}{"n": float64(i)},
+			StartTime:    start.Add(time.Duration(i) * time.Second),
+		}
+		if err := s.SaveWorkflowState(ctx, ws); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+
+	got, err := s.GetWorkflowState(ctx, "wf-1")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.Status != state.StatusCompleted || got.Input.(map[string]interface{})["n"] != float64(1) {
+		t.Fatalf("unexpected state: %+v", got)
+	}
+	if _, err := s.GetWorkflowState(ctx, "missing"); err == nil {
+		t.Fatal("expected error for missing workflow")
+	}
+
+	running, err := s.ListWorkflows(ctx, state.StatusRunning)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(running) != 2 || running[0].WorkflowID != "wf-0" || running[1].WorkflowID != "wf-2" {
+		t.Fatalf("unexpected running workflows: %+v", running)
+	}
+	all, err := s.ListWorkflows(ctx, "")
+	if err != nil || len(all) != 3 {
+		t.Fatalf("list all: %d %v", len(all), err)
+	}
+
+	if err := s.DeleteWorkflow(ctx, "wf-0"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := s.GetWorkflowState(ctx, "wf-0"); err == nil {
+		t.Fatal("expected deleted workflow to be gone")
+	}
+}
+
+func TestStore_AppendEventConcurrentSequencing(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	if err := s.SaveWorkflowState(ctx, &state.WorkflowState{WorkflowID: "wf", Status: state.StatusRunning, StartTime: time.Now()}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := s.AppendEvent(ctx, state.NewEvent("wf", state.EventActivityScheduled, map[string]interface{}{"i": i})); err != nil {
+				t.Errorf("append: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	events, err := s.GetEvents(ctx, "wf")
+	if err != nil {
+		t.Fatalf("events: %v", err)
+	}
+	if len(events) != n {
+		t.Fatalf("want %d events got %d", n, len(events))
+	}
+	for i, ev := range events {
+		if ev.SequenceNum != int64(i+1) {
+			t.Fatalf("event %d has sequence %d", i, ev.SequenceNum)
+		}
+	}
+	since, err := s.GetEventsSince(ctx, "wf", n-5)
+	if err != nil || len(since) != 5 || since[0].SequenceNum != n-4 {
+		t.Fatalf("events since: %d %v", len(since), err)
+	}
+	ws, err := s.GetWorkflowState(ctx, "wf")
+	if err != nil || ws.LastEventSeq != n {
+		t.Fatalf("last_event_seq want %d got %+v %v", n, ws, err)
+	}
+}
+
+func TestStore_ContinueAsNew(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	closed := &state.WorkflowState{WorkflowID: "run-1", Status: state.StatusContinuedAsNew, ContinuedAsNewRunID: "run-2", StartTime: time.Now()}
+	next := &state.WorkflowState{WorkflowID: "run-2", Status: state.StatusRunning, FirstRunID: "run-1", StartTime: time.Now()}
+	err := s.ContinueAsNew(ctx, closed,
+		state.NewEvent("run-1", state.EventWorkflowContinuedAsNew, nil), next,
+		state.NewEvent("run-2", state.EventWorkflowStarted, nil))
+	if err != nil {
+		t.Fatalf("continue as new: %v", err)
+	}
+	for _, id := range []string{"run-1", "run-2"} {
+		events, err := s.GetEvents(ctx, id)
+		if err != nil || len(events) != 1 {
+			t.Fatalf("events of %s: %d %v", id, len(events), err)
+		}
+	}
+
+	// The next run exists now, so a second attempt changes nothing
+	err = s.ContinueAsNew(ctx, closed,
+		state.NewEvent("run-1", state.EventWorkflowContinuedAsNew, nil), next,
+		state.NewEvent("run-2", state.EventWorkflowStarted, nil))
+	if err == nil {
+		t.Fatal("expected error when the next run exists")
+	}
+	if events, _ := s.GetEvents(ctx, "run-1"); len(events) != 1 {
+		t.Fatalf("expected the failed attempt to roll back, got %d events", len(events))
+	}
+}
+
+func TestStore_IdempotencyTimersLeasesSchedules(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	created, existing, err := s.MapIdempotencyKeyToWorkflow(ctx, "k", "wf-1")
+	if err != nil || !created || existing != "" {
+		t.Fatalf("first mapping: %v %q %v", created, existing, err)
+	}
+	created, existing, err = s.MapIdempotencyKeyToWorkflow(ctx, "k", "wf-2")
+	if err != nil || created || existing != "wf-1" {
+		t.Fatalf("second mapping: %v %q %v", created, existing, err)
+	}
+
+	now := time.Now()
+	if err := s.ScheduleTimer(ctx, "wf", "due", now.Add(-time.Second)); err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+	if err := s.ScheduleTimer(ctx, "wf", "later", now.Add(time.Hour)); err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+	due, err := s.ListDueTimers(ctx, now)
+	if err != nil || len(due) != 1 || due[0].TimerID != "due" {
+		t.Fatalf("due timers: %+v %v", due, err)
+	}
+	if ok, err := s.MarkTimerFired(ctx, "wf", "due"); err != nil || !ok {
+		t.Fatalf("mark fired: %v %v", ok, err)
+	}
+	if ok, _ := s.MarkTimerFired(ctx, "wf", "due"); ok {
+		t.Fatal("expected a fired timer not to transition again")
+	}
+
+	if ok, err := s.AcquireLease(ctx, "lease", "a", time.Minute); err != nil || !ok {
+		t.Fatalf("acquire: %v %v", ok, err)
+	}
+	if ok, _ := s.AcquireLease(ctx, "lease", "b", time.Minute); ok {
+		t.Fatal("expected a held lease to be refused")
+	}
+	if err := s.ReleaseLease(ctx, "lease", "a"); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if ok, _ := s.AcquireLease(ctx, "lease", "b", time.Minute); !ok {
+		t.Fatal("expected a released lease to be free")
+	}
+
+	for _, id := range []string{"b", "a"} {
+		if err := s.SaveSchedule(ctx, &state.ScheduleState{ScheduleID: id, WorkflowName: "demo", Interval: time.Minute}); err != nil {
+			t.Fatalf("save schedule: %v", err)
+		}
+	}
+	schedules, err := s.ListSchedules(ctx)
+	if err != nil || len(schedules) != 2 || schedules[0].ScheduleID != "a" {
+		t.Fatalf("list schedules: %+v %v", schedules, err)
+	}
+	if err := s.DeleteSchedule(ctx, "a"); err != nil {
+		t.Fatalf("delete schedule: %v", err)
+	}
+	if err := s.DeleteSchedule(ctx, "a"); err == nil {
+		t.Fatal("expected error deleting a missing schedule")
+	}
+}
+
+func TestQueue_PriorityAndFairness(t *testing.T) {
+	q := newTestQueue(t, QueueConfig{PollInterval: 20 * time.Millisecond})
+	ctx := context.Background()
+
+	var tasks []*queue.Task
+	add := func(id, key string, priority int) {
+		task := queue.NewTask(queue.TaskTypeActivity, "wf", id)
+		task.ID = id
+		task.FairnessKey = key
+		task.Priority = priority
+		tasks = append(tasks, task)
+	}
+	add("a1", "a", 0)
+	add("a2", "a", 0)
+	add("a3", "a", 0)
+	add("b1", "b", 0)
+	add("urgent", "a", 5)
+	for _, task := range tasks {
+		if err := q.Enqueue(ctx, "default", task); err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+	}
+
+	var order []string
+	for range tasks {
+		got, err := q.DequeueWithTimeout(ctx, "default", time.Second)
+		if err != nil {
+			t.Fatalf("dequeue: %v", err)
+		}
+		order = append(order, got.ID)
+		if err := q.Ack(ctx, "default", got.ID); err != nil {
+			t.Fatalf("ack: %v", err)
+		}
+	}
+	want := []string{"urgent", "b1", "a1", "a2", "a3"}
+	if !slices.Equal(order, want) {
+		t.Fatalf("want %v got %v", want, order)
+	}
+}
+
+func TestQueue_RedeliveryAndDeadLetters(t *testing.T) {
+	q := newTestQueue(t, QueueConfig{
+		VisibilityTimeout: 200 * time.Millisecond,
+		MaxDeliveries:     2,
+		PollInterval:      20 * time.Millisecond,
+	})
+	ctx := context.Background()
+
+	task := queue.NewTask(queue.TaskTypeActivity, "wf", map[string]interface{}{"x": float64(1)})
+	if err := q.Enqueue(ctx, "default", task); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	first, err := q.DequeueWithTimeout(ctx, "default", time.Second)
+	if err != nil || first.Attempts != 1 {
+		t.Fatalf("first delivery: %+v %v", first, err)
+	}
+
+	// Not acknowledged: delivered again after the visibility timeout
+	second, err := q.DequeueWithTimeout(ctx, "default", 2*time.Second)
+	if err != nil || second.ID != task.ID || second.Attempts != 2 {
+		t.Fatalf("second delivery: %+v %v", second, err)
+	}
+	if err := q.Nack(ctx, "default", second.ID, true); err != nil {
+		t.Fatalf("nack: %v", err)
+	}
+
+	// Delivered MaxDeliveries times: dead-lettered instead of a third delivery
+	if _, err := q.DequeueWithTimeout(ctx, "default", 300*time.Millisecond); err == nil {
+		t.Fatal("expected no third delivery")
+	}
+	dead, err := q.DeadLetters(ctx, "default", 10)
+	if err != nil || len(dead) != 1 || dead[0].ID != task.ID {
+		t.Fatalf("dead letters: %+v %v", dead, err)
+	}
+	if dead[0].Metadata["dead_letter_reason"] != "max deliveries exceeded" {
+		t.Fatalf("unexpected reason: %v", dead[0].Metadata["dead_letter_reason"])
+	}
+
+	other := queue.NewTask(queue.TaskTypeActivity, "wf", "y")
+	other.ID = task.ID + "-other"
+	if err := q.Enqueue(ctx, "default", other); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	got, err := q.DequeueWithTimeout(ctx, "default", time.Second)
+	if err != nil {
+		t.Fatalf("dequeue: %v", err)
+	}
+	if err := q.Nack(ctx, "default", got.ID, false); err != nil {
+		t.Fatalf("nack: %v", err)
+	}
+	if dead, _ := q.DeadLetters(ctx, "default", 10); len(dead) != 2 || dead[1].Metadata["dead_letter_reason"] != "nacked" {
+		t.Fatalf("expected the nacked task to be dead-lettered: %+v", dead)
+	}
+}
+
+func TestQueue_EnqueueAt(t *testing.T) {
+	q := newTestQueue(t, QueueConfig{PollInterval: 20 * time.Millisecond})
+	ctx := context.Background()
+
+	task := queue.NewTask(queue.TaskTypeActivity, "wf", "later")
+	if err := q.EnqueueAt(ctx, "default", task, time.Now().Add(300*time.Millisecond)); err != nil {
+		t.Fatalf("enqueue at: %v", err)
+	}
+	if l, _ := q.Len(ctx, "default"); l != 0 {
+		t.Fatalf("expected delayed task not to be counted, got %d", l)
+	}
+	if _, err := q.DequeueWithTimeout(ctx, "default", 100*time.Millisecond); err == nil {
+		t.Fatal("expected delayed task to stay invisible")
+	}
+	got, err := q.DequeueWithTimeout(ctx, "default", 2*time.Second)
+	if err != nil || got.ID != task.ID {
+		t.Fatalf("dequeue: %+v %v", got, err)
+	}
+}
@@ -0,0 +1,143 @@
+//go:build adapters_postgres
+// +build adapters_postgres
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migration is one embedded schema migration. Files are named
+// {version}_{name}.sql and reference the schema as {{schema}}.
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// loadMigrations returns the embedded migrations ordered by version
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	out := make([]migration, 0, len(entries))
+	seen := make(map[int]string)
+	for _, entry := range entries {
+		name := entry.Name()
+		prefix, _, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("migration %s: name must start with a version number", name)
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", other, name, version)
+		}
+		seen[version] = name
+		b, err := migrationFiles.ReadFile(path.Join("migrations", name))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, migration{version: version, name: name, sql: string(b)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].version < out[j].version })
+	return out, nil
+}
+
+// Migrate creates schema if needed and applies the embedded migrations it is
+// missing, recording them in its schema_migrations table. Migrations run in
+// one transaction under an advisory lock, so processes starting together
+// apply them once.
+func Migrate(ctx context.Context, db *sql.DB, schema string) error {
+	if schema == "" {
+		schema = defaultSchema
+	}
+	migrations, err := loadMigrations()
+	if err != nil {
+		return fmt.Errorf("load migrations: %w", err)
+	}
+	r := newRenderer(schema)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("postgres begin migrations: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, "marathon-migrate:"+schema); err != nil {
+		return fmt.Errorf("postgres lock migrations: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, r.sql(`CREATE SCHEMA IF NOT EXISTS {{schema}}`)); err != nil {
+		return fmt.Errorf("postgres create schema: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, r.sql(`CREATE TABLE IF NOT EXISTS {{schema}}.schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)); err != nil {
+		return fmt.Errorf("postgres create schema_migrations: %w", err)
+	}
+
+	applied := make(map[int]bool)
+	rows, err := tx.QueryContext(ctx, r.sql(`SELECT version FROM {{schema}}.schema_migrations`))
+	if err != nil {
+		return fmt.Errorf("postgres list migrations: %w", err)
+	}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return fmt.Errorf("postgres list migrations: %w", err)
+		}
+		applied[version] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("postgres list migrations: %w", err)
+	}
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+		// Executed without arguments so drivers send the file's statements
+		// in one simple query
+		if _, err := tx.ExecContext(ctx, r.sql(m.sql)); err != nil {
+			return fmt.Errorf("postgres apply migration %s: %w", m.name, err)
+		}
+		if _, err := tx.ExecContext(ctx, r.sql(`INSERT INTO {{schema}}.schema_migrations (version, name) VALUES ($1, $2)`), m.version, m.name); err != nil {
+			return fmt.Errorf("postgres record migration %s: %w", m.name, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("postgres commit migrations: %w", err)
+	}
+	return nil
+}
+
+// renderer renders SQL written against {{schema}} for a concrete schema
+type renderer struct {
+	replacer *strings.Replacer
+}
+
+func newRenderer(schema string) renderer {
+	return renderer{replacer: strings.NewReplacer("{{schema}}", quoteIdent(schema))}
+}
+
+func (r renderer) sql(query string) string { return r.replacer.Replace(query) }
+
+// quoteIdent quotes a PostgreSQL identifier
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
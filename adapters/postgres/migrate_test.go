@@ -0,0 +1,36 @@
+//go:build adapters_postgres
+// +build adapters_postgres
+
+package postgres
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadMigrations_OrderedAndSchemaQualified(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("expected embedded migrations")
+	}
+	for i, m := range migrations {
+		if i > 0 && m.version <= migrations[i-1].version {
+			t.Fatalf("migrations out of order: %s after %s", m.name, migrations[i-1].name)
+		}
+		if !strings.Contains(m.sql, "{{schema}}.") {
+			t.Fatalf("migration %s does not reference {{schema}}", m.name)
+		}
+	}
+}
+
+func TestRenderer_QuotesSchema(t *testing.T) {
+	r := newRenderer(`odd"name`)
+	got := r.sql(`SELECT 1 FROM {{schema}}.workflows`)
+	want := `SELECT 1 FROM "odd""name".workflows`
+	if got != want {
+		t.Fatalf("want %q got %q", want, got)
+	}
+}
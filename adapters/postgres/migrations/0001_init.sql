@@ -0,0 +1,93 @@
+-- Workflow runs; state holds the JSON-encoded state.WorkflowState
+CREATE TABLE IF NOT EXISTS {{schema}}.workflows (
+    workflow_id TEXT PRIMARY KEY,
+    status      TEXT NOT NULL,
+    start_time  TIMESTAMPTZ NOT NULL,
+    state       JSONB NOT NULL,
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS workflows_status_idx ON {{schema}}.workflows (status, start_time);
+
+-- Last sequence number appended to each workflow's event log. Appends lock
+-- the row, which serializes them per workflow.
+CREATE TABLE IF NOT EXISTS {{schema}}.event_sequences (
+    workflow_id TEXT PRIMARY KEY,
+    last_seq    BIGINT NOT NULL
+);
+
+-- Append-only event logs
+CREATE TABLE IF NOT EXISTS {{schema}}.events (
+    workflow_id TEXT NOT NULL,
+    seq         BIGINT NOT NULL,
+    event       JSONB NOT NULL,
+    PRIMARY KEY (workflow_id, seq)
+);
+
+CREATE TABLE IF NOT EXISTS {{schema}}.activities (
+    activity_id TEXT PRIMARY KEY,
+    workflow_id TEXT NOT NULL,
+    state       JSONB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS activities_workflow_idx ON {{schema}}.activities (workflow_id);
+
+CREATE TABLE IF NOT EXISTS {{schema}}.idempotency_keys (
+    key         TEXT PRIMARY KEY,
+    workflow_id TEXT NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS {{schema}}.timers (
+    workflow_id TEXT NOT NULL,
+    timer_id    TEXT NOT NULL,
+    fire_at     TIMESTAMPTZ NOT NULL,
+    fired       BOOLEAN NOT NULL DEFAULT false,
+    PRIMARY KEY (workflow_id, timer_id)
+);
+CREATE INDEX IF NOT EXISTS timers_due_idx ON {{schema}}.timers (fire_at) WHERE NOT fired;
+
+CREATE TABLE IF NOT EXISTS {{schema}}.schedules (
+    schedule_id TEXT PRIMARY KEY,
+    state       JSONB NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS {{schema}}.leases (
+    name       TEXT PRIMARY KEY,
+    owner      TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- Queued tasks. A task is ready once visible_at has passed; Dequeue pushes
+-- visible_at back by the visibility timeout, so a task that is not
+-- acknowledged in time becomes ready again.
+CREATE TABLE IF NOT EXISTS {{schema}}.queue_tasks (
+    id           BIGSERIAL PRIMARY KEY,
+    queue_name   TEXT NOT NULL,
+    task_id      TEXT NOT NULL,
+    priority     INTEGER NOT NULL DEFAULT 0,
+    fairness_key TEXT NOT NULL DEFAULT '',
+    task         JSONB NOT NULL,
+    attempts     INTEGER NOT NULL DEFAULT 0,
+    visible_at   TIMESTAMPTZ NOT NULL,
+    enqueued_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS queue_tasks_ready_idx ON {{schema}}.queue_tasks (queue_name, priority DESC, visible_at);
+
+-- When each fairness key of a queue was last served, to serve the keys of a
+-- priority round-robin
+CREATE TABLE IF NOT EXISTS {{schema}}.queue_fairness (
+    queue_name   TEXT NOT NULL,
+    fairness_key TEXT NOT NULL,
+    served_at    TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (queue_name, fairness_key)
+);
+
+CREATE TABLE IF NOT EXISTS {{schema}}.queue_dead_letters (
+    id               BIGSERIAL PRIMARY KEY,
+    queue_name       TEXT NOT NULL,
+    task_id          TEXT NOT NULL,
+    task             JSONB NOT NULL,
+    attempts         INTEGER NOT NULL,
+    reason           TEXT NOT NULL,
+    dead_lettered_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS queue_dead_letters_queue_idx ON {{schema}}.queue_dead_letters (queue_name, id);
@@ -0,0 +1,350 @@
+//go:build adapters_postgres
+// +build adapters_postgres
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/KamdynS/marathon/converter"
+	"github.com/KamdynS/marathon/queue"
+)
+
+// Ensure Queue implements queue.Queue
+var _ queue.Queue = (*Queue)(nil)
+
+// Queue implements queue.Queue on a PostgreSQL table. Consumers claim tasks
+// with SELECT ... FOR UPDATE SKIP LOCKED, so concurrent workers never block
+// on or claim the same task, and a claimed task stays invisible for the
+// visibility timeout: tasks not acknowledged in time, for example because
+// their worker crashed, are delivered again. Tasks delivered more than
+// MaxDeliveries times or Nack'ed without requeue move to the dead-letter
+// table. Task.Attempts is the number of times the task was delivered.
+//
+// Like InMemoryQueue, each queue name serves higher priorities first and the
+// fairness keys of a priority round-robin, by serving the key that was
+// served least recently.
+type Queue struct {
+	db  *sql.DB
+	r   renderer
+	cfg QueueConfig
+
+	mu sync.Mutex
+	// handles maps the IDs of tasks delivered to this consumer to their
+	// deliveries, for Ack and Nack
+	handles map[string]delivery
+
+	closeOnce sync.Once
+	stopCh    chan struct{}
+}
+
+// delivery identifies one delivery of a task row. A stale delivery, whose
+// task was delivered again after its visibility timeout, no longer matches
+// the row's attempts and cannot settle the task.
+type delivery struct {
+	id       int64
+	attempts int
+}
+
+// NewQueue creates a Queue on db, applying the embedded migrations unless
+// cfg.SkipMigrations is set. The Queue does not close db.
+func NewQueue(ctx context.Context, db *sql.DB, cfg QueueConfig) (*Queue, error) {
+	base := DefaultQueueConfig()
+	if cfg.Schema == "" {
+		cfg.Schema = base.Schema
+	}
+	if cfg.VisibilityTimeout <= 0 {
+		cfg.VisibilityTimeout = base.VisibilityTimeout
+	}
+	if cfg.MaxDeliveries == 0 {
+		cfg.MaxDeliveries = base.MaxDeliveries
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = base.PollInterval
+	}
+	if cfg.PopTimeout <= 0 {
+		cfg.PopTimeout = base.PopTimeout
+	}
+	if cfg.DataConverter == nil {
+		cfg.DataConverter = converter.Default()
+	}
+	if err := db.PingContext(ctx); err != nil {
+		return nil, err
+	}
+	if !cfg.SkipMigrations {
+		if err := Migrate(ctx, db, cfg.Schema); err != nil {
+			return nil, err
+		}
+	}
+	return &Queue{
+		db:      db,
+		r:       newRenderer(cfg.Schema),
+		cfg:     cfg,
+		handles: make(map[string]delivery),
+		stopCh:  make(chan struct{}),
+	}, nil
+}
+
+// Enqueue adds a task that is visible right away.
+func (q *Queue) Enqueue(ctx context.Context, queueName string, task *queue.Task) error {
+	return q.EnqueueAt(ctx, queueName, task, time.Time{})
+}
+
+// EnqueueAt adds a task that becomes visible at visibleAt.
+func (q *Queue) EnqueueAt(ctx context.Context, queueName string, task *queue.Task, visibleAt time.Time) error {
+	// Normalize the input on a copy so the caller's task is left untouched
+	msg := *task
+	var err error
+	if msg.Input, err = converter.Normalize(q.cfg.DataConverter, task.Input); err != nil {
+		return fmt.Errorf("encode task input: %w", err)
+	}
+	b, err := json.Marshal(&msg)
+	if err != nil {
+		return fmt.Errorf("marshal task: %w", err)
+	}
+	if visibleAt.IsZero() {
+		visibleAt = time.Now()
+	}
+	_, err = q.db.ExecContext(ctx, q.r.sql(`
+INSERT INTO {{schema}}.queue_tasks (queue_name, task_id, priority, fairness_key, task, attempts, visible_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)`),
+		queueName, task.ID, task.Priority, task.FairnessKey, string(b), task.Attempts, visibleAt)
+	if err != nil {
+		return fmt.Errorf("postgres enqueue task: %w", err)
+	}
+	return nil
+}
+
+// Dequeue is a convenience for DequeueWithTimeout with default timeout.
+func (q *Queue) Dequeue(ctx context.Context, queueName string) (*queue.Task, error) {
+	return q.DequeueWithTimeout(ctx, queueName, q.cfg.PopTimeout)
+}
+
+// DequeueWithTimeout claims the next ready task, polling the queue every
+// PollInterval until one is ready or timeout elapses.
+func (q *Queue) DequeueWithTimeout(ctx context.Context, queueName string, timeout time.Duration) (*queue.Task, error) {
+	if timeout <= 0 {
+		timeout = q.cfg.PopTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		select {
+		case <-q.stopCh:
+			return nil, fmt.Errorf("queue is closed")
+		default:
+		}
+		if q.cfg.MaxDeliveries > 0 {
+			if err := q.deadLetterExhausted(ctx, queueName); err != nil {
+				return nil, err
+			}
+		}
+		task, err := q.claim(ctx, queueName)
+		if err != nil || task != nil {
+			return task, err
+		}
+
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return nil, fmt.Errorf("dequeue timeout")
+		}
+		timer := time.NewTimer(min(wait, q.cfg.PollInterval))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-q.stopCh:
+			timer.Stop()
+			return nil, fmt.Errorf("queue is closed")
+		}
+	}
+}
+
+// claimSQL claims the next ready task of a queue and records its fairness
+// key as served. Rows locked by other consumers are skipped rather than
+// waited on.
+const claimSQL = `
+WITH next AS (
+    SELECT t.id FROM {{schema}}.queue_tasks t
+    LEFT JOIN {{schema}}.queue_fairness f
+        ON f.queue_name = t.queue_name AND f.fairness_key = t.fairness_key
+    WHERE t.queue_name = $1 AND t.visible_at <= now()
+    ORDER BY t.priority DESC, f.served_at NULLS FIRST, t.id
+    LIMIT 1
+    FOR UPDATE OF t SKIP LOCKED
+), claimed AS (
+    UPDATE {{schema}}.queue_tasks t
+    SET visible_at = now() + $2::bigint * interval '1 millisecond', attempts = t.attempts + 1
+    FROM next WHERE t.id = next.id
+    RETURNING t.id, t.fairness_key, t.task, t.attempts
+), served AS (
+    INSERT INTO {{schema}}.queue_fairness (queue_name, fairness_key, served_at)
+    SELECT $1, fairness_key, clock_timestamp() FROM claimed
+    ON CONFLICT (queue_name, fairness_key) DO UPDATE SET served_at = EXCLUDED.served_at
+)
+SELECT id, task, attempts FROM claimed`
+
+// claim claims the next ready task, or returns nil if none is ready
+func (q *Queue) claim(ctx context.Context, queueName string) (*queue.Task, error) {
+	var d delivery
+	var b []byte
+	err := q.db.QueryRowContext(ctx, q.r.sql(claimSQL), queueName, q.cfg.VisibilityTimeout.Milliseconds()).Scan(&d.id, &b, &d.attempts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("postgres claim task: %w", err)
+	}
+	var t queue.Task
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, fmt.Errorf("unmarshal task: %w", err)
+	}
+	t.Input = converter.Restore(t.Input)
+	t.Attempts = d.attempts
+	q.mu.Lock()
+	q.handles[t.ID] = d
+	q.mu.Unlock()
+	return &t, nil
+}
+
+// deadLetterSQL moves tasks matching a condition on t to the dead-letter
+// table; $1 is the queue name and $2 the reason
+const deadLetterSQL = `
+WITH moved AS (
+    DELETE FROM {{schema}}.queue_tasks WHERE id IN (
+        SELECT t.id FROM {{schema}}.queue_tasks t
+        WHERE t.queue_name = $1 AND %s
+        FOR UPDATE SKIP LOCKED
+    )
+    RETURNING queue_name, task_id, task, attempts
+)
+INSERT INTO {{schema}}.queue_dead_letters (queue_name, task_id, task, attempts, reason)
+SELECT queue_name, task_id, task, attempts, $2::text FROM moved`
+
+// deadLetterExhausted moves ready tasks that were already delivered
+// MaxDeliveries times to the dead-letter table
+func (q *Queue) deadLetterExhausted(ctx context.Context, queueName string) error {
+	query := q.r.sql(fmt.Sprintf(deadLetterSQL, "t.visible_at <= now() AND t.attempts >= $3"))
+	if _, err := q.db.ExecContext(ctx, query, queueName, "max deliveries exceeded", q.cfg.MaxDeliveries); err != nil {
+		return fmt.Errorf("postgres dead-letter exhausted tasks: %w", err)
+	}
+	return nil
+}
+
+// handle returns and forgets the delivery of a task delivered to this
+// consumer
+func (q *Queue) handle(taskID string) (delivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	d, ok := q.handles[taskID]
+	if !ok {
+		return delivery{}, fmt.Errorf("task %s not found in pending", taskID)
+	}
+	delete(q.handles, taskID)
+	return d, nil
+}
+
+// settled checks that a statement settling a delivery found its task
+func settled(res sql.Result, taskID string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("task %s was delivered again after its visibility timeout", taskID)
+	}
+	return nil
+}
+
+// Ack deletes a delivered task.
+func (q *Queue) Ack(ctx context.Context, queueName string, taskID string) error {
+	d, err := q.handle(taskID)
+	if err != nil {
+		return err
+	}
+	res, err := q.db.ExecContext(ctx, q.r.sql(`DELETE FROM {{schema}}.queue_tasks WHERE id = $1 AND attempts = $2`), d.id, d.attempts)
+	if err != nil {
+		return fmt.Errorf("postgres ack task: %w", err)
+	}
+	return settled(res, taskID)
+}
+
+// Nack makes a delivered task visible again right away with requeue, and
+// moves it to the dead-letter table without.
+func (q *Queue) Nack(ctx context.Context, queueName string, taskID string, requeue bool) error {
+	d, err := q.handle(taskID)
+	if err != nil {
+		return err
+	}
+	var res sql.Result
+	if requeue {
+		res, err = q.db.ExecContext(ctx, q.r.sql(`UPDATE {{schema}}.queue_tasks SET visible_at = now() WHERE id = $1 AND attempts = $2`), d.id, d.attempts)
+	} else {
+		query := q.r.sql(fmt.Sprintf(deadLetterSQL, "t.id = $3 AND t.attempts = $4"))
+		res, err = q.db.ExecContext(ctx, query, queueName, "nacked", d.id, d.attempts)
+	}
+	if err != nil {
+		return fmt.Errorf("postgres nack task: %w", err)
+	}
+	return settled(res, taskID)
+}
+
+// DeadLetters returns up to count of the oldest dead-lettered tasks of a
+// queue, with the reason they were dead-lettered in their "dead_letter_reason"
+// metadata.
+func (q *Queue) DeadLetters(ctx context.Context, queueName string, count int) ([]*queue.Task, error) {
+	rows, err := q.db.QueryContext(ctx, q.r.sql(`
+SELECT task, attempts, reason FROM {{schema}}.queue_dead_letters WHERE queue_name = $1 ORDER BY id LIMIT $2`), queueName, count)
+	if err != nil {
+		return nil, fmt.Errorf("postgres list dead letters: %w", err)
+	}
+	defer rows.Close()
+	out := make([]*queue.Task, 0)
+	for rows.Next() {
+		var b []byte
+		var attempts int
+		var reason string
+		if err := rows.Scan(&b, &attempts, &reason); err != nil {
+			return nil, fmt.Errorf("postgres scan dead letter: %w", err)
+		}
+		var t queue.Task
+		if err := json.Unmarshal(b, &t); err != nil {
+			continue
+		}
+		t.Input = converter.Restore(t.Input)
+		t.Attempts = attempts
+		if t.Metadata == nil {
+			t.Metadata = make(map[string]interface{})
+		}
+		t.Metadata["dead_letter_reason"] = reason
+		out = append(out, &t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("postgres list dead letters: %w", err)
+	}
+	return out, nil
+}
+
+// Len returns the number of ready tasks; delayed and in-flight tasks are not
+// counted.
+func (q *Queue) Len(ctx context.Context, queueName string) (int, error) {
+	var n int
+	err := q.db.QueryRowContext(ctx, q.r.sql(`
+SELECT count(*) FROM {{schema}}.queue_tasks WHERE queue_name = $1 AND visible_at <= now()`), queueName).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("postgres count tasks: %w", err)
+	}
+	return n, nil
+}
+
+// Close stops waiting Dequeue calls. The Queue does not close its db.
+func (q *Queue) Close() error {
+	q.closeOnce.Do(func() { close(q.stopCh) })
+	return nil
+}
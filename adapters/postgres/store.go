@@ -0,0 +1,589 @@
+//go:build adapters_postgres
+// +build adapters_postgres
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/KamdynS/marathon/converter"
+	"github.com/KamdynS/marathon/state"
+)
+
+// Ensure Store implements state.Store
+var _ state.Store = (*Store)(nil)
+
+// Store is a PostgreSQL-backed implementation of state.Store. It uses
+// database/sql only, so the caller picks the driver: open db with a
+// PostgreSQL driver such as pgx's stdlib or lib/pq.
+//
+// Store does not implement state.EventWatcher; the engine polls it for new
+// events.
+type Store struct {
+	db *sql.DB
+	r  renderer
+	// dataConverter normalizes payload fields before they are serialized
+	dataConverter converter.DataConverter
+}
+
+// New creates a Store on db, applying the embedded migrations unless
+// cfg.SkipMigrations is set. The Store does not close db.
+func New(ctx context.Context, db *sql.DB, cfg Config) (*Store, error) {
+	if cfg.Schema == "" {
+		cfg.Schema = defaultSchema
+	}
+	if cfg.DataConverter == nil {
+		cfg.DataConverter = converter.Default()
+	}
+	if err := db.PingContext(ctx); err != nil {
+		return nil, err
+	}
+	if !cfg.SkipMigrations {
+		if err := Migrate(ctx, db, cfg.Schema); err != nil {
+			return nil, err
+		}
+	}
+	return &Store{db: db, r: newRenderer(cfg.Schema), dataConverter: cfg.DataConverter}, nil
+}
+
+// SetDataConverter replaces the converter used for payload fields. It must be
+// called before the Store is used.
+func (s *Store) SetDataConverter(dc converter.DataConverter) {
+	if dc == nil {
+		dc = converter.Default()
+	}
+	s.dataConverter = dc
+}
+
+// execer is implemented by *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// inTx runs fn in a transaction, committing it if fn succeeds
+func (s *Store) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("postgres begin: %w", err)
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("postgres commit: %w", err)
+	}
+	return nil
+}
+
+// ---------- Workflow State ----------
+
+const upsertWorkflowSQL = `
+INSERT INTO {{schema}}.workflows (workflow_id, status, start_time, state, updated_at)
+VALUES ($1, $2, $3, $4, now())
+ON CONFLICT (workflow_id) DO UPDATE
+SET status = EXCLUDED.status, start_time = EXCLUDED.start_time, state = EXCLUDED.state, updated_at = now()`
+
+func (s *Store) SaveWorkflowState(ctx context.Context, st *state.WorkflowState) error {
+	return s.saveWorkflowState(ctx, s.db, st)
+}
+
+func (s *Store) saveWorkflowState(ctx context.Context, ex execer, st *state.WorkflowState) error {
+	b, err := s.marshalWorkflowState(st)
+	if err != nil {
+		return fmt.Errorf("marshal workflow state: %w", err)
+	}
+	if _, err := ex.ExecContext(ctx, s.r.sql(upsertWorkflowSQL), st.WorkflowID, string(st.Status), st.StartTime, string(b)); err != nil {
+		return fmt.Errorf("postgres save workflow state: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) GetWorkflowState(ctx context.Context, workflowID string) (*state.WorkflowState, error) {
+	var b []byte
+	err := s.db.QueryRowContext(ctx, s.r.sql(`SELECT state FROM {{schema}}.workflows WHERE workflow_id = $1`), workflowID).Scan(&b)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", state.ErrWorkflowNotFound, workflowID)
+		}
+		return nil, fmt.Errorf("postgres get workflow state: %w", err)
+	}
+	st, err := s.unmarshalWorkflowState(b)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal workflow state: %w", err)
+	}
+	return st, nil
+}
+
+// ---------- Activity State ----------
+
+func (s *Store) SaveActivityState(ctx context.Context, st *state.ActivityState) error {
+	b, err := s.marshalActivityState(st)
+	if err != nil {
+		return fmt.Errorf("marshal activity state: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx, s.r.sql(`
+INSERT INTO {{schema}}.activities (activity_id, workflow_id, state) VALUES ($1, $2, $3)
+ON CONFLICT (activity_id) DO UPDATE SET workflow_id = EXCLUDED.workflow_id, state = EXCLUDED.state`),
+		st.ActivityID, st.WorkflowID, string(b))
+	if err != nil {
+		return fmt.Errorf("postgres save activity state: %w", err)
+	}
+	return nil
+}
+
+// TransitionActivityState updates an activity state in place only if the
+// stored status and attempt match.
+func (s *Store) TransitionActivityState(ctx context.Context, st *state.ActivityState, from state.WorkflowStatus) (bool, error) {
+	b, err := s.marshalActivityState(st)
+	if err != nil {
+		return false, fmt.Errorf("marshal activity state: %w", err)
+	}
+	res, err := s.db.ExecContext(ctx, s.r.sql(`
+UPDATE {{schema}}.activities SET state = $1
+WHERE activity_id = $2 AND state->>'status' = $3 AND (state->>'attempt')::int = $4`),
+		string(b), st.ActivityID, string(from), st.Attempt)
+	if err != nil {
+		return false, fmt.Errorf("postgres transition activity state: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("postgres transition activity state: %w", err)
+	}
+	return n == 1, nil
+}
+
+func (s *Store) GetActivityState(ctx context.Context, activityID string) (*state.ActivityState, error) {
+	var b []byte
+	err := s.db.QueryRowContext(ctx, s.r.sql(`SELECT state FROM {{schema}}.activities WHERE activity_id = $1`), activityID).Scan(&b)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("activity %s not found", activityID)
+		}
+		return nil, fmt.Errorf("postgres get activity state: %w", err)
+	}
+	st, err := s.unmarshalActivityState(b)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal activity state: %w", err)
+	}
+	return st, nil
+}
+
+// ---------- Events ----------
+
+// AppendEvent appends an event with the next sequence number of its
+// workflow, and records the number as the workflow state's last_event_seq.
+// Like InMemoryStore, it sets event.SequenceNum.
+func (s *Store) AppendEvent(ctx context.Context, e *state.Event) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		return s.appendEvent(ctx, tx, e)
+	})
+}
+
+// appendEvent appends an event within tx. Incrementing the workflow's
+// sequence row locks it until tx ends, so appends to one workflow are
+// serialized and its sequence has no gaps.
+func (s *Store) appendEvent(ctx context.Context, tx *sql.Tx, e *state.Event) error {
+	var seq int64
+	err := tx.QueryRowContext(ctx, s.r.sql(`
+INSERT INTO {{schema}}.event_sequences AS s (workflow_id, last_seq) VALUES ($1, 1)
+ON CONFLICT (workflow_id) DO UPDATE SET last_seq = s.last_seq + 1
+RETURNING last_seq`), e.WorkflowID).Scan(&seq)
+	if err != nil {
+		return fmt.Errorf("postgres next event sequence: %w", err)
+	}
+
+	cp := *e
+	cp.SequenceNum = seq
+	b, err := json.Marshal(&cp)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, s.r.sql(`INSERT INTO {{schema}}.events (workflow_id, seq, event) VALUES ($1, $2, $3)`), e.WorkflowID, seq, string(b)); err != nil {
+		return fmt.Errorf("postgres insert event: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, s.r.sql(`
+UPDATE {{schema}}.workflows SET state = jsonb_set(state, '{last_event_seq}', to_jsonb($2::bigint))
+WHERE workflow_id = $1`), e.WorkflowID, seq); err != nil {
+		return fmt.Errorf("postgres update last event sequence: %w", err)
+	}
+	e.SequenceNum = seq
+	return nil
+}
+
+func (s *Store) GetEvents(ctx context.Context, workflowID string) ([]*state.Event, error) {
+	return s.GetEventsSince(ctx, workflowID, 0)
+}
+
+func (s *Store) GetEventsSince(ctx context.Context, workflowID string, since int64) ([]*state.Event, error) {
+	rows, err := s.db.QueryContext(ctx, s.r.sql(`
+SELECT event FROM {{schema}}.events WHERE workflow_id = $1 AND seq > $2 ORDER BY seq`), workflowID, since)
+	if err != nil {
+		return nil, fmt.Errorf("postgres query events: %w", err)
+	}
+	defer rows.Close()
+	out := make([]*state.Event, 0)
+	for rows.Next() {
+		var b []byte
+		if err := rows.Scan(&b); err != nil {
+			return nil, fmt.Errorf("postgres scan event: %w", err)
+		}
+		ev, uerr := unmarshalEvent(b)
+		if uerr != nil {
+			continue
+		}
+		out = append(out, ev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("postgres query events: %w", err)
+	}
+	return out, nil
+}
+
+// ContinueAsNew closes the current run and creates its successor in a single
+// transaction so readers never observe one without the other.
+func (s *Store) ContinueAsNew(ctx context.Context, closed *state.WorkflowState, closedEvent *state.Event, next *state.WorkflowState, nextEvent *state.Event) error {
+	nextJSON, err := s.marshalWorkflowState(next)
+	if err != nil {
+		return fmt.Errorf("marshal workflow state: %w", err)
+	}
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		// Lock the closed run so a concurrent continue-as-new waits and then
+		// sees it already continued
+		var status string
+		err := tx.QueryRowContext(ctx, s.r.sql(`
+SELECT status FROM {{schema}}.workflows WHERE workflow_id = $1 FOR UPDATE`), closed.WorkflowID).Scan(&status)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("postgres lock workflow state: %w", err)
+		}
+		if state.WorkflowStatus(status) == state.StatusContinuedAsNew {
+			return fmt.Errorf("workflow %s already continued as new", closed.WorkflowID)
+		}
+		res, err := tx.ExecContext(ctx, s.r.sql(`
+INSERT INTO {{schema}}.workflows (workflow_id, status, start_time, state) VALUES ($1, $2, $3, $4)
+ON CONFLICT (workflow_id) DO NOTHING`), next.WorkflowID, string(next.Status), next.StartTime, string(nextJSON))
+		if err != nil {
+			return fmt.Errorf("postgres insert workflow state: %w", err)
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return fmt.Errorf("postgres insert workflow state: %w", err)
+		} else if n == 0 {
+			return fmt.Errorf("workflow %s already exists", next.WorkflowID)
+		}
+		if err := s.saveWorkflowState(ctx, tx, closed); err != nil {
+			return err
+		}
+		if err := s.appendEvent(ctx, tx, closedEvent); err != nil {
+			return err
+		}
+		return s.appendEvent(ctx, tx, nextEvent)
+	})
+}
+
+// ---------- Listing / Deletion ----------
+
+// ListWorkflows lists workflows ordered by start time then ID, like
+// InMemoryStore.
+func (s *Store) ListWorkflows(ctx context.Context, st state.WorkflowStatus) ([]*state.WorkflowState, error) {
+	rows, err := s.db.QueryContext(ctx, s.r.sql(`
+SELECT state FROM {{schema}}.workflows WHERE $1 = '' OR status = $1 ORDER BY start_time, workflow_id`), string(st))
+	if err != nil {
+		return nil, fmt.Errorf("postgres list workflows: %w", err)
+	}
+	defer rows.Close()
+	out := make([]*state.WorkflowState, 0)
+	for rows.Next() {
+		var b []byte
+		if err := rows.Scan(&b); err != nil {
+			return nil, fmt.Errorf("postgres scan workflow state: %w", err)
+		}
+		ws, uerr := s.unmarshalWorkflowState(b)
+		if uerr != nil {
+			continue
+		}
+		out = append(out, ws)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("postgres list workflows: %w", err)
+	}
+	return out, nil
+}
+
+// DeleteWorkflow removes a workflow's state, events, activities and timers.
+func (s *Store) DeleteWorkflow(ctx context.Context, workflowID string) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		for _, table := range []string{"workflows", "events", "event_sequences", "activities", "timers"} {
+			if _, err := tx.ExecContext(ctx, s.r.sql(`DELETE FROM {{schema}}.`+table+` WHERE workflow_id = $1`), workflowID); err != nil {
+				return fmt.Errorf("postgres delete workflow %s: %w", table, err)
+			}
+		}
+		return nil
+	})
+}
+
+// ---------- Idempotency ----------
+
+func (s *Store) MapIdempotencyKeyToWorkflow(ctx context.Context, key string, workflowID string) (bool, string, error) {
+	res, err := s.db.ExecContext(ctx, s.r.sql(`
+INSERT INTO {{schema}}.idempotency_keys (key, workflow_id) VALUES ($1, $2) ON CONFLICT (key) DO NOTHING`), key, workflowID)
+	if err != nil {
+		return false, "", fmt.Errorf("postgres insert idempotency key: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return false, "", fmt.Errorf("postgres insert idempotency key: %w", err)
+	} else if n == 1 {
+		return true, "", nil
+	}
+	existing, ok, err := s.GetWorkflowIDByIdempotencyKey(ctx, key)
+	if err != nil || !ok {
+		return false, "", err
+	}
+	return false, existing, nil
+}
+
+func (s *Store) GetWorkflowIDByIdempotencyKey(ctx context.Context, key string) (string, bool, error) {
+	var workflowID string
+	err := s.db.QueryRowContext(ctx, s.r.sql(`SELECT workflow_id FROM {{schema}}.idempotency_keys WHERE key = $1`), key).Scan(&workflowID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("postgres get idempotency key: %w", err)
+	}
+	return workflowID, true, nil
+}
+
+// ---------- Timers ----------
+
+func (s *Store) ScheduleTimer(ctx context.Context, workflowID string, timerID string, fireAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, s.r.sql(`
+INSERT INTO {{schema}}.timers (workflow_id, timer_id, fire_at) VALUES ($1, $2, $3)
+ON CONFLICT (workflow_id, timer_id) DO NOTHING`), workflowID, timerID, fireAt)
+	if err != nil {
+		return fmt.Errorf("postgres schedule timer: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) ListDueTimers(ctx context.Context, now time.Time) ([]state.TimerRecord, error) {
+	rows, err := s.db.QueryContext(ctx, s.r.sql(`
+SELECT workflow_id, timer_id, fire_at FROM {{schema}}.timers
+WHERE NOT fired AND fire_at <= $1 ORDER BY fire_at`), now)
+	if err != nil {
+		return nil, fmt.Errorf("postgres list due timers: %w", err)
+	}
+	defer rows.Close()
+	out := make([]state.TimerRecord, 0)
+	for rows.Next() {
+		var rec state.TimerRecord
+		if err := rows.Scan(&rec.WorkflowID, &rec.TimerID, &rec.FireAt); err != nil {
+			return nil, fmt.Errorf("postgres scan timer: %w", err)
+		}
+		out = append(out, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("postgres list due timers: %w", err)
+	}
+	return out, nil
+}
+
+func (s *Store) MarkTimerFired(ctx context.Context, workflowID string, timerID string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, s.r.sql(`
+UPDATE {{schema}}.timers SET fired = true WHERE workflow_id = $1 AND timer_id = $2 AND NOT fired`), workflowID, timerID)
+	if err != nil {
+		return false, fmt.Errorf("postgres mark timer fired: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("postgres mark timer fired: %w", err)
+	}
+	return n == 1, nil
+}
+
+// ---------- Leases ----------
+
+// AcquireLease takes or extends a lease. Expiry is judged by the database
+// clock, so owners on hosts with skewed clocks agree on it.
+func (s *Store) AcquireLease(ctx context.Context, name string, owner string, ttl time.Duration) (bool, error) {
+	res, err := s.db.ExecContext(ctx, s.r.sql(`
+INSERT INTO {{schema}}.leases AS l (name, owner, expires_at)
+VALUES ($1, $2, now() + $3::bigint * interval '1 millisecond')
+ON CONFLICT (name) DO UPDATE SET owner = EXCLUDED.owner, expires_at = EXCLUDED.expires_at
+WHERE l.owner = EXCLUDED.owner OR l.expires_at <= now()`), name, owner, ttl.Milliseconds())
+	if err != nil {
+		return false, fmt.Errorf("postgres acquire lease: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("postgres acquire lease: %w", err)
+	}
+	return n == 1, nil
+}
+
+func (s *Store) ReleaseLease(ctx context.Context, name string, owner string) error {
+	if _, err := s.db.ExecContext(ctx, s.r.sql(`DELETE FROM {{schema}}.leases WHERE name = $1 AND owner = $2`), name, owner); err != nil {
+		return fmt.Errorf("postgres release lease: %w", err)
+	}
+	return nil
+}
+
+// ---------- Schedules ----------
+
+func (s *Store) SaveSchedule(ctx context.Context, sched *state.ScheduleState) error {
+	b, err := s.marshalSchedule(sched)
+	if err != nil {
+		return fmt.Errorf("marshal schedule: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx, s.r.sql(`
+INSERT INTO {{schema}}.schedules (schedule_id, state) VALUES ($1, $2)
+ON CONFLICT (schedule_id) DO UPDATE SET state = EXCLUDED.state`), sched.ScheduleID, string(b))
+	if err != nil {
+		return fmt.Errorf("postgres save schedule: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) GetSchedule(ctx context.Context, scheduleID string) (*state.ScheduleState, error) {
+	var b []byte
+	err := s.db.QueryRowContext(ctx, s.r.sql(`SELECT state FROM {{schema}}.schedules WHERE schedule_id = $1`), scheduleID).Scan(&b)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("schedule %s not found", scheduleID)
+		}
+		return nil, fmt.Errorf("postgres get schedule: %w", err)
+	}
+	sched, err := s.unmarshalSchedule(b)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal schedule: %w", err)
+	}
+	return sched, nil
+}
+
+func (s *Store) ListSchedules(ctx context.Context) ([]*state.ScheduleState, error) {
+	rows, err := s.db.QueryContext(ctx, s.r.sql(`SELECT state FROM {{schema}}.schedules ORDER BY schedule_id`))
+	if err != nil {
+		return nil, fmt.Errorf("postgres list schedules: %w", err)
+	}
+	defer rows.Close()
+	out := make([]*state.ScheduleState, 0)
+	for rows.Next() {
+		var b []byte
+		if err := rows.Scan(&b); err != nil {
+			return nil, fmt.Errorf("postgres scan schedule: %w", err)
+		}
+		sched, uerr := s.unmarshalSchedule(b)
+		if uerr != nil {
+			continue
+		}
+		out = append(out, sched)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("postgres list schedules: %w", err)
+	}
+	return out, nil
+}
+
+func (s *Store) DeleteSchedule(ctx context.Context, scheduleID string) error {
+	res, err := s.db.ExecContext(ctx, s.r.sql(`DELETE FROM {{schema}}.schedules WHERE schedule_id = $1`), scheduleID)
+	if err != nil {
+		return fmt.Errorf("postgres delete schedule: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("postgres delete schedule: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("schedule %s not found", scheduleID)
+	}
+	return nil
+}
+
+// ---------- Payloads ----------
+
+// marshalWorkflowState serializes a workflow state with its input and output
+// normalized by the store's DataConverter.
+func (s *Store) marshalWorkflowState(st *state.WorkflowState) ([]byte, error) {
+	cp := *st
+	var err error
+	if cp.Input, err = converter.Normalize(s.dataConverter, st.Input); err != nil {
+		return nil, fmt.Errorf("encode input: %w", err)
+	}
+	if cp.Output, err = converter.Normalize(s.dataConverter, st.Output); err != nil {
+		return nil, fmt.Errorf("encode output: %w", err)
+	}
+	return json.Marshal(&cp)
+}
+
+func (s *Store) unmarshalWorkflowState(b []byte) (*state.WorkflowState, error) {
+	var st state.WorkflowState
+	if err := json.Unmarshal(b, &st); err != nil {
+		return nil, err
+	}
+	st.Input = converter.Restore(st.Input)
+	st.Output = converter.Restore(st.Output)
+	return &st, nil
+}
+
+// marshalActivityState serializes an activity state with its input, output
+// and heartbeat details normalized by the store's DataConverter.
+func (s *Store) marshalActivityState(st *state.ActivityState) ([]byte, error) {
+	cp := *st
+	var err error
+	if cp.Input, err = converter.Normalize(s.dataConverter, st.Input); err != nil {
+		return nil, fmt.Errorf("encode input: %w", err)
+	}
+	if cp.Output, err = converter.Normalize(s.dataConverter, st.Output); err != nil {
+		return nil, fmt.Errorf("encode output: %w", err)
+	}
+	if cp.HeartbeatDetails, err = converter.Normalize(s.dataConverter, st.HeartbeatDetails); err != nil {
+		return nil, fmt.Errorf("encode heartbeat details: %w", err)
+	}
+	return json.Marshal(&cp)
+}
+
+func (s *Store) unmarshalActivityState(b []byte) (*state.ActivityState, error) {
+	var st state.ActivityState
+	if err := json.Unmarshal(b, &st); err != nil {
+		return nil, err
+	}
+	st.Input = converter.Restore(st.Input)
+	st.Output = converter.Restore(st.Output)
+	st.HeartbeatDetails = converter.Restore(st.HeartbeatDetails)
+	return &st, nil
+}
+
+// marshalSchedule serializes a schedule with its input normalized by the
+// store's DataConverter.
+func (s *Store) marshalSchedule(sched *state.ScheduleState) ([]byte, error) {
+	cp := *sched
+	var err error
+	if cp.Input, err = converter.Normalize(s.dataConverter, sched.Input); err != nil {
+		return nil, fmt.Errorf("encode input: %w", err)
+	}
+	return json.Marshal(&cp)
+}
+
+func (s *Store) unmarshalSchedule(b []byte) (*state.ScheduleState, error) {
+	var sched state.ScheduleState
+	if err := json.Unmarshal(b, &sched); err != nil {
+		return nil, err
+	}
+	sched.Input = converter.Restore(sched.Input)
+	return &sched, nil
+}
+
+// unmarshalEvent decodes an event, restoring non-JSON payloads in its data
+func unmarshalEvent(b []byte) (*state.Event, error) {
+	ev, err := state.FromJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	converter.RestoreMap(ev.Data)
+	return ev, nil
+}
@@ -5,6 +5,8 @@ import (
 	"time"
 
 	"github.com/redis/go-redis/v9"
+
+	"github.com/KamdynS/marathon/converter"
 )
 
 // Config configures the Redis-backed Store.
@@ -18,12 +20,17 @@ type Config struct {
 	WriteTimeout time.Duration
 	PoolSize     int
 	Username     string
+	// DataConverter encodes workflow and activity inputs and outputs;
+	// defaults to JSON
+	DataConverter converter.DataConverter
 }
 
 // Store is a Redis-backed implementation of state.Store.
 type Store struct {
 	rdb    redis.UniversalClient
 	prefix string
+	// dataConverter normalizes payload fields before they are serialized
+	dataConverter converter.DataConverter
 	// cached SHA for the append event LUA script
 	appendSHA string
 	// ownsClient determines whether Close() should close the underlying client
@@ -52,7 +59,11 @@ func New(cfg Config) (*Store, error) {
 	if prefix == "" {
 		prefix = "marathon"
 	}
-	s := &Store{rdb: rdb, prefix: prefix, ownsClient: true}
+	dc := cfg.DataConverter
+	if dc == nil {
+		dc = converter.Default()
+	}
+	s := &Store{rdb: rdb, prefix: prefix, dataConverter: dc, ownsClient: true}
 	// load Lua script and cache SHA (best-effort; fallback to EVAL if it fails)
 	if sha, err := s.rdb.ScriptLoad(ctx, luaAppendEvent).Result(); err == nil {
 		s.appendSHA = sha
@@ -78,10 +89,19 @@ func NewFromClient(ctx context.Context, rdb redis.UniversalClient, prefix string
 	if err := rdb.Ping(ctx).Err(); err != nil {
 		return nil, err
 	}
-	s := &Store{rdb: rdb, prefix: prefix, ownsClient: false}
+	s := &Store{rdb: rdb, prefix: prefix, dataConverter: converter.Default(), ownsClient: false}
 	// Best-effort load of the Lua script
 	if sha, err := s.rdb.ScriptLoad(ctx, luaAppendEvent).Result(); err == nil {
 		s.appendSHA = sha
 	}
 	return s, nil
 }
+
+// SetDataConverter replaces the converter used for payload fields. It must be
+// called before the Store is used.
+func (s *Store) SetDataConverter(dc converter.DataConverter) {
+	if dc == nil {
+		dc = converter.Default()
+	}
+	s.dataConverter = dc
+}
@@ -8,6 +8,7 @@ package redisstore
 // KEYS[2] = events zset key
 // KEYS[3] = workflow state key (JSON string)
 // ARGV[1] = event JSON string
+// ARGV[2] = pub/sub channel the stored event is published to (optional)
 //
 // Returns: sequence (number)
 const luaAppendEvent = `
@@ -29,6 +30,11 @@ if stjson then
   redis.call('SET', KEYS[3], cjson.encode(st))
 end
 
+-- notify watchers of the workflow
+if ARGV[2] then
+  redis.call('PUBLISH', ARGV[2], evjson)
+end
+
 return seq
 `
 
@@ -53,4 +59,50 @@ redis.call('ZREM', KEYS[2], ARGV[1])
 return 1
 `
 
+// luaAcquireLease takes or extends a lease if it is free or already held by
+// the owner. Expired leases are removed by Redis. Returns 1 if held, 0 otherwise.
+//
+// KEYS[1] = lease key
+// ARGV[1] = owner
+// ARGV[2] = ttl in milliseconds
+const luaAcquireLease = `
+local holder = redis.call('GET', KEYS[1])
+if holder and holder ~= ARGV[1] then
+  return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
+`
 
+// luaReleaseLease deletes a lease if it is held by the owner.
+//
+// KEYS[1] = lease key
+// ARGV[1] = owner
+const luaReleaseLease = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  redis.call('DEL', KEYS[1])
+end
+return 0
+`
+
+// luaTransitionActivityState replaces an activity state only if the stored
+// state has the expected status and attempt.
+//
+// KEYS[1] = activity state key (JSON string)
+// ARGV[1] = expected status
+// ARGV[2] = expected attempt
+// ARGV[3] = new activity state JSON
+//
+// Returns: 1 if replaced, 0 otherwise
+const luaTransitionActivityState = `
+local cur = redis.call('GET', KEYS[1])
+if not cur then
+  return 0
+end
+local st = cjson.decode(cur)
+if st['status'] ~= ARGV[1] or tonumber(st['attempt']) ~= tonumber(ARGV[2]) then
+  return 0
+end
+redis.call('SET', KEYS[1], ARGV[3])
+return 1
+`
@@ -0,0 +1,59 @@
+package redisstore
+
+import (
+	"testing"
+
+	"github.com/KamdynS/marathon/converter"
+	"github.com/KamdynS/marathon/state"
+)
+
+func TestWorkflowState_PayloadRoundTrip(t *testing.T) {
+	type result struct {
+		Answer int `json:"answer"`
+	}
+
+	for _, dc := range []converter.DataConverter{converter.JSONConverter{}, converter.MsgPackConverter{}} {
+		t.Run(dc.Encoding(), func(t *testing.T) {
+			s := &Store{dataConverter: dc}
+			in := &state.WorkflowState{WorkflowID: "wf-1", Status: state.StatusCompleted, Input: "q", Output: result{Answer: 42}}
+
+			b, err := s.marshalWorkflowState(in)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			if _, ok := in.Output.(result); !ok {
+				t.Fatalf("expected caller's state to be left untouched, got %#v", in.Output)
+			}
+			out, err := s.unmarshalWorkflowState(b)
+			if err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+
+			var got result
+			if err := converter.Assign(dc, out.Output, &got); err != nil || got.Answer != 42 {
+				t.Fatalf("expected answer 42, got %+v (%v)", got, err)
+			}
+			var input string
+			if err := converter.Assign(dc, out.Input, &input); err != nil || input != "q" {
+				t.Fatalf("expected input q, got %q (%v)", input, err)
+			}
+		})
+	}
+}
+
+func TestWorkflowState_PayloadShapedUserDataRoundTrip(t *testing.T) {
+	s := &Store{dataConverter: converter.JSONConverter{}}
+	// User data that looks like a payload but was never one
+	lookalike := map[string]interface{}{"encoding": "text/plain", "data": "aGk=", "metadata": map[string]interface{}{"k": "v"}}
+	b, err := s.marshalWorkflowState(&state.WorkflowState{WorkflowID: "wf-1", Status: state.StatusRunning, Input: lookalike})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	out, err := s.unmarshalWorkflowState(b)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if m, ok := out.Input.(map[string]interface{}); !ok || m["data"] != "aGk=" {
+		t.Fatalf("expected the user map back as is, got %#v", out.Input)
+	}
+}
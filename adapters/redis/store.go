@@ -3,24 +3,33 @@ package redisstore
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 
+	"github.com/KamdynS/marathon/converter"
 	"github.com/KamdynS/marathon/state"
 )
 
-// Ensure Store implements state.Store
-var _ state.Store = (*Store)(nil)
+// Ensure Store implements state.Store and state.EventWatcher
+var (
+	_ state.Store        = (*Store)(nil)
+	_ state.EventWatcher = (*Store)(nil)
+)
 
 // ---------- Key helpers ----------
 
 func (s *Store) wfStateKey(id string) string  { return fmt.Sprintf("%s:wf:%s:state", s.prefix, id) }
 func (s *Store) wfEventsKey(id string) string { return fmt.Sprintf("%s:wf:%s:events", s.prefix, id) }
 func (s *Store) wfSeqKey(id string) string    { return fmt.Sprintf("%s:wf:%s:seq", s.prefix, id) }
+func (s *Store) wfEventsChannel(id string) string {
+	return fmt.Sprintf("%s:wf:%s:events:pub", s.prefix, id)
+}
 func (s *Store) actStateKey(id string) string { return fmt.Sprintf("%s:act:%s:state", s.prefix, id) }
 func (s *Store) statusIdxKey(st state.WorkflowStatus) string {
 	return fmt.Sprintf("%s:idx:status:%s", s.prefix, string(st))
@@ -33,6 +42,9 @@ func (s *Store) timersDueKey() string        { return fmt.Sprintf("%s:timers:due
 func (s *Store) timerRecKey(workflowID, timerID string) string {
 	return fmt.Sprintf("%s:timer:%s:%s", s.prefix, workflowID, timerID)
 }
+func (s *Store) scheduleKey(id string) string { return fmt.Sprintf("%s:sched:%s", s.prefix, id) }
+func (s *Store) schedulesIdxKey() string      { return fmt.Sprintf("%s:idx:schedules", s.prefix) }
+func (s *Store) leaseKey(name string) string  { return fmt.Sprintf("%s:lease:%s", s.prefix, name) }
 
 // ---------- Workflow State ----------
 
@@ -51,7 +63,7 @@ func (s *Store) SaveWorkflowState(ctx context.Context, st *state.WorkflowState)
 		}
 	}
 
-	b, err := json.Marshal(st)
+	b, err := s.marshalWorkflowState(st)
 	if err != nil {
 		return fmt.Errorf("marshal workflow state: %w", err)
 	}
@@ -73,21 +85,21 @@ func (s *Store) GetWorkflowState(ctx context.Context, workflowID string) (*state
 	v, err := s.rdb.Get(ctx, s.wfStateKey(workflowID)).Bytes()
 	if err != nil {
 		if err == redis.Nil {
-			return nil, fmt.Errorf("workflow %s not found", workflowID)
+			return nil, fmt.Errorf("%w: %s", state.ErrWorkflowNotFound, workflowID)
 		}
 		return nil, fmt.Errorf("redis get workflow state: %w", err)
 	}
-	var st state.WorkflowState
-	if err := json.Unmarshal(v, &st); err != nil {
+	st, err := s.unmarshalWorkflowState(v)
+	if err != nil {
 		return nil, fmt.Errorf("unmarshal workflow state: %w", err)
 	}
-	return &st, nil
+	return st, nil
 }
 
 // ---------- Activity State ----------
 
 func (s *Store) SaveActivityState(ctx context.Context, st *state.ActivityState) error {
-	b, err := json.Marshal(st)
+	b, err := s.marshalActivityState(st)
 	if err != nil {
 		return fmt.Errorf("marshal activity state: %w", err)
 	}
@@ -97,6 +109,18 @@ func (s *Store) SaveActivityState(ctx context.Context, st *state.ActivityState)
 	return nil
 }
 
+func (s *Store) TransitionActivityState(ctx context.Context, st *state.ActivityState, from state.WorkflowStatus) (bool, error) {
+	b, err := s.marshalActivityState(st)
+	if err != nil {
+		return false, fmt.Errorf("marshal activity state: %w", err)
+	}
+	n, err := s.rdb.Eval(ctx, luaTransitionActivityState, []string{s.actStateKey(st.ActivityID)}, string(from), st.Attempt, string(b)).Int()
+	if err != nil {
+		return false, fmt.Errorf("redis transition activity state: %w", err)
+	}
+	return n == 1, nil
+}
+
 func (s *Store) GetActivityState(ctx context.Context, activityID string) (*state.ActivityState, error) {
 	v, err := s.rdb.Get(ctx, s.actStateKey(activityID)).Bytes()
 	if err != nil {
@@ -105,11 +129,11 @@ func (s *Store) GetActivityState(ctx context.Context, activityID string) (*state
 		}
 		return nil, fmt.Errorf("redis get activity state: %w", err)
 	}
-	var st state.ActivityState
-	if err := json.Unmarshal(v, &st); err != nil {
+	st, err := s.unmarshalActivityState(v)
+	if err != nil {
 		return nil, fmt.Errorf("unmarshal activity state: %w", err)
 	}
-	return &st, nil
+	return st, nil
 }
 
 // ---------- Events ----------
@@ -121,7 +145,7 @@ func (s *Store) AppendEvent(ctx context.Context, e *state.Event) error {
 		return fmt.Errorf("marshal event: %w", err)
 	}
 	keys := []string{s.wfSeqKey(e.WorkflowID), s.wfEventsKey(e.WorkflowID), s.wfStateKey(e.WorkflowID)}
-	args := []interface{}{string(b)}
+	args := []interface{}{string(b), s.wfEventsChannel(e.WorkflowID)}
 
 	// Try EVALSHA first if we cached the SHA
 	if s.appendSHA != "" {
@@ -136,6 +160,44 @@ func (s *Store) AppendEvent(ctx context.Context, e *state.Event) error {
 	return nil
 }
 
+// WatchEvents implements state.EventWatcher using Redis pub/sub. Events are
+// published by the append script, so they carry their sequence number. Each
+// watch holds its own pub/sub connection until ctx is done.
+func (s *Store) WatchEvents(ctx context.Context, workflowID string) (<-chan *state.Event, error) {
+	sub := s.rdb.Subscribe(ctx, s.wfEventsChannel(workflowID))
+	// Wait for the subscription to be confirmed so no later append is missed
+	if _, err := sub.Receive(ctx); err != nil {
+		_ = sub.Close()
+		return nil, fmt.Errorf("redis subscribe events: %w", err)
+	}
+
+	out := make(chan *state.Event, 64)
+	go func() {
+		defer close(out)
+		defer sub.Close()
+		msgs := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+				ev, err := unmarshalEvent([]byte(msg.Payload))
+				if err != nil {
+					continue
+				}
+				select {
+				case out <- ev:
+				default:
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
 func (s *Store) GetEvents(ctx context.Context, workflowID string) ([]*state.Event, error) {
 	vals, err := s.rdb.ZRange(ctx, s.wfEventsKey(workflowID), 0, -1).Result()
 	if err != nil {
@@ -143,7 +205,7 @@ func (s *Store) GetEvents(ctx context.Context, workflowID string) ([]*state.Even
 	}
 	out := make([]*state.Event, 0, len(vals))
 	for _, v := range vals {
-		ev, uerr := state.FromJSON([]byte(v))
+		ev, uerr := unmarshalEvent([]byte(v))
 		if uerr != nil {
 			continue
 		}
@@ -165,7 +227,7 @@ func (s *Store) GetEventsSince(ctx context.Context, workflowID string, since int
 	}
 	out := make([]*state.Event, 0, len(vals))
 	for _, v := range vals {
-		ev, uerr := state.FromJSON([]byte(v))
+		ev, uerr := unmarshalEvent([]byte(v))
 		if uerr != nil {
 			continue
 		}
@@ -174,6 +236,88 @@ func (s *Store) GetEventsSince(ctx context.Context, workflowID string, since int
 	return out, nil
 }
 
+// ContinueAsNew closes the current run and creates its successor in a single
+// MULTI/EXEC transaction so readers never observe one without the other.
+// continueAsNewRetries bounds how often ContinueAsNew retries after a
+// concurrent write to the closed run (e.g. a signal) aborts its transaction
+const continueAsNewRetries = 5
+
+func (s *Store) ContinueAsNew(ctx context.Context, closed *state.WorkflowState, closedEvent *state.Event, next *state.WorkflowState, nextEvent *state.Event) error {
+	closedJSON, err := s.marshalWorkflowState(closed)
+	if err != nil {
+		return fmt.Errorf("marshal workflow state: %w", err)
+	}
+	nextJSON, err := s.marshalWorkflowState(next)
+	if err != nil {
+		return fmt.Errorf("marshal workflow state: %w", err)
+	}
+	closedEventJSON, err := json.Marshal(closedEvent)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+	nextEventJSON, err := json.Marshal(nextEvent)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+
+	closedKey := s.wfStateKey(closed.WorkflowID)
+	nextKey := s.wfStateKey(next.WorkflowID)
+	// WATCH both run states so the checks below and the writes commit
+	// together; a concurrent continue-as-new aborts the EXEC and is caught by
+	// the checks on retry
+	txf := func(tx *redis.Tx) error {
+		exists, err := tx.Exists(ctx, nextKey).Result()
+		if err != nil {
+			return fmt.Errorf("redis exists workflow state: %w", err)
+		}
+		if exists > 0 {
+			return fmt.Errorf("workflow %s already exists", next.WorkflowID)
+		}
+		if v, err := tx.Get(ctx, closedKey).Bytes(); err == nil {
+			current, err := s.unmarshalWorkflowState(v)
+			if err != nil {
+				return fmt.Errorf("unmarshal workflow state: %w", err)
+			}
+			if current.Status == state.StatusContinuedAsNew {
+				return fmt.Errorf("workflow %s already continued as new", closed.WorkflowID)
+			}
+		} else if err != redis.Nil {
+			return fmt.Errorf("redis get workflow state: %w", err)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, closedKey, closedJSON, 0)
+			for _, st := range []state.WorkflowStatus{state.StatusPending, state.StatusRunning} {
+				if st != closed.Status {
+					pipe.SRem(ctx, s.statusIdxKey(st), closed.WorkflowID)
+				}
+			}
+			pipe.SAdd(ctx, s.statusIdxKey(closed.Status), closed.WorkflowID)
+			pipe.Set(ctx, nextKey, nextJSON, 0)
+			pipe.SAdd(ctx, s.statusIdxKey(next.Status), next.WorkflowID)
+			pipe.Eval(ctx, luaAppendEvent,
+				[]string{s.wfSeqKey(closed.WorkflowID), s.wfEventsKey(closed.WorkflowID), closedKey},
+				string(closedEventJSON), s.wfEventsChannel(closed.WorkflowID))
+			pipe.Eval(ctx, luaAppendEvent,
+				[]string{s.wfSeqKey(next.WorkflowID), s.wfEventsKey(next.WorkflowID), nextKey},
+				string(nextEventJSON), s.wfEventsChannel(next.WorkflowID))
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("redis tx continue as new: %w", err)
+		}
+		return nil
+	}
+
+	for i := 0; i < continueAsNewRetries; i++ {
+		err = s.rdb.Watch(ctx, txf, closedKey, nextKey)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return fmt.Errorf("workflow %s modified concurrently during continue as new", closed.WorkflowID)
+}
+
 // ---------- Listing / Deletion ----------
 
 func (s *Store) ListWorkflows(ctx context.Context, st state.WorkflowStatus) ([]*state.WorkflowState, error) {
@@ -181,6 +325,7 @@ func (s *Store) ListWorkflows(ctx context.Context, st state.WorkflowStatus) ([]*
 		// No global index of all workflows; best-effort: collect from all known status sets
 		statuses := []state.WorkflowStatus{
 			state.StatusPending, state.StatusRunning, state.StatusCompleted, state.StatusFailed, state.StatusCanceled,
+			state.StatusTimedOut, state.StatusContinuedAsNew,
 		}
 		idSet := make(map[string]struct{})
 		for _, status := range statuses {
@@ -227,11 +372,11 @@ func (s *Store) mgetWorkflowStates(ctx context.Context, ids []string) ([]*state.
 		if err != nil {
 			continue
 		}
-		var st state.WorkflowState
-		if uerr := json.Unmarshal(v, &st); uerr != nil {
+		st, uerr := s.unmarshalWorkflowState(v)
+		if uerr != nil {
 			continue
 		}
-		out = append(out, &st)
+		out = append(out, st)
 	}
 	return out, nil
 }
@@ -367,3 +512,165 @@ func (s *Store) MarkTimerFired(ctx context.Context, workflowID string, timerID s
 	}
 	return res == 1, nil
 }
+
+// ---------- Leases ----------
+
+func (s *Store) AcquireLease(ctx context.Context, name string, owner string, ttl time.Duration) (bool, error) {
+	res, err := s.rdb.Eval(ctx, luaAcquireLease, []string{s.leaseKey(name)}, owner, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("redis eval acquire lease: %w", err)
+	}
+	return res == 1, nil
+}
+
+func (s *Store) ReleaseLease(ctx context.Context, name string, owner string) error {
+	if err := s.rdb.Eval(ctx, luaReleaseLease, []string{s.leaseKey(name)}, owner).Err(); err != nil {
+		return fmt.Errorf("redis eval release lease: %w", err)
+	}
+	return nil
+}
+
+// ---------- Schedules ----------
+
+func (s *Store) SaveSchedule(ctx context.Context, sched *state.ScheduleState) error {
+	b, err := s.marshalSchedule(sched)
+	if err != nil {
+		return fmt.Errorf("marshal schedule: %w", err)
+	}
+	pipe := s.rdb.TxPipeline()
+	pipe.Set(ctx, s.scheduleKey(sched.ScheduleID), b, 0)
+	pipe.SAdd(ctx, s.schedulesIdxKey(), sched.ScheduleID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis pipeline save schedule: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) GetSchedule(ctx context.Context, scheduleID string) (*state.ScheduleState, error) {
+	v, err := s.rdb.Get(ctx, s.scheduleKey(scheduleID)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, fmt.Errorf("schedule %s not found", scheduleID)
+		}
+		return nil, fmt.Errorf("redis get schedule: %w", err)
+	}
+	sched, err := s.unmarshalSchedule(v)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal schedule: %w", err)
+	}
+	return sched, nil
+}
+
+func (s *Store) ListSchedules(ctx context.Context) ([]*state.ScheduleState, error) {
+	ids, err := s.rdb.SMembers(ctx, s.schedulesIdxKey()).Result()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("redis smembers schedules: %w", err)
+	}
+	sort.Strings(ids)
+	out := make([]*state.ScheduleState, 0, len(ids))
+	for _, id := range ids {
+		sched, err := s.GetSchedule(ctx, id)
+		if err != nil {
+			continue
+		}
+		out = append(out, sched)
+	}
+	return out, nil
+}
+
+func (s *Store) DeleteSchedule(ctx context.Context, scheduleID string) error {
+	pipe := s.rdb.TxPipeline()
+	del := pipe.Del(ctx, s.scheduleKey(scheduleID))
+	pipe.SRem(ctx, s.schedulesIdxKey(), scheduleID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis pipeline delete schedule: %w", err)
+	}
+	if del.Val() == 0 {
+		return fmt.Errorf("schedule %s not found", scheduleID)
+	}
+	return nil
+}
+
+// ---------- Payloads ----------
+
+// marshalWorkflowState serializes a workflow state with its input and output
+// normalized by the store's DataConverter.
+func (s *Store) marshalWorkflowState(st *state.WorkflowState) ([]byte, error) {
+	cp := *st
+	var err error
+	if cp.Input, err = converter.Normalize(s.dataConverter, st.Input); err != nil {
+		return nil, fmt.Errorf("encode input: %w", err)
+	}
+	if cp.Output, err = converter.Normalize(s.dataConverter, st.Output); err != nil {
+		return nil, fmt.Errorf("encode output: %w", err)
+	}
+	return json.Marshal(&cp)
+}
+
+func (s *Store) unmarshalWorkflowState(b []byte) (*state.WorkflowState, error) {
+	var st state.WorkflowState
+	if err := json.Unmarshal(b, &st); err != nil {
+		return nil, err
+	}
+	st.Input = converter.Restore(st.Input)
+	st.Output = converter.Restore(st.Output)
+	return &st, nil
+}
+
+// marshalActivityState serializes an activity state with its input and output
+// normalized by the store's DataConverter.
+func (s *Store) marshalActivityState(st *state.ActivityState) ([]byte, error) {
+	cp := *st
+	var err error
+	if cp.Input, err = converter.Normalize(s.dataConverter, st.Input); err != nil {
+		return nil, fmt.Errorf("encode input: %w", err)
+	}
+	if cp.Output, err = converter.Normalize(s.dataConverter, st.Output); err != nil {
+		return nil, fmt.Errorf("encode output: %w", err)
+	}
+	if cp.HeartbeatDetails, err = converter.Normalize(s.dataConverter, st.HeartbeatDetails); err != nil {
+		return nil, fmt.Errorf("encode heartbeat details: %w", err)
+	}
+	return json.Marshal(&cp)
+}
+
+func (s *Store) unmarshalActivityState(b []byte) (*state.ActivityState, error) {
+	var st state.ActivityState
+	if err := json.Unmarshal(b, &st); err != nil {
+		return nil, err
+	}
+	st.Input = converter.Restore(st.Input)
+	st.Output = converter.Restore(st.Output)
+	st.HeartbeatDetails = converter.Restore(st.HeartbeatDetails)
+	return &st, nil
+}
+
+// marshalSchedule serializes a schedule with its input normalized by the
+// store's DataConverter.
+func (s *Store) marshalSchedule(sched *state.ScheduleState) ([]byte, error) {
+	cp := *sched
+	var err error
+	if cp.Input, err = converter.Normalize(s.dataConverter, sched.Input); err != nil {
+		return nil, fmt.Errorf("encode input: %w", err)
+	}
+	return json.Marshal(&cp)
+}
+
+func (s *Store) unmarshalSchedule(b []byte) (*state.ScheduleState, error) {
+	var sched state.ScheduleState
+	if err := json.Unmarshal(b, &sched); err != nil {
+		return nil, err
+	}
+	sched.Input = converter.Restore(sched.Input)
+	return &sched, nil
+}
+
+// unmarshalEvent decodes an event, restoring non-JSON payloads in its data
+func unmarshalEvent(b []byte) (*state.Event, error) {
+	ev, err := state.FromJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	converter.RestoreMap(ev.Data)
+	return ev, nil
+}
@@ -195,6 +195,70 @@ func TestGetEventsSince(t *testing.T) {
 	}
 }
 
+func TestWatchEvents(t *testing.T) {
+	s := newTestStore(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wfID := "wf-watch"
+
+	events, err := s.WatchEvents(ctx, wfID)
+	if err != nil {
+		t.Fatalf("WatchEvents: %v", err)
+	}
+	if err := s.AppendEvent(ctx, state.NewEvent(wfID, state.EventTimerFired, map[string]interface{}{"timer_id": "t1"})); err != nil {
+		t.Fatalf("AppendEvent: %v", err)
+	}
+	select {
+	case e := <-events:
+		if e.Type != state.EventTimerFired || e.SequenceNum != 1 || e.Data["timer_id"] != "t1" {
+			t.Fatalf("unexpected event %+v", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected watched event")
+	}
+
+	cancel()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatal("expected no further events")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected channel to close")
+	}
+}
+
+func TestLeases(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	if ok, err := s.AcquireLease(ctx, "workflow/wf-1", "a", time.Second); err != nil || !ok {
+		t.Fatalf("AcquireLease a: %v %v", ok, err)
+	}
+	if ok, _ := s.AcquireLease(ctx, "workflow/wf-1", "b", time.Second); ok {
+		t.Fatal("expected lease held by a")
+	}
+	if ok, _ := s.AcquireLease(ctx, "workflow/wf-1", "a", time.Second); !ok {
+		t.Fatal("expected owner to renew its lease")
+	}
+	// Releasing as another owner is a no-op
+	if err := s.ReleaseLease(ctx, "workflow/wf-1", "b"); err != nil {
+		t.Fatalf("ReleaseLease b: %v", err)
+	}
+	if ok, _ := s.AcquireLease(ctx, "workflow/wf-1", "b", time.Second); ok {
+		t.Fatal("expected lease still held by a")
+	}
+	if err := s.ReleaseLease(ctx, "workflow/wf-1", "a"); err != nil {
+		t.Fatalf("ReleaseLease a: %v", err)
+	}
+	if ok, _ := s.AcquireLease(ctx, "workflow/wf-1", "b", 50*time.Millisecond); !ok {
+		t.Fatal("expected released lease to be acquirable")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if ok, _ := s.AcquireLease(ctx, "workflow/wf-1", "a", time.Second); !ok {
+		t.Fatal("expected expired lease to be acquirable")
+	}
+}
+
 func TestIdempotencyHelpers(t *testing.T) {
 	s := newTestStore(t)
 	ctx := context.Background()
@@ -268,4 +332,69 @@ func TestTimersFlow(t *testing.T) {
 	}
 }
 
+func TestSchedulesRoundTrip(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	next := time.Now().UTC().Truncate(time.Minute).Add(time.Minute)
+	for _, id := range []string{"b", "a"} {
+		sched := &state.ScheduleState{ScheduleID: id, WorkflowName: "w", Input: map[string]interface{}{"k": "v"}, Cron: "* * * * *", NextRunAt: next}
+		if err := s.SaveSchedule(ctx, sched); err != nil {
+			t.Fatalf("SaveSchedule: %v", err)
+		}
+	}
+	got, err := s.GetSchedule(ctx, "a")
+	if err != nil || !got.NextRunAt.Equal(next) || got.Input.(map[string]interface{})["k"] != "v" {
+		t.Fatalf("GetSchedule: %+v %v", got, err)
+	}
+	list, err := s.ListSchedules(ctx)
+	if err != nil || len(list) != 2 || list[0].ScheduleID != "a" {
+		t.Fatalf("ListSchedules: %+v %v", list, err)
+	}
+	if err := s.DeleteSchedule(ctx, "a"); err != nil {
+		t.Fatalf("DeleteSchedule: %v", err)
+	}
+	if _, err := s.GetSchedule(ctx, "a"); err == nil {
+		t.Fatal("expected error for deleted schedule")
+	}
+}
+
+func TestContinueAsNewConcurrent(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	closedID := "wf-can"
+	if err := s.SaveWorkflowState(ctx, &state.WorkflowState{WorkflowID: closedID, WorkflowName: "w", Status: state.StatusRunning}); err != nil {
+		t.Fatalf("SaveWorkflowState: %v", err)
+	}
 
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			nextID := closedID + "-next-" + strconv.Itoa(i)
+			closed := &state.WorkflowState{WorkflowID: closedID, WorkflowName: "w", Status: state.StatusContinuedAsNew, ContinuedAsNewRunID: nextID}
+			next := &state.WorkflowState{WorkflowID: nextID, WorkflowName: "w", Status: state.StatusPending}
+			errs[i] = s.ContinueAsNew(ctx, closed,
+				&state.Event{WorkflowID: closedID, Type: state.EventWorkflowContinuedAsNew},
+				next,
+				&state.Event{WorkflowID: nextID, Type: state.EventWorkflowStarted})
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("expected exactly one continue-as-new to succeed, got %d: %v", succeeded, errs)
+	}
+	events, err := s.GetEvents(ctx, closedID)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("expected one event on the closed run, got %d %v", len(events), err)
+	}
+}
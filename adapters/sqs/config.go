@@ -3,6 +3,8 @@
 
 package sqsqueue
 
+import "github.com/KamdynS/marathon/converter"
+
 // Config controls the SQS adapter behavior.
 type Config struct {
 	// Required: fully qualified SQS queue URL
@@ -31,6 +33,9 @@ type Config struct {
 
 	// If true and Nack with requeue=false, drop the message (DeleteMessage) instead of exposing it.
 	DropOnNackNoRequeue bool
+
+	// DataConverter encodes task inputs in message bodies; defaults to JSON.
+	DataConverter converter.DataConverter
 }
 
 // DefaultConfig provides sensible defaults.
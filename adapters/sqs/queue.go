@@ -16,12 +16,22 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
 
+	"github.com/KamdynS/marathon/converter"
 	"github.com/KamdynS/marathon/queue"
 )
 
+// sqsAPI is the part of the SQS client the adapter uses
+type sqsAPI interface {
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+	ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error)
+	GetQueueAttributes(ctx context.Context, params *sqs.GetQueueAttributesInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error)
+}
+
 // Queue implements queue.Queue backed by AWS SQS.
 type Queue struct {
-	client  *sqs.Client
+	client  sqsAPI
 	cfg     Config
 	mu      sync.Mutex
 	handles map[string]string // taskID -> receiptHandle
@@ -58,6 +68,14 @@ func New(ctx context.Context, cfg Config) (*Queue, error) {
 
 // NewFromClient constructs the adapter from an existing SQS client.
 func NewFromClient(client *sqs.Client, cfg Config) *Queue {
+	return newQueue(client, cfg)
+}
+
+// newQueue constructs the adapter from any implementation of the SQS API
+func newQueue(client sqsAPI, cfg Config) *Queue {
+	if cfg.DataConverter == nil {
+		cfg.DataConverter = converter.Default()
+	}
 	return &Queue{
 		client:  client,
 		cfg:     cfg,
@@ -65,12 +83,42 @@ func NewFromClient(client *sqs.Client, cfg Config) *Queue {
 	}
 }
 
+// maxDelay is the longest delay SQS applies to a message on send
+const maxDelay = 15 * time.Minute
+
+// maxVisibilityTimeout is the longest SQS hides a received message
+const maxVisibilityTimeout = 12 * time.Hour
+
+// visibleAtAttribute carries the time, in Unix milliseconds, a task becomes
+// visible when SQS cannot delay the message for the whole time: delays beyond
+// maxDelay, and any delay on FIFO queues
+const visibleAtAttribute = "VisibleAt"
+
 // Enqueue sends a task to SQS. queueName is ignored; QueueURL controls the destination.
 func (q *Queue) Enqueue(ctx context.Context, _ string, t *queue.Task) error {
-	body, err := json.Marshal(t)
+	return q.EnqueueAt(ctx, "", t, time.Time{})
+}
+
+// EnqueueAt sends a task that becomes visible at visibleAt. Standard queues
+// delay the message with DelaySeconds; tasks received before visibleAt, after
+// delays beyond SQS's 15-minute limit or on FIFO queues, which only support
+// queue-level delays, are delayed again until they are due.
+func (q *Queue) EnqueueAt(ctx context.Context, _ string, t *queue.Task, visibleAt time.Time) error {
+	// Normalize the input on a copy so the caller's task is left untouched
+	msg := *t
+	var err error
+	if msg.Input, err = converter.Normalize(q.cfg.DataConverter, t.Input); err != nil {
+		return fmt.Errorf("encode task input: %w", err)
+	}
+	body, err := json.Marshal(&msg)
 	if err != nil {
 		return fmt.Errorf("marshal task: %w", err)
 	}
+	return q.send(ctx, string(body), t, visibleAt)
+}
+
+// send sends a task's message body, delayed until visibleAt if it is set
+func (q *Queue) send(ctx context.Context, body string, t *queue.Task, visibleAt time.Time) error {
 	msgAttributes := map[string]sqstypes.MessageAttributeValue{
 		"ActivityName": {
 			DataType:    aws.String("String"),
@@ -87,9 +135,20 @@ func (q *Queue) Enqueue(ctx context.Context, _ string, t *queue.Task) error {
 	}
 	input := &sqs.SendMessageInput{
 		QueueUrl:          aws.String(q.cfg.QueueURL),
-		MessageBody:       aws.String(string(body)),
+		MessageBody:       aws.String(body),
 		MessageAttributes: msgAttributes,
 	}
+	if delay := time.Until(visibleAt); delay > 0 {
+		if !q.cfg.FIFO {
+			input.DelaySeconds = int32(ceilSeconds(min(delay, maxDelay)))
+		}
+		if q.cfg.FIFO || delay > maxDelay {
+			msgAttributes[visibleAtAttribute] = sqstypes.MessageAttributeValue{
+				DataType:    aws.String("Number"),
+				StringValue: aws.String(strconv.FormatInt(visibleAt.UnixMilli(), 10)),
+			}
+		}
+	}
 	if q.cfg.FIFO {
 		groupID := q.cfg.MessageGroupID
 		if groupID == "" {
@@ -99,7 +158,7 @@ func (q *Queue) Enqueue(ctx context.Context, _ string, t *queue.Task) error {
 		// Deduplication window is 5 minutes for FIFO standard dedup
 		input.MessageDeduplicationId = aws.String(t.ID)
 	}
-	_, err = q.client.SendMessage(ctx, input)
+	_, err := q.client.SendMessage(ctx, input)
 	if err != nil {
 		return fmt.Errorf("sqs SendMessage: %w", err)
 	}
@@ -148,11 +207,11 @@ func (q *Queue) DequeueWithTimeout(ctx context.Context, _ string, timeout time.D
 		},
 		MessageAttributeNames: []string{"All"},
 		MaxNumberOfMessages:   int32(maxMsgs),
-		WaitTimeSeconds:       int32Ptr(int32(waitSec)),
+		WaitTimeSeconds:       int32(waitSec),
 	}
 	// Apply visibility timeout if configured
 	if vis > 0 {
-		input.VisibilityTimeout = int32Ptr(int32(vis))
+		input.VisibilityTimeout = int32(vis)
 	}
 	out, err := q.client.ReceiveMessage(ctx, input)
 	if err != nil {
@@ -170,6 +229,14 @@ func (q *Queue) DequeueWithTimeout(ctx context.Context, _ string, timeout time.D
 	if err := json.Unmarshal([]byte(*msg.Body), &t); err != nil {
 		return nil, fmt.Errorf("unmarshal task body: %w", err)
 	}
+	if visibleAt, ok := messageVisibleAt(msg); ok && time.Until(visibleAt) > 0 {
+		// Received early: delay the task again and report no task
+		if err := q.delayAgain(ctx, msg, &t, visibleAt); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	t.Input = converter.Restore(t.Input)
 	// Derive attempts from system attribute if present
 	attempts := 0
 	if msg.Attributes != nil {
@@ -291,6 +358,53 @@ func (q *Queue) lookupHandle(taskID string) (string, bool) {
 	return h, ok
 }
 
-func int32Ptr(v int32) *int32 { return &v }
+// delayAgain hides a task received before it is due until visibleAt, or as
+// long as SQS allows
+func (q *Queue) delayAgain(ctx context.Context, msg sqstypes.Message, t *queue.Task, visibleAt time.Time) error {
+	if msg.ReceiptHandle == nil {
+		return nil
+	}
+	if q.cfg.FIFO {
+		// Sending the task again would be dropped as a duplicate within
+		// the deduplication window, so hide the received message instead
+		_, err := q.client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+			QueueUrl:          aws.String(q.cfg.QueueURL),
+			ReceiptHandle:     msg.ReceiptHandle,
+			VisibilityTimeout: int32(ceilSeconds(min(time.Until(visibleAt), maxVisibilityTimeout))),
+		})
+		if err != nil {
+			return fmt.Errorf("sqs ChangeMessageVisibility: %w", err)
+		}
+		return nil
+	}
+	// Send a new delayed message so the receive count is not inflated
+	if err := q.send(ctx, *msg.Body, t, visibleAt); err != nil {
+		return err
+	}
+	_, err := q.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(q.cfg.QueueURL),
+		ReceiptHandle: msg.ReceiptHandle,
+	})
+	if err != nil {
+		return fmt.Errorf("sqs DeleteMessage: %w", err)
+	}
+	return nil
+}
 
+// messageVisibleAt returns the visible time a message was sent with, if any
+func messageVisibleAt(msg sqstypes.Message) (time.Time, bool) {
+	attr, ok := msg.MessageAttributes[visibleAtAttribute]
+	if !ok || attr.StringValue == nil {
+		return time.Time{}, false
+	}
+	ms, err := strconv.ParseInt(*attr.StringValue, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(ms), true
+}
 
+// ceilSeconds converts a duration to whole seconds, rounding up
+func ceilSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,219 @@
+//go:build adapters_sqs
+// +build adapters_sqs
+
+package sqsqueue
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+
+	"github.com/KamdynS/marathon/queue"
+)
+
+// fakeSQS records the requests the adapter makes and hands out the messages
+// queued in received
+type fakeSQS struct {
+	mu         sync.Mutex
+	sent       []*sqs.SendMessageInput
+	received   []sqstypes.Message
+	receives   []*sqs.ReceiveMessageInput
+	deleted    []string
+	visibility []*sqs.ChangeMessageVisibilityInput
+}
+
+func (f *fakeSQS) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, params)
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func (f *fakeSQS) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.receives = append(f.receives, params)
+	if len(f.received) == 0 {
+		return &sqs.ReceiveMessageOutput{}, nil
+	}
+	msg := f.received[0]
+	f.received = f.received[1:]
+	return &sqs.ReceiveMessageOutput{Messages: []sqstypes.Message{msg}}, nil
+}
+
+func (f *fakeSQS) DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deleted = append(f.deleted, aws.ToString(params.ReceiptHandle))
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (f *fakeSQS) ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.visibility = append(f.visibility, params)
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func (f *fakeSQS) GetQueueAttributes(ctx context.Context, params *sqs.GetQueueAttributesInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error) {
+	return &sqs.GetQueueAttributesOutput{}, nil
+}
+
+// receive queues the last sent message for delivery, as SQS would
+func (f *fakeSQS) receive(handle string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	in := f.sent[len(f.sent)-1]
+	f.received = append(f.received, sqstypes.Message{
+		Body:              in.MessageBody,
+		MessageAttributes: in.MessageAttributes,
+		ReceiptHandle:     aws.String(handle),
+	})
+}
+
+func newFakeQueue(fifo bool) (*Queue, *fakeSQS) {
+	fake := &fakeSQS{}
+	cfg := DefaultConfig()
+	cfg.QueueURL = "https://sqs.example/queue"
+	cfg.FIFO = fifo
+	return newQueue(fake, cfg), fake
+}
+
+// sentVisibleAt returns the VisibleAt attribute of a sent message, if any
+func sentVisibleAt(t *testing.T, in *sqs.SendMessageInput) (time.Time, bool) {
+	t.Helper()
+	attr, ok := in.MessageAttributes[visibleAtAttribute]
+	if !ok {
+		return time.Time{}, false
+	}
+	ms, err := strconv.ParseInt(aws.ToString(attr.StringValue), 10, 64)
+	if err != nil {
+		t.Fatalf("bad %s attribute: %v", visibleAtAttribute, err)
+	}
+	return time.UnixMilli(ms), true
+}
+
+func TestEnqueueAt_DelaySeconds(t *testing.T) {
+	cases := []struct {
+		name          string
+		fifo          bool
+		delay         time.Duration
+		wantDelay     int32
+		wantVisibleAt bool
+	}{
+		{name: "immediate", delay: 0, wantDelay: 0},
+		{name: "within_limit", delay: 90 * time.Second, wantDelay: 90},
+		{name: "beyond_limit", delay: time.Hour, wantDelay: 900, wantVisibleAt: true},
+		{name: "fifo", fifo: true, delay: 90 * time.Second, wantDelay: 0, wantVisibleAt: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q, fake := newFakeQueue(tc.fifo)
+			task := queue.NewTask(queue.TaskTypeActivity, "wf-delay", "in")
+			var visibleAt time.Time
+			if tc.delay > 0 {
+				visibleAt = time.Now().Add(tc.delay)
+			}
+			if err := q.EnqueueAt(context.Background(), "ignored", task, visibleAt); err != nil {
+				t.Fatalf("EnqueueAt: %v", err)
+			}
+			in := fake.sent[0]
+			if in.DelaySeconds != tc.wantDelay {
+				t.Fatalf("expected DelaySeconds %d, got %d", tc.wantDelay, in.DelaySeconds)
+			}
+			got, ok := sentVisibleAt(t, in)
+			if ok != tc.wantVisibleAt {
+				t.Fatalf("expected %s attribute %v, got %v", visibleAtAttribute, tc.wantVisibleAt, ok)
+			}
+			if ok && !got.Equal(time.UnixMilli(visibleAt.UnixMilli())) {
+				t.Fatalf("expected visible at %s, got %s", visibleAt, got)
+			}
+		})
+	}
+}
+
+func TestDequeue_RedelaysEarlyTask(t *testing.T) {
+	ctx := context.Background()
+	q, fake := newFakeQueue(false)
+	task := queue.NewTask(queue.TaskTypeActivity, "wf-redelay", "in")
+	visibleAt := time.Now().Add(40 * time.Minute)
+	if err := q.EnqueueAt(ctx, "ignored", task, visibleAt); err != nil {
+		t.Fatalf("EnqueueAt: %v", err)
+	}
+
+	// Delivered after the first 15 minutes: delayed again, not handed out
+	fake.receive("handle-1")
+	got, err := q.DequeueWithTimeout(ctx, "ignored", time.Second)
+	if err != nil || got != nil {
+		t.Fatalf("expected no task before it is due, got %+v (%v)", got, err)
+	}
+	if len(fake.deleted) != 1 || fake.deleted[0] != "handle-1" {
+		t.Fatalf("expected the early message to be deleted, got %v", fake.deleted)
+	}
+	if len(fake.sent) != 2 {
+		t.Fatalf("expected the task to be sent again, got %d sends", len(fake.sent))
+	}
+	again := fake.sent[1]
+	if again.DelaySeconds != 900 {
+		t.Fatalf("expected the re-delay to use the 15 minute maximum, got %d", again.DelaySeconds)
+	}
+	if at, ok := sentVisibleAt(t, again); !ok || !at.Equal(time.UnixMilli(visibleAt.UnixMilli())) {
+		t.Fatalf("expected the re-delay to keep visible at %s, got %s (%v)", visibleAt, at, ok)
+	}
+	if aws.ToString(again.MessageBody) != aws.ToString(fake.sent[0].MessageBody) {
+		t.Fatal("expected the re-delayed message to carry the same task")
+	}
+	if in := fake.receives[0]; in.WaitTimeSeconds != 1 || in.VisibilityTimeout != 30 {
+		t.Fatalf("expected a 1s wait and 30s visibility, got %d and %d", in.WaitTimeSeconds, in.VisibilityTimeout)
+	}
+
+	// Delivered once due: handed out
+	fake.mu.Lock()
+	fake.received = append(fake.received, sqstypes.Message{
+		Body: again.MessageBody,
+		MessageAttributes: map[string]sqstypes.MessageAttributeValue{
+			visibleAtAttribute: {
+				DataType:    aws.String("Number"),
+				StringValue: aws.String(strconv.FormatInt(time.Now().Add(-time.Second).UnixMilli(), 10)),
+			},
+		},
+		ReceiptHandle: aws.String("handle-2"),
+	})
+	fake.mu.Unlock()
+	got, err = q.DequeueWithTimeout(ctx, "ignored", time.Second)
+	if err != nil || got == nil || got.ID != task.ID {
+		t.Fatalf("expected the due task, got %+v (%v)", got, err)
+	}
+}
+
+func TestDequeue_RedelaysEarlyFIFOTask(t *testing.T) {
+	ctx := context.Background()
+	q, fake := newFakeQueue(true)
+	task := queue.NewTask(queue.TaskTypeActivity, "wf-fifo", "in")
+	if err := q.EnqueueAt(ctx, "ignored", task, time.Now().Add(40*time.Minute)); err != nil {
+		t.Fatalf("EnqueueAt: %v", err)
+	}
+
+	fake.receive("handle-1")
+	got, err := q.DequeueWithTimeout(ctx, "ignored", time.Second)
+	if err != nil || got != nil {
+		t.Fatalf("expected no task before it is due, got %+v (%v)", got, err)
+	}
+	// A FIFO message is hidden rather than sent again, which the
+	// deduplication window would drop
+	if len(fake.sent) != 1 || len(fake.deleted) != 0 {
+		t.Fatalf("expected no resend, got %d sends and %d deletes", len(fake.sent), len(fake.deleted))
+	}
+	if len(fake.visibility) != 1 {
+		t.Fatalf("expected the message to be hidden, got %d visibility changes", len(fake.visibility))
+	}
+	if vis := fake.visibility[0].VisibilityTimeout; vis < 39*60 || vis > 40*60 {
+		t.Fatalf("expected the message hidden for about 40 minutes, got %ds", vis)
+	}
+}
@@ -0,0 +1,128 @@
+package converter
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+)
+
+// PayloadCodec transforms encoded payloads, for example to compress or
+// encrypt them before they are written to a store or queue. Encode wraps a
+// payload in a new one tagged with the codec's encoding; Decode reverses it.
+type PayloadCodec interface {
+	// Encoding identifies the payloads produced by this codec
+	Encoding() string
+
+	// Encode wraps a payload
+	Encode(payload *Payload) (*Payload, error)
+
+	// Decode unwraps a payload produced by Encode
+	Decode(payload *Payload) (*Payload, error)
+}
+
+// CodecConverter is a DataConverter that runs payloads produced by an
+// underlying converter through a chain of codecs. Codecs are applied in
+// order when encoding and in reverse when decoding, so
+//
+//	NewCodecConverter(Default(), &GzipCodec{}, encryption)
+//
+// compresses and then encrypts. Payloads a codec did not produce (such as
+// values recorded before the codec was introduced) pass through it untouched.
+type CodecConverter struct {
+	parent DataConverter
+	codecs []PayloadCodec
+}
+
+// NewCodecConverter wraps parent with the given codecs
+func NewCodecConverter(parent DataConverter, codecs ...PayloadCodec) *CodecConverter {
+	return &CodecConverter{parent: orDefault(parent), codecs: codecs}
+}
+
+// Encoding implements DataConverter and reports the outermost encoding
+func (c *CodecConverter) Encoding() string {
+	if len(c.codecs) == 0 {
+		return c.parent.Encoding()
+	}
+	return c.codecs[len(c.codecs)-1].Encoding()
+}
+
+// ToPayload implements DataConverter
+func (c *CodecConverter) ToPayload(value interface{}) (*Payload, error) {
+	p, err := c.parent.ToPayload(value)
+	if err != nil {
+		return nil, err
+	}
+	for _, codec := range c.codecs {
+		if p, err = codec.Encode(p); err != nil {
+			return nil, fmt.Errorf("%s codec: %w", codec.Encoding(), err)
+		}
+	}
+	return p, nil
+}
+
+// FromPayload implements DataConverter
+func (c *CodecConverter) FromPayload(payload *Payload, valuePtr interface{}) error {
+	p, err := c.DecodePayload(payload)
+	if err != nil {
+		return err
+	}
+	return c.parent.FromPayload(p, valuePtr)
+}
+
+// DecodePayload runs a payload back through the codec chain, returning the
+// payload produced by the underlying converter.
+func (c *CodecConverter) DecodePayload(payload *Payload) (*Payload, error) {
+	p := payload
+	for i := len(c.codecs) - 1; i >= 0; i-- {
+		codec := c.codecs[i]
+		if p.Encoding != codec.Encoding() {
+			continue
+		}
+		var err error
+		if p, err = codec.Decode(p); err != nil {
+			return nil, fmt.Errorf("%s codec: %w", codec.Encoding(), err)
+		}
+	}
+	return p, nil
+}
+
+// marshalEnvelope serializes a payload, including its encoding and metadata,
+// so a codec can wrap it as opaque bytes.
+func marshalEnvelope(p *Payload) ([]byte, error) {
+	meta, err := json.Marshal(p.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 0, 2*binary.MaxVarintLen64+len(p.Encoding)+len(meta)+len(p.Data))
+	buf = binary.AppendUvarint(buf, uint64(len(p.Encoding)))
+	buf = append(buf, p.Encoding...)
+	buf = binary.AppendUvarint(buf, uint64(len(meta)))
+	buf = append(buf, meta...)
+	return append(buf, p.Data...), nil
+}
+
+// unmarshalEnvelope reverses marshalEnvelope
+func unmarshalEnvelope(b []byte) (*Payload, error) {
+	enc, b, err := readChunk(b)
+	if err != nil {
+		return nil, err
+	}
+	meta, b, err := readChunk(b)
+	if err != nil {
+		return nil, err
+	}
+	p := &Payload{Encoding: string(enc), Data: b}
+	if err := json.Unmarshal(meta, &p.Metadata); err != nil {
+		return nil, fmt.Errorf("malformed payload envelope: %w", err)
+	}
+	return p, nil
+}
+
+func readChunk(b []byte) ([]byte, []byte, error) {
+	n, read := binary.Uvarint(b)
+	if read <= 0 || uint64(len(b)-read) < n {
+		return nil, nil, fmt.Errorf("malformed payload envelope")
+	}
+	b = b[read:]
+	return b[:n], b[n:], nil
+}
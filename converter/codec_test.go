@@ -0,0 +1,106 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func TestEncryptionCodec_RoundTripAndRotation(t *testing.T) {
+	v1, err := NewEncryptionCodec("k1", map[string][]byte{"k1": testKey(1)})
+	if err != nil {
+		t.Fatalf("codec: %v", err)
+	}
+	dc := NewCodecConverter(nil, &GzipCodec{}, v1)
+
+	secret := map[string]interface{}{"ssn": "123-45-6789"}
+	stored, err := Normalize(dc, secret)
+	if err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	p, ok := stored.(*Payload)
+	if !ok || p.Encoding != EncodingEncrypted || p.Metadata[MetadataEncryptionKeyID] != "k1" {
+		t.Fatalf("expected encrypted payload, got %#v", stored)
+	}
+	b, _ := json.Marshal(stored)
+	if strings.Contains(string(b), "123-45-6789") {
+		t.Fatalf("plaintext leaked into serialized payload: %s", b)
+	}
+
+	// Rotate: k2 becomes active, k1 stays available for old payloads
+	v2, err := NewEncryptionCodec("k2", map[string][]byte{"k1": testKey(1), "k2": testKey(2)})
+	if err != nil {
+		t.Fatalf("codec: %v", err)
+	}
+	rotated := NewCodecConverter(nil, &GzipCodec{}, v2)
+
+	var got map[string]interface{}
+	if err := Assign(rotated, Restore(roundTripJSON(t, stored)), &got); err != nil || got["ssn"] != "123-45-6789" {
+		t.Fatalf("decrypt old payload after rotation: %v (%v)", got, err)
+	}
+	fresh, _ := Normalize(rotated, secret)
+	if fresh.(*Payload).Metadata[MetadataEncryptionKeyID] != "k2" {
+		t.Fatalf("expected new payloads to use the active key, got %#v", fresh)
+	}
+
+	// A converter without k2 cannot read new payloads
+	if err := Assign(dc, fresh, &got); err == nil || !strings.Contains(err.Error(), `unknown encryption key "k2"`) {
+		t.Fatalf("expected unknown key error, got %v", err)
+	}
+}
+
+func TestEncryptionCodec_DetectsTampering(t *testing.T) {
+	codec, _ := NewEncryptionCodec("k", map[string][]byte{"k": testKey(3)})
+	p, err := codec.Encode(&Payload{Encoding: EncodingJSON, Data: []byte(`"x"`)})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	p.Data[len(p.Data)-1] ^= 0xff
+	if _, err := codec.Decode(p); err == nil {
+		t.Fatal("expected tampered ciphertext to fail")
+	}
+
+	if _, err := NewEncryptionCodec("missing", map[string][]byte{"k": testKey(3)}); err == nil {
+		t.Fatal("expected error for missing active key")
+	}
+	if _, err := NewEncryptionCodec("k", map[string][]byte{"k": []byte("short")}); err == nil {
+		t.Fatal("expected error for invalid key size")
+	}
+}
+
+func TestGzipCodec_MinSize(t *testing.T) {
+	dc := NewCodecConverter(nil, &GzipCodec{MinSize: 64})
+
+	small, _ := Normalize(dc, "tiny")
+	if small != "tiny" {
+		t.Fatalf("expected small value to stay plain JSON, got %#v", small)
+	}
+
+	large, _ := Normalize(dc, strings.Repeat("a", 1000))
+	p, ok := large.(*Payload)
+	if !ok || p.Encoding != EncodingGzip || len(p.Data) >= 1000 {
+		t.Fatalf("expected compressed payload, got %#v", large)
+	}
+	var s string
+	if err := Assign(dc, large, &s); err != nil || len(s) != 1000 {
+		t.Fatalf("decompress: %d chars (%v)", len(s), err)
+	}
+}
+
+func roundTripJSON(t *testing.T, v interface{}) interface{} {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var out interface{}
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	return out
+}
@@ -0,0 +1,57 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CompositeConverter encodes each value with the first converter that
+// supports it and decodes payloads with the converter matching their
+// encoding.
+type CompositeConverter struct {
+	converters []DataConverter
+	byEncoding map[string]DataConverter
+}
+
+// NewCompositeConverter creates a converter that tries converters in order
+func NewCompositeConverter(converters ...DataConverter) *CompositeConverter {
+	c := &CompositeConverter{
+		converters: converters,
+		byEncoding: make(map[string]DataConverter, len(converters)),
+	}
+	for _, dc := range converters {
+		if _, exists := c.byEncoding[dc.Encoding()]; !exists {
+			c.byEncoding[dc.Encoding()] = dc
+		}
+	}
+	return c
+}
+
+// Encoding implements DataConverter and reports the preferred encoding
+func (c *CompositeConverter) Encoding() string {
+	if len(c.converters) == 0 {
+		return ""
+	}
+	return c.converters[0].Encoding()
+}
+
+// ToPayload implements DataConverter
+func (c *CompositeConverter) ToPayload(value interface{}) (*Payload, error) {
+	for _, dc := range c.converters {
+		p, err := dc.ToPayload(value)
+		if errors.Is(err, ErrEncodingNotSupported) {
+			continue
+		}
+		return p, err
+	}
+	return nil, fmt.Errorf("%w: no converter for %T", ErrEncodingNotSupported, value)
+}
+
+// FromPayload implements DataConverter
+func (c *CompositeConverter) FromPayload(payload *Payload, valuePtr interface{}) error {
+	dc, ok := c.byEncoding[payload.Encoding]
+	if !ok {
+		return fmt.Errorf("%w: no converter for encoding %q", ErrEncodingNotSupported, payload.Encoding)
+	}
+	return dc.FromPayload(payload, valuePtr)
+}
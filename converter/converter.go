@@ -0,0 +1,213 @@
+// Package converter serializes the inputs, outputs and signal payloads that
+// flow between workflows, activities, the state store and the task queue.
+//
+// Values are recorded in normalized form: payloads produced by a JSON
+// converter are stored as plain JSON values (maps, slices, float64, ...),
+// while other encodings are stored as opaque *Payload values that survive a
+// JSON round trip and are decoded on demand. The in-memory and external
+// adapters therefore hand workflow code the same shapes.
+package converter
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Well-known payload encodings
+const (
+	EncodingJSON     = "json/plain"
+	EncodingProtobuf = "binary/protobuf"
+	EncodingMsgPack  = "binary/msgpack"
+)
+
+// ErrEncodingNotSupported is returned by a DataConverter that cannot encode a
+// value, or cannot decode a payload into the requested type.
+var ErrEncodingNotSupported = errors.New("encoding not supported")
+
+// Payload is a serialized value tagged with its encoding
+type Payload struct {
+	Encoding string            `json:"encoding"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Data     []byte            `json:"data"`
+}
+
+// payloadTag marks the JSON form of a Payload, so Restore can tell recorded
+// payloads from user data of the same shape
+const payloadTag = "_marathon_payload"
+
+// MarshalJSON encodes the payload with the payloadTag key set to 1
+func (p Payload) MarshalJSON() ([]byte, error) {
+	type fields Payload
+	return json.Marshal(struct {
+		Tag int `json:"_marathon_payload"`
+		fields
+	}{Tag: 1, fields: fields(p)})
+}
+
+// DataConverter converts between Go values and payloads
+type DataConverter interface {
+	// Encoding identifies the payloads produced by this converter
+	Encoding() string
+
+	// ToPayload serializes a value
+	ToPayload(value interface{}) (*Payload, error)
+
+	// FromPayload deserializes a payload into the value pointed to by valuePtr
+	FromPayload(payload *Payload, valuePtr interface{}) error
+}
+
+// Default returns the converter used when none is configured
+func Default() DataConverter {
+	return JSONConverter{}
+}
+
+// Encode serializes value with dc. Values that are already payloads are
+// returned unchanged.
+func Encode(dc DataConverter, value interface{}) (*Payload, error) {
+	if p, ok := value.(*Payload); ok {
+		return p, nil
+	}
+	return orDefault(dc).ToPayload(value)
+}
+
+// Decode deserializes a payload into valuePtr. Decoding into *interface{} a
+// payload that has no generic representation (such as protobuf) stores the
+// payload itself, so it can be decoded into a concrete type later.
+func Decode(dc DataConverter, payload *Payload, valuePtr interface{}) error {
+	err := orDefault(dc).FromPayload(payload, valuePtr)
+	if errors.Is(err, ErrEncodingNotSupported) {
+		if p, ok := valuePtr.(*interface{}); ok {
+			*p = payload
+			return nil
+		}
+	}
+	return err
+}
+
+// Normalize converts a value into the form in which it is recorded in state
+// stores, queues and events: JSON payloads become plain JSON values and
+// other encodings become *Payload. Normalizing a normalized value is a no-op.
+func Normalize(dc DataConverter, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	p, err := Encode(dc, value)
+	if err != nil {
+		return nil, err
+	}
+	if p.Encoding != EncodingJSON {
+		return p, nil
+	}
+	var out interface{}
+	if err := Decode(dc, p, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Value returns the generic form of a recorded value, decoding payloads
+// where the encoding allows it. It is used where code expects interface{}
+// inputs, such as workflow and activity functions.
+func Value(dc DataConverter, value interface{}) (interface{}, error) {
+	p, ok := value.(*Payload)
+	if !ok {
+		return value, nil
+	}
+	var out interface{}
+	if err := Decode(dc, p, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Assign stores value into valuePtr. Payloads are decoded with dc; values
+// already assignable to the target type are set directly; anything else is
+// round-tripped through dc, which turns generic maps into structs.
+func Assign(dc DataConverter, value interface{}, valuePtr interface{}) error {
+	if valuePtr == nil {
+		return nil
+	}
+	if p, ok := value.(*Payload); ok {
+		return Decode(dc, p, valuePtr)
+	}
+	if p, ok := valuePtr.(*interface{}); ok {
+		*p = value
+		return nil
+	}
+
+	rv := reflect.ValueOf(valuePtr)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("value pointer must be a non-nil pointer, got %T", valuePtr)
+	}
+	target := rv.Elem()
+	if value == nil {
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+	if v := reflect.ValueOf(value); v.Type().AssignableTo(target.Type()) {
+		target.Set(v)
+		return nil
+	}
+
+	p, err := Encode(dc, value)
+	if err != nil {
+		return fmt.Errorf("failed to encode %T: %w", value, err)
+	}
+	if err := Decode(dc, p, valuePtr); err != nil {
+		return fmt.Errorf("failed to decode into %T: %w", valuePtr, err)
+	}
+	return nil
+}
+
+// Restore reverses the effect of a JSON round trip on a normalized value:
+// payloads that came back as maps tagged by Payload.MarshalJSON are turned
+// into *Payload again, and any other value is returned unchanged. Stores and
+// queues that serialize records as JSON call it on every payload field they
+// read.
+func Restore(value interface{}) interface{} {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	if tag, ok := m[payloadTag].(float64); !ok || tag != 1 {
+		return value
+	}
+	encoding, ok := m["encoding"].(string)
+	if !ok {
+		return value
+	}
+	encoded, _ := m["data"].(string)
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return value
+	}
+	p := &Payload{Encoding: encoding, Data: data}
+	if meta, ok := m["metadata"].(map[string]interface{}); ok {
+		p.Metadata = make(map[string]string, len(meta))
+		for k, v := range meta {
+			s, ok := v.(string)
+			if !ok {
+				return value
+			}
+			p.Metadata[k] = s
+		}
+	}
+	return p
+}
+
+// RestoreMap applies Restore to each value of an event data map in place
+func RestoreMap(m map[string]interface{}) {
+	for k, v := range m {
+		m[k] = Restore(v)
+	}
+}
+
+func orDefault(dc DataConverter) DataConverter {
+	if dc == nil {
+		return Default()
+	}
+	return dc
+}
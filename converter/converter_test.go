@@ -0,0 +1,153 @@
+package converter
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type order struct {
+	ID    string   `json:"id"`
+	Items []string `json:"items"`
+	Total int      `json:"total"`
+}
+
+func TestNormalize_JSONProducesPlainValues(t *testing.T) {
+	v, err := Normalize(nil, order{ID: "o1", Items: []string{"a"}, Total: 3})
+	if err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok || m["id"] != "o1" || m["total"] != float64(3) {
+		t.Fatalf("expected generic JSON map, got %#v", v)
+	}
+	again, _ := Normalize(nil, v)
+	if again.(map[string]interface{})["total"] != float64(3) {
+		t.Fatalf("expected normalize to be idempotent, got %#v", again)
+	}
+
+	var back order
+	if err := Assign(nil, v, &back); err != nil || back.ID != "o1" || back.Total != 3 || back.Items[0] != "a" {
+		t.Fatalf("assign: %+v (%v)", back, err)
+	}
+}
+
+func TestNormalize_MsgPackSurvivesJSONRoundTrip(t *testing.T) {
+	dc := MsgPackConverter{}
+	v, err := Normalize(dc, order{ID: "o2", Total: 5})
+	if err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	if p, ok := v.(*Payload); !ok || p.Encoding != EncodingMsgPack {
+		t.Fatalf("expected msgpack payload, got %#v", v)
+	}
+
+	// Simulate a JSON-backed store
+	b, _ := json.Marshal(map[string]interface{}{"output": v})
+	var stored map[string]interface{}
+	json.Unmarshal(b, &stored)
+	restored := Restore(stored["output"])
+
+	var back order
+	if err := Assign(dc, restored, &back); err != nil || back.ID != "o2" || back.Total != 5 {
+		t.Fatalf("assign: %+v (%v)", back, err)
+	}
+	generic, err := Value(dc, restored)
+	if err != nil {
+		t.Fatalf("value: %v", err)
+	}
+	if m, ok := generic.(map[string]interface{}); !ok || m["id"] != "o2" {
+		t.Fatalf("expected generic map using json tags, got %#v", generic)
+	}
+}
+
+func TestCompositeConverter_Protobuf(t *testing.T) {
+	dc := NewCompositeConverter(ProtobufConverter{}, JSONConverter{})
+
+	v, err := Normalize(dc, wrapperspb.String("hi"))
+	if err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	if p, ok := v.(*Payload); !ok || p.Encoding != EncodingProtobuf {
+		t.Fatalf("expected protobuf payload, got %#v", v)
+	}
+
+	// Protobuf has no generic form; *interface{} receives the payload itself
+	var raw interface{}
+	if err := Assign(dc, v, &raw); err != nil || raw != v {
+		t.Fatalf("expected payload passthrough, got %#v (%v)", raw, err)
+	}
+	var msg *wrapperspb.StringValue
+	if err := Assign(dc, v, &msg); err != nil || msg.GetValue() != "hi" {
+		t.Fatalf("decode into **msg: %v (%v)", msg, err)
+	}
+	into := &wrapperspb.StringValue{}
+	if err := Assign(dc, v, into); err != nil || !proto.Equal(into, msg) {
+		t.Fatalf("decode into *msg: %v (%v)", into, err)
+	}
+
+	// Non-proto values fall back to JSON
+	plain, err := Normalize(dc, "text")
+	if err != nil || plain != "text" {
+		t.Fatalf("expected JSON fallback, got %#v (%v)", plain, err)
+	}
+
+	if _, err := (ProtobufConverter{}).ToPayload("text"); !errors.Is(err, ErrEncodingNotSupported) {
+		t.Fatalf("expected ErrEncodingNotSupported, got %v", err)
+	}
+}
+
+func TestAssign(t *testing.T) {
+	var n int
+	if err := Assign(nil, float64(42), &n); err != nil || n != 42 {
+		t.Errorf("expected 42, got %d (%v)", n, err)
+	}
+
+	var anything interface{}
+	o := order{ID: "x"}
+	if err := Assign(nil, o, &anything); err != nil || anything.(order).ID != "x" {
+		t.Errorf("expected direct assignment to interface, got %v (%v)", anything, err)
+	}
+
+	n = 7
+	if err := Assign(nil, nil, &n); err != nil || n != 0 {
+		t.Errorf("expected nil to zero the target, got %d (%v)", n, err)
+	}
+
+	if err := Assign(nil, 1, n); err == nil {
+		t.Error("expected error for non-pointer target")
+	}
+	if err := Assign(nil, "text", &n); err == nil {
+		t.Error("expected error decoding string into int")
+	}
+}
+
+func TestRestore_LeavesOrdinaryMapsAlone(t *testing.T) {
+	cases := []map[string]interface{}{
+		{"encoding": "utf-8", "data": "not base64!"},
+		{"encoding": EncodingJSON, "data": "e30="},
+		// Shaped like a payload but not tagged as one
+		{"encoding": "text/plain", "data": "aGk=", "metadata": map[string]interface{}{"k": "v"}},
+	}
+	for _, m := range cases {
+		if _, ok := Restore(m).(*Payload); ok {
+			t.Fatalf("expected ordinary map %v to be left alone", m)
+		}
+	}
+}
+
+func TestRestore_TaggedPayload(t *testing.T) {
+	b, err := json.Marshal(&Payload{Encoding: "text/plain", Metadata: map[string]string{"k": "v"}, Data: []byte("hi")})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var stored interface{}
+	json.Unmarshal(b, &stored)
+	p, ok := Restore(stored).(*Payload)
+	if !ok || p.Encoding != "text/plain" || string(p.Data) != "hi" || p.Metadata["k"] != "v" {
+		t.Fatalf("expected the payload back, got %#v from %s", Restore(stored), b)
+	}
+}
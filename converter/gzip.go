@@ -0,0 +1,53 @@
+package converter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// EncodingGzip tags payloads compressed by GzipCodec
+const EncodingGzip = "binary/gzip"
+
+// GzipCodec compresses payloads. Payloads smaller than MinSize bytes are
+// left uncompressed.
+type GzipCodec struct {
+	MinSize int
+}
+
+// Encoding implements PayloadCodec
+func (c *GzipCodec) Encoding() string { return EncodingGzip }
+
+// Encode implements PayloadCodec
+func (c *GzipCodec) Encode(p *Payload) (*Payload, error) {
+	if len(p.Data) < c.MinSize {
+		return p, nil
+	}
+	raw, err := marshalEnvelope(p)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return &Payload{Encoding: EncodingGzip, Data: buf.Bytes()}, nil
+}
+
+// Decode implements PayloadCodec
+func (c *GzipCodec) Decode(p *Payload) (*Payload, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(p.Data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalEnvelope(raw)
+}
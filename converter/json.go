@@ -0,0 +1,29 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// JSONConverter encodes values with encoding/json. It is the default.
+type JSONConverter struct{}
+
+// Encoding implements DataConverter
+func (JSONConverter) Encoding() string { return EncodingJSON }
+
+// ToPayload implements DataConverter
+func (JSONConverter) ToPayload(value interface{}) (*Payload, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return &Payload{Encoding: EncodingJSON, Data: data}, nil
+}
+
+// FromPayload implements DataConverter
+func (JSONConverter) FromPayload(payload *Payload, valuePtr interface{}) error {
+	if payload.Encoding != EncodingJSON {
+		return fmt.Errorf("%w: %s payload for json converter", ErrEncodingNotSupported, payload.Encoding)
+	}
+	return json.Unmarshal(payload.Data, valuePtr)
+}
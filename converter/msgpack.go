@@ -0,0 +1,36 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MsgPackConverter encodes values as MessagePack. Struct fields use their
+// json tags so types shared with the JSON converter need no extra tags.
+type MsgPackConverter struct{}
+
+// Encoding implements DataConverter
+func (MsgPackConverter) Encoding() string { return EncodingMsgPack }
+
+// ToPayload implements DataConverter
+func (MsgPackConverter) ToPayload(value interface{}) (*Payload, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(value); err != nil {
+		return nil, err
+	}
+	return &Payload{Encoding: EncodingMsgPack, Data: buf.Bytes()}, nil
+}
+
+// FromPayload implements DataConverter
+func (MsgPackConverter) FromPayload(payload *Payload, valuePtr interface{}) error {
+	if payload.Encoding != EncodingMsgPack {
+		return fmt.Errorf("%w: %s payload for msgpack converter", ErrEncodingNotSupported, payload.Encoding)
+	}
+	dec := msgpack.NewDecoder(bytes.NewReader(payload.Data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(valuePtr)
+}
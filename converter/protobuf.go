@@ -0,0 +1,53 @@
+package converter
+
+import (
+	"fmt"
+	"reflect"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ProtobufConverter encodes proto.Message values in the protobuf binary
+// format. Other values are rejected with ErrEncodingNotSupported, so it is
+// usually combined with a JSON fallback:
+//
+//	converter.NewCompositeConverter(converter.ProtobufConverter{}, converter.JSONConverter{})
+type ProtobufConverter struct{}
+
+// Encoding implements DataConverter
+func (ProtobufConverter) Encoding() string { return EncodingProtobuf }
+
+// ToPayload implements DataConverter
+func (ProtobufConverter) ToPayload(value interface{}) (*Payload, error) {
+	msg, ok := value.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T is not a proto.Message", ErrEncodingNotSupported, value)
+	}
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return &Payload{Encoding: EncodingProtobuf, Data: data}, nil
+}
+
+// FromPayload implements DataConverter. valuePtr may be a message (*pb.Msg)
+// or a pointer to a message pointer (**pb.Msg), which is allocated.
+func (ProtobufConverter) FromPayload(payload *Payload, valuePtr interface{}) error {
+	if payload.Encoding != EncodingProtobuf {
+		return fmt.Errorf("%w: %s payload for protobuf converter", ErrEncodingNotSupported, payload.Encoding)
+	}
+	if msg, ok := valuePtr.(proto.Message); ok {
+		return proto.Unmarshal(payload.Data, msg)
+	}
+	rv := reflect.ValueOf(valuePtr)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.Ptr {
+		if msg, ok := reflect.New(rv.Elem().Type().Elem()).Interface().(proto.Message); ok {
+			if err := proto.Unmarshal(payload.Data, msg); err != nil {
+				return err
+			}
+			rv.Elem().Set(reflect.ValueOf(msg))
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: cannot decode protobuf into %T", ErrEncodingNotSupported, valuePtr)
+}
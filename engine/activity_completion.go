@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/KamdynS/marathon/activity"
+	"github.com/KamdynS/marathon/converter"
+	"github.com/KamdynS/marathon/state"
+)
+
+// CompleteActivity completes an activity that returned
+// activity.ErrResultPending, resolving the workflow's future with result.
+// The token is the one the activity got from activity.GetTaskToken.
+func (e *Engine) CompleteActivity(ctx context.Context, token string, result interface{}) error {
+	activityState, err := e.pendingActivity(ctx, token)
+	if err != nil {
+		return err
+	}
+	output, err := converter.Normalize(e.dataConverter, result)
+	if err != nil {
+		return fmt.Errorf("failed to encode activity result: %w", err)
+	}
+
+	activityState.Status = state.StatusCompleted
+	activityState.Output = output
+	return e.closeActivity(ctx, activityState, state.EventActivityCompleted, map[string]interface{}{
+		"activity_id": activityState.ActivityID,
+		"output":      output,
+	})
+}
+
+// FailActivity fails an activity that returned activity.ErrResultPending.
+// The failure is final: the activity is not retried.
+func (e *Engine) FailActivity(ctx context.Context, token string, cause error) error {
+	if cause == nil {
+		return fmt.Errorf("failure cause is required")
+	}
+	activityState, err := e.pendingActivity(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	activityState.Status = state.StatusFailed
+	activityState.Error = cause.Error()
+	return e.closeActivity(ctx, activityState, state.EventActivityFailed, map[string]interface{}{
+		"activity_id": activityState.ActivityID,
+		"error":       cause.Error(),
+		"attempt":     activityState.Attempt,
+	})
+}
+
+// pendingActivity returns the state of the activity attempt a task token
+// identifies, provided it is still waiting to be completed
+func (e *Engine) pendingActivity(ctx context.Context, token string) (*state.ActivityState, error) {
+	tt, err := activity.ParseTaskToken(token, e.taskTokenSecret)
+	if err != nil {
+		return nil, err
+	}
+	activityState, err := e.stateStore.GetActivityState(ctx, tt.ActivityID)
+	if err != nil {
+		return nil, fmt.Errorf("activity not found: %w", err)
+	}
+	if activityState.WorkflowID != tt.WorkflowID || activityState.Attempt != tt.Attempt {
+		return nil, fmt.Errorf("task token does not match the current attempt of activity %s", tt.ActivityID)
+	}
+	if activityState.Status != state.StatusRunning {
+		return nil, fmt.Errorf("activity %s is %s", tt.ActivityID, activityState.Status)
+	}
+	workflowState, err := e.stateStore.GetWorkflowState(ctx, tt.WorkflowID)
+	if err != nil {
+		return nil, err
+	}
+	if workflowState.IsComplete() {
+		return nil, fmt.Errorf("workflow already completed")
+	}
+	return activityState, nil
+}
+
+// closeActivity records the outcome of an asynchronously completed activity
+// the way a worker records a synchronous one. Only the caller that moves the
+// activity out of running records its event; concurrent callers get an error.
+func (e *Engine) closeActivity(ctx context.Context, activityState *state.ActivityState, eventType state.EventType, data map[string]interface{}) error {
+	now := time.Now().UTC()
+	activityState.EndTime = &now
+
+	closed, err := e.stateStore.TransitionActivityState(ctx, activityState, state.StatusRunning)
+	if err != nil {
+		return fmt.Errorf("failed to save activity state: %w", err)
+	}
+	if !closed {
+		return fmt.Errorf("activity %s was already closed", activityState.ActivityID)
+	}
+	event := state.NewEventAt(activityState.WorkflowID, eventType, now, data)
+	if err := e.stateStore.AppendEvent(ctx, event); err != nil {
+		return fmt.Errorf("failed to record activity outcome: %w", err)
+	}
+	e.wakeWorkflow(ctx, activityState.WorkflowID)
+
+	log.Printf("[Engine] Activity %s of workflow %s %s asynchronously", activityState.ActivityID, activityState.WorkflowID, activityState.Status)
+	return nil
+}
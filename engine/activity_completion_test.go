@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/KamdynS/marathon/activity"
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/worker"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+func TestCompleteActivity_ResolvesPendingActivity(t *testing.T) {
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+	ctx := context.Background()
+
+	secret := []byte("task-token-secret")
+	tokens := make(chan string, 2)
+	actReg := activity.NewRegistry()
+	actReg.Register("review", activity.ActivityFunc(func(ctx context.Context, in interface{}) (interface{}, error) {
+		token, _ := activity.GetTaskToken(ctx)
+		tokens <- token
+		return nil, activity.ErrResultPending
+	}), activity.Info{})
+
+	reg := workflow.NewRegistry()
+	reg.Register(&workflow.Definition{Name: "approve", Options: workflow.Options{TaskQueue: "default"},
+		Workflow: workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+			var verdict string
+			if err := ctx.ExecuteActivity(ctx, "review", in).Get(ctx, &verdict); err != nil {
+				return nil, err
+			}
+			return verdict, nil
+		})})
+	eng, err := New(Config{StateStore: store, Queue: q, WorkflowRegistry: reg, TaskTokenSecret: secret})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer eng.Stop()
+	w, err := worker.New(worker.Config{Queue: q, ActivityRegistry: actReg, StateStore: store, PollInterval: 50 * time.Millisecond, TaskTokenSecret: secret})
+	if err != nil {
+		t.Fatalf("worker: %v", err)
+	}
+	w.Start(ctx)
+	defer w.Stop(ctx)
+
+	completed, _ := eng.StartWorkflow(ctx, "approve", "doc-1")
+	failed, _ := eng.StartWorkflow(ctx, "approve", "doc-2")
+	pending := map[string]string{}
+	for len(pending) < 2 {
+		select {
+		case token := <-tokens:
+			tt, err := activity.ParseTaskToken(token, secret)
+			if err != nil {
+				t.Fatalf("parse token: %v", err)
+			}
+			pending[tt.WorkflowID] = token
+		case <-time.After(3 * time.Second):
+			t.Fatal("activities did not run")
+		}
+	}
+
+	// The worker released the task, but the workflow keeps waiting
+	time.Sleep(200 * time.Millisecond)
+	if st, _ := store.GetWorkflowState(ctx, completed); st.Status != state.StatusRunning {
+		t.Fatalf("expected workflow to wait for the activity, got %s", st.Status)
+	}
+
+	if err := eng.CompleteActivity(ctx, "not-a-token", "approved"); err == nil {
+		t.Fatal("expected error for invalid token")
+	}
+	tt, _ := activity.ParseTaskToken(pending[completed], secret)
+	if err := eng.CompleteActivity(ctx, tt.Sign([]byte("forged")), "approved"); err == nil {
+		t.Fatal("expected error for a token signed with another secret")
+	}
+
+	// Concurrent completions agree on a single outcome
+	var wg sync.WaitGroup
+	var succeeded atomic.Int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if eng.CompleteActivity(ctx, pending[completed], "approved") == nil {
+				succeeded.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := succeeded.Load(); n != 1 {
+		t.Fatalf("expected exactly one completion to succeed, got %d", n)
+	}
+	if err := eng.CompleteActivity(ctx, pending[completed], "again"); err == nil {
+		t.Fatal("expected error completing a closed activity")
+	}
+	if err := eng.FailActivity(ctx, pending[failed], errors.New("rejected")); err != nil {
+		t.Fatalf("fail: %v", err)
+	}
+
+	st := waitForStatus(t, eng, completed, 3*time.Second)
+	if st.Status != state.StatusCompleted || st.Output != "approved" {
+		t.Fatalf("expected approved, got status=%s output=%v error=%s", st.Status, st.Output, st.Error)
+	}
+	events, _ := store.GetEvents(ctx, completed)
+	closedEvents := 0
+	for _, e := range events {
+		if e.Type == state.EventActivityCompleted {
+			closedEvents++
+		}
+	}
+	if closedEvents != 1 {
+		t.Fatalf("expected one activity_completed event, got %d", closedEvents)
+	}
+	st = waitForStatus(t, eng, failed, 3*time.Second)
+	if st.Status != state.StatusFailed {
+		t.Fatalf("expected failed workflow, got %s", st.Status)
+	}
+}
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KamdynS/marathon/activity"
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/worker"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+func TestBuilder_DataPassingAndControlFlow(t *testing.T) {
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+	ctx := context.Background()
+
+	actReg := activity.NewRegistry()
+	actReg.Register("list", activity.ActivityFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		return strings.Split(input.(string), ","), nil
+	}), activity.Info{})
+	actReg.Register("upper", activity.ActivityFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		return strings.ToUpper(input.(string)), nil
+	}), activity.Info{})
+	actReg.Register("join", activity.ActivityFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		parts := input.([]interface{})
+		out := make([]string, len(parts))
+		for i, p := range parts {
+			out[i] = p.(string)
+		}
+		return strings.Join(out, "+"), nil
+	}), activity.Info{})
+	actReg.Register("echo", activity.ActivityFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		return input, nil
+	}), activity.Info{})
+
+	reg := workflow.NewRegistry()
+	reg.Register(workflow.New("pipeline").
+		Step(&workflow.ActivityStep{ActivityName: "list", Input: workflow.Template("{{.Input.docs}}"), Name: "docs"}).
+		ForEach(nil, &workflow.ActivityStep{ActivityName: "upper", Input: workflow.Template("{{.Item}}")}, 10).
+		If(func(d workflow.StepData) (bool, error) {
+			return len(d.Prev.([]interface{})) == 3, nil
+		}, &workflow.ActivityStep{ActivityName: "join", InputFunc: func(d workflow.StepData) (interface{}, error) {
+			return d.Prev, nil
+		}}, nil).
+		While(func(d workflow.StepData) (bool, error) {
+			return d.Index < 2, nil
+		}, &workflow.ActivityStep{ActivityName: "echo", Input: workflow.Template("{{.Prev}}!")}, 5).
+		ActivityWithInput("echo", func(d workflow.StepData) (interface{}, error) {
+			return fmt.Sprintf("%s from %d docs", d.Prev, len(d.Steps["docs"].([]interface{}))), nil
+		}).
+		Build())
+
+	w, err := worker.New(worker.Config{Queue: q, QueueName: "default", ActivityRegistry: actReg, StateStore: store, MaxConcurrent: 2, PollInterval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("worker: %v", err)
+	}
+	w.Start(ctx)
+	defer func() {
+		stopCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		w.Stop(stopCtx)
+	}()
+
+	eng, err := New(Config{StateStore: store, Queue: q, WorkflowRegistry: reg})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer eng.Stop()
+
+	id, err := eng.StartWorkflow(ctx, "pipeline", map[string]interface{}{"docs": "a,b,c"})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	st := waitForStatus(t, eng, id, 20*time.Second)
+	if st.Status != state.StatusCompleted {
+		t.Fatalf("expected completed, got %s (%s)", st.Status, st.Error)
+	}
+	if want := "A+B+C!! from 3 docs"; st.Output != want {
+		t.Fatalf("expected %q, got %v", want, st.Output)
+	}
+}
@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+func TestExecutionTimeout_FailsPendingFutures(t *testing.T) {
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+	ctx := context.Background()
+
+	sleepErr := make(chan error, 1)
+	reg := workflow.NewRegistry()
+	reg.Register(&workflow.Definition{Name: "slow", Options: workflow.Options{TaskQueue: "default", ExecutionTimeout: 300 * time.Millisecond},
+		Workflow: workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+			// Waiting on an unrelated context still ends when the workflow times out
+			err := ctx.Sleep(time.Hour).Get(context.Background(), nil)
+			sleepErr <- err
+			return nil, err
+		})})
+	eng, err := New(Config{StateStore: store, Queue: q, WorkflowRegistry: reg})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer eng.Stop()
+
+	id, err := eng.StartWorkflow(ctx, "slow", nil)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	st := waitForStatus(t, eng, id, 5*time.Second)
+	if st.Status != state.StatusTimedOut {
+		t.Fatalf("expected timed out, got %s (%s)", st.Status, st.Error)
+	}
+
+	var timeoutErr *workflow.TimeoutError
+	if err := <-sleepErr; !errors.As(err, &timeoutErr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected TimeoutError from pending timer, got %v", err)
+	}
+	events, _ := store.GetEvents(ctx, id)
+	if last := events[len(events)-1]; last.Type != state.EventWorkflowTimedOut {
+		t.Fatalf("expected workflow_timed_out event last, got %s", last.Type)
+	}
+}
+
+func TestCancelWorkflow_FailsPendingActivity(t *testing.T) {
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+	ctx := context.Background()
+
+	started := make(chan struct{})
+	activityErr := make(chan error, 1)
+	reg := workflow.NewRegistry()
+	reg.Register(&workflow.Definition{Name: "waits", Options: workflow.Options{TaskQueue: "default"},
+		Workflow: workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+			// No worker polls the queue, so the activity never completes
+			future := ctx.ExecuteActivity(ctx, "never", nil)
+			close(started)
+			err := future.Get(ctx, nil)
+			activityErr <- err
+			return "ignored", nil
+		})})
+	eng, err := New(Config{StateStore: store, Queue: q, WorkflowRegistry: reg})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer eng.Stop()
+
+	id, err := eng.StartWorkflow(ctx, "waits", nil)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	<-started
+	if err := eng.CancelWorkflow(ctx, id); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+
+	select {
+	case err := <-activityErr:
+		var canceled *workflow.CanceledError
+		if !errors.As(err, &canceled) || !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected CanceledError, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("pending activity was not interrupted")
+	}
+
+	// The workflow returning normally after cancellation does not complete it
+	time.Sleep(100 * time.Millisecond)
+	if st, _ := eng.GetWorkflowStatus(ctx, id); st.Status != state.StatusCanceled {
+		t.Fatalf("expected status canceled, got %s", st.Status)
+	}
+}
@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+func newChildTestEngine(t *testing.T) (*Engine, state.Store) {
+	t.Helper()
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	t.Cleanup(func() { q.Close() })
+
+	reg := workflow.NewRegistry()
+	opts := workflow.Options{TaskQueue: "default"}
+	reg.Register(&workflow.Definition{Name: "echo-child", Options: opts, Workflow: workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+		return in.(string) + "!", nil
+	})})
+	reg.Register(&workflow.Definition{Name: "waiting-child", Options: opts, Workflow: workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+		var v interface{}
+		if err := ctx.ReceiveSignal(workflow.CancelRequestedSignal).Get(ctx, &v); err != nil {
+			return nil, err
+		}
+		return "cleaned-up", nil
+	})})
+	reg.Register(&workflow.Definition{Name: "supervisor", Options: opts, Workflow: workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+		var out interface{}
+		if err := ctx.ExecuteChildWorkflow(ctx, "echo-child", "hi", workflow.ChildWorkflowOptions{}).Get(ctx, &out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	})})
+	reg.Register(&workflow.Definition{Name: "fan-out", Options: opts, Workflow: workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+		id := ctx.WorkflowID()
+		ctx.ExecuteChildWorkflow(ctx, "waiting-child", nil, workflow.ChildWorkflowOptions{WorkflowID: id + "-terminate"})
+		ctx.ExecuteChildWorkflow(ctx, "waiting-child", nil, workflow.ChildWorkflowOptions{WorkflowID: id + "-abandon", ParentClosePolicy: workflow.ParentClosePolicyAbandon})
+		ctx.ExecuteChildWorkflow(ctx, "waiting-child", nil, workflow.ChildWorkflowOptions{WorkflowID: id + "-request", ParentClosePolicy: workflow.ParentClosePolicyRequestCancel})
+		var v interface{}
+		return nil, ctx.ReceiveSignal("never").Get(ctx, &v)
+	})})
+
+	eng, err := New(Config{StateStore: store, Queue: q, WorkflowRegistry: reg})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	t.Cleanup(eng.Stop)
+	return eng, store
+}
+
+func TestExecuteChildWorkflow_Completes(t *testing.T) {
+	eng, store := newChildTestEngine(t)
+	ctx := context.Background()
+
+	parentID, err := eng.StartWorkflow(ctx, "supervisor", nil)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	st := waitForStatus(t, eng, parentID, 3*time.Second)
+	if st.Status != state.StatusCompleted || st.Output != "hi!" {
+		t.Fatalf("unexpected parent result: %s %v (%s)", st.Status, st.Output, st.Error)
+	}
+
+	events, _ := store.GetEvents(ctx, parentID)
+	var childID string
+	var completed bool
+	for _, e := range events {
+		switch e.Type {
+		case state.EventChildWorkflowStarted:
+			childID = eventString(e, "child_workflow_id")
+		case state.EventChildWorkflowCompleted:
+			completed = eventString(e, "child_workflow_id") == childID
+		}
+	}
+	if childID == "" || !completed {
+		t.Fatalf("expected child started/completed events in parent log, got child=%q completed=%v", childID, completed)
+	}
+	child, err := eng.GetWorkflowStatus(ctx, childID)
+	if err != nil || child.ParentWorkflowID != parentID || child.Status != state.StatusCompleted {
+		t.Fatalf("unexpected child state: %+v (%v)", child, err)
+	}
+}
+
+func TestCancelWorkflow_AppliesParentClosePolicies(t *testing.T) {
+	eng, _ := newChildTestEngine(t)
+	ctx := context.Background()
+
+	parentID, err := eng.StartWorkflow(ctx, "fan-out", nil)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	// wait until all children exist
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		_, err := eng.GetWorkflowStatus(ctx, parentID+"-request")
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("children not started")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if err := eng.CancelWorkflow(ctx, parentID); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+
+	cases := []struct {
+		suffix string
+		status state.WorkflowStatus
+	}{
+		{suffix: "-terminate", status: state.StatusCanceled},
+		{suffix: "-request", status: state.StatusCompleted},
+		{suffix: "-abandon", status: state.StatusRunning},
+	}
+	for _, c := range cases {
+		t.Run(c.suffix, func(t *testing.T) {
+			var st *state.WorkflowState
+			deadline := time.Now().Add(2 * time.Second)
+			for time.Now().Before(deadline) {
+				st, _ = eng.GetWorkflowStatus(ctx, parentID+c.suffix)
+				if st != nil && st.Status == c.status {
+					return
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+			t.Fatalf("expected child%s to be %s, got %+v", c.suffix, c.status, st)
+		})
+	}
+}
@@ -2,11 +2,14 @@ package engine
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"log"
 	"sync"
 	"time"
 
+	"github.com/KamdynS/marathon/converter"
 	"github.com/KamdynS/marathon/queue"
 	"github.com/KamdynS/marathon/state"
 	"github.com/KamdynS/marathon/workflow"
@@ -15,30 +18,120 @@ import (
 // executionContext implements workflow.Context
 type executionContext struct {
 	context.Context
-	workflowID string
-	queue      queue.Queue
-	stateStore state.Store
-	taskQueue  string
-	futures    map[string]*futureImpl
-	mu         sync.Mutex
+	workflowID    string
+	engine        *Engine
+	queue         queue.Queue
+	stateStore    state.Store
+	taskQueue     string
+	futures       map[string]*futureImpl
+	history       *history
+	seqs          map[string]int  // deterministic ID counters
+	replayed      map[string]bool // recorded commands this execution has reached
+	versions      map[string]int  // changeID -> version chosen by GetVersion
+	clock         time.Time       // workflow time, advanced as futures are observed
+	queries       map[string]workflow.QueryHandler
+	dataConverter converter.DataConverter
+	// priority and fairnessKey are given to the tasks the workflow enqueues
+	priority    int
+	fairnessKey string
+	// replayOnly contexts never issue side effects; futures not resolvable
+	// from history block and report on blocked. Used to answer queries for
+	// workflows that are not resident in this engine.
+	replayOnly bool
+	blocked    chan struct{}
+	pending    []*futureImpl
+	cancel     context.CancelFunc
+	// abort cancels a live execution with a workflow.CanceledError or
+	// workflow.TimeoutError cause
+	abort context.CancelCauseFunc
+	// lifetime ends when a live execution returns, which may be after its
+	// context is done while disconnected work such as compensations finishes
+	lifetime context.Context
+	// watchOnce subscribes to the store's events the first time a future
+	// waits; waiters receive the events they match
+	watchOnce sync.Once
+	watching  bool
+	waiters   map[*eventWaiter]struct{}
+	// task is set for executions run by a workflow task, which are released
+	// once the workflow waits on pending results for idleTimeout; see
+	// Engine.releaseWhenIdle
+	task        *workflowTask
+	idleTimeout time.Duration
+	waiting     int
+	idleSince   time.Time
+	woken       bool
+	released    bool
+	mu          sync.Mutex
 }
 
-// newExecutionContext creates a new execution context
-func newExecutionContext(workflowID string, q queue.Queue, store state.Store, taskQueue string) *executionContext {
+// newExecutionContext creates a new execution context. Events recorded before
+// this execution are used to replay completed activities and timers.
+func newExecutionContext(workflowID string, q queue.Queue, store state.Store, taskQueue string, events []*state.Event) *executionContext {
+	h := newHistory(events)
+	clock := h.startTime
+	if clock.IsZero() {
+		clock = time.Now().UTC()
+	}
 	return &executionContext{
-		Context:    context.Background(),
-		workflowID: workflowID,
-		queue:      q,
-		stateStore: store,
-		taskQueue:  taskQueue,
-		futures:    make(map[string]*futureImpl),
+		Context:       context.Background(),
+		workflowID:    workflowID,
+		queue:         q,
+		stateStore:    store,
+		taskQueue:     taskQueue,
+		futures:       make(map[string]*futureImpl),
+		history:       h,
+		seqs:          make(map[string]int),
+		replayed:      make(map[string]bool),
+		versions:      make(map[string]int),
+		clock:         clock,
+		queries:       make(map[string]workflow.QueryHandler),
+		dataConverter: converter.Default(),
+		waiters:       make(map[*eventWaiter]struct{}),
+	}
+}
+
+// newReplayContext creates an execution context that only replays recorded
+// history and never schedules activities, timers or events.
+func newReplayContext(workflowID string, store state.Store, taskQueue string, events []*state.Event) *executionContext {
+	ctx := newExecutionContext(workflowID, nil, store, taskQueue, events)
+	ctx.Context, ctx.cancel = context.WithCancel(context.Background())
+	ctx.replayOnly = true
+	ctx.blocked = make(chan struct{}, 1)
+	return ctx
+}
+
+// blockedFuture returns a future that never resolves from history and
+// reports on ctx.blocked once the workflow waits on it.
+func (ctx *executionContext) blockedFuture(id string) *futureImpl {
+	f := ctx.newFuture(id)
+	f.onWait = func() {
+		select {
+		case ctx.blocked <- struct{}{}:
+		default:
+		}
+	}
+	ctx.mu.Lock()
+	ctx.pending = append(ctx.pending, f)
+	ctx.mu.Unlock()
+	return f
+}
+
+// abandon unwinds a replay-only execution by failing its blocked futures.
+func (ctx *executionContext) abandon() {
+	ctx.cancel()
+	ctx.mu.Lock()
+	pending := ctx.pending
+	ctx.pending = nil
+	ctx.mu.Unlock()
+	for _, f := range pending {
+		f.setError(context.Canceled)
 	}
 }
 
 // ExecuteActivity implements workflow.Context
 func (ctx *executionContext) ExecuteActivity(activityCtx context.Context, activityName string, input interface{}) workflow.Future {
-	// Generate activity ID
-	activityID := generateActivityID()
+	// Generate a deterministic activity ID so replays map to the same record
+	activityID := ctx.generateActivityID(activityName, input)
 
 	return ctx.ExecuteActivityWithID(activityCtx, activityName, input, activityID)
 }
@@ -46,25 +139,64 @@ func (ctx *executionContext) ExecuteActivity(activityCtx context.Context, activi
 // ExecuteActivityWithID implements workflow.Context with stable id support
 func (ctx *executionContext) ExecuteActivityWithID(activityCtx context.Context, activityName string, input interface{}, activityID string) workflow.Future {
 	if activityID == "" {
-		activityID = generateActivityID()
+		activityID = ctx.generateActivityID(activityName, input)
+	}
+	if _, ok := ctx.history.activityScheduled[activityID]; ok {
+		ctx.markReplayed("activity:" + activityID)
+	}
+
+	// On replay, return the recorded result without re-issuing the activity
+	if evt, ok := ctx.history.activityCompleted[activityID]; ok {
+		future := ctx.newFuture(activityID)
+		future.setValueAt(evt.Data["output"], evt.Timestamp)
+		return future
 	}
 
 	// If activity already completed, return cached result
-	if st, err := ctx.stateStore.GetActivityState(activityCtx, activityID); err == nil && st != nil {
-		if st.Status == state.StatusCompleted {
-			future := newFuture(activityID)
-			future.setValue(st.Output)
+	st, stErr := ctx.stateStore.GetActivityState(activityCtx, activityID)
+	if stErr == nil && st != nil {
+		switch st.Status {
+		case state.StatusCompleted:
+			future := ctx.newFuture(activityID)
+			future.setValueAt(st.Output, activityEndTime(st))
 			return future
+		case state.StatusFailed:
+			if _, replayed := ctx.history.activityScheduled[activityID]; replayed {
+				future := ctx.newFuture(activityID)
+				future.setErrorAt(fmt.Errorf("activity failed: %s", st.Error), activityEndTime(st))
+				return future
+			}
 		}
 	}
 
+	if ctx.replayOnly {
+		return ctx.blockedFuture(activityID)
+	}
+	if f := ctx.releasedFuture(activityID); f != nil {
+		return f
+	}
+
+	input, err := converter.Normalize(ctx.dataConverter, input)
+	if err != nil {
+		future := ctx.newFuture(activityID)
+		future.setError(fmt.Errorf("failed to encode activity input: %w", err))
+		return future
+	}
+
 	// Create task
 	task := queue.NewTask(queue.TaskTypeActivity, ctx.workflowID, input)
 	task.ActivityID = activityID
 	task.ActivityName = activityName
+	task.Priority = ctx.priority
+	task.FairnessKey = ctx.fairnessKey
+	if ctx.engine != nil && ctx.engine.workflowTaskQueue != "" {
+		// Wake the workflow with a workflow task once the activity closes
+		task.Metadata[queue.MetadataWorkflowTaskQueue] = ctx.engine.workflowTaskQueue
+	}
 
 	// Record activity scheduled event only if not previously scheduled
-	if _, err := ctx.stateStore.GetActivityState(activityCtx, activityID); err != nil {
+	_, replayed := ctx.history.activityScheduled[activityID]
+	if stErr != nil && !replayed {
 		event := state.NewEvent(ctx.workflowID, state.EventActivityScheduled, map[string]interface{}{
 			"activity_id":   activityID,
 			"activity_name": activityName,
@@ -73,10 +205,18 @@ func (ctx *executionContext) ExecuteActivityWithID(activityCtx context.Context,
 		ctx.stateStore.AppendEvent(activityCtx, event)
 	}
 
+	// Watch for the outcome before enqueueing so a fast worker cannot beat us
+	waiter := ctx.watch(func(e *state.Event) bool {
+		// Attempts the worker retries record activity_retrying instead
+		return (e.Type == state.EventActivityCompleted || e.Type == state.EventActivityFailed) &&
+			eventString(e, "activity_id") == activityID
+	})
+
 	// Enqueue task
 	if err := ctx.queue.Enqueue(activityCtx, ctx.taskQueue, task); err != nil {
+		ctx.unwatch(waiter)
 		// Return a future that will fail immediately
-		future := newFuture(activityID)
+		future := ctx.newFuture(activityID)
 		future.setError(fmt.Errorf("failed to enqueue activity: %w", err))
 		return future
 	}
@@ -85,101 +225,445 @@ func (ctx *executionContext) ExecuteActivityWithID(activityCtx context.Context,
 		activityID, activityName, ctx.workflowID)
 
 	// Create and return future
-	future := newFuture(activityID)
+	future := ctx.newFuture(activityID)
 	ctx.mu.Lock()
 	ctx.futures[activityID] = future
 	ctx.mu.Unlock()
 
-	// Start polling for result in background
-	go ctx.pollActivityResult(activityCtx, activityID, future)
+	// Wait for the result in background
+	go ctx.pollActivityResult(activityCtx, activityID, waiter, future)
 
 	return future
 }
 
-// pollActivityResult polls for activity completion
-func (ctx *executionContext) pollActivityResult(activityCtx context.Context, activityID string, future *futureImpl) {
-	ticker := time.NewTicker(500 * time.Millisecond)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-activityCtx.Done():
-			future.setError(activityCtx.Err())
-			return
-		case <-ticker.C:
-			// Check activity state
-			activityState, err := ctx.stateStore.GetActivityState(activityCtx, activityID)
-			if err != nil {
-				// Activity not found yet, continue polling
-				continue
+// pollActivityResult waits for activity completion, resolving from the
+// watched event or, as a fallback, from the activity state
+func (ctx *executionContext) pollActivityResult(activityCtx context.Context, activityID string, waiter *eventWaiter, future *futureImpl) {
+	err := ctx.waitFor(activityCtx, waiter, 500*time.Millisecond, func(evt *state.Event) bool {
+		if evt != nil {
+			if evt.Type == state.EventActivityCompleted {
+				future.setValueAt(evt.Data["output"], evt.Timestamp)
+			} else {
+				future.setErrorAt(fmt.Errorf("activity failed: %s", eventString(evt, "error")), evt.Timestamp)
 			}
+			return true
+		}
 
-			if activityState.Status == state.StatusCompleted {
-				future.setValue(activityState.Output)
-				return
-			} else if activityState.Status == state.StatusFailed {
-				future.setError(fmt.Errorf("activity failed: %s", activityState.Error))
-				return
+		// Check activity state
+		activityState, err := ctx.stateStore.GetActivityState(activityCtx, activityID)
+		if err != nil {
+			// Activity not found yet, keep waiting
+			return false
+		}
+		if activityState.Status == state.StatusCompleted {
+			future.setValueAt(activityState.Output, activityEndTime(activityState))
+			return true
+		} else if activityState.Status == state.StatusFailed {
+			future.setErrorAt(fmt.Errorf("activity failed: %s", activityState.Error), activityEndTime(activityState))
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		future.setError(err)
+	}
+}
+
+// ExecuteChildWorkflow implements workflow.Context
+func (ctx *executionContext) ExecuteChildWorkflow(childCtx context.Context, workflowName string, input interface{}, opts workflow.ChildWorkflowOptions) workflow.Future {
+	childID := opts.WorkflowID
+	if childID == "" {
+		childID = ctx.generateChildWorkflowID(workflowName, input)
+	}
+	future := ctx.newFuture(childID)
+	if _, ok := ctx.history.childStarted[childID]; ok {
+		ctx.markReplayed("child:" + childID)
+	}
+
+	// On replay, return the recorded child outcome
+	if evt, ok := ctx.history.childClosed[childID]; ok {
+		if evt.Type == state.EventChildWorkflowCompleted {
+			future.setValueAt(evt.Data["output"], evt.Timestamp)
+		} else {
+			future.setErrorAt(fmt.Errorf("%s", eventString(evt, "error")), evt.Timestamp)
+		}
+		return future
+	}
+
+	if ctx.replayOnly {
+		return ctx.blockedFuture(childID)
+	}
+	if f := ctx.releasedFuture(childID); f != nil {
+		return f
+	}
+
+	// The parent is notified with an event when the child closes
+	waiter := ctx.watch(func(e *state.Event) bool {
+		return (e.Type == state.EventChildWorkflowCompleted || e.Type == state.EventChildWorkflowFailed) &&
+			eventString(e, "child_workflow_id") == childID
+	})
+
+	// Start the child unless it was already started before a restart
+	if _, started := ctx.history.childStarted[childID]; !started {
+		if err := ctx.engine.startChildWorkflow(childCtx, ctx.workflowID, childID, workflowName, input, opts.ParentClosePolicy, StartWorkflowOptions{Priority: ctx.priority, FairnessKey: ctx.fairnessKey}); err != nil {
+			ctx.unwatch(waiter)
+			future.setError(fmt.Errorf("failed to start child workflow: %w", err))
+			return future
+		}
+	}
+
+	go ctx.pollChildResult(childCtx, childID, waiter, future)
+
+	return future
+}
+
+// pollChildResult waits for child workflow completion. The child's state is
+// read whenever its close event is watched and as a fallback.
+func (ctx *executionContext) pollChildResult(childCtx context.Context, childID string, waiter *eventWaiter, future *futureImpl) {
+	err := ctx.waitFor(childCtx, waiter, 200*time.Millisecond, func(*state.Event) bool {
+		// Follow the child across continue-as-new runs
+		runID := childID
+		if ctx.engine != nil {
+			if latest, err := ctx.engine.GetLatestRunID(childCtx, childID); err == nil {
+				runID = latest
 			}
-			// Otherwise, continue polling
 		}
+		child, err := ctx.stateStore.GetWorkflowState(childCtx, runID)
+		if err != nil || !child.IsComplete() {
+			return false
+		}
+		var endTime time.Time
+		if child.EndTime != nil {
+			endTime = *child.EndTime
+		}
+		if child.Status == state.StatusCompleted {
+			future.setValueAt(child.Output, endTime)
+		} else {
+			future.setErrorAt(childWorkflowError(child), endTime)
+		}
+		return true
+	})
+	if err != nil {
+		future.setError(err)
 	}
 }
 
 // Sleep implements workflow.Context
 func (ctx *executionContext) Sleep(duration time.Duration) workflow.Future {
-	timerID := fmt.Sprintf("tm-%d", time.Now().UnixNano())
-	fireAt := time.Now().Add(duration).UTC()
+	timerID := ctx.generateTimerID(duration)
+	future := ctx.newFuture(timerID)
+	if _, ok := ctx.history.timerScheduled[timerID]; ok {
+		ctx.markReplayed("timer:" + timerID)
+	}
 
-	// persist timer schedule (idempotent)
-	_ = ctx.stateStore.ScheduleTimer(context.Background(), ctx.workflowID, timerID, fireAt)
+	// On replay, a fired timer resolves immediately
+	if evt, ok := ctx.history.timerFired[timerID]; ok {
+		future.setValueAt(nil, evt.Timestamp)
+		return future
+	}
 
-	// record timer scheduled event
-	evt := state.NewEvent(ctx.workflowID, state.EventTimerScheduled, map[string]interface{}{
-		"timer_id": timerID,
-		"fire_at":  fireAt,
-		"duration": duration.String(),
+	if ctx.replayOnly {
+		return ctx.blockedFuture(timerID)
+	}
+	if f := ctx.releasedFuture(timerID); f != nil {
+		return f
+	}
+
+	waiter := ctx.watch(func(e *state.Event) bool {
+		return e.Type == state.EventTimerFired && eventString(e, "timer_id") == timerID
 	})
-	_ = ctx.stateStore.AppendEvent(context.Background(), evt)
 
-	future := newFuture(timerID)
+	// A timer scheduled before a restart keeps its original deadline and is
+	// still persisted in the store, so only schedule timers that are new.
+	if _, ok := ctx.history.timerScheduled[timerID]; !ok {
+		fireAt := time.Now().Add(duration).UTC()
+
+		// persist timer schedule (idempotent)
+		_ = ctx.stateStore.ScheduleTimer(context.Background(), ctx.workflowID, timerID, fireAt)
+
+		// record timer scheduled event
+		evt := state.NewEvent(ctx.workflowID, state.EventTimerScheduled, map[string]interface{}{
+			"timer_id": timerID,
+			"fire_at":  fireAt,
+			"duration": duration.String(),
+		})
+		_ = ctx.stateStore.AppendEvent(context.Background(), evt)
+	}
+
+	// wait for the TimerFired event, re-reading the log past the last seen
+	// event as a fallback
+	go func() {
+		since := ctx.history.lastSeq
+		err := ctx.waitFor(ctx, waiter, 200*time.Millisecond, func(evt *state.Event) bool {
+			if evt != nil {
+				future.setValueAt(nil, evt.Timestamp)
+				return true
+			}
+			events, err := ctx.stateStore.GetEventsSince(ctx, ctx.workflowID, since)
+			if err != nil {
+				return false
+			}
+			for _, e := range events {
+				if e.SequenceNum > since {
+					since = e.SequenceNum
+				}
+				if e.Type == state.EventTimerFired && eventString(e, "timer_id") == timerID {
+					future.setValueAt(nil, e.Timestamp)
+					return true
+				}
+			}
+			return false
+		})
+		if err != nil {
+			future.setError(err)
+		}
+	}()
+
+	return future
+}
+
+// ReceiveSignal implements workflow.Context. The n-th call for a name resolves
+// with the n-th signal_received event of that name, so replays see the same
+// payloads in the same order.
+func (ctx *executionContext) ReceiveSignal(name string) workflow.Future {
+	n := ctx.nextSeq("sig:" + name)
+	future := ctx.newFuture(fmt.Sprintf("sig-%s-%d", name, n))
+
+	// On replay, a recorded signal resolves immediately
+	if recorded := ctx.history.signals[name]; len(recorded) >= n {
+		evt := recorded[n-1]
+		future.setValueAt(evt.Data["payload"], evt.Timestamp)
+		return future
+	}
+
+	if ctx.replayOnly {
+		return ctx.blockedFuture(future.id)
+	}
 
-	// poll for TimerFired event durably
+	// wait for the n-th matching SignalReceived event durably. Signals are
+	// counted from the log, so a watched signal only triggers a re-read of
+	// the events past the last one seen.
+	waiter := ctx.watch(func(e *state.Event) bool {
+		return e.Type == state.EventSignalReceived && eventString(e, "signal_name") == name
+	})
 	go func() {
-		ticker := time.NewTicker(200 * time.Millisecond)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ctx.Done():
-				future.setError(ctx.Err())
-				return
-			case <-ticker.C:
-				events, err := ctx.stateStore.GetEventsSince(context.Background(), ctx.workflowID, 0)
-				if err != nil {
-					continue
+		since := ctx.history.lastSeq
+		seen := len(ctx.history.signals[name])
+		err := ctx.waitFor(ctx, waiter, 200*time.Millisecond, func(*state.Event) bool {
+			events, err := ctx.stateStore.GetEventsSince(ctx, ctx.workflowID, since)
+			if err != nil {
+				return false
+			}
+			for _, e := range events {
+				if e.SequenceNum > since {
+					since = e.SequenceNum
 				}
-				for _, e := range events {
-					if e.Type == state.EventTimerFired {
-						if idAny, ok := e.Data["timer_id"]; ok {
-							if idStr, ok := idAny.(string); ok && idStr == timerID {
-								future.setValue(nil)
-								return
-							}
-						}
+				if e.Type == state.EventSignalReceived && eventString(e, "signal_name") == name {
+					seen++
+					if seen == n {
+						future.setValueAt(e.Data["payload"], e.Timestamp)
+						return true
 					}
 				}
 			}
+			return false
+		})
+		if err != nil {
+			future.setError(err)
 		}
 	}()
 
 	return future
 }
 
-// Now implements workflow.Context
+// ContinueAsNew implements workflow.Context
+func (ctx *executionContext) ContinueAsNew(input interface{}) error {
+	return &workflow.ContinueAsNewError{Input: input}
+}
+
+// GetVersion implements workflow.Context. A change reached while the
+// execution is still replaying recorded decisions predates the change and
+// gets DefaultVersion; a change reached past the end of the recorded
+// decisions gets maxSupported. Either way the choice is recorded as a
+// version_marker event so later replays return the same version.
+func (ctx *executionContext) GetVersion(changeID string, minSupported, maxSupported int) (int, error) {
+	if changeID == "" {
+		return 0, fmt.Errorf("change ID cannot be empty")
+	}
+
+	ctx.mu.Lock()
+	version, seen := ctx.versions[changeID]
+	ctx.mu.Unlock()
+	if !seen {
+		version = ctx.resolveVersion(changeID, maxSupported)
+	}
+
+	if version < minSupported || version > maxSupported {
+		return version, fmt.Errorf("workflow %s: version %d of change %s is outside supported range [%d, %d]",
+			ctx.workflowID, version, changeID, minSupported, maxSupported)
+	}
+	return version, nil
+}
+
+// resolveVersion picks and records the version of a change the first time
+// the execution reaches it.
+func (ctx *executionContext) resolveVersion(changeID string, maxSupported int) int {
+	if evt, ok := ctx.history.versions[changeID]; ok {
+		ctx.markReplayed("version:" + changeID)
+		version, _ := eventInt(evt, "version")
+		ctx.mu.Lock()
+		ctx.versions[changeID] = version
+		ctx.mu.Unlock()
+		return version
+	}
+
+	version := maxSupported
+	if ctx.replaying() {
+		version = workflow.DefaultVersion
+	}
+	ctx.mu.Lock()
+	ctx.versions[changeID] = version
+	ctx.mu.Unlock()
+
+	if !ctx.replayOnly && !ctx.isReleased() {
+		evt := state.NewEvent(ctx.workflowID, state.EventVersionMarker, map[string]interface{}{
+			"change_id": changeID,
+			"version":   version,
+		})
+		_ = ctx.stateStore.AppendEvent(context.Background(), evt)
+	}
+	return version
+}
+
+// markReplayed notes that the execution reached a recorded command.
+func (ctx *executionContext) markReplayed(key string) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	ctx.replayed[key] = true
+}
+
+// replaying reports whether recorded commands remain that the execution has
+// not reached yet.
+func (ctx *executionContext) replaying() bool {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	return len(ctx.replayed) < ctx.history.commands()
+}
+
+// SetQueryHandler implements workflow.Context
+func (ctx *executionContext) SetQueryHandler(name string, handler workflow.QueryHandler) error {
+	if name == "" {
+		return fmt.Errorf("query name cannot be empty")
+	}
+	if handler == nil {
+		return fmt.Errorf("query handler cannot be nil")
+	}
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	ctx.queries[name] = handler
+	return nil
+}
+
+// handleQuery invokes the registered handler for a query.
+func (ctx *executionContext) handleQuery(name string, args interface{}) (interface{}, error) {
+	ctx.mu.Lock()
+	handler, ok := ctx.queries[name]
+	ctx.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s for workflow %s", ErrQueryNotFound, name, ctx.workflowID)
+	}
+	return handler(args)
+}
+
+// Now implements workflow.Context. Workflow time starts at the recorded
+// workflow start and advances to the recorded completion time of each future
+// the workflow observes, so it is identical across replays.
 func (ctx *executionContext) Now() time.Time {
-	// For determinism, this should use workflow time, not system time
-	// For now, we'll use system time as a simple implementation
-	return time.Now()
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	return ctx.clock
+}
+
+// advanceClock moves workflow time forward to t.
+func (ctx *executionContext) advanceClock(t time.Time) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	if t.After(ctx.clock) {
+		ctx.clock = t
+	}
+}
+
+// newFuture creates a future whose resolution advances workflow time when observed.
+func (ctx *executionContext) newFuture(id string) *futureImpl {
+	f := newFuture(id)
+	f.observe = ctx.advanceClock
+	f.dataConverter = ctx.dataConverter
+	if ctx.task != nil {
+		f.onWait = ctx.beginWait
+		f.onWaitDone = ctx.endWait
+	}
+	return f
+}
+
+// generateActivityID derives a stable activity ID from the workflow ID, the
+// activity name, a digest of the input and the number of identical calls made
+// so far. Concurrent branches scheduling different activities therefore get
+// the same IDs on every replay regardless of goroutine ordering.
+func (ctx *executionContext) generateActivityID(activityName string, input interface{}) string {
+	digest := inputDigest(input)
+	n := ctx.nextSeq(fmt.Sprintf("act:%s:%08x", activityName, digest))
+	return ctx.attemptScoped(fmt.Sprintf("%s-%s-%08x-%d", ctx.workflowID, activityName, digest, n))
+}
+
+// generateChildWorkflowID derives a stable child workflow ID in the same way
+// as generateActivityID.
+func (ctx *executionContext) generateChildWorkflowID(workflowName string, input interface{}) string {
+	digest := inputDigest(input)
+	n := ctx.nextSeq(fmt.Sprintf("child:%s:%08x", workflowName, digest))
+	return ctx.attemptScoped(fmt.Sprintf("%s-child-%s-%08x-%d", ctx.workflowID, workflowName, digest, n))
+}
+
+// generateTimerID derives a stable timer ID from the duration and call count.
+func (ctx *executionContext) generateTimerID(duration time.Duration) string {
+	n := ctx.nextSeq("tm:" + duration.String())
+	return ctx.attemptScoped(fmt.Sprintf("tm-%s-%d", duration, n))
+}
+
+// attemptScoped qualifies an ID generated by a retry attempt so it does not
+// collide with the records of earlier attempts. The first attempt keeps
+// unqualified IDs.
+func (ctx *executionContext) attemptScoped(id string) string {
+	if ctx.history.attempt <= 1 {
+		return id
+	}
+	return fmt.Sprintf("%s@%d", id, ctx.history.attempt)
+}
+
+// nextSeq increments and returns the counter for key.
+func (ctx *executionContext) nextSeq(key string) int {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	ctx.seqs[key]++
+	return ctx.seqs[key]
+}
+
+// inputDigest hashes the JSON form of an input, falling back to its %v form.
+func inputDigest(input interface{}) uint32 {
+	h := fnv.New32a()
+	if b, err := json.Marshal(input); err == nil {
+		h.Write(b)
+	} else {
+		fmt.Fprintf(h, "%v", input)
+	}
+	return h.Sum32()
+}
+
+// activityEndTime returns the recorded end time of an activity, if any.
+func activityEndTime(st *state.ActivityState) time.Time {
+	if st.EndTime != nil {
+		return *st.EndTime
+	}
+	return time.Time{}
 }
 
 // WorkflowID implements workflow.Context
@@ -200,6 +684,16 @@ type futureImpl struct {
 	ready   bool
 	readyCh chan struct{}
 	mu      sync.Mutex
+	// ts is the recorded time the result became available; observe is
+	// called with it when the workflow reads the result.
+	ts      time.Time
+	observe func(time.Time)
+	// onWait is called when Get must wait for an unresolved result, and
+	// onWaitDone once that wait ends.
+	onWait     func()
+	onWaitDone func()
+	// converter decodes the value into the type requested by Get.
+	dataConverter converter.DataConverter
 }
 
 // newFuture creates a new future
@@ -213,34 +707,33 @@ func newFuture(id string) *futureImpl {
 
 // Get implements workflow.Future
 func (f *futureImpl) Get(ctx context.Context, valuePtr interface{}) error {
+	if f.onWait != nil && !f.IsReady() {
+		f.onWait()
+		if f.onWaitDone != nil {
+			defer f.onWaitDone()
+		}
+	}
+
 	// Wait for result
 	select {
 	case <-f.readyCh:
 		// Result is ready
 	case <-ctx.Done():
-		return ctx.Err()
+		return context.Cause(ctx)
 	}
 
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	if f.err != nil {
-		return f.err
+	if f.observe != nil && !f.ts.IsZero() {
+		f.observe(f.ts)
 	}
 
-	// Set value if pointer provided
-	if valuePtr != nil {
-		// Simple assignment - in production, use reflection for proper type handling
-		switch v := valuePtr.(type) {
-		case *interface{}:
-			*v = f.value
-		default:
-			// For now, just assign directly
-			*valuePtr.(*interface{}) = f.value
-		}
+	if f.err != nil {
+		return f.err
 	}
 
-	return nil
+	return converter.Assign(f.dataConverter, f.value, valuePtr)
 }
 
 // IsReady implements workflow.Future
@@ -268,6 +761,22 @@ func (f *futureImpl) setError(err error) {
 	close(f.readyCh)
 }
 
+// setValueAt sets the future's value along with the time it was recorded
+func (f *futureImpl) setValueAt(value interface{}, ts time.Time) {
+	f.mu.Lock()
+	f.ts = ts
+	f.mu.Unlock()
+	f.setValue(value)
+}
+
+// setErrorAt sets the future's error along with the time it was recorded
+func (f *futureImpl) setErrorAt(err error, ts time.Time) {
+	f.mu.Lock()
+	f.ts = ts
+	f.mu.Unlock()
+	f.setError(err)
+}
+
 // defaultLogger implements workflow.Logger
 type defaultLogger struct {
 	workflowID string
@@ -288,8 +797,3 @@ func (l *defaultLogger) Warn(msg string, keyvals ...interface{}) {
 func (l *defaultLogger) Error(msg string, keyvals ...interface{}) {
 	log.Printf("[ERROR] [Workflow %s] %s %v", l.workflowID, msg, keyvals)
 }
-
-// generateActivityID generates a unique activity ID
-func generateActivityID() string {
-	return fmt.Sprintf("act-%d", time.Now().UnixNano())
-}
@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+func TestContinueAsNew_ChainsRuns(t *testing.T) {
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+
+	reg := workflow.NewRegistry()
+	reg.Register(&workflow.Definition{Name: "counter", Options: workflow.Options{TaskQueue: "default"}, Workflow: workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+		n := int(in.(float64))
+		if n < 3 {
+			return nil, ctx.ContinueAsNew(n + 1)
+		}
+		return n, nil
+	})})
+	eng, err := New(Config{StateStore: store, Queue: q, WorkflowRegistry: reg})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer eng.Stop()
+	ctx := context.Background()
+
+	firstID, err := eng.StartWorkflow(ctx, "counter", 0)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	var latest *state.WorkflowState
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		runID, err := eng.GetLatestRunID(ctx, firstID)
+		if err == nil {
+			latest, _ = eng.GetWorkflowStatus(ctx, runID)
+			if latest != nil && latest.Status == state.StatusCompleted {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if latest == nil || latest.Status != state.StatusCompleted || latest.Output != float64(3) {
+		t.Fatalf("expected final run to complete with 3, got %+v", latest)
+	}
+	if latest.WorkflowID == firstID || latest.LogicalWorkflowID() != firstID {
+		t.Fatalf("expected new run ID with same logical ID, got run=%s logical=%s", latest.WorkflowID, latest.LogicalWorkflowID())
+	}
+
+	first, _ := eng.GetWorkflowStatus(ctx, firstID)
+	if first.Status != state.StatusContinuedAsNew || first.ContinuedAsNewRunID == "" || first.LatestRunID != latest.WorkflowID {
+		t.Fatalf("unexpected first run state: %+v", first)
+	}
+
+	// Each run has its own bounded history.
+	firstEvents, _ := store.GetEvents(ctx, firstID)
+	if len(firstEvents) != 2 || firstEvents[1].Type != state.EventWorkflowContinuedAsNew {
+		t.Fatalf("expected started + continued_as_new in first run, got %d events", len(firstEvents))
+	}
+	latestEvents, _ := store.GetEvents(ctx, latest.WorkflowID)
+	if len(latestEvents) != 2 || latestEvents[0].Type != state.EventWorkflowStarted || latestEvents[1].Type != state.EventWorkflowCompleted {
+		t.Fatalf("expected started + completed in latest run, got %d events", len(latestEvents))
+	}
+}
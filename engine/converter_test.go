@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/KamdynS/marathon/activity"
+	"github.com/KamdynS/marathon/converter"
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/worker"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+func TestDataConverter_MsgPackEndToEnd(t *testing.T) {
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+	ctx := context.Background()
+	dc := converter.MsgPackConverter{}
+
+	var activityInput interface{}
+	actReg := activity.NewRegistry()
+	actReg.Register("greet", activity.ActivityFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		activityInput = input
+		return greeting{Text: "hi", Count: 1}, nil
+	}), activity.Info{})
+
+	var workflowInput interface{}
+	reg := workflow.NewRegistry()
+	reg.Register(&workflow.Definition{Name: "msgpack", Options: workflow.Options{TaskQueue: "default"}, Workflow: workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+		workflowInput = in
+		g, err := workflow.ExecuteActivity[greeting, greeting](ctx, "greet", greeting{Text: "in"}).Result(ctx)
+		if err != nil {
+			return nil, err
+		}
+		g.Count++
+		return g, nil
+	})})
+
+	w, err := worker.New(worker.Config{Queue: q, QueueName: "default", ActivityRegistry: actReg, StateStore: store, MaxConcurrent: 1, PollInterval: 20 * time.Millisecond, DataConverter: dc})
+	if err != nil {
+		t.Fatalf("worker: %v", err)
+	}
+	w.Start(ctx)
+	defer func() {
+		stopCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		w.Stop(stopCtx)
+	}()
+
+	eng, err := New(Config{StateStore: store, Queue: q, WorkflowRegistry: reg, DataConverter: dc})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer eng.Stop()
+
+	id, err := eng.StartWorkflow(ctx, "msgpack", greeting{Text: "start"})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	st := waitForStatus(t, eng, id, 5*time.Second)
+	if st.Status != state.StatusCompleted {
+		t.Fatalf("expected completed, got %s (%s)", st.Status, st.Error)
+	}
+
+	// Recorded values are msgpack payloads, exactly as an external store holds them
+	if p, ok := st.Output.(*converter.Payload); !ok || p.Encoding != converter.EncodingMsgPack {
+		t.Fatalf("expected msgpack payload output, got %#v", st.Output)
+	}
+	var got greeting
+	if err := converter.Assign(dc, st.Output, &got); err != nil || got.Text != "hi" || got.Count != 2 {
+		t.Fatalf("unexpected output %+v (%v)", got, err)
+	}
+
+	// Workflow and activity functions see generic decoded values
+	if m, ok := workflowInput.(map[string]interface{}); !ok || m["text"] != "start" {
+		t.Fatalf("expected decoded workflow input, got %#v", workflowInput)
+	}
+	if m, ok := activityInput.(map[string]interface{}); !ok || m["text"] != "in" {
+		t.Fatalf("expected decoded activity input, got %#v", activityInput)
+	}
+}
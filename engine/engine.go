@@ -3,26 +3,50 @@ package engine
 
 import (
     "context"
+    "errors"
     "fmt"
     "log"
+    "strings"
     "sync"
+    "sync/atomic"
     "time"
 
-    "github.com/KamdynS/marathon/queue"
+    "github.com/KamdynS/marathon/converter"
+	"github.com/KamdynS/marathon/queue"
     "github.com/KamdynS/marathon/state"
     "github.com/KamdynS/marathon/workflow"
 )
 
+var (
+	// ErrWorkflowNotFound is returned for a workflow the state store has no
+	// record of
+	ErrWorkflowNotFound = errors.New("workflow not found")
+	// ErrWorkflowClosed is returned for a workflow that has already reached a
+	// terminal state
+	ErrWorkflowClosed = errors.New("workflow closed")
+	// ErrQueryNotFound is returned for a query the workflow has registered no
+	// handler for
+	ErrQueryNotFound = errors.New("query handler not registered")
+)
+
 // Engine coordinates workflow execution
 type Engine struct {
 	stateStore       state.Store
 	queue            queue.Queue
 	workflowRegistry *workflow.Registry
+	dataConverter    converter.DataConverter
 	runningWorkflows sync.Map // workflowID -> *executionContext
 	mu               sync.Mutex
+	scheduleMu       sync.Mutex // serializes schedule updates made by this engine
     timerCtx         context.Context
     timerCancel      context.CancelFunc
     timerInterval    time.Duration
+	// id identifies the engine as the owner of workflow leases
+	id                string
+	leaseSeq          atomic.Int64
+	workflowTaskQueue string
+	workflowTaskIdle  time.Duration
+	taskTokenSecret   []byte
 }
 
 // Config holds engine configuration
@@ -30,6 +54,20 @@ type Config struct {
 	StateStore       state.Store
 	Queue            queue.Queue
 	WorkflowRegistry *workflow.Registry
+	// DataConverter decodes results for Future.Get; defaults to JSON
+	DataConverter converter.DataConverter
+	// WorkflowTaskQueue, if set, dispatches workflow executions as workflow
+	// tasks on this queue instead of running them in this engine. Workers
+	// with a worker.WorkflowExecutor, typically an engine configured with
+	// the same queue, run them; see ExecuteWorkflowTask.
+	WorkflowTaskQueue string
+	// WorkflowTaskIdleTimeout is how long a workflow task keeps a workflow
+	// that waits on pending results before releasing it; defaults to
+	// DefaultWorkflowTaskIdleTimeout
+	WorkflowTaskIdleTimeout time.Duration
+	// TaskTokenSecret verifies the task tokens passed to CompleteActivity and
+	// FailActivity; it must match worker.Config.TaskTokenSecret
+	TaskTokenSecret []byte
 }
 
 // New creates a new workflow engine
@@ -48,13 +86,32 @@ func New(cfg Config) (*Engine, error) {
 		stateStore:       cfg.StateStore,
 		queue:            cfg.Queue,
 		workflowRegistry: cfg.WorkflowRegistry,
+		dataConverter:    cfg.DataConverter,
         timerInterval:    200 * time.Millisecond,
+		id:                fmt.Sprintf("engine-%d", time.Now().UnixNano()),
+		workflowTaskQueue: cfg.WorkflowTaskQueue,
+		workflowTaskIdle:  cfg.WorkflowTaskIdleTimeout,
+		taskTokenSecret:   cfg.TaskTokenSecret,
     }
+    if e.dataConverter == nil {
+        e.dataConverter = converter.Default()
+    }
+	if e.workflowTaskIdle <= 0 {
+		e.workflowTaskIdle = DefaultWorkflowTaskIdleTimeout
+	}
 
     // start timer scanner
     e.timerCtx, e.timerCancel = context.WithCancel(context.Background())
     go e.scanTimersLoop()
 
+    // re-drive workflows left running by a previous process
+    go func() {
+        if _, err := e.ResumeWorkflows(e.timerCtx); err != nil {
+            log.Printf("[Engine] Failed to resume workflows: %v", err)
+        }
+        e.resumeSchedules(e.timerCtx)
+    }()
+
     return e, nil
 }
 
@@ -66,15 +123,32 @@ func (e *Engine) StartWorkflow(ctx context.Context, workflowName string, input i
 // StartWorkflowOptions configures workflow start behavior.
 type StartWorkflowOptions struct {
     IdempotencyKey string
+    // Version pins the run to a registered definition version; the latest
+    // version is used if empty
+    Version string
+    // Priority and FairnessKey are given to the activity and workflow tasks
+    // the workflow and its children enqueue, so queues serve urgent
+    // workflows first and share workers fairly across keys such as tenants
+    Priority    int
+    FairnessKey string
 }
 
 // StartWorkflowWithOptions initiates a new workflow with options such as idempotency.
 func (e *Engine) StartWorkflowWithOptions(ctx context.Context, workflowName string, input interface{}, opts StartWorkflowOptions) (string, error) {
+	return e.startWorkflow(ctx, workflowName, input, opts, "")
+}
+
+// startWorkflow starts a top-level workflow, optionally on behalf of a schedule
+func (e *Engine) startWorkflow(ctx context.Context, workflowName string, input interface{}, opts StartWorkflowOptions, scheduleID string) (string, error) {
 	// Get workflow definition
-	def, err := e.workflowRegistry.Get(workflowName)
+	def, err := e.workflowRegistry.GetVersion(workflowName, opts.Version)
 	if err != nil {
 		return "", fmt.Errorf("workflow not found: %w", err)
 	}
+	input, err = converter.Normalize(e.dataConverter, input)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode input: %w", err)
+	}
 
     // Generate workflow ID up front
     workflowID := generateWorkflowID()
@@ -91,38 +165,314 @@ func (e *Engine) StartWorkflowWithOptions(ctx context.Context, workflowName stri
         }
     }
 
+	if err := e.createWorkflow(ctx, workflowID, workflowName, def, input, "", scheduleID, opts); err != nil {
+		return "", err
+	}
+
+	// Start execution asynchronously
+	e.runWorkflow(workflowID, def, input)
+
+	log.Printf("[Engine] Started workflow %s (%s)", workflowID, workflowName)
+
+	return workflowID, nil
+}
+
+// createWorkflow saves the initial state for a workflow and records its start event
+func (e *Engine) createWorkflow(ctx context.Context, workflowID string, workflowName string, def *workflow.Definition, input interface{}, parentWorkflowID string, scheduleID string, opts StartWorkflowOptions) error {
 	// Create initial state
 	workflowState := &state.WorkflowState{
-		WorkflowID:   workflowID,
-		WorkflowName: workflowName,
-		Status:       state.StatusPending,
-		Input:        input,
-		StartTime:    time.Now().UTC(),
-		TaskQueue:    def.Options.TaskQueue,
+		WorkflowID:       workflowID,
+		WorkflowName:     workflowName,
+		WorkflowVersion:  def.Version,
+		Status:           state.StatusPending,
+		Input:            input,
+		StartTime:        time.Now().UTC(),
+		TaskQueue:        def.Options.TaskQueue,
+		ParentWorkflowID: parentWorkflowID,
+		ScheduleID:       scheduleID,
+		Attempt:          1,
+		Priority:         opts.Priority,
+		FairnessKey:      opts.FairnessKey,
 	}
 
 	// Save initial state
 	if err := e.stateStore.SaveWorkflowState(ctx, workflowState); err != nil {
-		return "", fmt.Errorf("failed to save workflow state: %w", err)
+		return fmt.Errorf("failed to save workflow state: %w", err)
+	}
+
+	// Record workflow started event
+	data := map[string]interface{}{
+		"workflow_name":    workflowName,
+		"workflow_version": def.Version,
+		"input":            input,
+		"task_queue":       def.Options.TaskQueue,
+	}
+	if parentWorkflowID != "" {
+		data["parent_workflow_id"] = parentWorkflowID
+	}
+	if scheduleID != "" {
+		data["schedule_id"] = scheduleID
+	}
+	if opts.Priority != 0 {
+		data["priority"] = opts.Priority
+	}
+	if opts.FairnessKey != "" {
+		data["fairness_key"] = opts.FairnessKey
 	}
+	event := state.NewEvent(workflowID, state.EventWorkflowStarted, data)
 
-    // Record workflow started event
-	event := state.NewEvent(workflowID, state.EventWorkflowStarted, map[string]interface{}{
-		"workflow_name": workflowName,
-		"input":         input,
-		"task_queue":    def.Options.TaskQueue,
+	if err := e.stateStore.AppendEvent(ctx, event); err != nil {
+		return fmt.Errorf("failed to record start event: %w", err)
+	}
+
+	return nil
+}
+
+// startChildWorkflow creates and launches a child workflow linked to its parent
+// and records child_workflow_started in the parent's event log. It is safe to
+// call again for a child that was created before a crash. The child inherits
+// the priority and fairness key in opts from its parent.
+func (e *Engine) startChildWorkflow(ctx context.Context, parentWorkflowID string, childWorkflowID string, workflowName string, input interface{}, policy workflow.ParentClosePolicy, opts StartWorkflowOptions) error {
+	def, err := e.workflowRegistry.Get(workflowName)
+	if err != nil {
+		return fmt.Errorf("workflow not found: %w", err)
+	}
+	input, err = converter.Normalize(e.dataConverter, input)
+	if err != nil {
+		return fmt.Errorf("failed to encode input: %w", err)
+	}
+
+	existing, err := e.stateStore.GetWorkflowState(ctx, childWorkflowID)
+	if err != nil {
+		if err := e.createWorkflow(ctx, childWorkflowID, workflowName, def, input, parentWorkflowID, "", opts); err != nil {
+			return err
+		}
+		e.runWorkflow(childWorkflowID, def, input)
+	} else if !existing.IsComplete() {
+		if def, err = e.definitionFor(existing); err != nil {
+			return err
+		}
+		e.runWorkflow(childWorkflowID, def, existing.Input)
+	}
+
+	if policy == "" {
+		policy = workflow.ParentClosePolicyTerminate
+	}
+	event := state.NewEvent(parentWorkflowID, state.EventChildWorkflowStarted, map[string]interface{}{
+		"child_workflow_id":   childWorkflowID,
+		"workflow_name":       workflowName,
+		"input":               input,
+		"parent_close_policy": string(policy),
 	})
+	if err := e.stateStore.AppendEvent(ctx, event); err != nil {
+		return fmt.Errorf("failed to record child start event: %w", err)
+	}
+
+	log.Printf("[Engine] Started child workflow %s (%s) of %s", childWorkflowID, workflowName, parentWorkflowID)
+
+	return nil
+}
+
+// continueAsNew closes the current run with a workflow_continued_as_new event
+// and atomically creates a fresh run of the same workflow, then executes it.
+func (e *Engine) continueAsNew(ctx context.Context, current *state.WorkflowState, def *workflow.Definition, input interface{}) {
+	// Respect a cancellation that raced with the end of the run
+	if latest, err := e.stateStore.GetWorkflowState(ctx, current.WorkflowID); err == nil && latest.Status == state.StatusCanceled {
+		return
+	}
 
+	firstRunID := current.LogicalWorkflowID()
+	nextRunID := generateRunID(firstRunID)
+
+	current.Status = state.StatusContinuedAsNew
+	current.ContinuedAsNewRunID = nextRunID
+	closedEvent := state.NewEvent(current.WorkflowID, state.EventWorkflowContinuedAsNew, map[string]interface{}{
+		"new_run_id": nextRunID,
+		"input":      input,
+	})
+
+	// The next run is saved as running so it is resumed if we crash before executing it
+	next := &state.WorkflowState{
+		WorkflowID:       nextRunID,
+		WorkflowName:     current.WorkflowName,
+		WorkflowVersion:  def.Version,
+		Status:           state.StatusRunning,
+		Input:            input,
+		StartTime:        time.Now().UTC(),
+		TaskQueue:        def.Options.TaskQueue,
+		ParentWorkflowID: current.ParentWorkflowID,
+		ScheduleID:       current.ScheduleID,
+		FirstRunID:       firstRunID,
+		Attempt:          1,
+		Priority:         current.Priority,
+		FairnessKey:      current.FairnessKey,
+	}
+	startEvent := state.NewEvent(nextRunID, state.EventWorkflowStarted, map[string]interface{}{
+		"workflow_name":     current.WorkflowName,
+		"workflow_version":  def.Version,
+		"input":             input,
+		"task_queue":        def.Options.TaskQueue,
+		"first_run_id":      firstRunID,
+		"continued_from_id": current.WorkflowID,
+	})
+
+	if err := e.stateStore.ContinueAsNew(ctx, current, closedEvent, next, startEvent); err != nil {
+		current.Status = state.StatusFailed
+		current.Error = fmt.Sprintf("failed to continue as new: %v", err)
+		current.ContinuedAsNewRunID = ""
+		e.stateStore.AppendEvent(ctx, state.NewEvent(current.WorkflowID, state.EventWorkflowFailed, map[string]interface{}{"error": current.Error}))
+		e.stateStore.SaveWorkflowState(ctx, current)
+		e.closeWorkflow(ctx, current)
+		log.Printf("[Engine] Workflow %s failed to continue as new: %v", current.WorkflowID, err)
+		return
+	}
+
+	// Maintain the shortcut from the logical workflow ID to the latest run
+	if first, err := e.stateStore.GetWorkflowState(ctx, firstRunID); err == nil {
+		first.LatestRunID = nextRunID
+		e.stateStore.SaveWorkflowState(ctx, first)
+	}
+
+	// Children of the closed run are subject to its parent close policies
+	e.applyParentClosePolicies(ctx, current.WorkflowID)
+
+	log.Printf("[Engine] Workflow %s continued as new run %s", firstRunID, nextRunID)
+
+	e.runWorkflow(nextRunID, def, input)
+}
+
+// GetLatestRunID follows the continue-as-new chain from a workflow or run ID
+// to the ID of the most recent run.
+func (e *Engine) GetLatestRunID(ctx context.Context, workflowID string) (string, error) {
+	st, err := e.stateStore.GetWorkflowState(ctx, workflowID)
+	if err != nil {
+		return "", err
+	}
+	// Jump ahead via the first run's shortcut; the chain below stays authoritative
+	if st.LatestRunID != "" {
+		if latest, err := e.stateStore.GetWorkflowState(ctx, st.LatestRunID); err == nil {
+			st = latest
+		}
+	}
+	for st.ContinuedAsNewRunID != "" {
+		next, err := e.stateStore.GetWorkflowState(ctx, st.ContinuedAsNewRunID)
+		if err != nil {
+			return "", fmt.Errorf("failed to follow run chain: %w", err)
+		}
+		st = next
+	}
+	return st.WorkflowID, nil
+}
+
+// definitionFor returns the definition version a run is pinned to. Runs
+// recorded without a version use the latest.
+func (e *Engine) definitionFor(st *state.WorkflowState) (*workflow.Definition, error) {
+	def, err := e.workflowRegistry.GetVersion(st.WorkflowName, st.WorkflowVersion)
+	if err != nil {
+		return nil, fmt.Errorf("workflow not found: %w", err)
+	}
+	return def, nil
+}
+
+// getWorkflowState loads a workflow's state, translating the store's
+// state.ErrWorkflowNotFound into ErrWorkflowNotFound.
+func (e *Engine) getWorkflowState(ctx context.Context, workflowID string) (*state.WorkflowState, error) {
+	st, err := e.stateStore.GetWorkflowState(ctx, workflowID)
+	if errors.Is(err, state.ErrWorkflowNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrWorkflowNotFound, workflowID)
+	}
+	return st, err
+}
+
+// closeWorkflow runs bookkeeping for a workflow that reached a terminal state:
+// the parent, if any, is notified and the workflow's own parent close
+// policies are applied to children that are still running.
+func (e *Engine) closeWorkflow(ctx context.Context, workflowState *state.WorkflowState) {
+	e.notifyParent(ctx, workflowState)
+	e.applyParentClosePolicies(ctx, workflowState.WorkflowID)
+	if workflowState.ScheduleID != "" {
+		e.startBufferedRun(ctx, workflowState.ScheduleID)
+	}
+}
+
+// notifyParent records the child's outcome in its parent's event log.
+func (e *Engine) notifyParent(ctx context.Context, child *state.WorkflowState) {
+	if child.ParentWorkflowID == "" || child.Status == state.StatusContinuedAsNew {
+		return
+	}
+
+	var endTime time.Time
+	if child.EndTime != nil {
+		endTime = *child.EndTime
+	}
+	var event *state.Event
+	if child.Status == state.StatusCompleted {
+		event = state.NewEventAt(child.ParentWorkflowID, state.EventChildWorkflowCompleted, endTime, map[string]interface{}{
+			"child_workflow_id": child.LogicalWorkflowID(),
+			"output":            child.Output,
+		})
+	} else {
+		event = state.NewEventAt(child.ParentWorkflowID, state.EventChildWorkflowFailed, endTime, map[string]interface{}{
+			"child_workflow_id": child.LogicalWorkflowID(),
+			"error":             childWorkflowError(child).Error(),
+		})
+	}
 	if err := e.stateStore.AppendEvent(ctx, event); err != nil {
-		return "", fmt.Errorf("failed to record start event: %w", err)
+		log.Printf("[Engine] Failed to notify parent %s of child %s: %v", child.ParentWorkflowID, child.WorkflowID, err)
+		return
 	}
+	e.wakeWorkflow(ctx, child.ParentWorkflowID)
+}
 
-	// Start execution asynchronously
-	go e.executeWorkflow(context.Background(), workflowID, def, input)
+// applyParentClosePolicies terminates, cancels or abandons the still-running
+// children of a closed workflow according to the policy each was started with.
+func (e *Engine) applyParentClosePolicies(ctx context.Context, parentWorkflowID string) {
+	events, err := e.stateStore.GetEvents(ctx, parentWorkflowID)
+	if err != nil {
+		return
+	}
+	h := newHistory(events)
 
-	log.Printf("[Engine] Started workflow %s (%s)", workflowID, workflowName)
+	for childID, started := range h.childStarted {
+		if _, closed := h.childClosed[childID]; closed {
+			continue
+		}
+		if latest, err := e.GetLatestRunID(ctx, childID); err == nil {
+			childID = latest
+		}
+		child, err := e.stateStore.GetWorkflowState(ctx, childID)
+		if err != nil || child.IsComplete() {
+			continue
+		}
 
-	return workflowID, nil
+		switch workflow.ParentClosePolicy(eventString(started, "parent_close_policy")) {
+		case workflow.ParentClosePolicyAbandon:
+			continue
+		case workflow.ParentClosePolicyRequestCancel:
+			err = e.SignalWorkflow(ctx, childID, workflow.CancelRequestedSignal, nil)
+		default:
+			err = e.CancelWorkflow(ctx, childID)
+		}
+		if err != nil {
+			log.Printf("[Engine] Failed to apply parent close policy to child %s: %v", childID, err)
+		}
+	}
+}
+
+// childWorkflowError describes a child workflow that did not complete
+func childWorkflowError(child *state.WorkflowState) error {
+	switch child.Status {
+	case state.StatusCanceled:
+		return fmt.Errorf("child workflow %s canceled", child.LogicalWorkflowID())
+	case state.StatusTimedOut:
+		return fmt.Errorf("child workflow %s timed out", child.LogicalWorkflowID())
+	}
+	return fmt.Errorf("child workflow %s failed: %s", child.LogicalWorkflowID(), child.Error)
+}
+
+// DataConverter returns the converter used to encode payloads
+func (e *Engine) DataConverter() converter.DataConverter {
+	return e.dataConverter
 }
 
 // GetWorkflowStatus retrieves the current status of a workflow
@@ -152,6 +502,28 @@ func (e *Engine) CancelWorkflow(ctx context.Context, workflowID string) error {
 		return fmt.Errorf("workflow already completed")
 	}
 
+	// A workflow executing in this engine, or run as workflow tasks, is
+	// interrupted and closes as canceled once it has unwound, so cleanup
+	// such as saga compensations runs while it is still open
+	resident, _ := e.runningWorkflows.Load(workflowID)
+	if resident != nil || e.workflowTaskQueue != "" {
+		workflowState.CancelRequested = true
+		if err := e.stateStore.SaveWorkflowState(ctx, workflowState); err != nil {
+			return err
+		}
+		event := state.NewEvent(workflowID, state.EventWorkflowCancelRequested, nil)
+		if err := e.stateStore.AppendEvent(ctx, event); err != nil {
+			return err
+		}
+		if resident != nil {
+			resident.(*executionContext).abort(&workflow.CanceledError{})
+		} else {
+			e.wakeWorkflow(ctx, workflowID)
+		}
+		log.Printf("[Engine] Requested cancellation of workflow %s", workflowID)
+		return nil
+	}
+
 	// Update state to canceled
 	now := time.Now().UTC()
 	workflowState.Status = state.StatusCanceled
@@ -167,49 +539,273 @@ func (e *Engine) CancelWorkflow(ctx context.Context, workflowID string) error {
 		return err
 	}
 
+	// An execution resident in another engine notices the status change
+
+	// Propagate to parent and children
+	e.closeWorkflow(ctx, workflowState)
+
 	log.Printf("[Engine] Canceled workflow %s", workflowID)
 
 	return nil
 }
 
-// executeWorkflow runs a workflow to completion
-func (e *Engine) executeWorkflow(ctx context.Context, workflowID string, def *workflow.Definition, input interface{}) {
-    // Small delay to allow immediate cancellation to take effect deterministically in tests
-    time.Sleep(10 * time.Millisecond)
-	// Create execution context
-	execCtx := newExecutionContext(workflowID, e.queue, e.stateStore, def.Options.TaskQueue)
+// ResumeWorkflows re-drives workflows left in StatusRunning, e.g. after a
+// process restart. Each workflow is re-executed against its event history, so
+// completed activities and fired timers are replayed rather than re-issued.
+// It returns the number of workflows resumed.
+func (e *Engine) ResumeWorkflows(ctx context.Context) (int, error) {
+	running, err := e.stateStore.ListWorkflows(ctx, state.StatusRunning)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list running workflows: %w", err)
+	}
+
+	resumed := 0
+	for _, wf := range running {
+		if _, active := e.runningWorkflows.Load(wf.WorkflowID); active {
+			continue
+		}
+		def, err := e.definitionFor(wf)
+		if err != nil {
+			log.Printf("[Engine] Cannot resume workflow %s: %v", wf.WorkflowID, err)
+			continue
+		}
+		e.runWorkflow(wf.WorkflowID, def, wf.Input)
+		resumed++
+		log.Printf("[Engine] Resuming workflow %s (%s)", wf.WorkflowID, wf.WorkflowName)
+	}
+
+	return resumed, nil
+}
+
+// SignalWorkflow delivers an external signal to a running workflow. The signal
+// is recorded durably as a signal_received event and consumed by the workflow
+// through workflow.Context.ReceiveSignal. It returns an error wrapping
+// ErrWorkflowNotFound for an unknown workflow and ErrWorkflowClosed for one
+// that has already closed.
+func (e *Engine) SignalWorkflow(ctx context.Context, workflowID string, signalName string, payload interface{}) error {
+	if signalName == "" {
+		return fmt.Errorf("signal name is required")
+	}
 
-	// Update state to running
-    workflowState, _ := e.stateStore.GetWorkflowState(ctx, workflowID)
-    if workflowState.Status == state.StatusCanceled {
-        // Respect cancellation before execution begins
-        return
-    }
-    if workflowState.Status != state.StatusRunning {
-        workflowState.Status = state.StatusRunning
-        e.stateStore.SaveWorkflowState(ctx, workflowState)
-    }
+	workflowState, err := e.getWorkflowState(ctx, workflowID)
+	if err != nil {
+		return err
+	}
+
+	if workflowState.IsComplete() {
+		return fmt.Errorf("%w: %s is %s", ErrWorkflowClosed, workflowID, workflowState.Status)
+	}
+
+	payload, err = converter.Normalize(e.dataConverter, payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode signal payload: %w", err)
+	}
+
+	event := state.NewEvent(workflowID, state.EventSignalReceived, map[string]interface{}{
+		"signal_name": signalName,
+		"payload":     payload,
+	})
+	if err := e.stateStore.AppendEvent(ctx, event); err != nil {
+		return fmt.Errorf("failed to record signal: %w", err)
+	}
+	e.wakeWorkflow(ctx, workflowID)
+
+	log.Printf("[Engine] Signaled workflow %s (%s)", workflowID, signalName)
+
+	return nil
+}
+
+// QueryWorkflow invokes a query handler registered by a workflow through
+// workflow.Context.SetQueryHandler. Workflows resident in this engine are
+// queried directly; otherwise the workflow is replayed from its event history
+// without side effects until it completes or waits on an unrecorded result,
+// and the query is answered from the replayed state.
+//
+// It returns an error wrapping ErrWorkflowNotFound for an unknown workflow,
+// ErrQueryNotFound if the workflow has no handler for the query, and
+// ErrWorkflowClosed for a closed workflow that can no longer be replayed
+// because its definition is not registered.
+func (e *Engine) QueryWorkflow(ctx context.Context, workflowID string, queryName string, args interface{}) (interface{}, error) {
+	if v, ok := e.runningWorkflows.Load(workflowID); ok {
+		return v.(*executionContext).handleQuery(queryName, args)
+	}
+
+	workflowState, err := e.getWorkflowState(ctx, workflowID)
+	if err != nil {
+		return nil, err
+	}
+	def, err := e.definitionFor(workflowState)
+	if err != nil {
+		if workflowState.IsComplete() {
+			return nil, fmt.Errorf("%w: %s is %s and cannot be replayed: %v", ErrWorkflowClosed, workflowID, workflowState.Status, err)
+		}
+		return nil, err
+	}
+	events, err := e.stateStore.GetEvents(ctx, workflowID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load history: %w", err)
+	}
 
-	// Set execution timeout if specified
-	if def.Options.ExecutionTimeout > 0 {
+	replayCtx := newReplayContext(workflowID, e.stateStore, def.Options.TaskQueue, events)
+	replayCtx.dataConverter = e.dataConverter
+	defer replayCtx.abandon()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		input, err := converter.Value(e.dataConverter, workflowState.Input)
+		if err != nil {
+			return
+		}
+		def.Workflow.Execute(replayCtx, input)
+	}()
+
+	select {
+	case <-done:
+	case <-replayCtx.blocked:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return replayCtx.handleQuery(queryName, args)
+}
+
+// executeWorkflow runs a workflow to completion, replaying any recorded
+// history. Executions run by a workflow task (wt != nil) are released instead
+// when they wait on pending results for the idle timeout.
+func (e *Engine) executeWorkflow(ctx context.Context, workflowID string, def *workflow.Definition, input interface{}, wt *workflowTask) {
+	// A retry begins once its backoff timer has fired; a workflow task
+	// leaves it to the timer to dispatch the next one
+	if !e.awaitRetry(ctx, workflowID, wt == nil) {
+		return
+	}
+
+	// Load recorded history for replay
+	events, err := e.stateStore.GetEvents(ctx, workflowID)
+	if err != nil {
+		log.Printf("[Engine] Failed to load history for workflow %s: %v", workflowID, err)
+		return
+	}
+
+	workflowState, err := e.stateStore.GetWorkflowState(ctx, workflowID)
+	if err != nil {
+		log.Printf("[Engine] Failed to load workflow %s: %v", workflowID, err)
+		return
+	}
+	if workflowState.IsComplete() {
+		// Respect cancellation before execution begins
+		return
+	}
+
+	// Create execution context. Its context is canceled with a typed cause
+	// when the workflow is canceled or runs past its execution timeout.
+	execCtx := newExecutionContext(workflowID, e.queue, e.stateStore, def.Options.TaskQueue, events)
+	execCtx.engine = e
+	execCtx.dataConverter = e.dataConverter
+	execCtx.priority = workflowState.Priority
+	execCtx.fairnessKey = workflowState.FairnessKey
+	runCtx, abort := context.WithCancelCause(context.Background())
+	defer abort(nil)
+	if timeout := def.Options.ExecutionTimeout; timeout > 0 {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, def.Options.ExecutionTimeout)
+		runCtx, cancel = context.WithDeadlineCause(runCtx, workflowState.StartTime.Add(timeout), &workflow.TimeoutError{Timeout: timeout})
 		defer cancel()
 	}
+	execCtx.Context = runCtx
+	execCtx.abort = abort
+	lifetime, endLifetime := context.WithCancel(context.Background())
+	defer endLifetime()
+	execCtx.lifetime = lifetime
+	if wt != nil {
+		execCtx.task = wt
+		execCtx.idleTimeout = e.workflowTaskIdle
+	}
+
+	// Only one execution per workflow may be resident in this engine
+	if existing, loaded := e.runningWorkflows.LoadOrStore(workflowID, execCtx); loaded {
+		// The resident execution picks up new events itself; one that is
+		// being released is dispatched again
+		if wt != nil && !existing.(*executionContext).wake() {
+			e.redispatchWorkflowTask(workflowID)
+		}
+		return
+	}
+	// A retry started below registers its own execution, which must outlive
+	// this one's registration
+	defer e.runningWorkflows.CompareAndDelete(workflowID, execCtx)
+	go e.watchCancellation(runCtx, workflowID, abort)
+	if wt != nil {
+		go e.releaseWhenIdle(ctx, execCtx, abort)
+	}
+	if workflowState.CancelRequested {
+		abort(&workflow.CanceledError{})
+	}
+
+	// Update state to running
+	if workflowState.Status != state.StatusRunning {
+		workflowState.Status = state.StatusRunning
+		e.stateStore.SaveWorkflowState(ctx, workflowState)
+	}
 
 	// Execute the workflow
-	output, err := def.Workflow.Execute(execCtx, input)
+	input, err = converter.Value(e.dataConverter, input)
+	var output interface{}
+	if err == nil {
+		output, err = def.Workflow.Execute(execCtx, input)
+	}
+	if err == nil {
+		output, err = converter.Normalize(e.dataConverter, output)
+	}
+
+	// A released workflow continues in a later workflow task
+	if errors.Is(context.Cause(runCtx), errWorkflowTaskReleased) {
+		log.Printf("[Engine] Released workflow %s until new events arrive", workflowID)
+		return
+	}
 
 	// Update final state
 	now := time.Now().UTC()
 	workflowState.EndTime = &now
 
-	if err != nil {
-		// If workflow was canceled meanwhile, do not override to failed
-		current, _ := e.stateStore.GetWorkflowState(ctx, workflowID)
-		if current != nil && current.Status == state.StatusCanceled {
-			log.Printf("[Engine] Workflow %s canceled during execution", workflowID)
-			e.stateStore.SaveWorkflowState(ctx, current)
+	var continueErr *workflow.ContinueAsNewError
+	if errors.As(err, &continueErr) {
+		next, encErr := converter.Normalize(e.dataConverter, continueErr.Input)
+		if encErr == nil {
+			e.continueAsNew(ctx, workflowState, def, next)
+			return
+		}
+		err = fmt.Errorf("failed to encode continue-as-new input: %w", encErr)
+	}
+
+	// If workflow was canceled meanwhile, keep it canceled
+	if current, _ := e.stateStore.GetWorkflowState(ctx, workflowID); current != nil && current.Status == state.StatusCanceled {
+		log.Printf("[Engine] Workflow %s canceled during execution", workflowID)
+		return
+	}
+
+	var canceledErr *workflow.CanceledError
+	var timeoutErr *workflow.TimeoutError
+	if errors.As(context.Cause(runCtx), &canceledErr) {
+		workflowState.Status = state.StatusCanceled
+		workflowState.CancelRequested = true
+		event := state.NewEvent(workflowID, state.EventWorkflowCanceled, nil)
+		e.stateStore.AppendEvent(ctx, event)
+		log.Printf("[Engine] Canceled workflow %s", workflowID)
+	} else if err != nil && errors.As(context.Cause(runCtx), &timeoutErr) {
+		workflowState.Status = state.StatusTimedOut
+		workflowState.Error = timeoutErr.Error()
+		event := state.NewEvent(workflowID, state.EventWorkflowTimedOut, map[string]interface{}{
+			"timeout": timeoutErr.Timeout.String(),
+			"error":   err.Error(),
+		})
+		e.stateStore.AppendEvent(ctx, event)
+		log.Printf("[Engine] Workflow %s timed out after %s", workflowID, timeoutErr.Timeout)
+	} else if err != nil {
+		if e.retryWorkflow(ctx, workflowState, def.Options.RetryPolicy, err) {
+			// Unregister first, so the next attempt is not turned away as
+			// already resident
+			e.runningWorkflows.CompareAndDelete(workflowID, execCtx)
+			e.runWorkflow(workflowID, def, workflowState.Input)
 			return
 		}
 		workflowState.Status = state.StatusFailed
@@ -231,6 +827,25 @@ func (e *Engine) executeWorkflow(ctx context.Context, workflowID string, def *wo
 	}
 
 	e.stateStore.SaveWorkflowState(ctx, workflowState)
+	e.closeWorkflow(ctx, workflowState)
+}
+
+// watchCancellation aborts a live execution once the workflow is canceled,
+// or its cancellation requested, through any engine sharing the state store
+func (e *Engine) watchCancellation(runCtx context.Context, workflowID string, abort context.CancelCauseFunc) {
+	ticker := time.NewTicker(e.timerInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-runCtx.Done():
+			return
+		case <-ticker.C:
+			if st, err := e.stateStore.GetWorkflowState(runCtx, workflowID); err == nil && (st.Status == state.StatusCanceled || st.CancelRequested) {
+				abort(&workflow.CanceledError{})
+				return
+			}
+		}
+	}
 }
 
 // generateWorkflowID generates a unique workflow ID
@@ -238,6 +853,11 @@ func generateWorkflowID() string {
 	return fmt.Sprintf("wf-%d", time.Now().UnixNano())
 }
 
+// generateRunID generates a unique ID for a new run of a logical workflow
+func generateRunID(workflowID string) string {
+	return fmt.Sprintf("%s-run-%d", workflowID, time.Now().UnixNano())
+}
+
 // Stop stops background engine routines (e.g., timer scanner)
 func (e *Engine) Stop() {
     if e.timerCancel != nil {
@@ -263,12 +883,19 @@ func (e *Engine) scanTimersLoop() {
                 if err != nil || !transitioned {
                     continue
                 }
+                // Schedule timers start workflows instead of waking one
+                if scheduleID, ok := strings.CutPrefix(rec.WorkflowID, scheduleTimerPrefix); ok {
+                    e.fireSchedule(e.timerCtx, scheduleID, rec.TimerID)
+                    continue
+                }
                 // Append TimerFired event
                 evt := state.NewEvent(rec.WorkflowID, state.EventTimerFired, map[string]interface{}{
                     "timer_id": rec.TimerID,
                     "fire_at":  rec.FireAt,
                 })
-                _ = e.stateStore.AppendEvent(e.timerCtx, evt)
+                if err := e.stateStore.AppendEvent(e.timerCtx, evt); err == nil {
+                    e.wakeWorkflow(e.timerCtx, rec.WorkflowID)
+                }
             }
         }
     }
@@ -0,0 +1,156 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/KamdynS/marathon/state"
+)
+
+// history is a read-only index over the events recorded for a workflow before
+// the current execution began. The execution context consults it so that
+// ExecuteActivity, Sleep and Now return recorded results on replay instead of
+// re-issuing side effects.
+type history struct {
+	startTime         time.Time
+	activityScheduled map[string]*state.Event   // activityID -> activity_scheduled
+	activityCompleted map[string]*state.Event   // activityID -> activity_completed
+	timerScheduled    map[string]*state.Event   // timerID -> timer_scheduled
+	timerFired        map[string]*state.Event   // timerID -> timer_fired
+	signals           map[string][]*state.Event // signal name -> signal_received, in order
+	childStarted      map[string]*state.Event   // childWorkflowID -> child_workflow_started
+	childClosed       map[string]*state.Event   // childWorkflowID -> child_workflow_completed/failed
+	versions          map[string]*state.Event   // changeID -> version_marker
+	localActivities   map[string]*state.Event   // localActivityID -> local_activity_completed/failed
+	// attempt is the workflow attempt the history belongs to and retry the
+	// workflow_retrying event that began it, if any. Signals carry over
+	// between attempts; all other decisions start afresh.
+	attempt int
+	retry   *state.Event
+	// lastSeq is the sequence number of the last indexed event, where waits
+	// for events that are not in the history resume reading the log
+	lastSeq int64
+}
+
+// newHistory indexes the given events by activity and timer ID.
+func newHistory(events []*state.Event) *history {
+	h := &history{attempt: 1, signals: make(map[string][]*state.Event)}
+	h.reset()
+	for _, e := range events {
+		if e.SequenceNum > h.lastSeq {
+			h.lastSeq = e.SequenceNum
+		}
+		switch e.Type {
+		case state.EventWorkflowStarted:
+			if h.startTime.IsZero() {
+				h.startTime = e.Timestamp
+			}
+		case state.EventWorkflowRetrying:
+			h.reset()
+			h.retry = e
+			if attempt, ok := eventInt(e, "attempt"); ok {
+				h.attempt = attempt
+			}
+			if at, ok := eventTime(e, "retry_at"); ok {
+				h.startTime = at
+			}
+		case state.EventActivityScheduled:
+			if id := eventString(e, "activity_id"); id != "" {
+				h.activityScheduled[id] = e
+			}
+		case state.EventActivityCompleted:
+			if id := eventString(e, "activity_id"); id != "" {
+				h.activityCompleted[id] = e
+			}
+		case state.EventTimerScheduled:
+			if id := eventString(e, "timer_id"); id != "" {
+				h.timerScheduled[id] = e
+			}
+		case state.EventTimerFired:
+			if id := eventString(e, "timer_id"); id != "" {
+				h.timerFired[id] = e
+			}
+		case state.EventChildWorkflowStarted:
+			if id := eventString(e, "child_workflow_id"); id != "" {
+				h.childStarted[id] = e
+			}
+		case state.EventChildWorkflowCompleted, state.EventChildWorkflowFailed:
+			if id := eventString(e, "child_workflow_id"); id != "" {
+				h.childClosed[id] = e
+			}
+		case state.EventLocalActivityCompleted, state.EventLocalActivityFailed:
+			if id := eventString(e, "local_activity_id"); id != "" {
+				h.localActivities[id] = e
+			}
+		case state.EventVersionMarker:
+			if id := eventString(e, "change_id"); id != "" {
+				h.versions[id] = e
+			}
+		case state.EventSignalReceived:
+			if name := eventString(e, "signal_name"); name != "" {
+				h.signals[name] = append(h.signals[name], e)
+			}
+		}
+	}
+	return h
+}
+
+// reset drops the decisions recorded by an earlier attempt
+func (h *history) reset() {
+	h.activityScheduled = make(map[string]*state.Event)
+	h.activityCompleted = make(map[string]*state.Event)
+	h.timerScheduled = make(map[string]*state.Event)
+	h.timerFired = make(map[string]*state.Event)
+	h.childStarted = make(map[string]*state.Event)
+	h.childClosed = make(map[string]*state.Event)
+	h.versions = make(map[string]*state.Event)
+	h.localActivities = make(map[string]*state.Event)
+}
+
+// commands returns the number of recorded workflow decisions: scheduled
+// activities and timers, started children, version markers and local
+// activities.
+func (h *history) commands() int {
+	return len(h.activityScheduled) + len(h.timerScheduled) + len(h.childStarted) + len(h.versions) + len(h.localActivities)
+}
+
+// eventString returns a string field from event data, or "" if absent.
+func eventString(e *state.Event, key string) string {
+	if e == nil || e.Data == nil {
+		return ""
+	}
+	s, _ := e.Data[key].(string)
+	return s
+}
+
+// eventInt returns an integer field from event data. Stores that round-trip
+// through JSON return float64 rather than int values.
+func eventInt(e *state.Event, key string) (int, bool) {
+	if e == nil || e.Data == nil {
+		return 0, false
+	}
+	switch v := e.Data[key].(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	}
+	return 0, false
+}
+
+// eventTime returns a time field from event data. Stores that round-trip
+// through JSON return RFC3339 strings rather than time.Time values.
+func eventTime(e *state.Event, key string) (time.Time, bool) {
+	if e == nil || e.Data == nil {
+		return time.Time{}, false
+	}
+	switch v := e.Data[key].(type) {
+	case time.Time:
+		return v, true
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
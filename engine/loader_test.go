@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KamdynS/marathon/activity"
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/worker"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+const pipelineDoc = `
+name: tag-docs
+steps:
+  - activity: split
+    name: docs
+    input: "{{.Input.docs}}"
+  - for_each: "{{json .Prev}}"
+    do:
+      - activity: tag
+        input: "{{.Item}}"
+  - if: "{{eq (len .Steps.docs) 2}}"
+    then:
+      - activity: tag
+        input: "{{index .Prev 0}}+{{index .Prev 1}}"
+    else:
+      - activity: tag
+        input: too many
+`
+
+func TestLoadedWorkflow_Runs(t *testing.T) {
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+	ctx := context.Background()
+
+	actReg := activity.NewRegistry()
+	actReg.Register("split", activity.ActivityFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		return strings.Split(input.(string), ","), nil
+	}), activity.Info{})
+	actReg.Register("tag", activity.ActivityFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		return "#" + input.(string), nil
+	}), activity.Info{})
+
+	reg := workflow.NewRegistry()
+	if _, err := reg.Load([]byte(pipelineDoc), workflow.LoadOptions{Activities: actReg.List()}); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	w, err := worker.New(worker.Config{Queue: q, QueueName: "default", ActivityRegistry: actReg, StateStore: store, MaxConcurrent: 2, PollInterval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("worker: %v", err)
+	}
+	w.Start(ctx)
+	defer func() {
+		stopCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		w.Stop(stopCtx)
+	}()
+
+	eng, err := New(Config{StateStore: store, Queue: q, WorkflowRegistry: reg})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer eng.Stop()
+
+	id, err := eng.StartWorkflow(ctx, "tag-docs", map[string]interface{}{"docs": "a,b"})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	st := waitForStatus(t, eng, id, 20*time.Second)
+	if st.Status != state.StatusCompleted {
+		t.Fatalf("expected completed, got %s (%s)", st.Status, st.Error)
+	}
+	if want := "##a+#b"; st.Output != want {
+		t.Fatalf("expected %q, got %v", want, st.Output)
+	}
+}
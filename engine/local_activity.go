@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/KamdynS/marathon/converter"
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+// ExecuteLocalActivity implements workflow.Context. The function runs in a
+// goroutine of this execution, with retries and backoff applied in process;
+// only its final outcome is recorded, as a local_activity_completed or
+// local_activity_failed marker.
+func (ctx *executionContext) ExecuteLocalActivity(activityCtx context.Context, fn workflow.LocalActivityFunc, input interface{}) workflow.Future {
+	name := workflow.LocalActivityName(activityCtx, fn)
+	localID := ctx.generateLocalActivityID(name, input)
+
+	// On replay, return the recorded outcome without running fn again
+	if evt, ok := ctx.history.localActivities[localID]; ok {
+		ctx.markReplayed("local:" + localID)
+		future := ctx.newFuture(localID)
+		if evt.Type == state.EventLocalActivityCompleted {
+			future.setValueAt(evt.Data["output"], evt.Timestamp)
+		} else {
+			future.setErrorAt(fmt.Errorf("local activity failed: %s", eventString(evt, "error")), evt.Timestamp)
+		}
+		return future
+	}
+
+	if ctx.replayOnly {
+		return ctx.blockedFuture(localID)
+	}
+	if f := ctx.releasedFuture(localID); f != nil {
+		return f
+	}
+
+	// Running a local activity is progress, not idling on pending results
+	future := ctx.newFuture(localID)
+	future.onWait, future.onWaitDone = nil, nil
+	go ctx.runLocalActivity(activityCtx, localID, name, fn, input, future)
+	return future
+}
+
+// runLocalActivity runs a local activity until it succeeds, fails with an
+// error its retry policy does not retry, or runs out of attempts, then
+// records the outcome and resolves future
+func (ctx *executionContext) runLocalActivity(activityCtx context.Context, localID, name string, fn workflow.LocalActivityFunc, input interface{}, future *futureImpl) {
+	opts := workflow.GetLocalActivityOptions(activityCtx)
+	policy := opts.RetryPolicy
+	if policy == nil {
+		policy = workflow.DefaultLocalActivityRetryPolicy()
+	}
+
+	var output interface{}
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		output, err = ctx.callLocalActivity(activityCtx, opts.Timeout, fn, input)
+		if err == nil {
+			// Return the value in the form replays read it back
+			output, err = converter.Normalize(ctx.dataConverter, output)
+		}
+		if err == nil || attempt >= policy.MaxAttempts || !policy.IsRetryable(err) {
+			break
+		}
+		backoff := policy.Backoff(attempt + 1)
+		log.Printf("[Context] Local activity %s attempt %d failed, retrying in %s: %v", localID, attempt, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-activityCtx.Done():
+			err = context.Cause(activityCtx)
+		case <-ctx.Done():
+			err = context.Cause(ctx)
+		}
+		if ctx.Err() != nil || activityCtx.Err() != nil {
+			break
+		}
+	}
+
+	now := time.Now().UTC()
+	data := map[string]interface{}{
+		"local_activity_id":   localID,
+		"local_activity_name": name,
+		"attempts":            attempt,
+	}
+	eventType := state.EventLocalActivityCompleted
+	if err != nil {
+		eventType = state.EventLocalActivityFailed
+		data["error"] = err.Error()
+	} else {
+		data["output"] = output
+	}
+	// An interrupted execution does not record the outcome, which may only
+	// reflect the interruption; the next execution runs the local activity
+	// again, so a released workflow is dispatched again for it
+	if ctx.Err() == nil {
+		event := state.NewEventAt(ctx.workflowID, eventType, now, data)
+		if appendErr := ctx.stateStore.AppendEvent(context.Background(), event); appendErr != nil {
+			future.setError(fmt.Errorf("failed to record local activity: %w", appendErr))
+			return
+		}
+	} else if ctx.isReleased() && ctx.engine != nil {
+		ctx.engine.wakeWorkflow(context.Background(), ctx.workflowID)
+	}
+
+	if err != nil {
+		future.setErrorAt(fmt.Errorf("local activity failed: %w", err), now)
+		return
+	}
+	future.setValueAt(output, now)
+}
+
+// callLocalActivity runs a single attempt of a local activity
+func (ctx *executionContext) callLocalActivity(activityCtx context.Context, timeout time.Duration, fn workflow.LocalActivityFunc, input interface{}) (output interface{}, err error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		activityCtx, cancel = context.WithTimeout(activityCtx, timeout)
+		defer cancel()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("local activity panicked: %v", r)
+		}
+	}()
+	return fn(activityCtx, input)
+}
+
+// generateLocalActivityID derives a stable local activity ID from the
+// function's name, a digest of the input and the number of identical calls
+// made so far, in the same way as generateActivityID.
+func (ctx *executionContext) generateLocalActivityID(name string, input interface{}) string {
+	digest := inputDigest(input)
+	n := ctx.nextSeq(fmt.Sprintf("local:%s:%08x", name, digest))
+	return ctx.attemptScoped(fmt.Sprintf("%s-local-%s-%08x-%d", ctx.workflowID, name, digest, n))
+}
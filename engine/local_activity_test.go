@@ -0,0 +1,176 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/worker"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+func TestLocalActivity_RetriesAndReplaysFromMarker(t *testing.T) {
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+	ctx := context.Background()
+
+	var calls atomic.Int32
+	render := func(ctx context.Context, in interface{}) (interface{}, error) {
+		if calls.Add(1) == 1 {
+			return nil, errors.New("flaky")
+		}
+		return "prompt for " + in.(string), nil
+	}
+	reject := func(ctx context.Context, in interface{}) (interface{}, error) {
+		return nil, workflow.NewNonRetryableError(errors.New("invalid json"))
+	}
+
+	reg := workflow.NewRegistry()
+	reg.Register(&workflow.Definition{Name: "local", Options: workflow.Options{TaskQueue: "default"},
+		Workflow: workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+			lctx := workflow.WithLocalActivityOptions(ctx, workflow.LocalActivityOptions{
+				RetryPolicy: &workflow.RetryPolicy{MaxAttempts: 3, InitialInterval: 10 * time.Millisecond, BackoffCoefficient: 2},
+			})
+			prompt, err := workflow.ExecuteLocalActivity(ctx, func(ctx context.Context, in string) (string, error) {
+				out, err := render(ctx, in)
+				s, _ := out.(string)
+				return s, err
+			}, in.(string)).Result(lctx)
+			if err != nil {
+				return nil, err
+			}
+			rejected := ctx.ExecuteLocalActivity(lctx, reject, prompt).Get(ctx, nil)
+			if rejected == nil || !strings.Contains(rejected.Error(), "invalid json") {
+				return nil, errors.New("expected the local activity to fail")
+			}
+			var name string
+			if err := ctx.ReceiveSignal("name").Get(ctx, &name); err != nil {
+				return nil, err
+			}
+			return prompt + " by " + name, nil
+		})})
+
+	// Run workflow tasks so the signal replays the workflow from history
+	server, err := New(Config{StateStore: store, Queue: q, WorkflowRegistry: reg, WorkflowTaskQueue: "workflows"})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer server.Stop()
+	runner, err := New(Config{StateStore: store, Queue: q, WorkflowRegistry: reg, WorkflowTaskQueue: "workflows", WorkflowTaskIdleTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer runner.Stop()
+	w, err := worker.New(worker.Config{Queue: q, QueueName: "workflows", WorkflowExecutor: runner, StateStore: store, PollInterval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("worker: %v", err)
+	}
+	w.Start(ctx)
+	defer w.Stop(ctx)
+
+	id, err := server.StartWorkflow(ctx, "local", "doc")
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if _, resident := runner.runningWorkflows.Load(id); !resident && calls.Load() == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the workflow to run its local activities and be released")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err := server.SignalWorkflow(ctx, id, "name", "marathon"); err != nil {
+		t.Fatalf("signal: %v", err)
+	}
+
+	st := waitForStatus(t, server, id, 3*time.Second)
+	if st.Status != state.StatusCompleted || st.Output != "prompt for doc by marathon" {
+		t.Fatalf("unexpected result: status=%s output=%v error=%s", st.Status, st.Output, st.Error)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("expected the replay not to run the local activity again, got %d calls", n)
+	}
+
+	events, _ := store.GetEvents(ctx, id)
+	markers := map[state.EventType]int{}
+	for _, e := range events {
+		switch e.Type {
+		case state.EventActivityScheduled:
+			t.Fatalf("expected no queued activities, got %+v", e)
+		case state.EventLocalActivityCompleted:
+			if attempts, _ := eventInt(e, "attempts"); attempts != 2 {
+				t.Fatalf("expected 2 attempts, got %+v", e.Data)
+			}
+			markers[e.Type]++
+		case state.EventLocalActivityFailed:
+			if attempts, _ := eventInt(e, "attempts"); attempts != 1 {
+				t.Fatalf("expected the non-retryable failure not to be retried, got %+v", e.Data)
+			}
+			markers[e.Type]++
+		}
+	}
+	if markers[state.EventLocalActivityCompleted] != 1 || markers[state.EventLocalActivityFailed] != 1 {
+		t.Fatalf("expected one marker of each kind, got %v", markers)
+	}
+}
+
+func upperLocal(ctx context.Context, in interface{}) (interface{}, error) {
+	return strings.ToUpper(in.(string)), nil
+}
+
+func lowerLocal(ctx context.Context, in interface{}) (interface{}, error) {
+	return strings.ToLower(in.(string)), nil
+}
+
+func typedUpperLocal(ctx context.Context, in string) (string, error) {
+	return strings.ToUpper(in), nil
+}
+
+func TestLocalActivity_IDIncludesFunctionName(t *testing.T) {
+	store := state.NewInMemoryStore()
+	ctx := context.Background()
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	first := newExecutionContext("wf-names", nil, store, "default", nil)
+	first.Context = runCtx
+	var out string
+	if err := first.ExecuteLocalActivity(runCtx, upperLocal, "In").Get(ctx, &out); err != nil || out != "IN" {
+		t.Fatalf("expected IN, got %q (%v)", out, err)
+	}
+	if out, err := workflow.ExecuteLocalActivity(first, typedUpperLocal, "In").Result(ctx); err != nil || out != "IN" {
+		t.Fatalf("expected IN, got %q (%v)", out, err)
+	}
+	events, _ := store.GetEvents(ctx, "wf-names")
+	var names []string
+	for _, e := range events {
+		if e.Type == state.EventLocalActivityCompleted {
+			names = append(names, eventString(e, "local_activity_name"))
+		}
+	}
+	if len(names) != 2 || names[0] != "engine.upperLocal" || names[1] != "engine.typedUpperLocal" {
+		t.Fatalf("expected the functions' names to be recorded, got %v", names)
+	}
+
+	// A replay calling another function with the same input does not get
+	// the recorded outcome of the first
+	replay := newExecutionContext("wf-names", nil, store, "default", events)
+	replay.Context = runCtx
+	if err := replay.ExecuteLocalActivity(runCtx, lowerLocal, "In").Get(ctx, &out); err != nil || out != "in" {
+		t.Fatalf("expected lowerLocal to run, got %q (%v)", out, err)
+	}
+	// An explicit name is used instead of the function's
+	named := workflow.WithLocalActivityOptions(runCtx, workflow.LocalActivityOptions{Name: "engine.upperLocal"})
+	if err := replay.ExecuteLocalActivity(named, lowerLocal, "In").Get(ctx, &out); err != nil || out != "IN" {
+		t.Fatalf("expected the outcome recorded under the name, got %q (%v)", out, err)
+	}
+}
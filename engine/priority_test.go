@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+func TestStartWorkflow_PlumbsPriorityAndFairnessKeyToTasks(t *testing.T) {
+	store := state.NewInMemoryStore()
+	var mu sync.Mutex
+	var tasks []*queue.Task
+	q := queue.NewInMemoryQueueWithOptions(queue.Options{Hooks: queue.Hooks{
+		OnEnqueue: func(queueName string, task *queue.Task) {
+			mu.Lock()
+			defer mu.Unlock()
+			tasks = append(tasks, task)
+		},
+	}})
+	defer q.Close()
+	ctx := context.Background()
+
+	reg := workflow.NewRegistry()
+	reg.Register(&workflow.Definition{Name: "parent", Options: workflow.Options{TaskQueue: "default"},
+		Workflow: workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+			child := ctx.ExecuteChildWorkflow(ctx, "child", nil, workflow.ChildWorkflowOptions{})
+			if err := ctx.ExecuteActivity(ctx, "parent-step", nil).Get(ctx, nil); err != nil {
+				return nil, err
+			}
+			return nil, child.Get(ctx, nil)
+		})})
+	reg.Register(&workflow.Definition{Name: "child", Options: workflow.Options{TaskQueue: "default"},
+		Workflow: workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+			return nil, ctx.ExecuteActivity(ctx, "child-step", nil).Get(ctx, nil)
+		})})
+	eng, err := New(Config{StateStore: store, Queue: q, WorkflowRegistry: reg})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer eng.Stop()
+
+	id, err := eng.StartWorkflowWithOptions(ctx, "parent", nil, StartWorkflowOptions{Priority: 5, FairnessKey: "tenant-a"})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if st, _ := store.GetWorkflowState(ctx, id); st.Priority != 5 || st.FairnessKey != "tenant-a" {
+		t.Fatalf("expected the workflow state to record priority and fairness key, got %d %q", st.Priority, st.FairnessKey)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		mu.Lock()
+		seen := map[string]*queue.Task{}
+		for _, task := range tasks {
+			seen[task.ActivityName] = task
+		}
+		mu.Unlock()
+		if len(seen) == 2 {
+			for name, task := range seen {
+				if task.Priority != 5 || task.FairnessKey != "tenant-a" {
+					t.Fatalf("expected %s task to have priority 5 and key tenant-a, got %d %q", name, task.Priority, task.FairnessKey)
+				}
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected parent and child activity tasks, got %v", seen)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+// stepWorkflow exposes its current step through a query and advances on signals.
+func stepWorkflow(ctx workflow.Context, in interface{}) (interface{}, error) {
+	step := "waiting"
+	if err := ctx.SetQueryHandler("step", func(args interface{}) (interface{}, error) {
+		return step, nil
+	}); err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := ctx.ReceiveSignal("advance").Get(ctx, &v); err != nil {
+		return nil, err
+	}
+	step = "advanced"
+	if err := ctx.ReceiveSignal("advance").Get(ctx, &v); err != nil {
+		return nil, err
+	}
+	step = "done"
+	return step, nil
+}
+
+func TestQueryWorkflow(t *testing.T) {
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+
+	reg := workflow.NewRegistry()
+	reg.Register(&workflow.Definition{Name: "wf-query", Workflow: workflow.WorkflowFunc(stepWorkflow), Options: workflow.Options{TaskQueue: "default"}})
+	eng, err := New(Config{StateStore: store, Queue: q, WorkflowRegistry: reg})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer eng.Stop()
+	ctx := context.Background()
+
+	t.Run("resident", func(t *testing.T) {
+		id, err := eng.StartWorkflow(ctx, "wf-query", nil)
+		if err != nil {
+			t.Fatalf("start: %v", err)
+		}
+		var got interface{}
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if got, err = eng.QueryWorkflow(ctx, id, "step", nil); err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if got != "waiting" {
+			t.Fatalf("expected waiting, got %v (%v)", got, err)
+		}
+		if _, err := eng.QueryWorkflow(ctx, id, "missing", nil); !errors.Is(err, ErrQueryNotFound) {
+			t.Fatalf("expected ErrQueryNotFound for unknown query, got %v", err)
+		}
+
+		eng.SignalWorkflow(ctx, id, "advance", nil)
+		eng.SignalWorkflow(ctx, id, "advance", nil)
+		waitForStatus(t, eng, id, 3*time.Second)
+
+		// Completed workflows are no longer resident and are answered by replay.
+		got, err = eng.QueryWorkflow(ctx, id, "step", nil)
+		if err != nil || got != "done" {
+			t.Fatalf("expected done from replay, got %v (%v)", got, err)
+		}
+	})
+
+	t.Run("replay_until_blocked", func(t *testing.T) {
+		id := "wf-query-replay"
+		store.SaveWorkflowState(ctx, &state.WorkflowState{WorkflowID: id, WorkflowName: "wf-query", Status: state.StatusPending, StartTime: time.Now().UTC()})
+		store.AppendEvent(ctx, state.NewEvent(id, state.EventWorkflowStarted, nil))
+		store.AppendEvent(ctx, state.NewEvent(id, state.EventSignalReceived, map[string]interface{}{"signal_name": "advance"}))
+
+		got, err := eng.QueryWorkflow(ctx, id, "step", nil)
+		if err != nil || got != "advanced" {
+			t.Fatalf("expected advanced from replay, got %v (%v)", got, err)
+		}
+		events, _ := store.GetEvents(ctx, id)
+		if len(events) != 2 {
+			t.Fatalf("expected replay to record no events, got %d", len(events))
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if _, err := eng.QueryWorkflow(ctx, "wf-query-missing", "step", nil); !errors.Is(err, ErrWorkflowNotFound) {
+			t.Fatalf("expected ErrWorkflowNotFound, got %v", err)
+		}
+
+		id := "wf-query-retired"
+		store.SaveWorkflowState(ctx, &state.WorkflowState{WorkflowID: id, WorkflowName: "wf-retired", Status: state.StatusCompleted, StartTime: time.Now().UTC()})
+		if _, err := eng.QueryWorkflow(ctx, id, "step", nil); !errors.Is(err, ErrWorkflowClosed) {
+			t.Fatalf("expected ErrWorkflowClosed for a closed workflow without a definition, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/KamdynS/marathon/activity"
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/worker"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+func TestResumeWorkflows_ReplaysRecordedHistory(t *testing.T) {
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+	ctx := context.Background()
+
+	var stepRuns, finalRuns int32
+	actReg := activity.NewRegistry()
+	actReg.Register("step", activity.ActivityFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		atomic.AddInt32(&stepRuns, 1)
+		return "live", nil
+	}), activity.Info{})
+	actReg.Register("final", activity.ActivityFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		atomic.AddInt32(&finalRuns, 1)
+		return input, nil
+	}), activity.Info{})
+
+	var observedNow time.Time
+	wfReg := workflow.NewRegistry()
+	wf := workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+		var step interface{}
+		if err := ctx.ExecuteActivity(ctx, "step", in).Get(ctx, &step); err != nil {
+			return nil, err
+		}
+		if err := ctx.Sleep(time.Hour).Get(ctx, nil); err != nil {
+			return nil, err
+		}
+		observedNow = ctx.Now()
+		var out interface{}
+		if err := ctx.ExecuteActivity(ctx, "final", step).Get(ctx, &out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	})
+	wfReg.Register(&workflow.Definition{Name: "resumable", Workflow: wf, Options: workflow.Options{TaskQueue: "default"}})
+
+	// Simulate a previous process that ran the first activity and timer, then died.
+	wfID := "wf-resume"
+	started := time.Now().Add(-2 * time.Hour).UTC()
+	fired := started.Add(time.Hour)
+	store.SaveWorkflowState(ctx, &state.WorkflowState{
+		WorkflowID: wfID, WorkflowName: "resumable", Status: state.StatusRunning,
+		Input: "in", StartTime: started, TaskQueue: "default",
+	})
+	prior := newExecutionContext(wfID, q, store, "default", nil)
+	stepID := prior.generateActivityID("step", "in")
+	timerID := prior.generateTimerID(time.Hour)
+	history := []*state.Event{
+		{Type: state.EventWorkflowStarted, Timestamp: started, Data: map[string]interface{}{"workflow_name": "resumable"}},
+		{Type: state.EventActivityScheduled, Timestamp: started, Data: map[string]interface{}{"activity_id": stepID, "activity_name": "step"}},
+		{Type: state.EventActivityCompleted, Timestamp: started, Data: map[string]interface{}{"activity_id": stepID, "output": "recorded"}},
+		{Type: state.EventTimerScheduled, Timestamp: started, Data: map[string]interface{}{"timer_id": timerID, "fire_at": fired}},
+		{Type: state.EventTimerFired, Timestamp: fired, Data: map[string]interface{}{"timer_id": timerID, "fire_at": fired}},
+	}
+	for _, e := range history {
+		e.WorkflowID = wfID
+		if err := store.AppendEvent(ctx, e); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	w, err := worker.New(worker.Config{Queue: q, QueueName: "default", ActivityRegistry: actReg, StateStore: store, MaxConcurrent: 1, PollInterval: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("worker: %v", err)
+	}
+	w.Start(ctx)
+	defer func() {
+		stopCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		w.Stop(stopCtx)
+	}()
+
+	// A new engine picks up the running workflow on startup.
+	eng, err := New(Config{StateStore: store, Queue: q, WorkflowRegistry: wfReg})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer eng.Stop()
+
+	deadline := time.Now().Add(3 * time.Second)
+	var st *state.WorkflowState
+	for time.Now().Before(deadline) {
+		st, _ = eng.GetWorkflowStatus(ctx, wfID)
+		if st != nil && st.IsComplete() {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if st == nil || st.Status != state.StatusCompleted {
+		t.Fatalf("expected resumed workflow to complete, got %+v", st)
+	}
+	if st.Output != "recorded" {
+		t.Fatalf("expected output from recorded activity result, got %v", st.Output)
+	}
+	if n := atomic.LoadInt32(&stepRuns); n != 0 {
+		t.Fatalf("expected completed activity not to re-execute, ran %d times", n)
+	}
+	if n := atomic.LoadInt32(&finalRuns); n != 1 {
+		t.Fatalf("expected pending activity to execute once, ran %d times", n)
+	}
+	if !observedNow.Equal(fired) {
+		t.Fatalf("expected Now to return recorded timer time %v, got %v", fired, observedNow)
+	}
+
+	events, _ := store.GetEvents(ctx, wfID)
+	scheduled := 0
+	for _, e := range events {
+		if e.Type == state.EventTimerScheduled {
+			scheduled++
+		}
+	}
+	if scheduled != 1 {
+		t.Fatalf("expected replay not to reschedule timer, got %d timer_scheduled events", scheduled)
+	}
+}
+
+func TestExecutionContext_DeterministicIDs(t *testing.T) {
+	a := newExecutionContext("wf-ids", nil, nil, "default", nil)
+	b := newExecutionContext("wf-ids", nil, nil, "default", nil)
+
+	// Different call orders for distinct activities must yield the same IDs.
+	a1 := a.generateActivityID("x", 1)
+	a2 := a.generateActivityID("y", 2)
+	b2 := b.generateActivityID("y", 2)
+	b1 := b.generateActivityID("x", 1)
+	if a1 != b1 || a2 != b2 {
+		t.Fatalf("expected order-independent IDs, got %s/%s vs %s/%s", a1, a2, b1, b2)
+	}
+	if again := a.generateActivityID("x", 1); again == a1 {
+		t.Fatalf("expected repeated call to get a new ID, got %s", again)
+	}
+	if a.generateTimerID(time.Second) != b.generateTimerID(time.Second) {
+		t.Fatalf("expected matching timer IDs")
+	}
+}
@@ -0,0 +1,134 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+// retryWorkflow records a workflow_retrying event for a failed attempt if the
+// retry policy allows another one. The next attempt starts once the backoff
+// timer fires; see awaitRetry. It reports whether the workflow will be retried.
+func (e *Engine) retryWorkflow(ctx context.Context, workflowState *state.WorkflowState, policy *workflow.RetryPolicy, err error) bool {
+	if policy == nil || !policy.IsRetryable(err) {
+		return false
+	}
+	attempt := workflowState.Attempt
+	if attempt < 1 {
+		attempt = 1
+	}
+	if attempt >= policy.MaxAttempts {
+		return false
+	}
+
+	next := attempt + 1
+	backoff := policy.Backoff(next)
+	retryAt := time.Now().Add(backoff).UTC()
+	event := state.NewEvent(workflowState.WorkflowID, state.EventWorkflowRetrying, map[string]interface{}{
+		"attempt":  next,
+		"error":    err.Error(),
+		"backoff":  backoff.String(),
+		"retry_at": retryAt,
+		"timer_id": fmt.Sprintf("retry-%d-%d", next, retryAt.UnixNano()),
+	})
+	if appendErr := e.stateStore.AppendEvent(ctx, event); appendErr != nil {
+		log.Printf("[Engine] Failed to record retry of workflow %s: %v", workflowState.WorkflowID, appendErr)
+		return false
+	}
+
+	workflowState.Attempt = next
+	workflowState.EndTime = nil
+	e.stateStore.SaveWorkflowState(ctx, workflowState)
+
+	log.Printf("[Engine] Workflow %s attempt %d failed, retrying in %s: %v", workflowState.WorkflowID, attempt, backoff, err)
+	return true
+}
+
+// awaitRetry blocks while the workflow's latest attempt is waiting for its
+// backoff timer, arming the timer if needed. It returns false if the
+// workflow closed meanwhile, for example because it was canceled, or if the
+// timer is pending and wait is false. While it waits, the log is re-read past
+// the last seen event whenever a watched event lands, and otherwise every
+// timer interval, or every watchFallbackInterval when events are watched.
+func (e *Engine) awaitRetry(ctx context.Context, workflowID string, wait bool) bool {
+	var notify <-chan *state.Event
+	interval := e.timerInterval
+	if watcher, ok := e.stateStore.(state.EventWatcher); ok && wait {
+		watchCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		if events, err := watcher.WatchEvents(watchCtx, workflowID); err == nil {
+			notify, interval = events, watchFallbackInterval
+		}
+	}
+
+	var retry *state.Event
+	var since int64
+	armed := false
+	for {
+		events, err := e.stateStore.GetEventsSince(ctx, workflowID, since)
+		if err != nil {
+			// Let the caller report the error
+			return true
+		}
+		retry = pendingRetry(retry, events)
+		if retry == nil {
+			return true
+		}
+		for _, evt := range events {
+			if evt.SequenceNum > since {
+				since = evt.SequenceNum
+			}
+		}
+		if st, err := e.stateStore.GetWorkflowState(ctx, workflowID); err == nil && st.IsComplete() {
+			return false
+		}
+		if !armed {
+			// Idempotent, so a timer armed before a restart keeps its deadline
+			retryAt, _ := eventTime(retry, "retry_at")
+			if err := e.stateStore.ScheduleTimer(ctx, workflowID, eventString(retry, "timer_id"), retryAt); err != nil {
+				log.Printf("[Engine] Failed to arm retry timer for workflow %s: %v", workflowID, err)
+			} else {
+				armed = true
+			}
+		}
+		if !wait {
+			return false
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-e.timerCtx.Done():
+			return false
+		case _, ok := <-notify:
+			if !ok {
+				notify, interval = nil, e.timerInterval
+			}
+		case <-time.After(interval):
+		}
+	}
+}
+
+// pendingRetry returns the latest workflow_retrying event, starting from
+// retry, if its backoff timer has not fired by the end of events
+func pendingRetry(retry *state.Event, events []*state.Event) *state.Event {
+	fired := false
+	for _, e := range events {
+		switch e.Type {
+		case state.EventWorkflowRetrying:
+			retry, fired = e, false
+		case state.EventTimerFired:
+			if retry != nil && eventString(e, "timer_id") == eventString(retry, "timer_id") {
+				fired = true
+			}
+		}
+	}
+	if fired {
+		return nil
+	}
+	return retry
+}
@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+func TestWorkflowRetry_RunsFreshAttempts(t *testing.T) {
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+	ctx := context.Background()
+
+	var attempts int32
+	policy := &workflow.RetryPolicy{MaxAttempts: 3, InitialInterval: 50 * time.Millisecond, BackoffCoefficient: 2}
+	reg := workflow.NewRegistry()
+	reg.Register(&workflow.Definition{Name: "flaky", Options: workflow.Options{TaskQueue: "default", RetryPolicy: policy},
+		Workflow: workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+			// Each attempt sleeps afresh rather than replaying the previous attempt's timer
+			if err := ctx.Sleep(10*time.Millisecond).Get(ctx, nil); err != nil {
+				return nil, err
+			}
+			if n := atomic.AddInt32(&attempts, 1); n < 3 {
+				return nil, fmt.Errorf("attempt %d failed", n)
+			}
+			return "ok", nil
+		})})
+	eng, err := New(Config{StateStore: store, Queue: q, WorkflowRegistry: reg})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer eng.Stop()
+
+	id, err := eng.StartWorkflow(ctx, "flaky", nil)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	st := waitForStatus(t, eng, id, 10*time.Second)
+	if st.Status != state.StatusCompleted || st.Output != "ok" || st.Attempt != 3 {
+		t.Fatalf("expected completion on attempt 3, got %s attempt %d (%s)", st.Status, st.Attempt, st.Error)
+	}
+
+	events, _ := store.GetEvents(ctx, id)
+	var retries []int
+	timers := map[string]bool{}
+	for _, e := range events {
+		switch e.Type {
+		case state.EventWorkflowRetrying:
+			n, _ := eventInt(e, "attempt")
+			retries = append(retries, n)
+		case state.EventTimerScheduled:
+			timers[eventString(e, "timer_id")] = true
+		}
+	}
+	if fmt.Sprint(retries) != "[2 3]" || len(timers) != 3 {
+		t.Fatalf("expected retries [2 3] with 3 distinct timers, got %v and %v", retries, timers)
+	}
+}
+
+func TestWorkflowRetry_StopsOnNonRetryableAndMaxAttempts(t *testing.T) {
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+	ctx := context.Background()
+
+	policy := &workflow.RetryPolicy{MaxAttempts: 2, InitialInterval: 10 * time.Millisecond, BackoffCoefficient: 2}
+	reg := workflow.NewRegistry()
+	reg.Register(&workflow.Definition{Name: "invalid", Options: workflow.Options{TaskQueue: "default", RetryPolicy: policy},
+		Workflow: workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+			return nil, workflow.NewNonRetryableError(errors.New("invalid input"))
+		})})
+	reg.Register(&workflow.Definition{Name: "broken", Options: workflow.Options{TaskQueue: "default", RetryPolicy: policy},
+		Workflow: workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+			return nil, errors.New("boom")
+		})})
+	eng, err := New(Config{StateStore: store, Queue: q, WorkflowRegistry: reg})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer eng.Stop()
+
+	for name, wantAttempts := range map[string]int{"invalid": 1, "broken": 2} {
+		id, err := eng.StartWorkflow(ctx, name, nil)
+		if err != nil {
+			t.Fatalf("start %s: %v", name, err)
+		}
+		st := waitForStatus(t, eng, id, 5*time.Second)
+		if st.Status != state.StatusFailed || st.Attempt != wantAttempts {
+			t.Errorf("%s: expected failure after %d attempts, got %s after %d", name, wantAttempts, st.Status, st.Attempt)
+		}
+	}
+}
+
+func TestWorkflowRetry_NextAttemptIsResident(t *testing.T) {
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+	ctx := context.Background()
+
+	var attempts int32
+	policy := &workflow.RetryPolicy{MaxAttempts: 2, InitialInterval: time.Millisecond, BackoffCoefficient: 1}
+	reg := workflow.NewRegistry()
+	reg.Register(&workflow.Definition{Name: "retry-resident", Options: workflow.Options{TaskQueue: "default", RetryPolicy: policy},
+		Workflow: workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+			if atomic.AddInt32(&attempts, 1) == 1 {
+				return nil, errors.New("first attempt fails")
+			}
+			var v string
+			err := ctx.ReceiveSignal("go").Get(ctx, &v)
+			return v, err
+		})})
+	eng, err := New(Config{StateStore: store, Queue: q, WorkflowRegistry: reg})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer eng.Stop()
+
+	id, err := eng.StartWorkflow(ctx, "retry-resident", nil)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	// The second attempt registers itself even though the first one was
+	// still resident when it scheduled the retry
+	deadline := time.Now().Add(3 * time.Second)
+	for atomic.LoadInt32(&attempts) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected a second attempt")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, resident := eng.runningWorkflows.Load(id); !resident {
+		t.Fatal("expected the second attempt to be resident")
+	}
+
+	if err := eng.SignalWorkflow(ctx, id, "go", "done"); err != nil {
+		t.Fatalf("signal: %v", err)
+	}
+	st := waitForStatus(t, eng, id, 3*time.Second)
+	if st.Status != state.StatusCompleted || st.Output != "done" {
+		t.Fatalf("expected completion, got %s (%s)", st.Status, st.Error)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, resident := eng.runningWorkflows.Load(id); resident {
+		t.Fatal("expected the completed workflow to be unregistered")
+	}
+}
@@ -0,0 +1,234 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/KamdynS/marathon/activity"
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/worker"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+func TestBuilder_CompensatesInReverseOrder(t *testing.T) {
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var calls []string
+	record := func(name string, out interface{}, err error) activity.Activity {
+		return activity.ActivityFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			// The worker redelivers failed tasks; record each activity once per run
+			if len(calls) == 0 || calls[len(calls)-1] != name {
+				calls = append(calls, name)
+			}
+			if strings.HasPrefix(name, "release") {
+				// Compensations receive the original input and output
+				m, _ := input.(map[string]interface{})
+				calls = append(calls, m["output"].(string))
+			}
+			return out, err
+		})
+	}
+	actReg := activity.NewRegistry()
+	actReg.Register("reserve-vm", record("reserve-vm", "vm-1", nil), activity.Info{})
+	actReg.Register("reserve-ip", record("reserve-ip", "ip-1", nil), activity.Info{})
+	actReg.Register("configure", record("configure", nil, errors.New("boom")), activity.Info{})
+	actReg.Register("release-vm", record("release-vm", nil, nil), activity.Info{})
+	actReg.Register("release-ip", record("release-ip", nil, nil), activity.Info{})
+
+	reg := workflow.NewRegistry()
+	reg.Register(workflow.New("provision").
+		ActivityWithCompensation("reserve-vm", "small", "release-vm").
+		ActivityWithCompensation("reserve-ip", "public", "release-ip").
+		Activity("configure", nil).
+		RetryPolicy(&workflow.RetryPolicy{MaxAttempts: 1}).
+		Build())
+
+	w, err := worker.New(worker.Config{Queue: q, QueueName: "default", ActivityRegistry: actReg, StateStore: store, MaxConcurrent: 1, PollInterval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("worker: %v", err)
+	}
+	w.Start(ctx)
+	defer func() {
+		stopCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		w.Stop(stopCtx)
+	}()
+
+	eng, err := New(Config{StateStore: store, Queue: q, WorkflowRegistry: reg})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer eng.Stop()
+
+	id, err := eng.StartWorkflow(ctx, "provision", nil)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	st := waitForStatus(t, eng, id, 10*time.Second)
+	if st.Status != state.StatusFailed || !strings.Contains(st.Error, "boom") {
+		t.Fatalf("expected failure from configure, got %s (%s)", st.Status, st.Error)
+	}
+
+	mu.Lock()
+	got := strings.Join(calls, ",")
+	mu.Unlock()
+	if want := "reserve-vm,reserve-ip,configure,release-ip,ip-1,release-vm,vm-1"; got != want {
+		t.Fatalf("expected calls %s, got %s", want, got)
+	}
+
+	// Each compensation is a durable activity with its own events
+	events, _ := store.GetEvents(ctx, id)
+	compensations := 0
+	for _, e := range events {
+		if e.Type == state.EventActivityCompleted {
+			if act, err := store.GetActivityState(ctx, eventString(e, "activity_id")); err == nil && strings.HasPrefix(act.ActivityName, "release") {
+				compensations++
+			}
+		}
+	}
+	if compensations != 2 {
+		t.Fatalf("expected 2 completed compensation activities, got %d", compensations)
+	}
+}
+
+// newSagaAfterWaitEngine runs a workflow that reserves, registers a "release"
+// compensation and then sleeps until it is canceled or times out, at which
+// point it compensates. released counts the compensation's executions.
+func newSagaAfterWaitEngine(t *testing.T, timeout time.Duration) (*Engine, state.Store, *int32) {
+	t.Helper()
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	t.Cleanup(func() { q.Close() })
+	ctx := context.Background()
+
+	var released int32
+	actReg := activity.NewRegistry()
+	actReg.Register("reserve", activity.ActivityFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		return "vm-1", nil
+	}), activity.Info{})
+	actReg.Register("release", activity.ActivityFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		// Outlast the closed-workflow checks of the worker
+		time.Sleep(300 * time.Millisecond)
+		atomic.AddInt32(&released, 1)
+		return nil, ctx.Err()
+	}), activity.Info{})
+
+	reg := workflow.NewRegistry()
+	reg.Register(&workflow.Definition{Name: "reserve-then-wait", Options: workflow.Options{TaskQueue: "default", ExecutionTimeout: timeout},
+		Workflow: workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+			saga := workflow.NewSaga(workflow.SagaOptions{})
+			var vm string
+			if err := ctx.ExecuteActivity(ctx, "reserve", nil).Get(ctx, &vm); err != nil {
+				return nil, err
+			}
+			saga.AddCompensation("release", vm)
+			if err := ctx.Sleep(time.Hour).Get(ctx, nil); err != nil {
+				return nil, errors.Join(err, saga.Compensate(ctx))
+			}
+			return nil, nil
+		})})
+
+	w, err := worker.New(worker.Config{Queue: q, QueueName: "default", ActivityRegistry: actReg, StateStore: store, MaxConcurrent: 1, PollInterval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("worker: %v", err)
+	}
+	w.Start(ctx)
+	t.Cleanup(func() {
+		stopCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		w.Stop(stopCtx)
+	})
+
+	eng, err := New(Config{StateStore: store, Queue: q, WorkflowRegistry: reg})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	t.Cleanup(eng.Stop)
+	return eng, store, &released
+}
+
+// assertCompensatedBeforeClose checks the compensation completed once and
+// before the event that closed the workflow
+func assertCompensatedBeforeClose(t *testing.T, store state.Store, id string, released *int32, closed state.EventType) {
+	t.Helper()
+	if n := atomic.LoadInt32(released); n != 1 {
+		t.Fatalf("expected compensation to run once, ran %d times", n)
+	}
+	events, _ := store.GetEvents(context.Background(), id)
+	compensated := false
+	for _, e := range events {
+		if e.Type == state.EventActivityCompleted && strings.Contains(eventString(e, "activity_id"), "release") {
+			compensated = true
+		}
+		if e.Type == closed {
+			if !compensated {
+				t.Fatalf("workflow closed with %s before the compensation completed", closed)
+			}
+			return
+		}
+	}
+	t.Fatalf("no %s event recorded", closed)
+}
+
+func TestSaga_CompensatesAfterTimeout(t *testing.T) {
+	eng, store, released := newSagaAfterWaitEngine(t, 500*time.Millisecond)
+
+	id, err := eng.StartWorkflow(context.Background(), "reserve-then-wait", nil)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	st := waitForStatus(t, eng, id, 10*time.Second)
+	if st.Status != state.StatusTimedOut {
+		t.Fatalf("expected timed out, got %s (%s)", st.Status, st.Error)
+	}
+	assertCompensatedBeforeClose(t, store, id, released, state.EventWorkflowTimedOut)
+}
+
+func TestSaga_CompensatesAfterCancel(t *testing.T) {
+	eng, store, released := newSagaAfterWaitEngine(t, 0)
+	ctx := context.Background()
+
+	id, err := eng.StartWorkflow(ctx, "reserve-then-wait", nil)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	// Cancel once the workflow sleeps after reserving
+	deadline := time.Now().Add(5 * time.Second)
+	for !hasEvent(store, id, state.EventTimerScheduled) {
+		if time.Now().After(deadline) {
+			t.Fatal("workflow did not start sleeping")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err := eng.CancelWorkflow(ctx, id); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+
+	st := waitForStatus(t, eng, id, 10*time.Second)
+	if st.Status != state.StatusCanceled {
+		t.Fatalf("expected canceled, got %s (%s)", st.Status, st.Error)
+	}
+	assertCompensatedBeforeClose(t, store, id, released, state.EventWorkflowCanceled)
+}
+
+func hasEvent(store state.Store, id string, typ state.EventType) bool {
+	events, _ := store.GetEvents(context.Background(), id)
+	for _, e := range events {
+		if e.Type == typ {
+			return true
+		}
+	}
+	return false
+}
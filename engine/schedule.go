@@ -0,0 +1,401 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/KamdynS/marathon/converter"
+	"github.com/KamdynS/marathon/schedule"
+	"github.com/KamdynS/marathon/state"
+)
+
+// scheduleTimerPrefix marks durable timers that fire a schedule rather than
+// wake a workflow. The timer's owner is the prefix followed by the schedule
+// ID and its timer ID is the nominal fire time in Unix nanoseconds.
+const scheduleTimerPrefix = "__schedule__"
+
+// maxBackfillRuns bounds the number of runs a single backfill may start
+const maxBackfillRuns = 1000
+
+// CreateSchedule registers a schedule and arms its first fire
+func (e *Engine) CreateSchedule(ctx context.Context, spec schedule.Spec) (*state.ScheduleState, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := e.workflowRegistry.GetVersion(spec.WorkflowName, spec.WorkflowVersion); err != nil {
+		return nil, fmt.Errorf("workflow not found: %w", err)
+	}
+	input, err := converter.Normalize(e.dataConverter, spec.Input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode input: %w", err)
+	}
+	spec.Input = input
+
+	e.scheduleMu.Lock()
+	defer e.scheduleMu.Unlock()
+
+	if _, err := e.stateStore.GetSchedule(ctx, spec.ID); err == nil {
+		return nil, fmt.Errorf("schedule %s already exists", spec.ID)
+	}
+	now := time.Now().UTC()
+	st := &state.ScheduleState{CreatedAt: now}
+	if err := applySpec(st, spec, now); err != nil {
+		return nil, err
+	}
+	if err := e.stateStore.SaveSchedule(ctx, st); err != nil {
+		return nil, fmt.Errorf("failed to save schedule: %w", err)
+	}
+	e.armSchedule(ctx, st)
+
+	log.Printf("[Engine] Created schedule %s (%s), next run at %s", st.ScheduleID, st.WorkflowName, st.NextRunAt.Format(time.RFC3339))
+	return st, nil
+}
+
+// UpdateSchedule replaces the spec of an existing schedule, keeping its run
+// counters and running workflows. The next fire is computed from now.
+func (e *Engine) UpdateSchedule(ctx context.Context, spec schedule.Spec) (*state.ScheduleState, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := e.workflowRegistry.GetVersion(spec.WorkflowName, spec.WorkflowVersion); err != nil {
+		return nil, fmt.Errorf("workflow not found: %w", err)
+	}
+	input, err := converter.Normalize(e.dataConverter, spec.Input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode input: %w", err)
+	}
+	spec.Input = input
+
+	e.scheduleMu.Lock()
+	defer e.scheduleMu.Unlock()
+
+	st, err := e.stateStore.GetSchedule(ctx, spec.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := applySpec(st, spec, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	if err := e.stateStore.SaveSchedule(ctx, st); err != nil {
+		return nil, fmt.Errorf("failed to save schedule: %w", err)
+	}
+	// The previous timer no longer matches NextRunAt and is ignored when it fires
+	e.armSchedule(ctx, st)
+	return st, nil
+}
+
+// GetSchedule returns the state of a schedule
+func (e *Engine) GetSchedule(ctx context.Context, scheduleID string) (*state.ScheduleState, error) {
+	return e.stateStore.GetSchedule(ctx, scheduleID)
+}
+
+// ListSchedules returns all schedules ordered by ID
+func (e *Engine) ListSchedules(ctx context.Context) ([]*state.ScheduleState, error) {
+	return e.stateStore.ListSchedules(ctx)
+}
+
+// DeleteSchedule removes a schedule. Workflows it started keep running.
+func (e *Engine) DeleteSchedule(ctx context.Context, scheduleID string) error {
+	e.scheduleMu.Lock()
+	defer e.scheduleMu.Unlock()
+	return e.stateStore.DeleteSchedule(ctx, scheduleID)
+}
+
+// PauseSchedule stops a schedule from firing until it is resumed
+func (e *Engine) PauseSchedule(ctx context.Context, scheduleID string) error {
+	e.scheduleMu.Lock()
+	defer e.scheduleMu.Unlock()
+
+	st, err := e.stateStore.GetSchedule(ctx, scheduleID)
+	if err != nil {
+		return err
+	}
+	if st.Paused {
+		return nil
+	}
+	st.Paused = true
+	st.UpdatedAt = time.Now().UTC()
+	return e.stateStore.SaveSchedule(ctx, st)
+}
+
+// ResumeSchedule resumes a paused schedule. Fires missed while paused are
+// not run; use BackfillSchedule for that.
+func (e *Engine) ResumeSchedule(ctx context.Context, scheduleID string) error {
+	e.scheduleMu.Lock()
+	defer e.scheduleMu.Unlock()
+
+	st, err := e.stateStore.GetSchedule(ctx, scheduleID)
+	if err != nil {
+		return err
+	}
+	if !st.Paused {
+		return nil
+	}
+	sched, err := scheduleSpec(st).Schedule()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	st.Paused = false
+	st.NextRunAt = sched.Next(now)
+	st.UpdatedAt = now
+	if err := e.stateStore.SaveSchedule(ctx, st); err != nil {
+		return err
+	}
+	e.armSchedule(ctx, st)
+	return nil
+}
+
+// BackfillSchedule starts a workflow for every fire time of the schedule in
+// [start, end], regardless of its overlap policy and whether it is paused.
+// Fire times that already started a workflow are not run again. It returns
+// the number of workflows started.
+func (e *Engine) BackfillSchedule(ctx context.Context, scheduleID string, start, end time.Time) (int, error) {
+	if end.Before(start) {
+		return 0, fmt.Errorf("backfill end is before start")
+	}
+	if now := time.Now(); end.After(now) {
+		end = now
+	}
+
+	e.scheduleMu.Lock()
+	defer e.scheduleMu.Unlock()
+
+	st, err := e.stateStore.GetSchedule(ctx, scheduleID)
+	if err != nil {
+		return 0, err
+	}
+	sched, err := scheduleSpec(st).Schedule()
+	if err != nil {
+		return 0, err
+	}
+	var fires []time.Time
+	for t := sched.Next(start.Add(-time.Nanosecond)); !t.IsZero() && !t.After(end); t = sched.Next(t) {
+		if len(fires) == maxBackfillRuns {
+			return 0, fmt.Errorf("backfill would start more than %d runs", maxBackfillRuns)
+		}
+		fires = append(fires, t)
+	}
+
+	started := 0
+	for _, t := range fires {
+		if e.startScheduledRun(ctx, st, t) {
+			started++
+		}
+	}
+	st.UpdatedAt = time.Now().UTC()
+	if err := e.stateStore.SaveSchedule(ctx, st); err != nil {
+		return started, fmt.Errorf("failed to save schedule: %w", err)
+	}
+	log.Printf("[Engine] Backfilled schedule %s: started %d of %d runs", scheduleID, started, len(fires))
+	return started, nil
+}
+
+// fireSchedule handles a schedule timer firing. Timers that no longer match
+// the schedule's next fire, e.g. after an update, are ignored.
+func (e *Engine) fireSchedule(ctx context.Context, scheduleID string, timerID string) {
+	e.scheduleMu.Lock()
+	defer e.scheduleMu.Unlock()
+
+	st, err := e.stateStore.GetSchedule(ctx, scheduleID)
+	if err != nil {
+		return
+	}
+	nominal, err := strconv.ParseInt(timerID, 10, 64)
+	if err != nil || st.Paused || st.NextRunAt.UnixNano() != nominal {
+		return
+	}
+	e.advanceSchedule(ctx, st, time.Now())
+}
+
+// resumeSchedules re-arms the timers of all active schedules and runs the
+// fires that came due while no engine was running
+func (e *Engine) resumeSchedules(ctx context.Context) {
+	schedules, err := e.stateStore.ListSchedules(ctx)
+	if err != nil {
+		log.Printf("[Engine] Failed to list schedules: %v", err)
+		return
+	}
+	for _, st := range schedules {
+		if st.Paused || st.NextRunAt.IsZero() {
+			continue
+		}
+		spec := scheduleSpec(st)
+		if st.NextRunAt.Add(spec.JitterFor(st.NextRunAt)).After(time.Now()) {
+			e.armSchedule(ctx, st)
+			continue
+		}
+		// The timer may have fired without the schedule advancing
+		e.fireSchedule(ctx, st.ScheduleID, strconv.FormatInt(st.NextRunAt.UnixNano(), 10))
+	}
+}
+
+// advanceSchedule runs every fire of the schedule due by now, then saves it
+// and arms the timer for the next fire. Callers hold scheduleMu.
+func (e *Engine) advanceSchedule(ctx context.Context, st *state.ScheduleState, now time.Time) {
+	spec := scheduleSpec(st)
+	sched, err := spec.Schedule()
+	if err != nil {
+		log.Printf("[Engine] Schedule %s is invalid: %v", st.ScheduleID, err)
+		return
+	}
+	e.refreshScheduleRuns(ctx, st)
+
+	next := st.NextRunAt
+	for !next.IsZero() && !next.Add(spec.JitterFor(next)).After(now) {
+		if now.Sub(next.Add(spec.JitterFor(next))) > st.CatchupWindow {
+			// Missed by more than the catch-up window; jump to the first
+			// fire that may still be within it
+			st.SkippedRuns++
+			if resume := sched.Next(now.Add(-st.CatchupWindow - st.Jitter)); resume.After(next) {
+				next = resume
+			} else {
+				next = sched.Next(next)
+			}
+			continue
+		}
+		e.runScheduled(ctx, st, next)
+		next = sched.Next(next)
+	}
+
+	st.NextRunAt = next
+	st.UpdatedAt = time.Now().UTC()
+	if err := e.stateStore.SaveSchedule(ctx, st); err != nil {
+		log.Printf("[Engine] Failed to save schedule %s: %v", st.ScheduleID, err)
+		return
+	}
+	e.armSchedule(ctx, st)
+}
+
+// runScheduled applies the overlap policy to a fire at nominal time t
+func (e *Engine) runScheduled(ctx context.Context, st *state.ScheduleState, t time.Time) {
+	switch {
+	case len(st.RunningWorkflowIDs) == 0 || schedule.OverlapPolicy(st.OverlapPolicy) == schedule.OverlapAllowAll:
+		e.startScheduledRun(ctx, st, t)
+	case schedule.OverlapPolicy(st.OverlapPolicy) == schedule.OverlapBufferOne && st.BufferedRunAt == nil:
+		st.BufferedRunAt = &t
+	default:
+		st.SkippedRuns++
+	}
+}
+
+// startBufferedRun starts the schedule's buffered fire once none of its
+// workflows are running. It is called when a scheduled workflow closes.
+func (e *Engine) startBufferedRun(ctx context.Context, scheduleID string) {
+	e.scheduleMu.Lock()
+	defer e.scheduleMu.Unlock()
+
+	st, err := e.stateStore.GetSchedule(ctx, scheduleID)
+	if err != nil || st.BufferedRunAt == nil {
+		return
+	}
+	e.refreshScheduleRuns(ctx, st)
+	if st.BufferedRunAt != nil {
+		// Still running; keep it buffered
+		return
+	}
+	st.UpdatedAt = time.Now().UTC()
+	if err := e.stateStore.SaveSchedule(ctx, st); err != nil {
+		log.Printf("[Engine] Failed to save schedule %s: %v", st.ScheduleID, err)
+	}
+}
+
+// refreshScheduleRuns drops closed workflows from RunningWorkflowIDs, following
+// continue-as-new chains, and starts a buffered fire if nothing is left running
+func (e *Engine) refreshScheduleRuns(ctx context.Context, st *state.ScheduleState) {
+	running := st.RunningWorkflowIDs[:0]
+	for _, id := range st.RunningWorkflowIDs {
+		latest, err := e.GetLatestRunID(ctx, id)
+		if err != nil {
+			continue
+		}
+		if ws, err := e.stateStore.GetWorkflowState(ctx, latest); err == nil && ws.IsRunning() {
+			running = append(running, latest)
+		}
+	}
+	st.RunningWorkflowIDs = running
+
+	if st.BufferedRunAt != nil && len(st.RunningWorkflowIDs) == 0 {
+		t := *st.BufferedRunAt
+		st.BufferedRunAt = nil
+		e.startScheduledRun(ctx, st, t)
+	}
+}
+
+// startScheduledRun starts the workflow for the fire at nominal time t and
+// reports whether it did. The fire time is used as an idempotency key, so a
+// fire never starts more than one workflow.
+func (e *Engine) startScheduledRun(ctx context.Context, st *state.ScheduleState, t time.Time) bool {
+	key := fmt.Sprintf("schedule/%s/%d", st.ScheduleID, t.UnixNano())
+	if _, exists, err := e.stateStore.GetWorkflowIDByIdempotencyKey(ctx, key); err == nil && exists {
+		return false
+	}
+	opts := StartWorkflowOptions{IdempotencyKey: key, Version: st.WorkflowVersion}
+	workflowID, err := e.startWorkflow(ctx, st.WorkflowName, st.Input, opts, st.ScheduleID)
+	if err != nil {
+		log.Printf("[Engine] Schedule %s failed to start %s: %v", st.ScheduleID, st.WorkflowName, err)
+		st.SkippedRuns++
+		return false
+	}
+	st.RunningWorkflowIDs = append(st.RunningWorkflowIDs, workflowID)
+	st.StartedRuns++
+	if st.LastRunAt == nil || t.After(*st.LastRunAt) {
+		st.LastRunAt = &t
+	}
+	return true
+}
+
+// armSchedule persists the durable timer for the schedule's next fire
+func (e *Engine) armSchedule(ctx context.Context, st *state.ScheduleState) {
+	if st.Paused || st.NextRunAt.IsZero() {
+		return
+	}
+	fireAt := st.NextRunAt.Add(scheduleSpec(st).JitterFor(st.NextRunAt))
+	timerID := strconv.FormatInt(st.NextRunAt.UnixNano(), 10)
+	if err := e.stateStore.ScheduleTimer(ctx, scheduleTimerPrefix+st.ScheduleID, timerID, fireAt); err != nil {
+		log.Printf("[Engine] Failed to arm schedule %s: %v", st.ScheduleID, err)
+	}
+}
+
+// applySpec copies a validated spec into the schedule state and computes the
+// next fire from now
+func applySpec(st *state.ScheduleState, spec schedule.Spec, now time.Time) error {
+	sched, err := spec.Schedule()
+	if err != nil {
+		return err
+	}
+	st.ScheduleID = spec.ID
+	st.WorkflowName = spec.WorkflowName
+	st.WorkflowVersion = spec.WorkflowVersion
+	st.Input = spec.Input
+	st.Cron = spec.Cron
+	st.Interval = spec.Interval
+	st.TimeZone = spec.TimeZone
+	st.Jitter = spec.Jitter
+	st.OverlapPolicy = string(spec.OverlapPolicy)
+	st.CatchupWindow = spec.CatchupWindow
+	st.Paused = spec.Paused
+	st.NextRunAt = sched.Next(now)
+	st.UpdatedAt = now
+	return nil
+}
+
+// scheduleSpec returns the spec recorded in a schedule state
+func scheduleSpec(st *state.ScheduleState) *schedule.Spec {
+	return &schedule.Spec{
+		ID:              st.ScheduleID,
+		WorkflowName:    st.WorkflowName,
+		Input:           st.Input,
+		WorkflowVersion: st.WorkflowVersion,
+		Cron:            st.Cron,
+		Interval:        st.Interval,
+		TimeZone:        st.TimeZone,
+		Jitter:          st.Jitter,
+		OverlapPolicy:   schedule.OverlapPolicy(st.OverlapPolicy),
+		CatchupWindow:   st.CatchupWindow,
+		Paused:          st.Paused,
+	}
+}
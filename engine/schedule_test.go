@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/schedule"
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+// newScheduleEngine returns an engine with a "tick" workflow that blocks until
+// release is closed
+func newScheduleEngine(t *testing.T, release chan struct{}) (*Engine, state.Store) {
+	t.Helper()
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	t.Cleanup(func() { q.Close() })
+
+	reg := workflow.NewRegistry()
+	reg.Register(&workflow.Definition{Name: "tick", Options: workflow.Options{TaskQueue: "default"},
+		Workflow: workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+			<-release
+			return in, nil
+		})})
+	eng, err := New(Config{StateStore: store, Queue: q, WorkflowRegistry: reg})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	t.Cleanup(eng.Stop)
+	return eng, store
+}
+
+// waitForSchedule polls a schedule until cond holds
+func waitForSchedule(t *testing.T, eng *Engine, id string, timeout time.Duration, cond func(*state.ScheduleState) bool) *state.ScheduleState {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		st, err := eng.GetSchedule(context.Background(), id)
+		if err == nil && cond(st) {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("schedule %s did not reach the expected state: %+v (%v)", id, st, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestSchedule_OverlapPolicies(t *testing.T) {
+	release := make(chan struct{})
+	eng, store := newScheduleEngine(t, release)
+	ctx := context.Background()
+
+	for _, spec := range []schedule.Spec{
+		{ID: "skip", WorkflowName: "tick", Input: "hi", Interval: time.Second},
+		{ID: "buffer", WorkflowName: "tick", Interval: time.Second, OverlapPolicy: schedule.OverlapBufferOne},
+	} {
+		if _, err := eng.CreateSchedule(ctx, spec); err != nil {
+			t.Fatalf("create %s: %v", spec.ID, err)
+		}
+	}
+	if _, err := eng.CreateSchedule(ctx, schedule.Spec{ID: "skip", WorkflowName: "tick", Interval: time.Second}); err == nil {
+		t.Fatal("expected error for duplicate schedule")
+	}
+	if _, err := eng.CreateSchedule(ctx, schedule.Spec{ID: "missing", WorkflowName: "nope", Interval: time.Second}); err == nil {
+		t.Fatal("expected error for unknown workflow")
+	}
+
+	// The first run blocks, so later fires are skipped or buffered
+	skip := waitForSchedule(t, eng, "skip", 5*time.Second, func(st *state.ScheduleState) bool { return st.SkippedRuns >= 1 })
+	if skip.StartedRuns != 1 || len(skip.RunningWorkflowIDs) != 1 {
+		t.Fatalf("expected one running workflow, got %+v", skip)
+	}
+	wf, err := store.GetWorkflowState(ctx, skip.RunningWorkflowIDs[0])
+	if err != nil || wf.ScheduleID != "skip" || wf.Input != "hi" {
+		t.Fatalf("expected workflow started by schedule skip, got %+v (%v)", wf, err)
+	}
+	buffered := waitForSchedule(t, eng, "buffer", 5*time.Second, func(st *state.ScheduleState) bool { return st.BufferedRunAt != nil })
+	if buffered.StartedRuns != 1 {
+		t.Fatalf("expected one started run, got %+v", buffered)
+	}
+
+	// Closing the running workflow starts the buffered one right away
+	close(release)
+	waitForSchedule(t, eng, "buffer", time.Second, func(st *state.ScheduleState) bool { return st.StartedRuns >= 2 })
+	waitForSchedule(t, eng, "skip", 3*time.Second, func(st *state.ScheduleState) bool { return st.StartedRuns >= 2 })
+}
+
+func TestSchedule_PauseResumeAndBackfill(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	eng, _ := newScheduleEngine(t, release)
+	ctx := context.Background()
+
+	if _, err := eng.CreateSchedule(ctx, schedule.Spec{ID: "paused", WorkflowName: "tick", Interval: time.Second, Paused: true}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	start := time.Now().Truncate(time.Second).Add(-10 * time.Second)
+	started, err := eng.BackfillSchedule(ctx, "paused", start, start.Add(2*time.Second))
+	if err != nil || started != 3 {
+		t.Fatalf("expected 3 backfilled runs, got %d (%v)", started, err)
+	}
+	// Fires that already ran are not started again
+	if started, err := eng.BackfillSchedule(ctx, "paused", start, start.Add(3*time.Second)); err != nil || started != 1 {
+		t.Fatalf("expected 1 new backfilled run, got %d (%v)", started, err)
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	if st, _ := eng.GetSchedule(ctx, "paused"); st.StartedRuns != 4 {
+		t.Fatalf("expected paused schedule not to fire, got %+v", st)
+	}
+
+	if err := eng.ResumeSchedule(ctx, "paused"); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	waitForSchedule(t, eng, "paused", 3*time.Second, func(st *state.ScheduleState) bool { return st.StartedRuns >= 5 })
+
+	if err := eng.DeleteSchedule(ctx, "paused"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := eng.GetSchedule(ctx, "paused"); err == nil {
+		t.Fatal("expected deleted schedule to be gone")
+	}
+}
+
+func TestSchedule_SkipsFiresOutsideCatchupWindow(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	eng, store := newScheduleEngine(t, release)
+	ctx := context.Background()
+
+	if _, err := eng.CreateSchedule(ctx, schedule.Spec{ID: "minutely", WorkflowName: "tick", Interval: time.Minute, CatchupWindow: 90 * time.Second, OverlapPolicy: schedule.OverlapAllowAll}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	// Pretend the engine was down for an hour
+	st, _ := store.GetSchedule(ctx, "minutely")
+	now := time.Now()
+	st.NextRunAt = now.Truncate(time.Minute).Add(-time.Hour)
+	store.SaveSchedule(ctx, st)
+
+	eng.fireSchedule(ctx, "minutely", strconv.FormatInt(st.NextRunAt.UnixNano(), 10))
+
+	st, _ = store.GetSchedule(ctx, "minutely")
+	if st.StartedRuns < 1 || st.StartedRuns > 2 || st.SkippedRuns != 1 {
+		t.Fatalf("expected only fires within the catch-up window to start, got %+v", st)
+	}
+	if !st.NextRunAt.After(now) {
+		t.Fatalf("expected next run after now, got %s", st.NextRunAt)
+	}
+}
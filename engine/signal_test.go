@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+func waitForStatus(t *testing.T, eng *Engine, workflowID string, timeout time.Duration) *state.WorkflowState {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		st, err := eng.GetWorkflowStatus(context.Background(), workflowID)
+		if err == nil && st.IsComplete() {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("workflow %s did not complete in %v (last: %+v)", workflowID, timeout, st)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestSignalWorkflow_DeliversInOrder(t *testing.T) {
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+
+	reg := workflow.NewRegistry()
+	wf := workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+		var first, second interface{}
+		if err := ctx.ReceiveSignal("approval").Get(ctx, &first); err != nil {
+			return nil, err
+		}
+		if err := ctx.ReceiveSignal("approval").Get(ctx, &second); err != nil {
+			return nil, err
+		}
+		return []interface{}{first, second}, nil
+	})
+	reg.Register(&workflow.Definition{Name: "wf-signal", Workflow: wf, Options: workflow.Options{TaskQueue: "default"}})
+
+	eng, err := New(Config{StateStore: store, Queue: q, WorkflowRegistry: reg})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer eng.Stop()
+
+	ctx := context.Background()
+	id, err := eng.StartWorkflow(ctx, "wf-signal", nil)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if err := eng.SignalWorkflow(ctx, id, "other", "ignored"); err != nil {
+		t.Fatalf("signal other: %v", err)
+	}
+	if err := eng.SignalWorkflow(ctx, id, "approval", "yes"); err != nil {
+		t.Fatalf("signal 1: %v", err)
+	}
+	if err := eng.SignalWorkflow(ctx, id, "approval", "really"); err != nil {
+		t.Fatalf("signal 2: %v", err)
+	}
+
+	st := waitForStatus(t, eng, id, 3*time.Second)
+	out, ok := st.Output.([]interface{})
+	if st.Status != state.StatusCompleted || !ok || len(out) != 2 || out[0] != "yes" || out[1] != "really" {
+		t.Fatalf("unexpected result: status=%s output=%v", st.Status, st.Output)
+	}
+
+	if err := eng.SignalWorkflow(ctx, id, "approval", "late"); !errors.Is(err, ErrWorkflowClosed) {
+		t.Fatalf("expected ErrWorkflowClosed signaling completed workflow, got %v", err)
+	}
+	if err := eng.SignalWorkflow(ctx, "wf-missing", "approval", nil); !errors.Is(err, ErrWorkflowNotFound) {
+		t.Fatalf("expected ErrWorkflowNotFound signaling unknown workflow, got %v", err)
+	}
+}
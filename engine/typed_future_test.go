@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/KamdynS/marathon/activity"
+	"github.com/KamdynS/marathon/converter"
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/worker"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+type greeting struct {
+	Text  string `json:"text"`
+	Count int    `json:"count"`
+}
+
+func TestTypedActivity_DecodesStoredOutput(t *testing.T) {
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+	ctx := context.Background()
+
+	actReg := activity.NewRegistry()
+	// Return the shape a JSON-backed store hands back, not the struct itself.
+	actReg.Register("greet", activity.ActivityFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		return map[string]interface{}{"text": "hello " + input.(string), "count": float64(2)}, nil
+	}), activity.Info{})
+
+	reg := workflow.NewRegistry()
+	reg.Register(&workflow.Definition{Name: "typed", Options: workflow.Options{TaskQueue: "default"}, Workflow: workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+		g, err := workflow.ExecuteActivity[string, greeting](ctx, "greet", "world").Result(ctx)
+		if err != nil {
+			return nil, err
+		}
+		n, err := workflow.NewTypedFuture[int](ctx.ReceiveSignal("repeat")).Result(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return greeting{Text: g.Text, Count: g.Count * n}, nil
+	})})
+
+	w, err := worker.New(worker.Config{Queue: q, QueueName: "default", ActivityRegistry: actReg, StateStore: store, MaxConcurrent: 1, PollInterval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("worker: %v", err)
+	}
+	w.Start(ctx)
+	defer func() {
+		stopCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		w.Stop(stopCtx)
+	}()
+
+	eng, err := New(Config{StateStore: store, Queue: q, WorkflowRegistry: reg})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer eng.Stop()
+
+	id, err := eng.StartWorkflow(ctx, "typed", nil)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if err := eng.SignalWorkflow(ctx, id, "repeat", float64(3)); err != nil {
+		t.Fatalf("signal: %v", err)
+	}
+
+	st := waitForStatus(t, eng, id, 5*time.Second)
+	if st.Status != state.StatusCompleted {
+		t.Fatalf("expected completed, got %s (%s)", st.Status, st.Error)
+	}
+	// Outputs are recorded in normalized form, as an external store returns them
+	var got greeting
+	if err := converter.Assign(eng.DataConverter(), st.Output, &got); err != nil || got.Text != "hello world" || got.Count != 6 {
+		t.Fatalf("unexpected output %#v (%v)", st.Output, err)
+	}
+}
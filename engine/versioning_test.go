@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+func TestStartWorkflow_PinsVersion(t *testing.T) {
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+	ctx := context.Background()
+
+	reg := workflow.NewRegistry()
+	for _, version := range []string{"1.9", "1.10"} {
+		v := version
+		reg.Register(&workflow.Definition{Name: "greet", Version: v, Options: workflow.Options{TaskQueue: "default"},
+			Workflow: workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+				return "hello from " + v, nil
+			})})
+	}
+	eng, err := New(Config{StateStore: store, Queue: q, WorkflowRegistry: reg})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer eng.Stop()
+
+	latest, err := eng.StartWorkflow(ctx, "greet", nil)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	pinned, err := eng.StartWorkflowWithOptions(ctx, "greet", nil, StartWorkflowOptions{Version: "1.9"})
+	if err != nil {
+		t.Fatalf("start pinned: %v", err)
+	}
+	if _, err := eng.StartWorkflowWithOptions(ctx, "greet", nil, StartWorkflowOptions{Version: "3.0"}); err == nil {
+		t.Fatal("expected error for unregistered version")
+	}
+
+	for id, want := range map[string]string{latest: "1.10", pinned: "1.9"} {
+		st := waitForStatus(t, eng, id, 5*time.Second)
+		if st.WorkflowVersion != want || st.Output != "hello from "+want {
+			t.Errorf("expected version %s, got %s with output %v", want, st.WorkflowVersion, st.Output)
+		}
+	}
+}
+
+func TestGetVersion_ReplaysRecordedDecision(t *testing.T) {
+	store := state.NewInMemoryStore()
+	ctx := context.Background()
+
+	record := func(wfID string, activities ...string) {
+		prior := newExecutionContext(wfID, nil, store, "default", nil)
+		store.AppendEvent(ctx, state.NewEvent(wfID, state.EventWorkflowStarted, map[string]interface{}{}))
+		for _, name := range activities {
+			id := prior.generateActivityID(name, nil)
+			store.AppendEvent(ctx, state.NewEvent(wfID, state.EventActivityScheduled, map[string]interface{}{"activity_id": id}))
+			store.AppendEvent(ctx, state.NewEvent(wfID, state.EventActivityCompleted, map[string]interface{}{"activity_id": id, "output": name}))
+		}
+	}
+	// The new code runs "a" and then guards a change that replaced "b" with "c"
+	run := func(wfID string) (int, error) {
+		events, _ := store.GetEvents(ctx, wfID)
+		execCtx := newExecutionContext(wfID, nil, store, "default", events)
+		if err := execCtx.ExecuteActivity(ctx, "a", nil).Get(ctx, nil); err != nil {
+			t.Fatalf("replay a: %v", err)
+		}
+		return execCtx.GetVersion("use-c", workflow.DefaultVersion, 1)
+	}
+
+	// A run that had already executed "b" keeps the old code path
+	record("wf-old", "a", "b")
+	if v, err := run("wf-old"); err != nil || v != workflow.DefaultVersion {
+		t.Fatalf("expected default version for old run, got %d (%v)", v, err)
+	}
+
+	// A run that reaches the change for the first time takes the new path
+	record("wf-new", "a")
+	if v, err := run("wf-new"); err != nil || v != 1 {
+		t.Fatalf("expected version 1 for new run, got %d (%v)", v, err)
+	}
+
+	// Both decisions are recorded and replayed, even once "b" is gone
+	for id, want := range map[string]int{"wf-old": workflow.DefaultVersion, "wf-new": 1} {
+		if v, err := run(id); err != nil || v != want {
+			t.Errorf("%s: expected recorded version %d, got %d (%v)", id, want, v, err)
+		}
+	}
+
+	// Dropping support for the old path fails old runs instead of diverging
+	events, _ := store.GetEvents(ctx, "wf-old")
+	execCtx := newExecutionContext("wf-old", nil, store, "default", events)
+	if _, err := execCtx.GetVersion("use-c", 1, 1); err == nil {
+		t.Fatal("expected error for unsupported recorded version")
+	}
+}
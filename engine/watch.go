@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+// watchFallbackInterval is how often a wait re-reads the store while events
+// are pushed by a state.EventWatcher. It only matters when a notification is
+// dropped, so it is much slower than the polling used without a watcher.
+const watchFallbackInterval = 5 * time.Second
+
+// eventWaiter receives the watched events a single wait is interested in. A
+// nil ch means the store cannot be watched and the wait only polls.
+type eventWaiter struct {
+	match func(*state.Event) bool
+	ch    chan *state.Event
+}
+
+// startWatch subscribes to the workflow's events once per execution if the
+// store supports it. The subscription ends when the execution returns.
+func (ctx *executionContext) startWatch() {
+	ctx.watchOnce.Do(func() {
+		watcher, ok := ctx.stateStore.(state.EventWatcher)
+		if !ok || ctx.replayOnly {
+			return
+		}
+		lifetime := ctx.lifetime
+		if lifetime == nil {
+			lifetime = ctx.Context
+		}
+		events, err := watcher.WatchEvents(lifetime, ctx.workflowID)
+		if err != nil {
+			log.Printf("[Context] Failed to watch events for workflow %s, polling instead: %v", ctx.workflowID, err)
+			return
+		}
+		ctx.watching = true
+		go ctx.dispatchEvents(events)
+	})
+}
+
+// dispatchEvents hands each watched event to the waiters it matches
+func (ctx *executionContext) dispatchEvents(events <-chan *state.Event) {
+	for evt := range events {
+		ctx.mu.Lock()
+		for w := range ctx.waiters {
+			if !w.match(evt) {
+				continue
+			}
+			select {
+			case w.ch <- evt:
+			default:
+			}
+		}
+		ctx.mu.Unlock()
+	}
+}
+
+// watch registers a waiter for events matching match. Register it before the
+// action that produces the event so the event cannot slip past.
+func (ctx *executionContext) watch(match func(*state.Event) bool) *eventWaiter {
+	ctx.startWatch()
+	w := &eventWaiter{match: match}
+	if !ctx.watching {
+		return w
+	}
+	w.ch = make(chan *state.Event, 1)
+	ctx.mu.Lock()
+	ctx.waiters[w] = struct{}{}
+	ctx.mu.Unlock()
+	return w
+}
+
+// unwatch removes a waiter registered by watch
+func (ctx *executionContext) unwatch(w *eventWaiter) {
+	if w.ch == nil {
+		return
+	}
+	ctx.mu.Lock()
+	delete(ctx.waiters, w)
+	ctx.mu.Unlock()
+}
+
+// waitFor calls check with every event delivered to w, and with nil whenever
+// the store should be re-read, until check reports done. The store is re-read
+// right away, then every pollInterval, or every watchFallbackInterval when
+// events are watched. It returns the cause if waitCtx or the execution ends
+// first. A wait on a workflow.NewDisconnectedContext outlives a canceled or
+// timed out execution, but not one released by its workflow task.
+func (ctx *executionContext) waitFor(waitCtx context.Context, w *eventWaiter, pollInterval time.Duration, check func(evt *state.Event) bool) error {
+	defer ctx.unwatch(w)
+	if w.ch != nil {
+		pollInterval = watchFallbackInterval
+	}
+	if check(nil) {
+		return nil
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	done := ctx.Done()
+	for {
+		select {
+		case <-waitCtx.Done():
+			return context.Cause(waitCtx)
+		case <-done:
+			cause := context.Cause(ctx)
+			if workflow.IsDisconnected(waitCtx) && !errors.Is(cause, errWorkflowTaskReleased) {
+				done = nil
+				continue
+			}
+			return cause
+		case evt := <-w.ch:
+			if check(evt) {
+				return nil
+			}
+		case <-ticker.C:
+			if check(nil) {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/state"
+)
+
+func TestWatch_ResolvesActivityFromEvent(t *testing.T) {
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+	execCtx := newExecutionContext("wf-watch", q, store, "default", nil)
+	runCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	execCtx.Context = runCtx
+
+	future := execCtx.ExecuteActivityWithID(runCtx, "step", "in", "act-1")
+
+	// Only the event lands; the activity state is never saved, so polling alone
+	// would not resolve the future
+	_ = store.AppendEvent(runCtx, state.NewEvent("wf-watch", state.EventActivityCompleted, map[string]interface{}{
+		"activity_id": "act-1",
+		"output":      "done",
+	}))
+
+	getCtx, getCancel := context.WithTimeout(runCtx, 2*time.Second)
+	defer getCancel()
+	var out string
+	if err := future.Get(getCtx, &out); err != nil || out != "done" {
+		t.Fatalf("expected watched result, got %q (%v)", out, err)
+	}
+}
+
+// sinceRecordingStore records where each GetEventsSince read starts and hides
+// the EventWatcher of the store it wraps, so waits fall back to reading
+type sinceRecordingStore struct {
+	state.Store
+	mu     sync.Mutex
+	sinces []int64
+}
+
+func (s *sinceRecordingStore) GetEventsSince(ctx context.Context, workflowID string, since int64) ([]*state.Event, error) {
+	s.mu.Lock()
+	s.sinces = append(s.sinces, since)
+	s.mu.Unlock()
+	return s.Store.GetEventsSince(ctx, workflowID, since)
+}
+
+func TestWatch_SignalWaitReadsPastSeenEvents(t *testing.T) {
+	inner := state.NewInMemoryStore()
+	ctx := context.Background()
+	signal := func(payload int) {
+		_ = inner.AppendEvent(ctx, state.NewEvent("wf-since", state.EventSignalReceived, map[string]interface{}{
+			"signal_name": "go",
+			"payload":     payload,
+		}))
+	}
+	for i := 0; i < 3; i++ {
+		signal(i)
+	}
+	events, _ := inner.GetEvents(ctx, "wf-since")
+	store := &sinceRecordingStore{Store: inner}
+	execCtx := newExecutionContext("wf-since", nil, store, "default", events)
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	execCtx.Context = runCtx
+
+	// The recorded signals replay; the fourth is waited for
+	for i := 0; i < 3; i++ {
+		execCtx.ReceiveSignal("go")
+	}
+	future := execCtx.ReceiveSignal("go")
+	time.Sleep(300 * time.Millisecond)
+	signal(3)
+
+	getCtx, getCancel := context.WithTimeout(ctx, 2*time.Second)
+	defer getCancel()
+	var got int
+	if err := future.Get(getCtx, &got); err != nil || got != 3 {
+		t.Fatalf("expected the fourth signal, got %d (%v)", got, err)
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.sinces) < 2 {
+		t.Fatalf("expected repeated reads, got %v", store.sinces)
+	}
+	for _, since := range store.sinces {
+		if since < 3 {
+			t.Fatalf("expected reads to start past the replayed events, got %v", store.sinces)
+		}
+	}
+}
+
+func TestWatch_SleepEndsWithExecution(t *testing.T) {
+	store := state.NewInMemoryStore()
+	execCtx := newExecutionContext("wf-sleep", nil, store, "default", nil)
+	runCtx, cancel := context.WithCancel(context.Background())
+	execCtx.Context = runCtx
+
+	future := execCtx.Sleep(time.Hour)
+	cancel()
+
+	getCtx, getCancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer getCancel()
+	if err := future.Get(getCtx, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the sleep to end with the execution, got %v", err)
+	}
+}
@@ -0,0 +1,235 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+// DefaultWorkflowTaskIdleTimeout is how long a workflow task keeps a workflow
+// that waits on pending results before releasing it, when
+// Config.WorkflowTaskIdleTimeout is not set
+const DefaultWorkflowTaskIdleTimeout = 500 * time.Millisecond
+
+const (
+	// workflowLeaseTTL bounds how long a crashed worker keeps a workflow
+	// from being run elsewhere; leases are renewed at a third of it
+	workflowLeaseTTL = 30 * time.Second
+	// workflowTaskRetryDelay spaces out redelivery of workflow tasks for a
+	// workflow that is resident on another worker
+	workflowTaskRetryDelay = 100 * time.Millisecond
+)
+
+// errWorkflowTaskReleased is the cause an execution is canceled with when its
+// workflow task hands the workflow back until new events arrive
+var errWorkflowTaskReleased = errors.New("workflow task released")
+
+// ExecuteWorkflowTask runs a workflow task dispatched on
+// Config.WorkflowTaskQueue. The workflow is replayed from its history and
+// executed until it closes or waits on pending results for longer than the
+// idle timeout; it is then released, and the events that unblock it dispatch
+// a new task. A lease in the state store keeps the workflow resident on one
+// engine at a time. It implements worker.WorkflowExecutor.
+func (e *Engine) ExecuteWorkflowTask(ctx context.Context, task *queue.Task) error {
+	workflowID := task.WorkflowID
+	workflowState, err := e.stateStore.GetWorkflowState(ctx, workflowID)
+	if err != nil {
+		return err
+	}
+	if workflowState.IsComplete() {
+		return nil
+	}
+	def, err := e.definitionFor(workflowState)
+	if err != nil {
+		return err
+	}
+
+	// A workflow resident in this engine picks up the new events itself
+	if v, ok := e.runningWorkflows.Load(workflowID); ok && v.(*executionContext).wake() {
+		return nil
+	}
+
+	wt := &workflowTask{
+		lease: "workflow/" + workflowID,
+		owner: fmt.Sprintf("%s/%d", e.id, e.leaseSeq.Add(1)),
+	}
+	held, err := e.stateStore.AcquireLease(ctx, wt.lease, wt.owner, workflowLeaseTTL)
+	if err != nil {
+		return fmt.Errorf("failed to acquire workflow lease: %w", err)
+	}
+	if !held {
+		// Resident elsewhere, or being released there: try again shortly so
+		// the events behind this task are never missed
+		return e.redispatchWorkflowTask(workflowID)
+	}
+	defer e.stateStore.ReleaseLease(context.Background(), wt.lease, wt.owner)
+
+	e.executeWorkflow(ctx, workflowID, def, workflowState.Input, wt)
+	return nil
+}
+
+// workflowTask identifies the workflow lease an execution run by a workflow
+// task holds
+type workflowTask struct {
+	lease string
+	owner string
+}
+
+// runWorkflow executes a workflow in this engine, or dispatches it as a
+// workflow task when the engine is configured with a workflow task queue
+func (e *Engine) runWorkflow(workflowID string, def *workflow.Definition, input interface{}) {
+	if e.workflowTaskQueue == "" {
+		go e.executeWorkflow(context.Background(), workflowID, def, input, nil)
+		return
+	}
+	if err := e.enqueueWorkflowTask(context.Background(), workflowID, time.Time{}); err != nil {
+		log.Printf("[Engine] Failed to dispatch workflow %s: %v", workflowID, err)
+	}
+}
+
+// wakeWorkflow dispatches a workflow task for a workflow that runs as
+// workflow tasks after an event that may unblock it was recorded
+func (e *Engine) wakeWorkflow(ctx context.Context, workflowID string) {
+	if e.workflowTaskQueue == "" {
+		return
+	}
+	if err := e.enqueueWorkflowTask(ctx, workflowID, time.Time{}); err != nil {
+		log.Printf("[Engine] Failed to wake workflow %s: %v", workflowID, err)
+	}
+}
+
+// enqueueWorkflowTask enqueues a workflow task on the workflow task queue,
+// with the priority and fairness key of the workflow, to become visible at
+// visibleAt; the zero time makes it visible right away
+func (e *Engine) enqueueWorkflowTask(ctx context.Context, workflowID string, visibleAt time.Time) error {
+	task := queue.NewTask(queue.TaskTypeWorkflow, workflowID, nil)
+	if workflowState, err := e.stateStore.GetWorkflowState(ctx, workflowID); err == nil {
+		task.Priority = workflowState.Priority
+		task.FairnessKey = workflowState.FairnessKey
+	}
+	return e.queue.EnqueueAt(ctx, e.workflowTaskQueue, task, visibleAt)
+}
+
+// redispatchWorkflowTask enqueues a workflow task again, to become visible
+// after a short delay
+func (e *Engine) redispatchWorkflowTask(workflowID string) error {
+	return e.enqueueWorkflowTask(context.Background(), workflowID, time.Now().Add(workflowTaskRetryDelay))
+}
+
+// releaseWhenIdle cancels a workflow task's execution once the workflow has
+// waited on pending results for the idle timeout, the task's context ends or
+// the workflow lease cannot be renewed. Executions released for any reason
+// other than idling are dispatched again. A canceled or timed out execution
+// is never released; it keeps its lease until it has unwound.
+func (e *Engine) releaseWhenIdle(ctx context.Context, execCtx *executionContext, abort context.CancelCauseFunc) {
+	ticker := time.NewTicker(max(execCtx.idleTimeout/4, 10*time.Millisecond))
+	defer ticker.Stop()
+	renewed := time.Now()
+	done := execCtx.Done()
+	for {
+		select {
+		case <-execCtx.lifetime.Done():
+			return
+		case <-done:
+			done = nil
+		case <-ctx.Done():
+			execCtx.release()
+			abort(errWorkflowTaskReleased)
+			e.wakeWorkflow(context.Background(), execCtx.workflowID)
+			return
+		case now := <-ticker.C:
+			if done != nil && execCtx.releaseIfIdle() {
+				abort(errWorkflowTaskReleased)
+				return
+			}
+			if now.Sub(renewed) < workflowLeaseTTL/3 {
+				continue
+			}
+			if held, err := e.stateStore.AcquireLease(ctx, execCtx.task.lease, execCtx.task.owner, workflowLeaseTTL); err != nil || !held {
+				log.Printf("[Engine] Lost lease on workflow %s, releasing it", execCtx.workflowID)
+				execCtx.release()
+				abort(errWorkflowTaskReleased)
+				e.wakeWorkflow(context.Background(), execCtx.workflowID)
+				return
+			}
+			renewed = now
+		}
+	}
+}
+
+// beginWait records that the workflow waits on an unresolved future
+func (ctx *executionContext) beginWait() {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	ctx.waiting++
+	ctx.idleSince = time.Now()
+}
+
+// endWait records that a wait recorded by beginWait ended
+func (ctx *executionContext) endWait() {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	ctx.waiting--
+	ctx.idleSince = time.Now()
+}
+
+// wake tells a resident workflow task that new events arrived, keeping it
+// resident for another idle timeout. It reports false if the execution was
+// already released.
+func (ctx *executionContext) wake() bool {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	if ctx.released {
+		return false
+	}
+	ctx.woken = true
+	return true
+}
+
+// releaseIfIdle marks the execution released if it has waited on pending
+// results for the idle timeout without being woken
+func (ctx *executionContext) releaseIfIdle() bool {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	if ctx.waiting == 0 || time.Since(ctx.idleSince) < ctx.idleTimeout {
+		return false
+	}
+	if ctx.woken {
+		ctx.woken = false
+		ctx.idleSince = time.Now()
+		return false
+	}
+	ctx.released = true
+	return true
+}
+
+// release marks the execution released regardless of its progress
+func (ctx *executionContext) release() {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	ctx.released = true
+}
+
+// isReleased reports whether the execution gave its workflow task back. A
+// released execution is unwinding and must not issue further commands.
+func (ctx *executionContext) isReleased() bool {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	return ctx.released
+}
+
+// releasedFuture returns a failed future for commands issued after the
+// execution was released, or nil if it was not
+func (ctx *executionContext) releasedFuture(id string) *futureImpl {
+	if !ctx.isReleased() {
+		return nil
+	}
+	f := ctx.newFuture(id)
+	f.setError(errWorkflowTaskReleased)
+	return f
+}
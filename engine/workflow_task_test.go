@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/KamdynS/marathon/activity"
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/worker"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+func TestWorkflowTasks_RunOnWorkers(t *testing.T) {
+	store := state.NewInMemoryStore()
+	var workflowTasks atomic.Int32
+	q := queue.NewInMemoryQueueWithOptions(queue.Options{
+		VisibilityTimeout: 30 * time.Second,
+		Hooks: queue.Hooks{OnEnqueue: func(queueName string, task *queue.Task) {
+			if task.Type == queue.TaskTypeWorkflow {
+				workflowTasks.Add(1)
+			}
+		}},
+	})
+	defer q.Close()
+
+	actReg := activity.NewRegistry()
+	actReg.Register("greet", activity.ActivityFunc(func(ctx context.Context, in interface{}) (interface{}, error) {
+		return fmt.Sprintf("hello %v", in), nil
+	}), activity.Info{})
+
+	var executions atomic.Int32
+	reg := workflow.NewRegistry()
+	reg.Register(&workflow.Definition{Name: "split", Options: workflow.Options{TaskQueue: "default"},
+		Workflow: workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+			executions.Add(1)
+			var greeting string
+			if err := ctx.ExecuteActivity(ctx, "greet", in).Get(ctx, &greeting); err != nil {
+				return nil, err
+			}
+			if err := ctx.Sleep(300*time.Millisecond).Get(ctx, nil); err != nil {
+				return nil, err
+			}
+			var name string
+			if err := ctx.ReceiveSignal("name").Get(ctx, &name); err != nil {
+				return nil, err
+			}
+			return greeting + " and " + name, nil
+		})})
+
+	// The server engine only dispatches; the worker process runs workflow code
+	server, err := New(Config{StateStore: store, Queue: q, WorkflowRegistry: reg, WorkflowTaskQueue: "workflows"})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer server.Stop()
+	runner, err := New(Config{StateStore: store, Queue: q, WorkflowRegistry: reg, WorkflowTaskQueue: "workflows", WorkflowTaskIdleTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer runner.Stop()
+
+	ctx := context.Background()
+	for _, cfg := range []worker.Config{
+		{Queue: q, QueueName: "workflows", WorkflowExecutor: runner, StateStore: store, PollInterval: 50 * time.Millisecond},
+		{Queue: q, QueueName: "default", ActivityRegistry: actReg, StateStore: store, PollInterval: 50 * time.Millisecond},
+	} {
+		w, err := worker.New(cfg)
+		if err != nil {
+			t.Fatalf("worker: %v", err)
+		}
+		w.Start(ctx)
+		defer w.Stop(ctx)
+	}
+
+	id, err := server.StartWorkflow(ctx, "split", "world")
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	// Released while waiting for the signal, the workflow is woken by it
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		events, _ := store.GetEvents(ctx, id)
+		if len(newHistory(events).timerFired) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timer did not fire")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if _, resident := runner.runningWorkflows.Load(id); resident {
+		t.Fatal("expected the idle workflow to be released")
+	}
+	if err := server.SignalWorkflow(ctx, id, "name", "marathon"); err != nil {
+		t.Fatalf("signal: %v", err)
+	}
+
+	st := waitForStatus(t, server, id, 3*time.Second)
+	if st.Status != state.StatusCompleted || st.Output != "hello world and marathon" {
+		t.Fatalf("unexpected result: status=%s output=%v error=%s", st.Status, st.Output, st.Error)
+	}
+	if _, resident := server.runningWorkflows.Load(id); resident || executions.Load() < 2 {
+		t.Fatalf("expected the workflow to be replayed on the worker, got %d executions", executions.Load())
+	}
+	if workflowTasks.Load() < 3 {
+		t.Fatalf("expected workflow tasks for start, timer and signal, got %d", workflowTasks.Load())
+	}
+	if held, _ := store.AcquireLease(ctx, "workflow/"+id, "other", time.Second); !held {
+		t.Fatal("expected the workflow lease to be released")
+	}
+}
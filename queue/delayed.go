@@ -0,0 +1,31 @@
+package queue
+
+import "time"
+
+// delayedTask is a task waiting in an InMemoryQueue until it becomes visible
+type delayedTask struct {
+	queueName string
+	task      *Task
+	visibleAt time.Time
+}
+
+// delayHeap orders delayed tasks by the time they become visible, earliest
+// first. It implements container/heap.Interface.
+type delayHeap []*delayedTask
+
+func (h delayHeap) Len() int { return len(h) }
+func (h delayHeap) Less(i, j int) bool {
+	return h[i].visibleAt.Before(h[j].visibleAt)
+}
+func (h delayHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *delayHeap) Push(x interface{}) { *h = append(*h, x.(*delayedTask)) }
+
+func (h *delayHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
@@ -1,6 +1,7 @@
 package queue
 
 import (
+	"container/heap"
 	"context"
 	"fmt"
 	"sync"
@@ -33,12 +34,17 @@ type Options struct {
 	Hooks Hooks
 }
 
-// InMemoryQueue is a channel-based in-memory queue implementation
+// InMemoryQueue is an in-memory queue implementation. Each queue name serves
+// higher task priorities first and round-robins across fairness keys within
+// a priority.
 type InMemoryQueue struct {
 	mu      sync.RWMutex
-	queues  map[string]chan *Task
+	queues  map[string]*lanes
 	pending map[string]map[string]*pendingRecord // queueName -> taskID -> record
 	dlq     map[string][]*Task                   // optional DLQ per queue
+	delayed delayHeap                            // tasks enqueued with EnqueueAt
+	// delayCh tells delayLoop that the earliest delayed task changed
+	delayCh chan struct{}
 	closed  bool
 	opts    Options
 	stopCh  chan struct{}
@@ -56,57 +62,79 @@ func NewInMemoryQueue() *InMemoryQueue {
 // NewInMemoryQueueWithOptions creates a new in-memory queue with options.
 func NewInMemoryQueueWithOptions(opts Options) *InMemoryQueue {
 	q := &InMemoryQueue{
-		queues:  make(map[string]chan *Task),
+		queues:  make(map[string]*lanes),
 		pending: make(map[string]map[string]*pendingRecord),
 		dlq:     make(map[string][]*Task),
+		delayCh: make(chan struct{}, 1),
 		closed:  false,
 		opts:    opts,
 		stopCh:  make(chan struct{}),
 	}
-	q.wg.Add(1)
+	q.wg.Add(2)
 	go q.scanLoop()
+	go q.delayLoop()
 	return q
 }
 
-// getOrCreateQueue returns an existing queue channel or creates a new one
-func (q *InMemoryQueue) getOrCreateQueue(queueName string) chan *Task {
-	q.mu.Lock()
-	defer q.mu.Unlock()
-
-	if q.closed {
-		return nil
-	}
-
+// getOrCreateQueue returns the ready tasks of a queue, creating the queue if
+// needed. The caller must hold q.mu.
+func (q *InMemoryQueue) getOrCreateQueue(queueName string) *lanes {
 	queue, exists := q.queues[queueName]
 	if !exists {
-		// Create buffered channel to prevent blocking on enqueue
-		queue = make(chan *Task, 100)
+		queue = newLanes()
 		q.queues[queueName] = queue
 		q.pending[queueName] = make(map[string]*pendingRecord)
 		if _, ok := q.dlq[queueName]; !ok {
 			q.dlq[queueName] = make([]*Task, 0)
 		}
 	}
-
 	return queue
 }
 
 // Enqueue implements Queue
 func (q *InMemoryQueue) Enqueue(ctx context.Context, queueName string, task *Task) error {
-	queue := q.getOrCreateQueue(queueName)
-	if queue == nil {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
 		return fmt.Errorf("queue is closed")
 	}
+	q.getOrCreateQueue(queueName).push(task)
+	q.mu.Unlock()
 
-	select {
-	case queue <- task:
-		if q.opts.Hooks.OnEnqueue != nil {
-			q.opts.Hooks.OnEnqueue(queueName, task)
+	if q.opts.Hooks.OnEnqueue != nil {
+		q.opts.Hooks.OnEnqueue(queueName, task)
+	}
+	return nil
+}
+
+// EnqueueAt implements Queue. Delayed tasks wait in a heap ordered by
+// visibleAt and move to their queue once it passes.
+func (q *InMemoryQueue) EnqueueAt(ctx context.Context, queueName string, task *Task, visibleAt time.Time) error {
+	if !visibleAt.After(time.Now()) {
+		return q.Enqueue(ctx, queueName, task)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return fmt.Errorf("queue is closed")
+	}
+	heap.Push(&q.delayed, &delayedTask{queueName: queueName, task: task, visibleAt: visibleAt})
+	earliest := q.delayed[0].task == task
+	q.mu.Unlock()
+
+	if earliest {
+		select {
+		case q.delayCh <- struct{}{}:
+		default:
 		}
-		return nil
-	case <-ctx.Done():
-		return ctx.Err()
 	}
+	return nil
 }
 
 // Dequeue implements Queue
@@ -116,11 +144,6 @@ func (q *InMemoryQueue) Dequeue(ctx context.Context, queueName string) (*Task, e
 
 // DequeueWithTimeout implements Queue
 func (q *InMemoryQueue) DequeueWithTimeout(ctx context.Context, queueName string, timeout time.Duration) (*Task, error) {
-	queue := q.getOrCreateQueue(queueName)
-	if queue == nil {
-		return nil, fmt.Errorf("queue is closed")
-	}
-
 	var timeoutCh <-chan time.Time
 	if timeout > 0 {
 		timer := time.NewTimer(timeout)
@@ -128,34 +151,38 @@ func (q *InMemoryQueue) DequeueWithTimeout(ctx context.Context, queueName string
 		timeoutCh = timer.C
 	}
 
-	select {
-	case task := <-queue:
-		if task != nil {
+	vis := q.opts.VisibilityTimeout
+	if vis <= 0 {
+		vis = 30 * time.Second
+	}
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return nil, fmt.Errorf("queue is closed")
+		}
+		queue := q.getOrCreateQueue(queueName)
+		if task := queue.pop(); task != nil {
 			task.Attempts++
-			vis := q.opts.VisibilityTimeout
-			if vis <= 0 {
-				vis = 30 * time.Second
-			}
-			q.addPending(queueName, task, time.Now().Add(vis))
+			q.pending[queueName][task.ID] = &pendingRecord{task: task, deadline: time.Now().Add(vis)}
+			q.mu.Unlock()
 			if q.opts.Hooks.OnDequeue != nil {
 				q.opts.Hooks.OnDequeue(queueName, task)
 			}
+			return task, nil
 		}
-		return task, nil
-	case <-timeoutCh:
-		return nil, fmt.Errorf("dequeue timeout")
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	}
-}
-
-// addPending adds a task to the inflight/pending map with a visibility deadline.
-func (q *InMemoryQueue) addPending(queueName string, task *Task, deadline time.Time) {
-	q.mu.Lock()
-	defer q.mu.Unlock()
+		ready := queue.ready
+		q.mu.Unlock()
 
-	if pending, exists := q.pending[queueName]; exists {
-		pending[task.ID] = &pendingRecord{task: task, deadline: deadline}
+		select {
+		case <-ready:
+		case <-timeoutCh:
+			return nil, fmt.Errorf("dequeue timeout")
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-q.stopCh:
+			return nil, fmt.Errorf("queue is closed")
+		}
 	}
 }
 
@@ -222,7 +249,7 @@ func (q *InMemoryQueue) Len(ctx context.Context, queueName string) (int, error)
 		return 0, nil
 	}
 
-	return len(queue), nil
+	return queue.size, nil
 }
 
 // Close implements Queue
@@ -240,11 +267,8 @@ func (q *InMemoryQueue) Close() error {
 	q.wg.Wait()
 
 	q.mu.Lock()
-	for _, queue := range q.queues {
-		close(queue)
-	}
-
-	q.queues = make(map[string]chan *Task)
+	q.queues = make(map[string]*lanes)
+	q.delayed = nil
 	q.pending = make(map[string]map[string]*pendingRecord)
 	q.dlq = make(map[string][]*Task)
 	q.mu.Unlock()
@@ -271,21 +295,70 @@ func (q *InMemoryQueue) scanOnce(now time.Time) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 	for queueName, inflight := range q.pending {
-		ch := q.queues[queueName]
+		queue := q.queues[queueName]
 		for id, rec := range inflight {
 			if now.After(rec.deadline) {
 				// Redeliver exactly once per expiry: move back to ready and remove from inflight
-				select {
-				case ch <- rec.task:
-					if q.opts.Hooks.OnRedeliver != nil {
-						q.opts.Hooks.OnRedeliver(queueName, rec.task)
-					}
-					delete(inflight, id)
-				default:
-					// Queue is full; push deadline forward a bit and try again later.
-					rec.deadline = now.Add(200 * time.Millisecond)
+				queue.push(rec.task)
+				if q.opts.Hooks.OnRedeliver != nil {
+					q.opts.Hooks.OnRedeliver(queueName, rec.task)
 				}
+				delete(inflight, id)
 			}
 		}
 	}
 }
+
+// delayLoop moves delayed tasks to their queues as they become visible
+func (q *InMemoryQueue) delayLoop() {
+	defer q.wg.Done()
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		next := q.releaseDelayed(time.Now())
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if next.IsZero() {
+			timer.Reset(time.Hour)
+		} else {
+			timer.Reset(time.Until(next))
+		}
+		select {
+		case <-q.stopCh:
+			return
+		case <-q.delayCh:
+		case <-timer.C:
+		}
+	}
+}
+
+// releaseDelayed enqueues the delayed tasks visible at now and returns when
+// the next one becomes visible, or the zero time if there is none
+func (q *InMemoryQueue) releaseDelayed(now time.Time) time.Time {
+	var released []*delayedTask
+	q.mu.Lock()
+	for len(q.delayed) > 0 && !q.delayed[0].visibleAt.After(now) {
+		d := heap.Pop(&q.delayed).(*delayedTask)
+		if q.closed {
+			continue
+		}
+		q.getOrCreateQueue(d.queueName).push(d.task)
+		released = append(released, d)
+	}
+	var next time.Time
+	if len(q.delayed) > 0 {
+		next = q.delayed[0].visibleAt
+	}
+	q.mu.Unlock()
+
+	if q.opts.Hooks.OnEnqueue != nil {
+		for _, d := range released {
+			q.opts.Hooks.OnEnqueue(d.queueName, d.task)
+		}
+	}
+	return next
+}
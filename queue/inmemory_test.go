@@ -2,6 +2,7 @@ package queue
 
 import (
 	"context"
+	"fmt"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -177,3 +178,99 @@ func TestInMemoryQueue_DLQ_NackNoRequeue(t *testing.T) {
 		t.Fatalf("dlq want 1 with id=%s, got=%d", task.ID, len(d))
 	}
 }
+
+func TestInMemoryQueue_PriorityAndFairness(t *testing.T) {
+	q := NewInMemoryQueue()
+	defer q.Close()
+
+	ctx := context.Background()
+	enqueue := func(input string, priority int, key string) {
+		task := NewTask(TaskTypeActivity, "wf", input)
+		task.ID = input
+		task.Priority = priority
+		task.FairnessKey = key
+		if err := q.Enqueue(ctx, "default", task); err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+	}
+	// One tenant floods the queue before another tenant and an urgent task arrive
+	for i := 1; i <= 3; i++ {
+		enqueue(fmt.Sprintf("big-%d", i), 0, "big")
+	}
+	enqueue("small-1", 0, "small")
+	enqueue("small-2", 0, "small")
+	enqueue("urgent", 10, "big")
+
+	want := []string{"urgent", "big-1", "small-1", "big-2", "small-2", "big-3"}
+	for _, id := range want {
+		got, err := q.DequeueWithTimeout(ctx, "default", time.Second)
+		if err != nil {
+			t.Fatalf("dequeue: %v", err)
+		}
+		if got.ID != id {
+			t.Fatalf("expected %s, got %s", id, got.ID)
+		}
+		_ = q.Ack(ctx, "default", got.ID)
+	}
+	if l, _ := q.Len(ctx, "default"); l != 0 {
+		t.Fatalf("len want 0 got %d", l)
+	}
+}
+
+func TestInMemoryQueue_DequeueWaitsForEnqueue(t *testing.T) {
+	q := NewInMemoryQueue()
+	defer q.Close()
+
+	ctx := context.Background()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = q.Enqueue(ctx, "default", NewTask(TaskTypeActivity, "wf", "x"))
+	}()
+	got, err := q.DequeueWithTimeout(ctx, "default", time.Second)
+	if err != nil || got == nil {
+		t.Fatalf("expected the waiting dequeue to get the task, got %v, %v", got, err)
+	}
+}
+
+func TestInMemoryQueue_EnqueueAt(t *testing.T) {
+	q := NewInMemoryQueue()
+	defer q.Close()
+
+	ctx := context.Background()
+	start := time.Now()
+	later := NewTask(TaskTypeActivity, "wf", "later")
+	sooner := NewTask(TaskTypeActivity, "wf", "sooner")
+	if err := q.EnqueueAt(ctx, "default", later, start.Add(200*time.Millisecond)); err != nil {
+		t.Fatalf("enqueue at: %v", err)
+	}
+	if err := q.EnqueueAt(ctx, "default", sooner, start.Add(100*time.Millisecond)); err != nil {
+		t.Fatalf("enqueue at: %v", err)
+	}
+	if l, _ := q.Len(ctx, "default"); l != 0 {
+		t.Fatalf("expected delayed tasks not to be counted, got len %d", l)
+	}
+	if _, err := q.DequeueWithTimeout(ctx, "default", 50*time.Millisecond); err == nil {
+		t.Fatal("expected no task to be visible yet")
+	}
+
+	for _, want := range []*Task{sooner, later} {
+		got, err := q.DequeueWithTimeout(ctx, "default", time.Second)
+		if err != nil {
+			t.Fatalf("dequeue: %v", err)
+		}
+		if got.Input != want.Input {
+			t.Fatalf("expected %v, got %v", want.Input, got.Input)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("expected the later task after 200ms, got it after %s", elapsed)
+	}
+
+	// A visible time in the past enqueues right away
+	if err := q.EnqueueAt(ctx, "default", NewTask(TaskTypeActivity, "wf", "now"), start); err != nil {
+		t.Fatalf("enqueue at: %v", err)
+	}
+	if l, _ := q.Len(ctx, "default"); l != 1 {
+		t.Fatalf("len want 1 got %d", l)
+	}
+}
@@ -0,0 +1,75 @@
+package queue
+
+import "sort"
+
+// lanes holds the ready tasks of one queue name, grouped by priority and,
+// within a priority, by fairness key.
+type lanes struct {
+	byPriority map[int]*lane
+	// priorities lists the priorities with ready tasks, highest first
+	priorities []int
+	size       int
+	// ready is closed, and replaced, whenever a task is added
+	ready chan struct{}
+}
+
+// lane holds the ready tasks of one priority
+type lane struct {
+	// keys lists the fairness keys with ready tasks in the order they are
+	// served
+	keys  []string
+	tasks map[string][]*Task
+}
+
+func newLanes() *lanes {
+	return &lanes{byPriority: make(map[int]*lane), ready: make(chan struct{})}
+}
+
+// push adds a task behind the other tasks of its priority and fairness key
+func (l *lanes) push(task *Task) {
+	ln, ok := l.byPriority[task.Priority]
+	if !ok {
+		ln = &lane{tasks: make(map[string][]*Task)}
+		l.byPriority[task.Priority] = ln
+		i := sort.Search(len(l.priorities), func(i int) bool { return l.priorities[i] < task.Priority })
+		l.priorities = append(l.priorities, 0)
+		copy(l.priorities[i+1:], l.priorities[i:])
+		l.priorities[i] = task.Priority
+	}
+	if len(ln.tasks[task.FairnessKey]) == 0 {
+		ln.keys = append(ln.keys, task.FairnessKey)
+	}
+	ln.tasks[task.FairnessKey] = append(ln.tasks[task.FairnessKey], task)
+	l.size++
+
+	close(l.ready)
+	l.ready = make(chan struct{})
+}
+
+// pop removes the oldest task of the next fairness key in the highest
+// priority, then moves that key behind the others. It returns nil if there
+// are no ready tasks.
+func (l *lanes) pop() *Task {
+	if len(l.priorities) == 0 {
+		return nil
+	}
+	priority := l.priorities[0]
+	ln := l.byPriority[priority]
+
+	key := ln.keys[0]
+	ln.keys = ln.keys[1:]
+	task := ln.tasks[key][0]
+	ln.tasks[key][0] = nil
+	ln.tasks[key] = ln.tasks[key][1:]
+	if len(ln.tasks[key]) > 0 {
+		ln.keys = append(ln.keys, key)
+	} else {
+		delete(ln.tasks, key)
+	}
+	if len(ln.keys) == 0 {
+		delete(l.byPriority, priority)
+		l.priorities = l.priorities[1:]
+	}
+	l.size--
+	return task
+}
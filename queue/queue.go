@@ -26,8 +26,20 @@ type Task struct {
 	Metadata     map[string]interface{} `json:"metadata"`
 	EnqueueTime  time.Time              `json:"enqueue_time"`
 	Attempts     int                    `json:"attempts"`
+	// Priority orders tasks within a queue: tasks with a higher priority are
+	// served first. The default priority is 0.
+	Priority int `json:"priority,omitempty"`
+	// FairnessKey groups tasks, typically by tenant. Within a priority,
+	// queues serve fairness keys round-robin so that one key with many tasks
+	// cannot starve the others. Tasks without a key share one group.
+	FairnessKey string `json:"fairness_key,omitempty"`
 }
 
+// MetadataWorkflowTaskQueue is the task metadata key naming the queue on which
+// an activity's workflow is woken with a workflow task once the activity
+// closes. The engine sets it when workflows run as workflow tasks.
+const MetadataWorkflowTaskQueue = "workflow_task_queue"
+
 // TaskResult represents the result of task execution
 type TaskResult struct {
 	TaskID     string        `json:"task_id"`
@@ -37,6 +49,18 @@ type TaskResult struct {
 	Output     interface{}   `json:"output,omitempty"`
 	Error      string        `json:"error,omitempty"`
 	Duration   time.Duration `json:"duration"`
+	// Canceled reports that the task was abandoned because its workflow
+	// closed; such tasks are not retried
+	Canceled bool `json:"canceled,omitempty"`
+	// Retried reports that the worker scheduled the task's next attempt
+	// itself, so the failed delivery is acknowledged
+	Retried bool `json:"retried,omitempty"`
+	// Final reports a failure that was recorded as final, such as an
+	// activity that exhausted its retry policy; the task is not redelivered
+	Final bool `json:"final,omitempty"`
+	// Pending reports an activity that awaits asynchronous completion
+	// through its task token; the task is acknowledged
+	Pending bool `json:"pending,omitempty"`
 }
 
 // Queue defines the interface for task distribution
@@ -44,6 +68,11 @@ type Queue interface {
 	// Enqueue adds a task to the queue
 	Enqueue(ctx context.Context, queueName string, task *Task) error
 
+	// EnqueueAt adds a task that stays invisible to Dequeue until visibleAt;
+	// a time that has passed makes it visible right away. Delayed tasks are
+	// not counted by Len until they become visible.
+	EnqueueAt(ctx context.Context, queueName string, task *Task, visibleAt time.Time) error
+
 	// Dequeue retrieves a task from the queue (blocking)
 	Dequeue(ctx context.Context, queueName string) (*Task, error)
 
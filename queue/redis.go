@@ -6,14 +6,22 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
-// RedisQueue is a simple LIST-based queue using Redis.
-// Producer: LPUSH; Consumer: BRPOP with timeout; Ack/Nack are best-effort via side lists.
+// RedisQueue is a LIST-based queue using Redis. Each queue name keeps one
+// list per priority and fairness key, served by Lua scripts in the same order
+// as InMemoryQueue: higher priorities first, fairness keys round-robin within
+// a priority. Delayed tasks wait in a sorted set scored by the time they
+// become visible. Dequeued tasks are held in an in-flight hash until they are
+// Ack'ed or Nack'ed, and Attempts counts the deliveries of each task. Tasks
+// held by a worker that crashes stay in flight and are not delivered again;
+// RedisStreamsQueue redelivers them.
 type RedisQueue struct {
 	rdb   *redis.Client
 	ns    string
@@ -39,13 +47,167 @@ func NewRedisQueue(cfg RedisConfig) (*RedisQueue, error) {
 	return &RedisQueue{rdb: rdb, ns: cfg.Namespace, popTO: cfg.PopTimeout}, nil
 }
 
-func (q *RedisQueue) keyTasks(queueName string) string {
-	return fmt.Sprintf("%s:queue:%s", q.ns, queueName)
+// keyQueue is the prefix of every key of a queue. The hash tag keeps the keys
+// of a queue in one cluster slot, since the scripts derive lane keys from it.
+func (q *RedisQueue) keyQueue(queueName string) string {
+	return fmt.Sprintf("%s:queue:{%s}", q.ns, queueName)
 }
-func (q *RedisQueue) keyInFlight(queueName string) string {
-	return fmt.Sprintf("%s:inflight:%s", q.ns, queueName)
+
+// scriptKeys are the keys shared by the queue scripts
+func (q *RedisQueue) scriptKeys(queueName string) []string {
+	prefix := q.keyQueue(queueName)
+	return []string{
+		prefix + ":priorities",
+		prefix + ":len",
+		prefix + ":wake",
+		prefix + ":delayed",
+		prefix + ":inflight",
+		prefix + ":attempts",
+	}
 }
 
+// luaQueueFunctions are shared by the queue scripts, which all take:
+//
+// KEYS[1] = priorities zset (score=priority)
+// KEYS[2] = ready task counter
+// KEYS[3] = wake list consumers block on
+// KEYS[4] = delayed task zset (score=visible time in ms)
+// KEYS[5] = in-flight task hash (task ID -> task JSON)
+// KEYS[6] = delivery count hash (task ID -> deliveries)
+// ARGV[1] = queue key prefix, from which lane and rotation keys are derived
+//
+// push adds a task to the list of its priority and fairness key, registering
+// the fairness key in the priority's rotation if the list was empty.
+// pushTask does the same with the priority and fairness key read from the
+// task. wake leaves a token for one consumer waiting on the queue.
+const luaQueueFunctions = `
+local function push(task, priority, key)
+  local lane = ARGV[1] .. ':lane:' .. priority .. ':' .. key
+  if redis.call('LPUSH', lane, task) == 1 then
+    redis.call('RPUSH', ARGV[1] .. ':keys:' .. priority, key)
+    redis.call('ZADD', KEYS[1], priority, priority)
+  end
+  redis.call('INCR', KEYS[2])
+end
+local function pushTask(task)
+  local t = cjson.decode(task)
+  local key = t['fairness_key']
+  if type(key) ~= 'string' then
+    key = ''
+  end
+  push(task, tostring(tonumber(t['priority']) or 0), key)
+end
+local function wake()
+  redis.call('LPUSH', KEYS[3], 1)
+  redis.call('LTRIM', KEYS[3], 0, 0)
+end
+`
+
+// redisEnqueue adds a task and wakes a waiting consumer.
+//
+// ARGV[2] = task JSON
+// ARGV[3] = priority
+// ARGV[4] = fairness key
+var redisEnqueue = redis.NewScript(luaQueueFunctions + `
+push(ARGV[2], ARGV[3], ARGV[4])
+wake()
+return 1
+`)
+
+// redisEnqueueAt adds a task to the delayed zset and wakes a waiting
+// consumer, which then waits no longer than until the task is visible.
+//
+// ARGV[2] = task JSON
+// ARGV[3] = visible time in ms
+var redisEnqueueAt = redis.NewScript(luaQueueFunctions + `
+redis.call('ZADD', KEYS[4], ARGV[3], ARGV[2])
+wake()
+return 1
+`)
+
+// redisDequeue moves delayed tasks that are visible to their lists, then pops
+// the oldest task of the next fairness key in the highest priority and moves
+// that key to the back of the rotation. If tasks remain, it passes the wakeup
+// on to the next waiting consumer. The popped task is held in flight and its
+// delivery count incremented. Returns the task JSON and delivery count or, if
+// no task is ready, the visible time in ms of the next delayed task, or nil.
+//
+// ARGV[2] = current time in ms
+var redisDequeue = redis.NewScript(luaQueueFunctions + `
+local due = redis.call('ZRANGEBYSCORE', KEYS[4], '-inf', ARGV[2], 'LIMIT', 0, 100)
+for _, task in ipairs(due) do
+  pushTask(task)
+  redis.call('ZREM', KEYS[4], task)
+end
+
+while true do
+  local top = redis.call('ZREVRANGE', KEYS[1], 0, 0)
+  local p = top[1]
+  if not p then
+    break
+  end
+  local rotation = ARGV[1] .. ':keys:' .. p
+  local key = redis.call('LPOP', rotation)
+  if not key then
+    redis.call('ZREM', KEYS[1], p)
+  else
+    local lane = ARGV[1] .. ':lane:' .. p .. ':' .. key
+    local task = redis.call('RPOP', lane)
+    if redis.call('LLEN', lane) > 0 then
+      redis.call('RPUSH', rotation, key)
+    elseif redis.call('LLEN', rotation) == 0 then
+      redis.call('ZREM', KEYS[1], p)
+    end
+    if task then
+      if redis.call('DECR', KEYS[2]) > 0 then
+        wake()
+      end
+      local id = cjson.decode(task)['id']
+      redis.call('HSET', KEYS[5], id, task)
+      return {task, redis.call('HINCRBY', KEYS[6], id, 1)}
+    end
+  end
+end
+
+local nextDue = redis.call('ZRANGE', KEYS[4], 0, 0, 'WITHSCORES')
+if nextDue[2] then
+  return tonumber(nextDue[2])
+end
+return false
+`)
+
+// redisAck drops an in-flight task. Returns 0 if the task is not in flight.
+//
+// ARGV[2] = task ID
+var redisAck = redis.NewScript(luaQueueFunctions + `
+if redis.call('HDEL', KEYS[5], ARGV[2]) == 0 then
+  return 0
+end
+redis.call('HDEL', KEYS[6], ARGV[2])
+return 1
+`)
+
+// redisNack takes a task out of flight and either puts it back in its list,
+// keeping its delivery count, or drops it. Returns 0 if the task is not in
+// flight.
+//
+// ARGV[2] = task ID
+// ARGV[3] = "1" to requeue the task
+var redisNack = redis.NewScript(luaQueueFunctions + `
+local task = redis.call('HGET', KEYS[5], ARGV[2])
+if not task then
+  return 0
+end
+redis.call('HDEL', KEYS[5], ARGV[2])
+if ARGV[3] == '1' then
+  pushTask(task)
+  wake()
+else
+  redis.call('HDEL', KEYS[6], ARGV[2])
+end
+return 1
+`)
+
 // Enqueue adds a task to the queue.
 func (q *RedisQueue) Enqueue(ctx context.Context, queueName string, task *Task) error {
 	if task == nil {
@@ -55,29 +217,81 @@ func (q *RedisQueue) Enqueue(ctx context.Context, queueName string, task *Task)
 	if err != nil {
 		return err
 	}
-	return q.rdb.LPush(ctx, q.keyTasks(queueName), string(b)).Err()
+	return redisEnqueue.Run(ctx, q.rdb, q.scriptKeys(queueName), q.keyQueue(queueName), string(b), strconv.Itoa(task.Priority), task.FairnessKey).Err()
 }
 
-// DequeueWithTimeout pops a task, moving it to inflight list.
+// EnqueueAt adds a task that becomes visible at visibleAt. Delayed tasks wait
+// in a sorted set and are moved to their lists by consumers once due.
+func (q *RedisQueue) EnqueueAt(ctx context.Context, queueName string, task *Task, visibleAt time.Time) error {
+	if !visibleAt.After(time.Now()) {
+		return q.Enqueue(ctx, queueName, task)
+	}
+	if task == nil {
+		return fmt.Errorf("nil task")
+	}
+	b, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	return redisEnqueueAt.Run(ctx, q.rdb, q.scriptKeys(queueName), q.keyQueue(queueName), string(b), visibleAt.UnixMilli()).Err()
+}
+
+// DequeueWithTimeout pops a task and holds it in flight until it is Ack'ed
+// or Nack'ed. It waits for a task to be enqueued, or a delayed task to
+// become visible, if none is ready.
 func (q *RedisQueue) DequeueWithTimeout(ctx context.Context, queueName string, timeout time.Duration) (*Task, error) {
 	if timeout <= 0 {
 		timeout = q.popTO
 	}
-	res, err := q.rdb.BRPop(ctx, timeout, q.keyTasks(queueName)).Result()
-	if err != nil {
-		return nil, err
+	deadline := time.Now().Add(timeout)
+	keys := q.scriptKeys(queueName)
+	for {
+		res, err := redisDequeue.Run(ctx, q.rdb, keys, q.keyQueue(queueName), time.Now().UnixMilli()).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+		wait := time.Until(deadline)
+		switch v := res.(type) {
+		case []interface{}:
+			body, _ := v[0].(string)
+			deliveries, _ := v[1].(int64)
+			var t Task
+			if err := json.Unmarshal([]byte(body), &t); err != nil {
+				return nil, err
+			}
+			t.Attempts += int(deliveries)
+			return &t, nil
+		case int64:
+			wait = min(wait, time.Until(time.UnixMilli(v)))
+		}
+
+		if time.Until(deadline) <= 0 {
+			return nil, fmt.Errorf("dequeue timeout")
+		}
+		if err := awaitRedisWake(ctx, q.rdb, q.keyQueue(queueName)+":wake", wait); err != nil {
+			return nil, err
+		}
 	}
-	if len(res) != 2 {
-		return nil, fmt.Errorf("unexpected BRPOP result")
+}
+
+// awaitRedisWake blocks until an enqueue leaves a token on the wake list or
+// d elapses. BRPOP takes whole seconds, so shorter waits sleep instead.
+func awaitRedisWake(ctx context.Context, rdb *redis.Client, wakeKey string, d time.Duration) error {
+	if d < time.Second {
+		timer := time.NewTimer(max(min(d, 100*time.Millisecond), 0))
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
-	payload := res[1]
-	// Push to inflight for visibility window best-effort
-	_ = q.rdb.LPush(ctx, q.keyInFlight(queueName), payload).Err()
-	var t Task
-	if err := json.Unmarshal([]byte(payload), &t); err != nil {
-		return nil, err
+	err := rdb.BRPop(ctx, d.Truncate(time.Second), wakeKey).Err()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
 	}
-	return &t, nil
+	return nil
 }
 
 // Dequeue is a convenience for DequeueWithTimeout with default timeout.
@@ -85,28 +299,42 @@ func (q *RedisQueue) Dequeue(ctx context.Context, queueName string) (*Task, erro
 	return q.DequeueWithTimeout(ctx, queueName, q.popTO)
 }
 
-// Ack removes a task from inflight list.
+// Ack removes a task from the in-flight hash.
 func (q *RedisQueue) Ack(ctx context.Context, queueName string, taskID string) error {
-	// Best-effort: scan inflight head and remove matching ID
-	key := q.keyInFlight(queueName)
-	// LREM with a constructed payload match is expensive; we store only IDs alongside full payload in practice.
-	// For simplicity, we trim inflight periodically; here we no-op.
-	_ = key
+	n, err := redisAck.Run(ctx, q.rdb, q.scriptKeys(queueName), q.keyQueue(queueName), taskID).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("task %s not found in flight", taskID)
+	}
 	return nil
 }
 
-// Nack optionally requeues.
+// Nack removes a task from the in-flight hash and, if requeue is set, puts
+// it back in its list.
 func (q *RedisQueue) Nack(ctx context.Context, queueName string, taskID string, requeue bool) error {
+	flag := "0"
 	if requeue {
-		// No direct lookup by ID; caller should re-enqueue full task if needed.
+		flag = "1"
+	}
+	n, err := redisNack.Run(ctx, q.rdb, q.scriptKeys(queueName), q.keyQueue(queueName), taskID, flag).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("task %s not found in flight", taskID)
 	}
 	return nil
 }
 
 // Len returns pending tasks length.
 func (q *RedisQueue) Len(ctx context.Context, queueName string) (int, error) {
-	n, err := q.rdb.LLen(ctx, q.keyTasks(queueName)).Result()
-	return int(n), err
+	n, err := q.rdb.Get(ctx, q.keyQueue(queueName)+":len").Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return n, err
 }
 
 // Close closes the Redis client.
@@ -0,0 +1,514 @@
+//go:build redis
+// +build redis
+
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStreamsQueue is a Redis Streams queue for workers sharing a consumer
+// group. Unlike RedisQueue it keeps delivered tasks pending until they are
+// acknowledged: tasks not acknowledged within the visibility timeout, for
+// example because their worker crashed, are claimed by another consumer with
+// XAUTOCLAIM, and tasks delivered more than MaxDeliveries times or Nack'ed
+// without requeue move to the queue's dead-letter stream. Task.Attempts is
+// the number of times the task was delivered.
+//
+// Each priority and fairness key has its own stream, served by Lua scripts in
+// the same order as InMemoryQueue. Requires Redis 6.2 or later.
+type RedisStreamsQueue struct {
+	rdb *redis.Client
+	cfg RedisStreamsConfig
+
+	mu sync.Mutex
+	// handles maps the IDs of tasks delivered to this consumer to their
+	// stream entries, for Ack and Nack
+	handles map[string]streamEntry
+	// reclaimedAt throttles the scan for expired deliveries per queue name
+	reclaimedAt map[string]time.Time
+}
+
+// RedisStreamsConfig configures the RedisStreamsQueue.
+type RedisStreamsConfig struct {
+	Addr      string
+	Username  string
+	Password  string
+	DB        int
+	Namespace string
+	// Group is the consumer group shared by all workers of a queue;
+	// defaults to "marathon"
+	Group string
+	// Consumer names this process within the group; defaults to the host
+	// name and process ID
+	Consumer string
+	// VisibilityTimeout is how long a delivered task may go unacknowledged
+	// before it is redelivered; defaults to 30 seconds
+	VisibilityTimeout time.Duration
+	// MaxDeliveries is how many times a task is delivered before it moves to
+	// the dead-letter stream; defaults to 10, and a negative value disables
+	// the limit
+	MaxDeliveries int
+	PopTimeout    time.Duration
+}
+
+// streamEntry locates a delivered task in its stream
+type streamEntry struct {
+	stream  string
+	id      string
+	payload string
+}
+
+// NewRedisStreamsQueue creates a Redis Streams-backed queue.
+func NewRedisStreamsQueue(cfg RedisStreamsConfig) (*RedisStreamsQueue, error) {
+	if cfg.Group == "" {
+		cfg.Group = "marathon"
+	}
+	if cfg.Consumer == "" {
+		host, _ := os.Hostname()
+		cfg.Consumer = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if cfg.VisibilityTimeout <= 0 {
+		cfg.VisibilityTimeout = 30 * time.Second
+	}
+	if cfg.MaxDeliveries == 0 {
+		cfg.MaxDeliveries = 10
+	}
+	if cfg.PopTimeout == 0 {
+		cfg.PopTimeout = 5 * time.Second
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: cfg.Addr, Username: cfg.Username, Password: cfg.Password, DB: cfg.DB})
+	return &RedisStreamsQueue{
+		rdb:         rdb,
+		cfg:         cfg,
+		handles:     make(map[string]streamEntry),
+		reclaimedAt: make(map[string]time.Time),
+	}, nil
+}
+
+// keyQueue is the prefix of every key of a queue, hash-tagged like
+// RedisQueue's
+func (q *RedisStreamsQueue) keyQueue(queueName string) string {
+	return fmt.Sprintf("%s:streams:{%s}", q.cfg.Namespace, queueName)
+}
+
+// keyDeadLetters is the dead-letter stream of a queue
+func (q *RedisStreamsQueue) keyDeadLetters(queueName string) string {
+	return q.keyQueue(queueName) + ":dead"
+}
+
+// scriptKeys are the keys shared by the queue scripts
+func (q *RedisStreamsQueue) scriptKeys(queueName string) []string {
+	prefix := q.keyQueue(queueName)
+	return []string{
+		prefix + ":priorities",
+		prefix + ":len",
+		prefix + ":wake",
+		prefix + ":delayed",
+		prefix + ":ready",
+		prefix + ":lanes",
+	}
+}
+
+// luaStreamsFunctions are shared by the streams queue scripts, which all
+// take:
+//
+// KEYS[1] = priorities zset (score=priority)
+// KEYS[2] = undelivered task counter
+// KEYS[3] = wake list consumers block on
+// KEYS[4] = delayed task zset (score=visible time in ms)
+// KEYS[5] = hash of undelivered task counts per lane stream
+// KEYS[6] = set of all lane streams, scanned for expired deliveries
+// ARGV[1] = queue key prefix, from which lane and rotation keys are derived
+// ARGV[2] = consumer group
+//
+// push adds a task to the stream of its priority and fairness key, creating
+// the stream's consumer group on first use and registering the fairness key
+// in the priority's rotation if the stream had no undelivered tasks.
+const luaStreamsFunctions = `
+redis.replicate_commands()
+local function push(task, priority, key)
+  local lane = ARGV[1] .. ':lane:' .. priority .. ':' .. key
+  if redis.call('SADD', KEYS[6], lane) == 1 then
+    redis.pcall('XGROUP', 'CREATE', lane, ARGV[2], '0', 'MKSTREAM')
+  end
+  redis.call('XADD', lane, '*', 'task', task)
+  if redis.call('HINCRBY', KEYS[5], lane, 1) == 1 then
+    redis.call('RPUSH', ARGV[1] .. ':keys:' .. priority, key)
+    redis.call('ZADD', KEYS[1], priority, priority)
+  end
+  redis.call('INCR', KEYS[2])
+end
+local function wake()
+  redis.call('LPUSH', KEYS[3], 1)
+  redis.call('LTRIM', KEYS[3], 0, 0)
+end
+`
+
+// streamsEnqueue adds a task and wakes a waiting consumer.
+//
+// ARGV[3] = task JSON
+// ARGV[4] = priority
+// ARGV[5] = fairness key
+var streamsEnqueue = redis.NewScript(luaStreamsFunctions + `
+push(ARGV[3], ARGV[4], ARGV[5])
+wake()
+return 1
+`)
+
+// streamsEnqueueAt adds a task to the delayed zset and wakes a waiting
+// consumer, which then waits no longer than until the task is visible.
+//
+// ARGV[3] = task JSON
+// ARGV[4] = visible time in ms
+var streamsEnqueueAt = redis.NewScript(luaStreamsFunctions + `
+redis.call('ZADD', KEYS[4], ARGV[4], ARGV[3])
+wake()
+return 1
+`)
+
+// streamsDequeue moves delayed tasks that are visible to their streams, then
+// reads the next undelivered task of the next fairness key in the highest
+// priority for the consumer and moves that key to the back of the rotation.
+// Returns {stream, entry ID, task JSON} or, if no task is ready, the visible
+// time in ms of the next delayed task, or nil.
+//
+// ARGV[3] = consumer
+// ARGV[4] = current time in ms
+var streamsDequeue = redis.NewScript(luaStreamsFunctions + `
+local due = redis.call('ZRANGEBYSCORE', KEYS[4], '-inf', ARGV[4], 'LIMIT', 0, 100)
+for _, task in ipairs(due) do
+  local t = cjson.decode(task)
+  local key = t['fairness_key']
+  if type(key) ~= 'string' then
+    key = ''
+  end
+  push(task, tostring(tonumber(t['priority']) or 0), key)
+  redis.call('ZREM', KEYS[4], task)
+end
+
+while true do
+  local top = redis.call('ZREVRANGE', KEYS[1], 0, 0)
+  local p = top[1]
+  if not p then
+    break
+  end
+  local rotation = ARGV[1] .. ':keys:' .. p
+  local key = redis.call('LPOP', rotation)
+  if not key then
+    redis.call('ZREM', KEYS[1], p)
+  else
+    local lane = ARGV[1] .. ':lane:' .. p .. ':' .. key
+    local res = redis.call('XREADGROUP', 'GROUP', ARGV[2], ARGV[3], 'COUNT', 1, 'STREAMS', lane, '>')
+    local entry = res and res[1][2][1]
+    local left = 0
+    if entry then
+      left = redis.call('HINCRBY', KEYS[5], lane, -1)
+    end
+    if left > 0 then
+      redis.call('RPUSH', rotation, key)
+    else
+      redis.call('HDEL', KEYS[5], lane)
+      if redis.call('LLEN', rotation) == 0 then
+        redis.call('ZREM', KEYS[1], p)
+      end
+    end
+    if entry then
+      if redis.call('DECR', KEYS[2]) > 0 then
+        wake()
+      end
+      return {lane, entry[1], entry[2][2]}
+    end
+  end
+end
+
+local nextDue = redis.call('ZRANGE', KEYS[4], 0, 0, 'WITHSCORES')
+if nextDue[2] then
+  return tonumber(nextDue[2])
+end
+return false
+`)
+
+// Enqueue adds a task to the queue.
+func (q *RedisStreamsQueue) Enqueue(ctx context.Context, queueName string, task *Task) error {
+	if task == nil {
+		return fmt.Errorf("nil task")
+	}
+	b, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	return streamsEnqueue.Run(ctx, q.rdb, q.scriptKeys(queueName), q.keyQueue(queueName), q.cfg.Group, string(b), strconv.Itoa(task.Priority), task.FairnessKey).Err()
+}
+
+// EnqueueAt adds a task that becomes visible at visibleAt.
+func (q *RedisStreamsQueue) EnqueueAt(ctx context.Context, queueName string, task *Task, visibleAt time.Time) error {
+	if !visibleAt.After(time.Now()) {
+		return q.Enqueue(ctx, queueName, task)
+	}
+	if task == nil {
+		return fmt.Errorf("nil task")
+	}
+	b, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	return streamsEnqueueAt.Run(ctx, q.rdb, q.scriptKeys(queueName), q.keyQueue(queueName), q.cfg.Group, string(b), visibleAt.UnixMilli()).Err()
+}
+
+// Dequeue is a convenience for DequeueWithTimeout with default timeout.
+func (q *RedisStreamsQueue) Dequeue(ctx context.Context, queueName string) (*Task, error) {
+	return q.DequeueWithTimeout(ctx, queueName, q.cfg.PopTimeout)
+}
+
+// DequeueWithTimeout delivers a task whose previous delivery expired, if
+// any, or else the next undelivered task. It waits for a task if none is
+// ready.
+func (q *RedisStreamsQueue) DequeueWithTimeout(ctx context.Context, queueName string, timeout time.Duration) (*Task, error) {
+	if timeout <= 0 {
+		timeout = q.cfg.PopTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	keys := q.scriptKeys(queueName)
+	for {
+		task, err := q.reclaim(ctx, queueName)
+		if err != nil || task != nil {
+			return task, err
+		}
+
+		res, err := streamsDequeue.Run(ctx, q.rdb, keys, q.keyQueue(queueName), q.cfg.Group, q.cfg.Consumer, time.Now().UnixMilli()).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+		// Wake up in time to scan for expired deliveries again
+		wait := min(time.Until(deadline), q.reclaimInterval())
+		switch v := res.(type) {
+		case []interface{}:
+			if len(v) != 3 {
+				return nil, fmt.Errorf("unexpected dequeue result")
+			}
+			stream, _ := v[0].(string)
+			id, _ := v[1].(string)
+			payload, _ := v[2].(string)
+			return q.deliver(streamEntry{stream: stream, id: id, payload: payload}, 1)
+		case int64:
+			wait = min(wait, time.Until(time.UnixMilli(v)))
+		}
+
+		if time.Until(deadline) <= 0 {
+			return nil, fmt.Errorf("dequeue timeout")
+		}
+		if err := awaitRedisWake(ctx, q.rdb, q.keyQueue(queueName)+":wake", wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// reclaimInterval is how often a consumer scans a queue's streams for
+// deliveries that outlived the visibility timeout
+func (q *RedisStreamsQueue) reclaimInterval() time.Duration {
+	return max(q.cfg.VisibilityTimeout/4, 100*time.Millisecond)
+}
+
+// reclaim claims a task whose delivery went unacknowledged for the
+// visibility timeout, moving tasks delivered too often to the dead-letter
+// stream. It returns nil if there is none or the queue was scanned recently.
+func (q *RedisStreamsQueue) reclaim(ctx context.Context, queueName string) (*Task, error) {
+	q.mu.Lock()
+	if time.Since(q.reclaimedAt[queueName]) < q.reclaimInterval() {
+		q.mu.Unlock()
+		return nil, nil
+	}
+	q.reclaimedAt[queueName] = time.Now()
+	q.mu.Unlock()
+
+	streams, err := q.rdb.SMembers(ctx, q.keyQueue(queueName)+":lanes").Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, stream := range streams {
+		// XAUTOCLAIM examines a bounded number of pending entries per call,
+		// so follow its cursor through the whole pending list
+		cursor := "0-0"
+		for {
+			msgs, next, err := q.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+				Stream:   stream,
+				Group:    q.cfg.Group,
+				Consumer: q.cfg.Consumer,
+				MinIdle:  q.cfg.VisibilityTimeout,
+				Start:    cursor,
+				Count:    1,
+			}).Result()
+			if err != nil {
+				return nil, err
+			}
+			for _, msg := range msgs {
+				t, err := q.claimed(ctx, queueName, stream, msg)
+				if err != nil || t != nil {
+					return t, err
+				}
+			}
+			if next == "" || next == "0-0" {
+				break
+			}
+			cursor = next
+		}
+	}
+	return nil, nil
+}
+
+// claimed delivers a task claimed by reclaim, or moves it to the dead-letter
+// stream if it was delivered too often. It returns nil if the task is not
+// delivered.
+func (q *RedisStreamsQueue) claimed(ctx context.Context, queueName, stream string, msg redis.XMessage) (*Task, error) {
+	entry := streamEntry{stream: stream, id: msg.ID}
+	entry.payload, _ = msg.Values["task"].(string)
+	if entry.payload == "" {
+		// Deleted while pending
+		q.rdb.XAck(ctx, stream, q.cfg.Group, msg.ID)
+		return nil, nil
+	}
+	pending, err := q.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: stream,
+		Group:  q.cfg.Group,
+		Start:  msg.ID,
+		End:    msg.ID,
+		Count:  1,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	deliveries := 1
+	if len(pending) == 1 {
+		deliveries = int(pending[0].RetryCount)
+	}
+	if q.cfg.MaxDeliveries > 0 && deliveries > q.cfg.MaxDeliveries {
+		return nil, q.deadLetter(ctx, queueName, entry, "max deliveries exceeded")
+	}
+
+	// More deliveries may have expired; scan again on the next call
+	q.resetReclaim(queueName)
+	return q.deliver(entry, deliveries)
+}
+
+// resetReclaim makes the next dequeue scan the queue for expired deliveries
+func (q *RedisStreamsQueue) resetReclaim(queueName string) {
+	q.mu.Lock()
+	delete(q.reclaimedAt, queueName)
+	q.mu.Unlock()
+}
+
+// deliver decodes a delivered task and remembers its stream entry
+func (q *RedisStreamsQueue) deliver(entry streamEntry, deliveries int) (*Task, error) {
+	var t Task
+	if err := json.Unmarshal([]byte(entry.payload), &t); err != nil {
+		return nil, err
+	}
+	t.Attempts = deliveries
+	q.mu.Lock()
+	q.handles[t.ID] = entry
+	q.mu.Unlock()
+	return &t, nil
+}
+
+// handle returns and forgets the stream entry of a task delivered to this
+// consumer
+func (q *RedisStreamsQueue) handle(taskID string) (streamEntry, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	entry, ok := q.handles[taskID]
+	if !ok {
+		return entry, fmt.Errorf("task %s not found in pending", taskID)
+	}
+	delete(q.handles, taskID)
+	return entry, nil
+}
+
+// Ack acknowledges and deletes a delivered task.
+func (q *RedisStreamsQueue) Ack(ctx context.Context, queueName string, taskID string) error {
+	entry, err := q.handle(taskID)
+	if err != nil {
+		return err
+	}
+	_, err = q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAck(ctx, entry.stream, q.cfg.Group, entry.id)
+		pipe.XDel(ctx, entry.stream, entry.id)
+		return nil
+	})
+	return err
+}
+
+// Nack makes a delivered task available for redelivery right away, or moves
+// it to the dead-letter stream if requeue is false.
+func (q *RedisStreamsQueue) Nack(ctx context.Context, queueName string, taskID string, requeue bool) error {
+	entry, err := q.handle(taskID)
+	if err != nil {
+		return err
+	}
+	if !requeue {
+		return q.deadLetter(ctx, queueName, entry, "nacked")
+	}
+	// Mark the delivery as expired so the next scan claims it; JUSTID leaves
+	// the delivery count to that claim
+	idle := (q.cfg.VisibilityTimeout + time.Millisecond).Milliseconds()
+	if err := q.rdb.Do(ctx, "XCLAIM", entry.stream, q.cfg.Group, q.cfg.Consumer, 0, entry.id, "IDLE", idle, "JUSTID").Err(); err != nil {
+		return err
+	}
+	q.resetReclaim(queueName)
+	return nil
+}
+
+// deadLetter moves a delivered task to the queue's dead-letter stream
+func (q *RedisStreamsQueue) deadLetter(ctx context.Context, queueName string, entry streamEntry, reason string) error {
+	_, err := q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: q.keyDeadLetters(queueName),
+			Values: map[string]interface{}{"task": entry.payload, "stream": entry.stream, "reason": reason},
+		})
+		pipe.XAck(ctx, entry.stream, q.cfg.Group, entry.id)
+		pipe.XDel(ctx, entry.stream, entry.id)
+		return nil
+	})
+	return err
+}
+
+// DeadLetters returns up to count tasks from the queue's dead-letter stream,
+// oldest first.
+func (q *RedisStreamsQueue) DeadLetters(ctx context.Context, queueName string, count int64) ([]*Task, error) {
+	msgs, err := q.rdb.XRangeN(ctx, q.keyDeadLetters(queueName), "-", "+", count).Result()
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]*Task, 0, len(msgs))
+	for _, msg := range msgs {
+		payload, _ := msg.Values["task"].(string)
+		var t Task
+		if err := json.Unmarshal([]byte(payload), &t); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, &t)
+	}
+	return tasks, nil
+}
+
+// Len returns the number of undelivered tasks; delivered tasks awaiting
+// acknowledgement and delayed tasks are not counted.
+func (q *RedisStreamsQueue) Len(ctx context.Context, queueName string) (int, error) {
+	n, err := q.rdb.Get(ctx, q.keyQueue(queueName)+":len").Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return n, err
+}
+
+// Close closes the Redis client.
+func (q *RedisStreamsQueue) Close() error { return q.rdb.Close() }
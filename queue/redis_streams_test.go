@@ -0,0 +1,168 @@
+//go:build redis
+// +build redis
+
+package queue
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func newTestRedisStreamsQueue(t *testing.T, cfg RedisStreamsConfig) *RedisStreamsQueue {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR not set; skipping Redis queue tests")
+	}
+	cfg.Addr = addr
+	q, err := NewRedisStreamsQueue(cfg)
+	if err != nil {
+		t.Fatalf("new queue: %v", err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func TestRedisStreamsQueue_AckAndPriority(t *testing.T) {
+	q := newTestRedisStreamsQueue(t, RedisStreamsConfig{Namespace: fmt.Sprintf("marathon-test-%d", time.Now().UnixNano()), PopTimeout: time.Second})
+	ctx := context.Background()
+
+	low := NewTask(TaskTypeActivity, "wf", "low")
+	high := NewTask(TaskTypeActivity, "wf", "high")
+	high.ID = low.ID + "-high"
+	high.Priority = 1
+	for _, task := range []*Task{low, high} {
+		if err := q.Enqueue(ctx, "default", task); err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+	}
+	if l, _ := q.Len(ctx, "default"); l != 2 {
+		t.Fatalf("len want 2 got %d", l)
+	}
+	for _, want := range []*Task{high, low} {
+		got, err := q.DequeueWithTimeout(ctx, "default", time.Second)
+		if err != nil {
+			t.Fatalf("dequeue: %v", err)
+		}
+		if got.ID != want.ID || got.Attempts != 1 {
+			t.Fatalf("expected %s on its first delivery, got %s attempt %d", want.ID, got.ID, got.Attempts)
+		}
+		if err := q.Ack(ctx, "default", got.ID); err != nil {
+			t.Fatalf("ack: %v", err)
+		}
+	}
+	if l, _ := q.Len(ctx, "default"); l != 0 {
+		t.Fatalf("len want 0 got %d", l)
+	}
+	if _, err := q.DequeueWithTimeout(ctx, "default", 200*time.Millisecond); err == nil {
+		t.Fatal("expected acknowledged tasks not to be redelivered")
+	}
+}
+
+func TestRedisStreamsQueue_RedeliversToAnotherConsumer(t *testing.T) {
+	cfg := RedisStreamsConfig{
+		Namespace:         fmt.Sprintf("marathon-test-%d", time.Now().UnixNano()),
+		VisibilityTimeout: 200 * time.Millisecond,
+		MaxDeliveries:     2,
+		PopTimeout:        time.Second,
+	}
+	cfg.Consumer = "crashed"
+	crashed := newTestRedisStreamsQueue(t, cfg)
+	cfg.Consumer = "healthy"
+	healthy := newTestRedisStreamsQueue(t, cfg)
+	ctx := context.Background()
+
+	task := NewTask(TaskTypeActivity, "wf", "x")
+	if err := crashed.Enqueue(ctx, "default", task); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if _, err := crashed.DequeueWithTimeout(ctx, "default", time.Second); err != nil {
+		t.Fatalf("dequeue: %v", err)
+	}
+
+	// The first consumer never acknowledges; another claims the task
+	got, err := healthy.DequeueWithTimeout(ctx, "default", 2*time.Second)
+	if err != nil {
+		t.Fatalf("redelivery: %v", err)
+	}
+	if got.ID != task.ID || got.Attempts != 2 {
+		t.Fatalf("expected %s on its second delivery, got %s attempt %d", task.ID, got.ID, got.Attempts)
+	}
+
+	// A third delivery exceeds MaxDeliveries and dead-letters the task
+	if _, err := healthy.DequeueWithTimeout(ctx, "default", time.Second); err == nil {
+		t.Fatal("expected the task to move to the dead-letter stream instead")
+	}
+	dead, err := healthy.DeadLetters(ctx, "default", 10)
+	if err != nil {
+		t.Fatalf("dead letters: %v", err)
+	}
+	if len(dead) != 1 || dead[0].ID != task.ID {
+		t.Fatalf("expected the task in the dead-letter stream, got %v", dead)
+	}
+}
+
+func TestRedisStreamsQueue_Nack(t *testing.T) {
+	q := newTestRedisStreamsQueue(t, RedisStreamsConfig{Namespace: fmt.Sprintf("marathon-test-%d", time.Now().UnixNano()), PopTimeout: time.Second})
+	ctx := context.Background()
+
+	task := NewTask(TaskTypeActivity, "wf", "x")
+	if err := q.Enqueue(ctx, "default", task); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	got, err := q.DequeueWithTimeout(ctx, "default", time.Second)
+	if err != nil {
+		t.Fatalf("dequeue: %v", err)
+	}
+	if err := q.Nack(ctx, "default", got.ID, true); err != nil {
+		t.Fatalf("nack: %v", err)
+	}
+	got, err = q.DequeueWithTimeout(ctx, "default", time.Second)
+	if err != nil {
+		t.Fatalf("redelivery: %v", err)
+	}
+	if got.ID != task.ID || got.Attempts != 2 {
+		t.Fatalf("expected %s on its second delivery, got %s attempt %d", task.ID, got.ID, got.Attempts)
+	}
+	if err := q.Nack(ctx, "default", got.ID, false); err != nil {
+		t.Fatalf("nack: %v", err)
+	}
+	if dead, _ := q.DeadLetters(ctx, "default", 10); len(dead) != 1 {
+		t.Fatalf("expected the task in the dead-letter stream, got %d", len(dead))
+	}
+	if _, err := q.DequeueWithTimeout(ctx, "default", 200*time.Millisecond); err == nil {
+		t.Fatal("expected the dead-lettered task not to be redelivered")
+	}
+}
+
+func TestRedisStreamsQueue_NackBehindManyInFlight(t *testing.T) {
+	q := newTestRedisStreamsQueue(t, RedisStreamsConfig{Namespace: fmt.Sprintf("marathon-test-%d", time.Now().UnixNano()), PopTimeout: time.Second})
+	ctx := context.Background()
+
+	// XAUTOCLAIM scans ten pending entries per call with a count of one, so
+	// the Nack'ed entry is only found by following its cursor
+	var last *Task
+	for i := 0; i < 16; i++ {
+		last = NewTask(TaskTypeActivity, "wf", fmt.Sprintf("x%d", i))
+		if err := q.Enqueue(ctx, "default", last); err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+	}
+	for i := 0; i < 16; i++ {
+		if _, err := q.DequeueWithTimeout(ctx, "default", time.Second); err != nil {
+			t.Fatalf("dequeue %d: %v", i, err)
+		}
+	}
+	if err := q.Nack(ctx, "default", last.ID, true); err != nil {
+		t.Fatalf("nack: %v", err)
+	}
+	got, err := q.DequeueWithTimeout(ctx, "default", time.Second)
+	if err != nil {
+		t.Fatalf("redelivery: %v", err)
+	}
+	if got.ID != last.ID || got.Attempts != 2 {
+		t.Fatalf("expected %s on its second delivery, got %s attempt %d", last.ID, got.ID, got.Attempts)
+	}
+}
@@ -0,0 +1,140 @@
+//go:build redis
+// +build redis
+
+package queue
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func newTestRedisQueue(t *testing.T) *RedisQueue {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR not set; skipping Redis queue tests")
+	}
+	q, err := NewRedisQueue(RedisConfig{Addr: addr, Namespace: fmt.Sprintf("marathon-test-%d", time.Now().UnixNano()), PopTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("new queue: %v", err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func TestRedisQueue_PriorityAndFairness(t *testing.T) {
+	q := newTestRedisQueue(t)
+
+	ctx := context.Background()
+	enqueue := func(id string, priority int, key string) {
+		task := NewTask(TaskTypeActivity, "wf", id)
+		task.ID = id
+		task.Priority = priority
+		task.FairnessKey = key
+		if err := q.Enqueue(ctx, "default", task); err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+	}
+	for i := 1; i <= 3; i++ {
+		enqueue(fmt.Sprintf("big-%d", i), 0, "big")
+	}
+	enqueue("small-1", 0, "small")
+	enqueue("small-2", 0, "small")
+	enqueue("urgent", 10, "big")
+
+	if l, _ := q.Len(ctx, "default"); l != 6 {
+		t.Fatalf("len want 6 got %d", l)
+	}
+	for _, id := range []string{"urgent", "big-1", "small-1", "big-2", "small-2", "big-3"} {
+		got, err := q.DequeueWithTimeout(ctx, "default", time.Second)
+		if err != nil {
+			t.Fatalf("dequeue: %v", err)
+		}
+		if got.ID != id {
+			t.Fatalf("expected %s, got %s", id, got.ID)
+		}
+	}
+	if _, err := q.DequeueWithTimeout(ctx, "default", 100*time.Millisecond); err == nil {
+		t.Fatal("expected the empty queue to time out")
+	}
+}
+
+func TestRedisQueue_EnqueueAt(t *testing.T) {
+	q := newTestRedisQueue(t)
+
+	ctx := context.Background()
+	start := time.Now()
+	task := NewTask(TaskTypeActivity, "wf", "later")
+	task.Priority = 3
+	task.FairnessKey = "tenant"
+	if err := q.EnqueueAt(ctx, "default", task, start.Add(300*time.Millisecond)); err != nil {
+		t.Fatalf("enqueue at: %v", err)
+	}
+	if l, _ := q.Len(ctx, "default"); l != 0 {
+		t.Fatalf("expected delayed tasks not to be counted, got len %d", l)
+	}
+	got, err := q.DequeueWithTimeout(ctx, "default", 2*time.Second)
+	if err != nil {
+		t.Fatalf("dequeue: %v", err)
+	}
+	if got.ID != task.ID || got.Priority != 3 || got.FairnessKey != "tenant" {
+		t.Fatalf("unexpected task %+v", got)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Fatalf("expected the task after 300ms, got it after %s", elapsed)
+	}
+}
+
+func TestRedisQueue_AttemptsAckNack(t *testing.T) {
+	q := newTestRedisQueue(t)
+
+	ctx := context.Background()
+	task := NewTask(TaskTypeActivity, "wf", "in")
+	if err := q.Enqueue(ctx, "default", task); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	for attempt := 1; attempt <= 3; attempt++ {
+		got, err := q.DequeueWithTimeout(ctx, "default", time.Second)
+		if err != nil {
+			t.Fatalf("dequeue %d: %v", attempt, err)
+		}
+		if got.ID != task.ID || got.Attempts != attempt {
+			t.Fatalf("expected %s on attempt %d, got %s on attempt %d", task.ID, attempt, got.ID, got.Attempts)
+		}
+		if err := q.Nack(ctx, "default", got.ID, true); err != nil {
+			t.Fatalf("nack: %v", err)
+		}
+	}
+
+	got, err := q.DequeueWithTimeout(ctx, "default", time.Second)
+	if err != nil {
+		t.Fatalf("dequeue: %v", err)
+	}
+	if err := q.Ack(ctx, "default", got.ID); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if err := q.Ack(ctx, "default", got.ID); err == nil {
+		t.Fatal("expected acking a task that is not in flight to fail")
+	}
+	if err := q.Nack(ctx, "default", got.ID, true); err == nil {
+		t.Fatal("expected nacking a task that is not in flight to fail")
+	}
+
+	// A task nacked without requeue is dropped
+	dropped := NewTask(TaskTypeActivity, "wf", "drop")
+	q.Enqueue(ctx, "default", dropped)
+	if got, err = q.DequeueWithTimeout(ctx, "default", time.Second); err != nil {
+		t.Fatalf("dequeue: %v", err)
+	}
+	if err := q.Nack(ctx, "default", got.ID, false); err != nil {
+		t.Fatalf("nack: %v", err)
+	}
+	if _, err := q.DequeueWithTimeout(ctx, "default", 100*time.Millisecond); err == nil {
+		t.Fatal("expected the dropped task not to be delivered again")
+	}
+	if n, _ := q.rdb.HLen(ctx, q.keyQueue("default")+":inflight").Result(); n != 0 {
+		t.Fatalf("expected nothing left in flight, got %d", n)
+	}
+}
@@ -0,0 +1,114 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron_Next(t *testing.T) {
+	from := time.Date(2024, 1, 31, 10, 17, 30, 0, time.UTC) // a Wednesday
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 31, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 31, 10, 30, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2024, 1, 31, 13, 0, 0, 0, time.UTC)},
+		{"30 2 * * mon-fri", time.Date(2024, 2, 1, 2, 30, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2024, 2, 4, 12, 0, 0, 0, time.UTC)},
+		// Day of month and day of week both restricted: either matches
+		{"0 0 15 * fri", time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 20m", time.Date(2024, 1, 31, 10, 20, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		s, err := ParseCron(c.expr, nil)
+		if err != nil {
+			t.Errorf("%q: %v", c.expr, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(c.want) {
+			t.Errorf("%q: expected %s, got %s", c.expr, c.want, got)
+		}
+	}
+}
+
+func TestParseCron_TimeZone(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	s, err := ParseCron("0 9 * * *", loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := s.Next(time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC))
+	if want := time.Date(2024, 7, 1, 13, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+	// No fire is skipped across the daylight saving change
+	got = s.Next(time.Date(2024, 11, 3, 12, 0, 0, 0, time.UTC))
+	if want := time.Date(2024, 11, 3, 14, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "* * * foo *", "@every 1x"} {
+		if _, err := ParseCron(expr, nil); err == nil {
+			t.Errorf("%q: expected error", expr)
+		}
+	}
+	// Valid but never matches
+	s, err := ParseCron("0 0 30 feb *", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Next(time.Now()); !got.IsZero() {
+		t.Fatalf("expected no fire time, got %s", got)
+	}
+}
+
+func TestEvery(t *testing.T) {
+	s, err := Every(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := s.Next(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+	if want := time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+	if _, err := Every(time.Millisecond); err == nil {
+		t.Fatal("expected error for sub-second interval")
+	}
+}
+
+func TestSpec_ValidateAndJitter(t *testing.T) {
+	spec := Spec{ID: "nightly-report", WorkflowName: "report", Cron: "@daily", Jitter: time.Minute}
+	if err := spec.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if spec.OverlapPolicy != OverlapSkip || spec.CatchupWindow != DefaultCatchupWindow {
+		t.Fatalf("expected defaults, got %+v", spec)
+	}
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if j := spec.JitterFor(at); j < 0 || j >= time.Minute || j != spec.JitterFor(at) {
+		t.Fatalf("expected stable jitter below 1m, got %s", j)
+	}
+
+	for _, bad := range []Spec{
+		{ID: "a b", WorkflowName: "w", Cron: "@daily"},
+		{ID: "a", Cron: "@daily"},
+		{ID: "a", WorkflowName: "w"},
+		{ID: "a", WorkflowName: "w", Cron: "@daily", Interval: time.Hour},
+		{ID: "a", WorkflowName: "w", Cron: "@daily", OverlapPolicy: "queue"},
+		{ID: "a", WorkflowName: "w", Cron: "@daily", TimeZone: "Mars/Olympus"},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("expected error for %+v", bad)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Package schedule describes recurring workflow schedules: cron expressions,
+// fixed intervals, jitter, overlap policies and catch-up of missed runs. The
+// engine persists schedules in the state store and fires them from its
+// durable timer scanner.
+package schedule
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"time"
+)
+
+// OverlapPolicy decides what happens when a schedule fires while a workflow
+// it started earlier is still running
+type OverlapPolicy string
+
+const (
+	// OverlapSkip drops the new run (default)
+	OverlapSkip OverlapPolicy = "skip"
+	// OverlapBufferOne starts the new run once the running one closes.
+	// At most one run is buffered; further fires are dropped.
+	OverlapBufferOne OverlapPolicy = "buffer_one"
+	// OverlapAllowAll starts the new run alongside the running ones
+	OverlapAllowAll OverlapPolicy = "allow_all"
+)
+
+// DefaultCatchupWindow is how late a fire may run when CatchupWindow is not
+// set
+const DefaultCatchupWindow = time.Minute
+
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Spec describes a schedule. Exactly one of Cron and Interval must be set.
+type Spec struct {
+	// ID identifies the schedule; letters, digits, '.', '_' and '-' only
+	ID string
+
+	// WorkflowName and Input describe the workflow started on each fire
+	WorkflowName string
+	Input        interface{}
+	// WorkflowVersion pins started runs to a workflow version; latest if empty
+	WorkflowVersion string
+
+	// Cron is a cron expression, see ParseCron
+	Cron string
+	// Interval fires the schedule at every multiple of the interval
+	Interval time.Duration
+	// TimeZone is the IANA time zone Cron is evaluated in; UTC if empty
+	TimeZone string
+
+	// Jitter delays each fire by a random but stable amount up to Jitter,
+	// spreading load from schedules that share a fire time
+	Jitter time.Duration
+
+	// OverlapPolicy defaults to OverlapSkip
+	OverlapPolicy OverlapPolicy
+
+	// CatchupWindow bounds how late a fire may still start a workflow, for
+	// example after the engine was down. Fires missed by more than the
+	// window are skipped; use Engine.BackfillSchedule to run them anyway.
+	// Defaults to DefaultCatchupWindow.
+	CatchupWindow time.Duration
+
+	// Paused creates the schedule without firing it until resumed
+	Paused bool
+}
+
+// Validate checks the spec and fills in defaults
+func (s *Spec) Validate() error {
+	if !idPattern.MatchString(s.ID) {
+		return fmt.Errorf("invalid schedule ID %q", s.ID)
+	}
+	if s.WorkflowName == "" {
+		return fmt.Errorf("workflow name is required")
+	}
+	if (s.Cron == "") == (s.Interval == 0) {
+		return fmt.Errorf("exactly one of cron and interval is required")
+	}
+	if s.Jitter < 0 || s.CatchupWindow < 0 {
+		return fmt.Errorf("jitter and catchup window must not be negative")
+	}
+	switch s.OverlapPolicy {
+	case "":
+		s.OverlapPolicy = OverlapSkip
+	case OverlapSkip, OverlapBufferOne, OverlapAllowAll:
+	default:
+		return fmt.Errorf("unknown overlap policy %q", s.OverlapPolicy)
+	}
+	if s.CatchupWindow == 0 {
+		s.CatchupWindow = DefaultCatchupWindow
+	}
+	_, err := s.Schedule()
+	return err
+}
+
+// Schedule returns the fire times described by the spec
+func (s *Spec) Schedule() (Schedule, error) {
+	if s.Interval != 0 {
+		return Every(s.Interval)
+	}
+	loc := time.UTC
+	if s.TimeZone != "" {
+		var err error
+		if loc, err = time.LoadLocation(s.TimeZone); err != nil {
+			return nil, fmt.Errorf("invalid time zone %q: %w", s.TimeZone, err)
+		}
+	}
+	return ParseCron(s.Cron, loc)
+}
+
+// JitterFor returns the delay applied to the fire at nominal time t. It is
+// derived from the schedule ID and t, so every engine computes the same value.
+func (s *Spec) JitterFor(t time.Time) time.Duration {
+	if s.Jitter <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s/%d", s.ID, t.UnixNano())
+	return time.Duration(h.Sum64() % uint64(s.Jitter))
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// CompleteActivityRequest represents a request to complete an activity that
+// awaits asynchronous completion
+type CompleteActivityRequest struct {
+	Result interface{} `json:"result"`
+}
+
+// FailActivityRequest represents a request to fail an activity that awaits
+// asynchronous completion
+type FailActivityRequest struct {
+	Error string `json:"error"`
+}
+
+// handleActivityByToken handles POST /activities/{token}/complete and
+// POST /activities/{token}/fail, where token is the activity's task token
+func (s *Server) handleActivityByToken(w http.ResponseWriter, r *http.Request) {
+	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(pathParts) != 3 {
+		s.sendError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	token := pathParts[1]
+
+	// /activities/{token}/{action}
+	switch pathParts[2] {
+	case "complete":
+		var req CompleteActivityRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			s.sendError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if err := s.engine.CompleteActivity(r.Context(), token, req.Result); err != nil {
+			s.sendError(w, http.StatusBadRequest, fmt.Sprintf("failed to complete activity: %v", err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "fail":
+		var req FailActivityRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Error == "" {
+			s.sendError(w, http.StatusBadRequest, "error is required")
+			return
+		}
+		if err := s.engine.FailActivity(r.Context(), token, errors.New(req.Error)); err != nil {
+			s.sendError(w, http.StatusBadRequest, fmt.Sprintf("failed to fail activity: %v", err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.sendError(w, http.StatusNotFound, "unknown action")
+	}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KamdynS/marathon/activity"
+	"github.com/KamdynS/marathon/engine"
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+func TestServer_CompleteActivity(t *testing.T) {
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+	ctx := context.Background()
+
+	reg := workflow.NewRegistry()
+	reg.Register(&workflow.Definition{Name: "approve", Options: workflow.Options{TaskQueue: "default"},
+		Workflow: workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+			var verdict interface{}
+			err := ctx.ExecuteActivityWithID(ctx, "review", in, "act-review").Get(ctx, &verdict)
+			return verdict, err
+		})})
+	secret := []byte("task-token-secret")
+	eng, err := engine.New(engine.Config{StateStore: store, Queue: q, WorkflowRegistry: reg, TaskTokenSecret: secret})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer eng.Stop()
+	srv, err := New(Config{Engine: eng})
+	if err != nil {
+		t.Fatalf("server: %v", err)
+	}
+
+	workflowID, err := eng.StartWorkflow(ctx, "approve", nil)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	// Stand in for a worker whose activity returned activity.ErrResultPending
+	store.SaveActivityState(ctx, &state.ActivityState{ActivityID: "act-review", ActivityName: "review", WorkflowID: workflowID, Status: state.StatusRunning, StartTime: time.Now().UTC(), Attempt: 1})
+	token := activity.TaskToken{WorkflowID: workflowID, ActivityID: "act-review", Attempt: 1}.Sign(secret)
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{name: "wrong_method", method: http.MethodGet, path: "/activities/" + token + "/complete", status: http.StatusMethodNotAllowed},
+		{name: "unknown_action", method: http.MethodPost, path: "/activities/" + token + "/cancel", status: http.StatusNotFound},
+		{name: "stale_token", method: http.MethodPost, path: "/activities/" + activity.TaskToken{WorkflowID: workflowID, ActivityID: "act-review", Attempt: 2}.Sign(secret) + "/complete", status: http.StatusBadRequest},
+		{name: "forged_token", method: http.MethodPost, path: "/activities/" + activity.TaskToken{WorkflowID: workflowID, ActivityID: "act-review", Attempt: 1}.Sign([]byte("forged")) + "/complete", status: http.StatusBadRequest},
+		{name: "fail_without_error", method: http.MethodPost, path: "/activities/" + token + "/fail", body: `{}`, status: http.StatusBadRequest},
+		{name: "ok", method: http.MethodPost, path: "/activities/" + token + "/complete", body: `{"result":{"approved":true}}`, status: http.StatusNoContent},
+		{name: "already_completed", method: http.MethodPost, path: "/activities/" + token + "/complete", body: `{"result":"late"}`, status: http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+			w := httptest.NewRecorder()
+			srv.handleActivityByToken(w, req)
+			if w.Code != c.status {
+				t.Fatalf("expected %d, got %d: %s", c.status, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		st, _ := eng.GetWorkflowStatus(ctx, workflowID)
+		if st != nil && st.Status == state.StatusCompleted {
+			out, _ := st.Output.(map[string]interface{})
+			if out["approved"] != true {
+				t.Fatalf("expected the activity result as output, got %v", st.Output)
+			}
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("workflow did not complete")
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KamdynS/marathon/converter"
+	"github.com/KamdynS/marathon/engine"
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+func TestServer_DecodesEncryptedPayloadsForAuthorizedCallers(t *testing.T) {
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+
+	codec, err := converter.NewEncryptionCodec("k1", map[string][]byte{"k1": bytes.Repeat([]byte{7}, 32)})
+	if err != nil {
+		t.Fatalf("codec: %v", err)
+	}
+	dc := converter.NewCodecConverter(nil, codec)
+
+	reg := workflow.NewRegistry()
+	reg.Register(&workflow.Definition{Name: "echo", Options: workflow.Options{TaskQueue: "default"}, Workflow: workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+		ctx.SetQueryHandler("input", func(interface{}) (interface{}, error) { return in, nil })
+		return in, nil
+	})})
+	eng, err := engine.New(engine.Config{StateStore: store, Queue: q, WorkflowRegistry: reg, DataConverter: dc})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer eng.Stop()
+	srv, _ := New(Config{Engine: eng, AuthorizeDecode: func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer ok"
+	}})
+
+	ctx := context.Background()
+	workflowID, err := eng.StartWorkflow(ctx, "echo", "jane@example.com")
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if st, _ := eng.GetWorkflowStatus(ctx, workflowID); st != nil && st.IsComplete() {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// Nothing reaches the store in plaintext
+	st, _ := store.GetWorkflowState(ctx, workflowID)
+	events, _ := store.GetEvents(ctx, workflowID)
+	recorded, _ := json.Marshal(map[string]interface{}{"state": st, "events": events})
+	if strings.Contains(string(recorded), "jane@example.com") {
+		t.Fatalf("plaintext found in store: %s", recorded)
+	}
+
+	get := func(path, auth string) string {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		srv.handleWorkflowByID(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d", path, w.Code)
+		}
+		return w.Body.String()
+	}
+
+	var status WorkflowStatusResponse
+	json.Unmarshal([]byte(get("/workflows/"+workflowID, "Bearer ok")), &status)
+	if status.Output != "jane@example.com" || status.Input != "jane@example.com" {
+		t.Fatalf("expected decoded payloads for authorized caller, got %+v", status)
+	}
+	if body := get("/workflows/"+workflowID+"/events", "Bearer ok"); !strings.Contains(body, "jane@example.com") {
+		t.Fatalf("expected decoded event payloads for authorized caller, got %s", body)
+	}
+
+	if body := get("/workflows/"+workflowID, ""); strings.Contains(body, "jane@example.com") || !strings.Contains(body, converter.EncodingEncrypted) {
+		t.Fatalf("expected encrypted payloads for unauthorized caller, got %s", body)
+	}
+	if body := get("/workflows/"+workflowID+"/events", "Bearer nope"); strings.Contains(body, "jane@example.com") {
+		t.Fatalf("expected encrypted event payloads for unauthorized caller, got %s", body)
+	}
+
+	if body := get("/workflows/"+workflowID+"/query/input", "Bearer ok"); !strings.Contains(body, "jane@example.com") {
+		t.Fatalf("expected decoded query result for authorized caller, got %s", body)
+	}
+	if body := get("/workflows/"+workflowID+"/query/input", ""); strings.Contains(body, "jane@example.com") || !strings.Contains(body, converter.EncodingEncrypted) {
+		t.Fatalf("expected encrypted query result for unauthorized caller, got %s", body)
+	}
+
+	// Agent events recorded by workers are decoded the same way
+	content, _ := converter.Normalize(dc, "the patient is jane")
+	store.AppendEvent(ctx, state.NewEvent(workflowID, state.EventAgentMessage, map[string]interface{}{"content": content}))
+	if body := get("/workflows/"+workflowID+"/events", "Bearer ok"); !strings.Contains(body, "the patient is jane") {
+		t.Fatalf("expected decoded agent event for authorized caller, got %s", body)
+	}
+	if body := get("/workflows/"+workflowID+"/events", ""); strings.Contains(body, "the patient is jane") {
+		t.Fatalf("expected encrypted agent event for unauthorized caller, got %s", body)
+	}
+
+	// Without a hook no caller is authorized
+	noHook, _ := New(Config{Engine: eng})
+	for _, path := range []string{"/workflows/" + workflowID, "/workflows/" + workflowID + "/events", "/workflows/" + workflowID + "/query/input"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer ok")
+		w := httptest.NewRecorder()
+		noHook.handleWorkflowByID(w, req)
+		if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "jane") {
+			t.Fatalf("expected GET %s to stay encrypted without a hook, got %d %s", path, w.Code, w.Body.String())
+		}
+	}
+}
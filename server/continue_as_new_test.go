@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/KamdynS/marathon/engine"
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+func TestServer_FollowsContinueAsNewChain(t *testing.T) {
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+
+	reg := workflow.NewRegistry()
+	reg.Register(&workflow.Definition{Name: "once-more", Options: workflow.Options{TaskQueue: "default"}, Workflow: workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+		if in == "first" {
+			return nil, ctx.ContinueAsNew("second")
+		}
+		return in, nil
+	})})
+	eng, err := engine.New(engine.Config{StateStore: store, Queue: q, WorkflowRegistry: reg})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer eng.Stop()
+	srv, _ := New(Config{Engine: eng})
+
+	workflowID, err := eng.StartWorkflow(context.Background(), "once-more", "first")
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	var resp WorkflowStatusResponse
+	for time.Now().Before(deadline) {
+		req := httptest.NewRequest(http.MethodGet, "/workflows/"+workflowID, nil)
+		w := httptest.NewRecorder()
+		srv.handleWorkflowByID(w, req)
+		if w.Code == http.StatusOK {
+			json.NewDecoder(w.Body).Decode(&resp)
+			if resp.Status == string(state.StatusCompleted) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if resp.Status != string(state.StatusCompleted) || resp.Output != "second" {
+		t.Fatalf("expected latest run completed with output second, got %+v", resp)
+	}
+	if resp.WorkflowID != workflowID || resp.RunID == workflowID || resp.RunID == "" {
+		t.Fatalf("expected logical workflow ID %s with a new run ID, got %+v", workflowID, resp)
+	}
+}
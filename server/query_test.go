@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/KamdynS/marathon/engine"
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+func TestServer_QueryWorkflow(t *testing.T) {
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+
+	reg := workflow.NewRegistry()
+	wf := workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+		ctx.SetQueryHandler("echo", func(args interface{}) (interface{}, error) {
+			return args, nil
+		})
+		var v interface{}
+		return nil, ctx.ReceiveSignal("stop").Get(ctx, &v)
+	})
+	reg.Register(&workflow.Definition{Name: "queryable", Workflow: wf, Options: workflow.Options{TaskQueue: "default"}})
+
+	eng, err := engine.New(engine.Config{StateStore: store, Queue: q, WorkflowRegistry: reg})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer eng.Stop()
+	srv, _ := New(Config{Engine: eng})
+
+	workflowID, err := eng.StartWorkflow(context.Background(), "queryable", nil)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// A closed workflow whose definition is no longer registered cannot be
+	// replayed
+	store.SaveWorkflowState(context.Background(), &state.WorkflowState{WorkflowID: "wf-retired", WorkflowName: "retired", Status: state.StatusCompleted, StartTime: time.Now().UTC()})
+
+	cases := []struct {
+		name       string
+		method     string
+		workflowID string
+		handler    string
+		query      string
+		status     int
+		result     string
+	}{
+		{name: "wrong_method", method: http.MethodPost, status: http.StatusMethodNotAllowed},
+		{name: "invalid_args", method: http.MethodGet, query: "?args=%7B", status: http.StatusBadRequest},
+		{name: "ok", method: http.MethodGet, query: "?args=%22hi%22", status: http.StatusOK, result: "hi"},
+		{name: "unknown_handler", method: http.MethodGet, handler: "missing", status: http.StatusNotFound},
+		{name: "unknown_workflow", method: http.MethodGet, workflowID: "wf-missing", status: http.StatusNotFound},
+		{name: "closed", method: http.MethodGet, workflowID: "wf-retired", status: http.StatusConflict},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			id, handler := c.workflowID, c.handler
+			if id == "" {
+				id = workflowID
+			}
+			if handler == "" {
+				handler = "echo"
+			}
+			req := httptest.NewRequest(c.method, "/workflows/"+id+"/query/"+handler+c.query, nil)
+			w := httptest.NewRecorder()
+			srv.handleWorkflowByID(w, req)
+			if w.Code != c.status {
+				t.Fatalf("expected %d, got %d: %s", c.status, w.Code, w.Body.String())
+			}
+			if c.result != "" {
+				var resp QueryWorkflowResponse
+				if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Result != c.result {
+					t.Fatalf("expected result %q, got %+v (%v)", c.result, resp, err)
+				}
+			}
+		})
+	}
+}
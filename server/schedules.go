@@ -0,0 +1,254 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/KamdynS/marathon/schedule"
+	"github.com/KamdynS/marathon/state"
+)
+
+// ScheduleRequest represents a request to create or update a schedule.
+// Durations use Go syntax, e.g. "90s" or "1h".
+type ScheduleRequest struct {
+	ID            string      `json:"id"`
+	WorkflowName  string      `json:"workflow_name"`
+	Input         interface{} `json:"input"`
+	Version       string      `json:"version,omitempty"`
+	Cron          string      `json:"cron,omitempty"`
+	Interval      string      `json:"interval,omitempty"`
+	TimeZone      string      `json:"time_zone,omitempty"`
+	Jitter        string      `json:"jitter,omitempty"`
+	OverlapPolicy string      `json:"overlap_policy,omitempty"`
+	CatchupWindow string      `json:"catchup_window,omitempty"`
+	Paused        bool        `json:"paused,omitempty"`
+}
+
+// ScheduleResponse represents a schedule
+type ScheduleResponse struct {
+	ID                 string      `json:"id"`
+	WorkflowName       string      `json:"workflow_name"`
+	Input              interface{} `json:"input,omitempty"`
+	Version            string      `json:"version,omitempty"`
+	Cron               string      `json:"cron,omitempty"`
+	Interval           string      `json:"interval,omitempty"`
+	TimeZone           string      `json:"time_zone,omitempty"`
+	Jitter             string      `json:"jitter,omitempty"`
+	OverlapPolicy      string      `json:"overlap_policy"`
+	CatchupWindow      string      `json:"catchup_window"`
+	Paused             bool        `json:"paused"`
+	NextRunAt          *time.Time  `json:"next_run_at,omitempty"`
+	LastRunAt          *time.Time  `json:"last_run_at,omitempty"`
+	BufferedRunAt      *time.Time  `json:"buffered_run_at,omitempty"`
+	RunningWorkflowIDs []string    `json:"running_workflow_ids"`
+	StartedRuns        int         `json:"started_runs"`
+	SkippedRuns        int         `json:"skipped_runs"`
+	CreatedAt          time.Time   `json:"created_at"`
+	UpdatedAt          time.Time   `json:"updated_at"`
+}
+
+// BackfillRequest represents a request to run a schedule's fires in a past
+// time range
+type BackfillRequest struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// BackfillResponse represents a response from backfilling a schedule
+type BackfillResponse struct {
+	Started int `json:"started"`
+}
+
+// handleSchedules handles POST /schedules (create) and GET /schedules (list)
+func (s *Server) handleSchedules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		spec, err := s.decodeScheduleRequest(r, "")
+		if err != nil {
+			s.sendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		st, err := s.engine.CreateSchedule(r.Context(), spec)
+		if err != nil {
+			s.sendError(w, http.StatusBadRequest, fmt.Sprintf("failed to create schedule: %v", err))
+			return
+		}
+		s.sendJSON(w, http.StatusOK, s.scheduleResponse(r, st))
+	case http.MethodGet:
+		schedules, err := s.engine.ListSchedules(r.Context())
+		if err != nil {
+			s.sendError(w, http.StatusInternalServerError, fmt.Sprintf("failed to list schedules: %v", err))
+			return
+		}
+		resp := make([]ScheduleResponse, len(schedules))
+		for i, st := range schedules {
+			resp[i] = s.scheduleResponse(r, st)
+		}
+		s.sendJSON(w, http.StatusOK, resp)
+	default:
+		s.sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleScheduleByID handles GET, PUT and DELETE /schedules/{id} and
+// POST /schedules/{id}/pause, /resume and /backfill
+func (s *Server) handleScheduleByID(w http.ResponseWriter, r *http.Request) {
+	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(pathParts) < 2 {
+		s.sendError(w, http.StatusNotFound, "schedule ID required")
+		return
+	}
+	scheduleID := pathParts[1]
+
+	if len(pathParts) == 2 {
+		// /schedules/{id}
+		switch r.Method {
+		case http.MethodGet:
+			st, err := s.engine.GetSchedule(r.Context(), scheduleID)
+			if err != nil {
+				s.sendError(w, http.StatusNotFound, fmt.Sprintf("schedule not found: %v", err))
+				return
+			}
+			s.sendJSON(w, http.StatusOK, s.scheduleResponse(r, st))
+		case http.MethodPut:
+			spec, err := s.decodeScheduleRequest(r, scheduleID)
+			if err != nil {
+				s.sendError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			st, err := s.engine.UpdateSchedule(r.Context(), spec)
+			if err != nil {
+				s.sendError(w, http.StatusBadRequest, fmt.Sprintf("failed to update schedule: %v", err))
+				return
+			}
+			s.sendJSON(w, http.StatusOK, s.scheduleResponse(r, st))
+		case http.MethodDelete:
+			if err := s.engine.DeleteSchedule(r.Context(), scheduleID); err != nil {
+				s.sendError(w, http.StatusNotFound, fmt.Sprintf("schedule not found: %v", err))
+				return
+			}
+			s.sendJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+		default:
+			s.sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+		return
+	}
+	if len(pathParts) != 3 {
+		s.sendError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	// /schedules/{id}/{action}
+	switch pathParts[2] {
+	case "pause":
+		if err := s.engine.PauseSchedule(r.Context(), scheduleID); err != nil {
+			s.sendError(w, http.StatusNotFound, fmt.Sprintf("schedule not found: %v", err))
+			return
+		}
+		s.sendJSON(w, http.StatusOK, map[string]string{"status": "paused"})
+	case "resume":
+		if err := s.engine.ResumeSchedule(r.Context(), scheduleID); err != nil {
+			s.sendError(w, http.StatusNotFound, fmt.Sprintf("schedule not found: %v", err))
+			return
+		}
+		s.sendJSON(w, http.StatusOK, map[string]string{"status": "resumed"})
+	case "backfill":
+		var req BackfillRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.sendError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		started, err := s.engine.BackfillSchedule(r.Context(), scheduleID, req.Start, req.End)
+		if err != nil {
+			s.sendError(w, http.StatusBadRequest, fmt.Sprintf("failed to backfill schedule: %v", err))
+			return
+		}
+		s.sendJSON(w, http.StatusOK, BackfillResponse{Started: started})
+	default:
+		s.sendError(w, http.StatusNotFound, "unknown action")
+	}
+}
+
+// decodeScheduleRequest reads a ScheduleRequest into a spec. A non-empty id
+// from the path overrides the body.
+func (s *Server) decodeScheduleRequest(r *http.Request, id string) (schedule.Spec, error) {
+	var req ScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return schedule.Spec{}, fmt.Errorf("invalid request body")
+	}
+	if id != "" {
+		req.ID = id
+	}
+	spec := schedule.Spec{
+		ID:              req.ID,
+		WorkflowName:    req.WorkflowName,
+		Input:           req.Input,
+		WorkflowVersion: req.Version,
+		Cron:            req.Cron,
+		TimeZone:        req.TimeZone,
+		OverlapPolicy:   schedule.OverlapPolicy(req.OverlapPolicy),
+		Paused:          req.Paused,
+	}
+	for _, d := range []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"interval", req.Interval, &spec.Interval},
+		{"jitter", req.Jitter, &spec.Jitter},
+		{"catchup_window", req.CatchupWindow, &spec.CatchupWindow},
+	} {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil {
+			return schedule.Spec{}, fmt.Errorf("invalid %s: %v", d.name, err)
+		}
+		*d.dst = v
+	}
+	return spec, nil
+}
+
+// scheduleResponse converts a schedule state into its API representation
+func (s *Server) scheduleResponse(r *http.Request, st *state.ScheduleState) ScheduleResponse {
+	resp := ScheduleResponse{
+		ID:                 st.ScheduleID,
+		WorkflowName:       st.WorkflowName,
+		Input:              s.payloadValue(r, st.Input),
+		Version:            st.WorkflowVersion,
+		Cron:               st.Cron,
+		TimeZone:           st.TimeZone,
+		OverlapPolicy:      st.OverlapPolicy,
+		CatchupWindow:      st.CatchupWindow.String(),
+		Paused:             st.Paused,
+		LastRunAt:          st.LastRunAt,
+		BufferedRunAt:      st.BufferedRunAt,
+		RunningWorkflowIDs: st.RunningWorkflowIDs,
+		StartedRuns:        st.StartedRuns,
+		SkippedRuns:        st.SkippedRuns,
+		CreatedAt:          st.CreatedAt,
+		UpdatedAt:          st.UpdatedAt,
+	}
+	if st.Interval > 0 {
+		resp.Interval = st.Interval.String()
+	}
+	if st.Jitter > 0 {
+		resp.Jitter = st.Jitter.String()
+	}
+	if !st.Paused && !st.NextRunAt.IsZero() {
+		next := st.NextRunAt
+		resp.NextRunAt = &next
+	}
+	if resp.RunningWorkflowIDs == nil {
+		resp.RunningWorkflowIDs = []string{}
+	}
+	return resp
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/KamdynS/marathon/engine"
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+func TestServer_ScheduleCRUD(t *testing.T) {
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+
+	reg := workflow.NewRegistry()
+	reg.Register(&workflow.Definition{Name: "report", Options: workflow.Options{TaskQueue: "default"}, Workflow: workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+		return in, nil
+	})})
+	eng, err := engine.New(engine.Config{StateStore: store, Queue: q, WorkflowRegistry: reg})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer eng.Stop()
+	srv, _ := New(Config{Engine: eng})
+
+	do := func(handler http.HandlerFunc, method, path, body string) (*httptest.ResponseRecorder, ScheduleResponse) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler(w, req)
+		var resp ScheduleResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp
+	}
+
+	w, resp := do(srv.handleSchedules, http.MethodPost, "/schedules",
+		`{"id":"nightly","workflow_name":"report","input":{"kind":"daily"},"cron":"0 2 * * *","time_zone":"UTC","jitter":"5m","paused":true}`)
+	if w.Code != http.StatusOK || resp.ID != "nightly" || resp.Jitter != "5m0s" || resp.OverlapPolicy != "skip" || !resp.Paused {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+	if w, _ := do(srv.handleSchedules, http.MethodPost, "/schedules", `{"id":"bad","workflow_name":"report","interval":"soon"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid interval, got %d", w.Code)
+	}
+
+	w, resp = do(srv.handleScheduleByID, http.MethodPut, "/schedules/nightly", `{"workflow_name":"report","interval":"1h","overlap_policy":"allow_all"}`)
+	if w.Code != http.StatusOK || resp.Interval != "1h0m0s" || resp.Cron != "" || resp.OverlapPolicy != "allow_all" || resp.NextRunAt == nil {
+		t.Fatalf("update: %d %s", w.Code, w.Body.String())
+	}
+
+	if w, _ := do(srv.handleScheduleByID, http.MethodPost, "/schedules/nightly/pause", ""); w.Code != http.StatusOK {
+		t.Fatalf("pause: %d %s", w.Code, w.Body.String())
+	}
+	if w, resp := do(srv.handleScheduleByID, http.MethodGet, "/schedules/nightly", ""); w.Code != http.StatusOK || !resp.Paused {
+		t.Fatalf("get: %d %s", w.Code, w.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/schedules", nil)
+	lw := httptest.NewRecorder()
+	srv.handleSchedules(lw, req)
+	var list []ScheduleResponse
+	if err := json.Unmarshal(lw.Body.Bytes(), &list); err != nil || len(list) != 1 {
+		t.Fatalf("list: %s", lw.Body.String())
+	}
+
+	if w, _ := do(srv.handleScheduleByID, http.MethodDelete, "/schedules/nightly", ""); w.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", w.Code, w.Body.String())
+	}
+	if w, _ := do(srv.handleScheduleByID, http.MethodGet, "/schedules/nightly", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 after delete, got %d", w.Code)
+	}
+	if _, err := eng.GetSchedule(context.Background(), "nightly"); err == nil {
+		t.Fatal("expected schedule removed from engine")
+	}
+}
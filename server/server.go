@@ -4,27 +4,38 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/KamdynS/marathon/converter"
 	"github.com/KamdynS/marathon/engine"
 	"github.com/KamdynS/marathon/server/agenthttp"
+	"github.com/KamdynS/marathon/state"
 )
 
 // Server provides HTTP API for workflows
 type Server struct {
-	engine     *engine.Engine
-	httpServer *http.Server
-	port       int
+	engine          *engine.Engine
+	httpServer      *http.Server
+	port            int
+	authorizeDecode func(r *http.Request) bool
 }
 
 // Config holds server configuration
 type Config struct {
 	Engine *engine.Engine
 	Port   int
+	// AuthorizeDecode reports whether a request may see decoded inputs,
+	// outputs, event payloads and query results. Unauthorized callers
+	// receive payloads as recorded (for example, encrypted). If nil, no
+	// caller is authorized; plain JSON payloads are recorded as is, so this
+	// only matters once the engine's converter encodes them.
+	AuthorizeDecode func(r *http.Request) bool
 }
 
 // New creates a new workflow API server
@@ -37,13 +48,17 @@ func New(cfg Config) (*Server, error) {
 	}
 
 	server := &Server{
-		engine: cfg.Engine,
-		port:   cfg.Port,
+		engine:          cfg.Engine,
+		port:            cfg.Port,
+		authorizeDecode: cfg.AuthorizeDecode,
 	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/workflows", server.handleWorkflows)
 	mux.HandleFunc("/workflows/", server.handleWorkflowByID)
+	mux.HandleFunc("/schedules", server.handleSchedules)
+	mux.HandleFunc("/schedules/", server.handleScheduleByID)
+	mux.HandleFunc("/activities/", server.handleActivityByToken)
 	mux.HandleFunc("/health", server.handleHealth)
 
 	server.httpServer = &http.Server{
@@ -77,6 +92,12 @@ func (s *Server) Stop(ctx context.Context) error {
 type StartWorkflowRequest struct {
 	WorkflowName string      `json:"workflow_name"`
 	Input        interface{} `json:"input"`
+	// Version pins the run to a workflow version; defaults to the latest
+	Version string `json:"version,omitempty"`
+	// Priority and FairnessKey order the workflow's tasks in their queues;
+	// see engine.StartWorkflowOptions
+	Priority    int    `json:"priority,omitempty"`
+	FairnessKey string `json:"fairness_key,omitempty"`
 }
 
 // StartWorkflowResponse represents a response from starting a workflow
@@ -86,15 +107,25 @@ type StartWorkflowResponse struct {
 
 // WorkflowStatusResponse represents a workflow status response
 type WorkflowStatusResponse struct {
-	WorkflowID   string      `json:"workflow_id"`
-	WorkflowName string      `json:"workflow_name"`
-	Status       string      `json:"status"`
-	Input        interface{} `json:"input"`
-	Output       interface{} `json:"output,omitempty"`
-	Error        string      `json:"error,omitempty"`
-	StartTime    time.Time   `json:"start_time"`
-	EndTime      *time.Time  `json:"end_time,omitempty"`
-	Duration     string      `json:"duration"`
+	WorkflowID       string      `json:"workflow_id"`
+	WorkflowName     string      `json:"workflow_name"`
+	WorkflowVersion  string      `json:"workflow_version,omitempty"`
+	Status           string      `json:"status"`
+	Input            interface{} `json:"input"`
+	Output           interface{} `json:"output,omitempty"`
+	Error            string      `json:"error,omitempty"`
+	StartTime        time.Time   `json:"start_time"`
+	EndTime          *time.Time  `json:"end_time,omitempty"`
+	Duration         string      `json:"duration"`
+	ParentWorkflowID string      `json:"parent_workflow_id,omitempty"`
+	ScheduleID       string      `json:"schedule_id,omitempty"`
+	Attempt          int         `json:"attempt"`
+	RunID            string      `json:"run_id"`
+}
+
+// QueryWorkflowResponse represents a workflow query response
+type QueryWorkflowResponse struct {
+	Result interface{} `json:"result"`
 }
 
 // ErrorResponse represents an error response
@@ -121,7 +152,12 @@ func (s *Server) handleWorkflows(w http.ResponseWriter, r *http.Request) {
 	}
 
     idemKey := r.Header.Get("Idempotency-Key")
-    workflowID, err := s.engine.StartWorkflowWithOptions(r.Context(), req.WorkflowName, req.Input, engine.StartWorkflowOptions{IdempotencyKey: idemKey})
+    workflowID, err := s.engine.StartWorkflowWithOptions(r.Context(), req.WorkflowName, req.Input, engine.StartWorkflowOptions{
+        IdempotencyKey: idemKey,
+        Version:        req.Version,
+        Priority:       req.Priority,
+        FairnessKey:    req.FairnessKey,
+    })
 	if err != nil {
 		s.sendError(w, http.StatusInternalServerError, fmt.Sprintf("failed to start workflow: %v", err))
 		return
@@ -134,7 +170,8 @@ func (s *Server) handleWorkflows(w http.ResponseWriter, r *http.Request) {
 	s.sendJSON(w, http.StatusOK, resp)
 }
 
-// handleWorkflowByID handles GET /workflows/{id}, GET /workflows/{id}/events, POST /workflows/{id}/cancel
+// handleWorkflowByID handles GET /workflows/{id}, GET /workflows/{id}/events, POST /workflows/{id}/cancel,
+// POST /workflows/{id}/signals/{name}, GET /workflows/{id}/query/{name}
 func (s *Server) handleWorkflowByID(w http.ResponseWriter, r *http.Request) {
 	// Extract workflow ID from path
 	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
@@ -145,6 +182,11 @@ func (s *Server) handleWorkflowByID(w http.ResponseWriter, r *http.Request) {
 
 	workflowID := pathParts[1]
 
+	// Follow continue-as-new chains so callers can keep using the original ID
+	if latest, err := s.engine.GetLatestRunID(r.Context(), workflowID); err == nil {
+		workflowID = latest
+	}
+
 	// Route based on path and method
 	if len(pathParts) == 2 {
 		// /workflows/{id}
@@ -173,6 +215,25 @@ func (s *Server) handleWorkflowByID(w http.ResponseWriter, r *http.Request) {
 		default:
 			s.sendError(w, http.StatusNotFound, "unknown action")
 		}
+	} else if len(pathParts) == 4 {
+		// /workflows/{id}/{action}/{name}
+		action, name := pathParts[2], pathParts[3]
+		switch action {
+		case "signals":
+			if r.Method == http.MethodPost {
+				s.handleSignalWorkflow(w, r, workflowID, name)
+			} else {
+				s.sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+			}
+		case "query":
+			if r.Method == http.MethodGet {
+				s.handleQueryWorkflow(w, r, workflowID, name)
+			} else {
+				s.sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+			}
+		default:
+			s.sendError(w, http.StatusNotFound, "unknown action")
+		}
 	} else {
 		s.sendError(w, http.StatusNotFound, "not found")
 	}
@@ -187,15 +248,20 @@ func (s *Server) handleGetWorkflowStatus(w http.ResponseWriter, r *http.Request,
 	}
 
 	resp := WorkflowStatusResponse{
-		WorkflowID:   workflowState.WorkflowID,
-		WorkflowName: workflowState.WorkflowName,
-		Status:       string(workflowState.Status),
-		Input:        workflowState.Input,
-		Output:       workflowState.Output,
-		Error:        workflowState.Error,
-		StartTime:    workflowState.StartTime,
-		EndTime:      workflowState.EndTime,
-		Duration:     workflowState.Duration().String(),
+		WorkflowID:       workflowState.LogicalWorkflowID(),
+		WorkflowName:     workflowState.WorkflowName,
+		WorkflowVersion:  workflowState.WorkflowVersion,
+		Status:           string(workflowState.Status),
+		Input:            s.payloadValue(r, workflowState.Input),
+		Output:           s.payloadValue(r, workflowState.Output),
+		Error:            workflowState.Error,
+		StartTime:        workflowState.StartTime,
+		EndTime:          workflowState.EndTime,
+		Duration:         workflowState.Duration().String(),
+		ParentWorkflowID: workflowState.ParentWorkflowID,
+		ScheduleID:       workflowState.ScheduleID,
+		Attempt:          max(workflowState.Attempt, 1),
+		RunID:            workflowState.WorkflowID,
 	}
 
 	s.sendJSON(w, http.StatusOK, resp)
@@ -217,7 +283,7 @@ func (s *Server) handleGetWorkflowEvents(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	s.sendJSON(w, http.StatusOK, events)
+	s.sendJSON(w, http.StatusOK, s.decodeEvents(r, events))
 }
 
 // handleWorkflowEventsSSE handles SSE streaming of workflow events
@@ -227,7 +293,10 @@ func (s *Server) handleWorkflowEventsSSE(w http.ResponseWriter, r *http.Request,
 		r.Context(),
 		w,
 		lastID,
-		s.engine.GetWorkflowEventsSince,
+		func(ctx context.Context, workflowID string, since int64) ([]*state.Event, error) {
+			events, err := s.engine.GetWorkflowEventsSince(ctx, workflowID, since)
+			return s.decodeEvents(r, events), err
+		},
 		workflowID,
 		500*time.Millisecond,
 		15*time.Second,
@@ -244,11 +313,110 @@ func (s *Server) handleCancelWorkflow(w http.ResponseWriter, r *http.Request, wo
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// handleSignalWorkflow handles POST /workflows/{id}/signals/{name}.
+// The request body, if any, is decoded as JSON and delivered as the signal payload.
+func (s *Server) handleSignalWorkflow(w http.ResponseWriter, r *http.Request, workflowID string, signalName string) {
+	var payload interface{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && err != io.EOF {
+		s.sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := s.engine.SignalWorkflow(r.Context(), workflowID, signalName, payload); err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, engine.ErrWorkflowNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, engine.ErrWorkflowClosed):
+			status = http.StatusConflict
+		}
+		s.sendError(w, status, fmt.Sprintf("failed to signal workflow: %v", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleQueryWorkflow handles GET /workflows/{id}/query/{name}.
+// Query arguments may be supplied as JSON in the "args" URL parameter.
+func (s *Server) handleQueryWorkflow(w http.ResponseWriter, r *http.Request, workflowID string, queryName string) {
+	var args interface{}
+	if raw := r.URL.Query().Get("args"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &args); err != nil {
+			s.sendError(w, http.StatusBadRequest, "invalid args parameter")
+			return
+		}
+	}
+
+	result, err := s.engine.QueryWorkflow(r.Context(), workflowID, queryName, args)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, engine.ErrWorkflowNotFound), errors.Is(err, engine.ErrQueryNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, engine.ErrWorkflowClosed):
+			status = http.StatusConflict
+		}
+		s.sendError(w, status, fmt.Sprintf("failed to query workflow: %v", err))
+		return
+	}
+	// Results come from workflow memory; encode them as they would be
+	// recorded so callers not authorized to decode never see plaintext
+	encoded, err := converter.Normalize(s.engine.DataConverter(), result)
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, fmt.Sprintf("failed to encode query result: %v", err))
+		return
+	}
+
+	s.sendJSON(w, http.StatusOK, QueryWorkflowResponse{Result: s.payloadValue(r, encoded)})
+}
+
 // handleHealth handles GET /health
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	s.sendJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
+// payloadValue decodes a recorded input or output for a JSON response. Values
+// are left as recorded for callers not authorized to decode them, which is
+// every caller without an AuthorizeDecode hook, and when the payload has no
+// generic form (such as protobuf).
+func (s *Server) payloadValue(r *http.Request, v interface{}) interface{} {
+	if s.authorizeDecode == nil || !s.authorizeDecode(r) {
+		return v
+	}
+	if out, err := converter.Value(s.engine.DataConverter(), v); err == nil {
+		return out
+	}
+	return v
+}
+
+// decodeEvents returns copies of events with payloads in their data decoded
+// by payloadValue. Events without payloads are returned as is.
+func (s *Server) decodeEvents(r *http.Request, events []*state.Event) []*state.Event {
+	if events == nil {
+		return nil
+	}
+	out := make([]*state.Event, len(events))
+	for i, e := range events {
+		out[i] = e
+		for k, v := range e.Data {
+			if _, ok := v.(*converter.Payload); !ok {
+				continue
+			}
+			if out[i] == e {
+				cp := *e
+				cp.Data = make(map[string]interface{}, len(e.Data))
+				for dk, dv := range e.Data {
+					cp.Data[dk] = dv
+				}
+				out[i] = &cp
+			}
+			out[i].Data[k] = s.payloadValue(r, v)
+		}
+	}
+	return out
+}
+
 // sendJSON sends a JSON response
 func (s *Server) sendJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
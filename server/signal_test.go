@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KamdynS/marathon/engine"
+	"github.com/KamdynS/marathon/queue"
+	"github.com/KamdynS/marathon/state"
+	"github.com/KamdynS/marathon/workflow"
+)
+
+// failingStore fails every workflow state lookup
+type failingStore struct {
+	state.Store
+}
+
+func (failingStore) GetWorkflowState(ctx context.Context, workflowID string) (*state.WorkflowState, error) {
+	return nil, errors.New("store unavailable")
+}
+
+func TestServer_SignalWorkflow(t *testing.T) {
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+
+	reg := workflow.NewRegistry()
+	wf := workflow.WorkflowFunc(func(ctx workflow.Context, in interface{}) (interface{}, error) {
+		var decision interface{}
+		if err := ctx.ReceiveSignal("approval").Get(ctx, &decision); err != nil {
+			return nil, err
+		}
+		return decision, nil
+	})
+	reg.Register(&workflow.Definition{Name: "await-approval", Workflow: wf, Options: workflow.Options{TaskQueue: "default"}})
+
+	eng, err := engine.New(engine.Config{StateStore: store, Queue: q, WorkflowRegistry: reg})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer eng.Stop()
+	srv, err := New(Config{Engine: eng})
+	if err != nil {
+		t.Fatalf("server: %v", err)
+	}
+
+	ctx := context.Background()
+	workflowID, err := eng.StartWorkflow(ctx, "await-approval", nil)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		method string
+		body   string
+		status int
+	}{
+		{name: "wrong_method", method: http.MethodGet, status: http.StatusMethodNotAllowed},
+		{name: "invalid_body", method: http.MethodPost, body: "{", status: http.StatusBadRequest},
+		{name: "ok", method: http.MethodPost, body: `{"approved":true}`, status: http.StatusNoContent},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(c.method, "/workflows/"+workflowID+"/signals/approval", strings.NewReader(c.body))
+			w := httptest.NewRecorder()
+			srv.handleWorkflowByID(w, req)
+			if w.Code != c.status {
+				t.Fatalf("expected %d, got %d: %s", c.status, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	var st *state.WorkflowState
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if st, _ = eng.GetWorkflowStatus(ctx, workflowID); st != nil && st.Status == state.StatusCompleted {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if st == nil || st.Status != state.StatusCompleted {
+		t.Fatalf("workflow did not complete after signal")
+	}
+	out, _ := st.Output.(map[string]interface{})
+	if out["approved"] != true {
+		t.Fatalf("expected signal payload as output, got %v", st.Output)
+	}
+
+	// A store failure is the only server error
+	broken, err := engine.New(engine.Config{StateStore: failingStore{store}, Queue: q, WorkflowRegistry: reg})
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer broken.Stop()
+	brokenSrv, err := New(Config{Engine: broken})
+	if err != nil {
+		t.Fatalf("server: %v", err)
+	}
+
+	for _, c := range []struct {
+		name       string
+		srv        *Server
+		workflowID string
+		status     int
+	}{
+		{name: "closed", srv: srv, workflowID: workflowID, status: http.StatusConflict},
+		{name: "unknown", srv: srv, workflowID: "wf-missing", status: http.StatusNotFound},
+		{name: "store_failure", srv: brokenSrv, workflowID: workflowID, status: http.StatusInternalServerError},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/workflows/"+c.workflowID+"/signals/approval", nil)
+			w := httptest.NewRecorder()
+			c.srv.handleWorkflowByID(w, req)
+			if w.Code != c.status {
+				t.Fatalf("expected %d, got %d: %s", c.status, w.Code, w.Body.String())
+			}
+		})
+	}
+}
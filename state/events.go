@@ -14,6 +14,7 @@ const (
 	EventWorkflowCompleted EventType = "workflow_completed"
 	EventWorkflowFailed    EventType = "workflow_failed"
 	EventWorkflowCanceled  EventType = "workflow_canceled"
+	EventWorkflowTimedOut  EventType = "workflow_timed_out"
 	EventActivityScheduled EventType = "activity_scheduled"
 	EventActivityStarted   EventType = "activity_started"
 	EventActivityCompleted EventType = "activity_completed"
@@ -22,6 +23,24 @@ const (
 	EventTimerScheduled    EventType = "timer_scheduled"
 	EventTimerFired        EventType = "timer_fired"
 	EventSignalReceived    EventType = "signal_received"
+	// Child workflow events, recorded in the parent's event log
+	EventChildWorkflowStarted   EventType = "child_workflow_started"
+	EventChildWorkflowCompleted EventType = "child_workflow_completed"
+	EventChildWorkflowFailed    EventType = "child_workflow_failed"
+	// EventWorkflowContinuedAsNew closes a run that was replaced by a fresh run
+	EventWorkflowContinuedAsNew EventType = "workflow_continued_as_new"
+	// EventWorkflowRetrying records a failed attempt that will be retried
+	// after a backoff; events after it belong to the next attempt
+	EventWorkflowRetrying EventType = "workflow_retrying"
+	// EventWorkflowCancelRequested records a cancellation that the running
+	// execution is unwinding from; workflow_canceled follows once it has
+	EventWorkflowCancelRequested EventType = "workflow_cancel_requested"
+	// EventVersionMarker records the version chosen by workflow.Context.GetVersion
+	EventVersionMarker EventType = "version_marker"
+	// Local activity markers record the outcome of
+	// workflow.Context.ExecuteLocalActivity for replay
+	EventLocalActivityCompleted EventType = "local_activity_completed"
+	EventLocalActivityFailed    EventType = "local_activity_failed"
 	// Agent loop specific events (SSE-friendly)
 	EventAgentStepPlanned EventType = "agent_step_planned"
 	EventAgentToolCalled  EventType = "agent_tool_called"
@@ -77,6 +96,26 @@ type ActivityFailedData struct {
 	Attempt    int    `json:"attempt"`
 }
 
+// ChildWorkflowStartedData contains data for child workflow started event
+type ChildWorkflowStartedData struct {
+	ChildWorkflowID   string      `json:"child_workflow_id"`
+	WorkflowName      string      `json:"workflow_name"`
+	Input             interface{} `json:"input"`
+	ParentClosePolicy string      `json:"parent_close_policy"`
+}
+
+// ChildWorkflowCompletedData contains data for child workflow completed event
+type ChildWorkflowCompletedData struct {
+	ChildWorkflowID string      `json:"child_workflow_id"`
+	Output          interface{} `json:"output"`
+}
+
+// ChildWorkflowFailedData contains data for child workflow failed event
+type ChildWorkflowFailedData struct {
+	ChildWorkflowID string `json:"child_workflow_id"`
+	Error           string `json:"error"`
+}
+
 // NewEvent creates a new event with generated ID
 func NewEvent(workflowID string, eventType EventType, data map[string]interface{}) *Event {
 	return &Event{
@@ -88,6 +127,19 @@ func NewEvent(workflowID string, eventType EventType, data map[string]interface{
 	}
 }
 
+// NewEventAt creates an event stamped with at, the time saved as the end
+// time of the activity or workflow whose outcome it records. A replayed
+// workflow's clock advances to the timestamps of the events it replays, so
+// sharing the end time keeps replayed workflow time equal to the live run's.
+// A zero at stamps the event with the current time, like NewEvent.
+func NewEventAt(workflowID string, eventType EventType, at time.Time, data map[string]interface{}) *Event {
+	event := NewEvent(workflowID, eventType, data)
+	if !at.IsZero() {
+		event.Timestamp = at
+	}
+	return event
+}
+
 // ToJSON serializes the event to JSON
 func (e *Event) ToJSON() ([]byte, error) {
 	return json.Marshal(e)
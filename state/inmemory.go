@@ -16,6 +16,15 @@ type InMemoryStore struct {
 	activities map[string]*ActivityState
 	idemKeys   map[string]string                  // idempotency key -> workflowID
 	timers     map[string]map[string]*TimerRecord // workflowID -> timerID -> record
+	schedules  map[string]*ScheduleState
+	watchers   map[string]map[chan *Event]struct{} // workflowID -> subscribers
+	leases     map[string]lease
+}
+
+// lease is a named lease held by owner until expires
+type lease struct {
+	owner   string
+	expires time.Time
 }
 
 // NewInMemoryStore creates a new in-memory state store
@@ -26,6 +35,9 @@ func NewInMemoryStore() *InMemoryStore {
 		activities: make(map[string]*ActivityState),
 		idemKeys:   make(map[string]string),
 		timers:     make(map[string]map[string]*TimerRecord),
+		schedules:  make(map[string]*ScheduleState),
+		watchers:   make(map[string]map[chan *Event]struct{}),
+		leases:     make(map[string]lease),
 	}
 }
 
@@ -47,7 +59,7 @@ func (s *InMemoryStore) GetWorkflowState(ctx context.Context, workflowID string)
 
 	state, exists := s.workflows[workflowID]
 	if !exists {
-		return nil, fmt.Errorf("workflow %s not found", workflowID)
+		return nil, fmt.Errorf("%w: %s", ErrWorkflowNotFound, workflowID)
 	}
 
 	// Return a copy to avoid external mutations
@@ -60,6 +72,12 @@ func (s *InMemoryStore) AppendEvent(ctx context.Context, event *Event) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.appendEventLocked(event)
+	return nil
+}
+
+// appendEventLocked appends an event; callers must hold s.mu.
+func (s *InMemoryStore) appendEventLocked(event *Event) {
 	events := s.events[event.WorkflowID]
 
 	// Set sequence number
@@ -69,7 +87,37 @@ func (s *InMemoryStore) AppendEvent(ctx context.Context, event *Event) error {
 	eventCopy := *event
 	s.events[event.WorkflowID] = append(events, &eventCopy)
 
-	return nil
+	// Notify watchers without blocking the writer
+	for ch := range s.watchers[event.WorkflowID] {
+		delivered := eventCopy
+		select {
+		case ch <- &delivered:
+		default:
+		}
+	}
+}
+
+// WatchEvents implements EventWatcher
+func (s *InMemoryStore) WatchEvents(ctx context.Context, workflowID string) (<-chan *Event, error) {
+	ch := make(chan *Event, 64)
+	s.mu.Lock()
+	if s.watchers[workflowID] == nil {
+		s.watchers[workflowID] = make(map[chan *Event]struct{})
+	}
+	s.watchers[workflowID][ch] = struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.watchers[workflowID], ch)
+		if len(s.watchers[workflowID]) == 0 {
+			delete(s.watchers, workflowID)
+		}
+		close(ch)
+	}()
+	return ch, nil
 }
 
 // GetEvents implements Store
@@ -151,6 +199,20 @@ func (s *InMemoryStore) SaveActivityState(ctx context.Context, state *ActivitySt
 	return nil
 }
 
+// TransitionActivityState implements Store
+func (s *InMemoryStore) TransitionActivityState(ctx context.Context, st *ActivityState, from WorkflowStatus) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.activities[st.ActivityID]
+	if !ok || current.Status != from || current.Attempt != st.Attempt {
+		return false, nil
+	}
+	stateCopy := *st
+	s.activities[st.ActivityID] = &stateCopy
+	return true, nil
+}
+
 // GetActivityState implements Store
 func (s *InMemoryStore) GetActivityState(ctx context.Context, activityID string) (*ActivityState, error) {
 	s.mu.RLock()
@@ -284,3 +346,100 @@ func (s *InMemoryStore) MarkTimerFired(ctx context.Context, workflowID string, t
 	rec.Fired = true
 	return true, nil
 }
+
+// AcquireLease implements Store
+func (s *InMemoryStore) AcquireLease(ctx context.Context, name string, owner string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if l, ok := s.leases[name]; ok && l.owner != owner && now.Before(l.expires) {
+		return false, nil
+	}
+	s.leases[name] = lease{owner: owner, expires: now.Add(ttl)}
+	return true, nil
+}
+
+// ReleaseLease implements Store
+func (s *InMemoryStore) ReleaseLease(ctx context.Context, name string, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if l, ok := s.leases[name]; ok && l.owner == owner {
+		delete(s.leases, name)
+	}
+	return nil
+}
+
+// ContinueAsNew implements Store
+func (s *InMemoryStore) ContinueAsNew(ctx context.Context, closed *WorkflowState, closedEvent *Event, next *WorkflowState, nextEvent *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.workflows[next.WorkflowID]; exists {
+		return fmt.Errorf("workflow %s already exists", next.WorkflowID)
+	}
+	if current, ok := s.workflows[closed.WorkflowID]; ok && current.Status == StatusContinuedAsNew {
+		return fmt.Errorf("workflow %s already continued as new", closed.WorkflowID)
+	}
+
+	closedCopy := *closed
+	nextCopy := *next
+	s.workflows[closed.WorkflowID] = &closedCopy
+	s.workflows[next.WorkflowID] = &nextCopy
+	s.appendEventLocked(closedEvent)
+	s.appendEventLocked(nextEvent)
+	return nil
+}
+
+// SaveSchedule implements Store
+func (s *InMemoryStore) SaveSchedule(ctx context.Context, schedule *ScheduleState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp := *schedule
+	cp.RunningWorkflowIDs = append([]string(nil), schedule.RunningWorkflowIDs...)
+	s.schedules[schedule.ScheduleID] = &cp
+	return nil
+}
+
+// GetSchedule implements Store
+func (s *InMemoryStore) GetSchedule(ctx context.Context, scheduleID string) (*ScheduleState, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schedule, ok := s.schedules[scheduleID]
+	if !ok {
+		return nil, fmt.Errorf("schedule %s not found", scheduleID)
+	}
+	cp := *schedule
+	cp.RunningWorkflowIDs = append([]string(nil), schedule.RunningWorkflowIDs...)
+	return &cp, nil
+}
+
+// ListSchedules implements Store
+func (s *InMemoryStore) ListSchedules(ctx context.Context) ([]*ScheduleState, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]*ScheduleState, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		cp := *schedule
+		cp.RunningWorkflowIDs = append([]string(nil), schedule.RunningWorkflowIDs...)
+		out = append(out, &cp)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ScheduleID < out[j].ScheduleID })
+	return out, nil
+}
+
+// DeleteSchedule implements Store
+func (s *InMemoryStore) DeleteSchedule(ctx context.Context, scheduleID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.schedules[scheduleID]; !ok {
+		return fmt.Errorf("schedule %s not found", scheduleID)
+	}
+	delete(s.schedules, scheduleID)
+	return nil
+}
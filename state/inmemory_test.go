@@ -204,3 +204,98 @@ func TestListWorkflows_StableOrder(t *testing.T) {
 		}
 	}
 }
+
+func TestInMemoryStore_Schedules(t *testing.T) {
+	store := NewInMemoryStore()
+	ctx := context.Background()
+
+	for _, id := range []string{"b", "a"} {
+		if err := store.SaveSchedule(ctx, &ScheduleState{ScheduleID: id, WorkflowName: "w", Interval: time.Minute}); err != nil {
+			t.Fatalf("SaveSchedule: %v", err)
+		}
+	}
+	got, err := store.GetSchedule(ctx, "a")
+	if err != nil || got.Interval != time.Minute {
+		t.Fatalf("GetSchedule: %+v %v", got, err)
+	}
+	// Returned schedules are copies
+	got.RunningWorkflowIDs = append(got.RunningWorkflowIDs, "wf-1")
+	if again, _ := store.GetSchedule(ctx, "a"); len(again.RunningWorkflowIDs) != 0 {
+		t.Fatalf("expected stored schedule unchanged, got %+v", again)
+	}
+
+	list, _ := store.ListSchedules(ctx)
+	if len(list) != 2 || list[0].ScheduleID != "a" || list[1].ScheduleID != "b" {
+		t.Fatalf("expected schedules ordered by ID, got %+v", list)
+	}
+	if err := store.DeleteSchedule(ctx, "a"); err != nil {
+		t.Fatalf("DeleteSchedule: %v", err)
+	}
+	if err := store.DeleteSchedule(ctx, "a"); err == nil {
+		t.Fatal("expected error deleting missing schedule")
+	}
+	if _, err := store.GetSchedule(ctx, "a"); err == nil {
+		t.Fatal("expected error for deleted schedule")
+	}
+}
+
+func TestInMemoryStore_WatchEvents(t *testing.T) {
+	store := NewInMemoryStore()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	events, err := store.WatchEvents(ctx, "wf-watch")
+	if err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	_ = store.AppendEvent(context.Background(), NewEvent("wf-other", EventSignalReceived, nil))
+	_ = store.AppendEvent(context.Background(), NewEvent("wf-watch", EventTimerFired, map[string]interface{}{"timer_id": "t1"}))
+
+	select {
+	case e := <-events:
+		if e.WorkflowID != "wf-watch" || e.Type != EventTimerFired || e.SequenceNum != 1 {
+			t.Fatalf("unexpected event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected watched event")
+	}
+
+	// Canceling the watch closes the channel
+	cancel()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatal("expected no further events")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected channel to close")
+	}
+}
+
+func TestInMemoryStore_Leases(t *testing.T) {
+	store := NewInMemoryStore()
+	ctx := context.Background()
+
+	if held, _ := store.AcquireLease(ctx, "workflow/wf-1", "a", time.Minute); !held {
+		t.Fatal("expected free lease to be acquired")
+	}
+	if held, _ := store.AcquireLease(ctx, "workflow/wf-1", "b", time.Minute); held {
+		t.Fatal("expected lease held by another owner to be refused")
+	}
+	if held, _ := store.AcquireLease(ctx, "workflow/wf-1", "a", time.Millisecond); !held {
+		t.Fatal("expected owner to extend its lease")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if held, _ := store.AcquireLease(ctx, "workflow/wf-1", "b", time.Minute); !held {
+		t.Fatal("expected expired lease to be taken over")
+	}
+
+	// Only the owner releases a lease
+	_ = store.ReleaseLease(ctx, "workflow/wf-1", "a")
+	if held, _ := store.AcquireLease(ctx, "workflow/wf-1", "a", time.Minute); held {
+		t.Fatal("expected release by a non-owner to be ignored")
+	}
+	_ = store.ReleaseLease(ctx, "workflow/wf-1", "b")
+	if held, _ := store.AcquireLease(ctx, "workflow/wf-1", "a", time.Minute); !held {
+		t.Fatal("expected released lease to be free")
+	}
+}
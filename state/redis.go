@@ -6,6 +6,7 @@ package state
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/redis/go-redis/v9"
@@ -44,6 +45,9 @@ func (s *RedisStore) SaveWorkflowState(ctx context.Context, st *WorkflowState) e
 
 func (s *RedisStore) GetWorkflowState(ctx context.Context, workflowID string) (*WorkflowState, error) {
 	v, err := s.rdb.HGet(ctx, s.keyWorkflow(workflowID), "state").Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("%w: %s", ErrWorkflowNotFound, workflowID)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,36 @@
+package state
+
+import "time"
+
+// ScheduleState is the durable state of a workflow schedule. The fields up to
+// Paused mirror schedule.Spec; the rest track the schedule's progress.
+type ScheduleState struct {
+	ScheduleID      string        `json:"schedule_id"`
+	WorkflowName    string        `json:"workflow_name"`
+	WorkflowVersion string        `json:"workflow_version,omitempty"`
+	Input           interface{}   `json:"input,omitempty"`
+	Cron            string        `json:"cron,omitempty"`
+	Interval        time.Duration `json:"interval,omitempty"`
+	TimeZone        string        `json:"time_zone,omitempty"`
+	Jitter          time.Duration `json:"jitter,omitempty"`
+	OverlapPolicy   string        `json:"overlap_policy"`
+	CatchupWindow   time.Duration `json:"catchup_window"`
+	Paused          bool          `json:"paused"`
+
+	// NextRunAt is the nominal time of the next fire, before jitter
+	NextRunAt time.Time `json:"next_run_at"`
+	// LastRunAt is the nominal time of the last fire that started a workflow
+	LastRunAt *time.Time `json:"last_run_at,omitempty"`
+	// BufferedRunAt is the nominal time of a fire waiting for a running
+	// workflow to close (OverlapBufferOne)
+	BufferedRunAt *time.Time `json:"buffered_run_at,omitempty"`
+	// RunningWorkflowIDs lists workflows started by the schedule that were
+	// running when it last fired
+	RunningWorkflowIDs []string `json:"running_workflow_ids,omitempty"`
+	// StartedRuns and SkippedRuns count fires that did and did not start a workflow
+	StartedRuns int `json:"started_runs"`
+	SkippedRuns int `json:"skipped_runs"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
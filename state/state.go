@@ -2,6 +2,7 @@ package state
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
@@ -14,6 +15,10 @@ const (
 	StatusCompleted WorkflowStatus = "completed"
 	StatusFailed    WorkflowStatus = "failed"
 	StatusCanceled  WorkflowStatus = "canceled"
+	// StatusTimedOut marks a workflow that exceeded its execution timeout
+	StatusTimedOut WorkflowStatus = "timed_out"
+	// StatusContinuedAsNew marks a run that completed by starting a fresh run
+	StatusContinuedAsNew WorkflowStatus = "continued_as_new"
 )
 
 // WorkflowState represents the current state of a workflow execution
@@ -28,6 +33,29 @@ type WorkflowState struct {
 	EndTime      *time.Time     `json:"end_time,omitempty"`
 	LastEventSeq int64          `json:"last_event_seq"`
 	TaskQueue    string         `json:"task_queue"`
+	// ParentWorkflowID links a child workflow to the workflow that started it
+	ParentWorkflowID string `json:"parent_workflow_id,omitempty"`
+	// FirstRunID is the logical workflow ID shared by all runs of a workflow
+	// that continued as new; empty for the first run
+	FirstRunID string `json:"first_run_id,omitempty"`
+	// ContinuedAsNewRunID is the ID of the run that replaced this one
+	ContinuedAsNewRunID string `json:"continued_as_new_run_id,omitempty"`
+	// LatestRunID is maintained on the first run as a shortcut to the latest run
+	LatestRunID string `json:"latest_run_id,omitempty"`
+	// WorkflowVersion is the definition version the run is pinned to
+	WorkflowVersion string `json:"workflow_version,omitempty"`
+	// ScheduleID is set on workflows started by a schedule
+	ScheduleID string `json:"schedule_id,omitempty"`
+	// Attempt is the current attempt of the run, starting at 1 and increased
+	// each time the workflow retry policy retries a failure
+	Attempt int `json:"attempt,omitempty"`
+	// Priority and FairnessKey are given to the tasks the workflow enqueues;
+	// see queue.Task
+	Priority    int    `json:"priority,omitempty"`
+	FairnessKey string `json:"fairness_key,omitempty"`
+	// CancelRequested is set when a running workflow is asked to cancel; it
+	// closes as canceled once its execution has unwound
+	CancelRequested bool `json:"cancel_requested,omitempty"`
 }
 
 // ActivityState represents the state of an activity execution
@@ -42,14 +70,23 @@ type ActivityState struct {
 	StartTime    time.Time      `json:"start_time"`
 	EndTime      *time.Time     `json:"end_time,omitempty"`
 	Attempt      int            `json:"attempt"`
+	// HeartbeatDetails holds the details of the last heartbeat, handed to
+	// the next attempt so it can resume from a checkpoint
+	HeartbeatDetails interface{} `json:"heartbeat_details,omitempty"`
+	LastHeartbeat    *time.Time  `json:"last_heartbeat,omitempty"`
 }
 
+// ErrWorkflowNotFound is wrapped by the error a Store returns for a workflow
+// it has no state for
+var ErrWorkflowNotFound = errors.New("workflow not found")
+
 // Store defines the interface for persisting workflow state
 type Store interface {
 	// SaveWorkflowState saves the current state of a workflow
 	SaveWorkflowState(ctx context.Context, state *WorkflowState) error
 
-	// GetWorkflowState retrieves the current state of a workflow
+	// GetWorkflowState retrieves the current state of a workflow, or an
+	// error wrapping ErrWorkflowNotFound if it has none
 	GetWorkflowState(ctx context.Context, workflowID string) (*WorkflowState, error)
 
 	// AppendEvent appends an event to the workflow's event log
@@ -67,6 +104,11 @@ type Store interface {
 	// GetActivityState retrieves the state of an activity
 	GetActivityState(ctx context.Context, activityID string) (*ActivityState, error)
 
+	// TransitionActivityState saves st only if the stored state is for the
+	// same attempt and has status from, and reports whether it did, so
+	// concurrent completions of an activity agree on a single outcome.
+	TransitionActivityState(ctx context.Context, st *ActivityState, from WorkflowStatus) (bool, error)
+
 	// ListWorkflows lists all workflows, optionally filtered by status
 	ListWorkflows(ctx context.Context, status WorkflowStatus) ([]*WorkflowState, error)
 
@@ -89,6 +131,43 @@ type Store interface {
 
   // MarkTimerFired marks a timer as fired (idempotent) and returns true if it was transitioned.
   MarkTimerFired(ctx context.Context, workflowID string, timerID string) (bool, error)
+
+	// ContinueAsNew atomically saves the closed run's final state and event
+	// together with the initial state and start event of the run replacing it.
+	// It fails if the next run exists or the closed run was already continued.
+	ContinueAsNew(ctx context.Context, closed *WorkflowState, closedEvent *Event, next *WorkflowState, nextEvent *Event) error
+
+	// SaveSchedule creates or replaces a schedule
+	SaveSchedule(ctx context.Context, schedule *ScheduleState) error
+
+	// GetSchedule retrieves a schedule by ID
+	GetSchedule(ctx context.Context, scheduleID string) (*ScheduleState, error)
+
+	// ListSchedules lists all schedules ordered by ID
+	ListSchedules(ctx context.Context) ([]*ScheduleState, error)
+
+	// DeleteSchedule removes a schedule
+	DeleteSchedule(ctx context.Context, scheduleID string) error
+
+	// AcquireLease takes the named lease for owner until ttl elapses. It
+	// succeeds if the lease is free, expired or already held by owner, in
+	// which case the lease is extended.
+	AcquireLease(ctx context.Context, name string, owner string, ttl time.Duration) (bool, error)
+
+	// ReleaseLease gives up the named lease if owner holds it
+	ReleaseLease(ctx context.Context, name string, owner string) error
+}
+
+// EventWatcher is implemented by stores that can push newly appended events
+// to subscribers. The engine uses it to resolve activities, timers, signals
+// and child workflows as soon as their events land, and falls back to polling
+// stores that do not implement it.
+type EventWatcher interface {
+	// WatchEvents streams events appended to a workflow's log once the
+	// subscription is established. The channel is closed when ctx is done.
+	// Delivery is best effort: events are dropped when the subscriber falls
+	// behind, so callers must keep a slower polling fallback.
+	WatchEvents(ctx context.Context, workflowID string) (<-chan *Event, error)
 }
 
 // TimerRecord represents a durable timer persisted by the store.
@@ -101,7 +180,7 @@ type TimerRecord struct {
 
 // IsTerminal returns true if the status is terminal (workflow is done)
 func (s WorkflowStatus) IsTerminal() bool {
-	return s == StatusCompleted || s == StatusFailed || s == StatusCanceled
+	return s == StatusCompleted || s == StatusFailed || s == StatusCanceled || s == StatusTimedOut || s == StatusContinuedAsNew
 }
 
 // IsRunning returns true if the workflow is currently running
@@ -114,6 +193,15 @@ func (w *WorkflowState) IsComplete() bool {
 	return w.Status.IsTerminal()
 }
 
+// LogicalWorkflowID returns the workflow ID shared by every run of this
+// workflow, i.e. the ID of its first run.
+func (w *WorkflowState) LogicalWorkflowID() string {
+	if w.FirstRunID != "" {
+		return w.FirstRunID
+	}
+	return w.WorkflowID
+}
+
 // Duration returns the workflow execution duration
 func (w *WorkflowState) Duration() time.Duration {
 	if w.EndTime != nil {
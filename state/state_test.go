@@ -243,3 +243,13 @@ func TestWorkflowStatus_IsTerminal(t *testing.T) {
 		}
 	}
 }
+
+func TestNewEventAt(t *testing.T) {
+	end := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if got := NewEventAt("wf-1", EventActivityCompleted, end, nil).Timestamp; !got.Equal(end) {
+		t.Fatalf("expected the end time, got %s", got)
+	}
+	if got := NewEventAt("wf-1", EventActivityCompleted, time.Time{}, nil).Timestamp; got.IsZero() {
+		t.Fatal("expected a zero end time to stamp the current time")
+	}
+}
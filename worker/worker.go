@@ -3,23 +3,41 @@ package worker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
 	"time"
 
 	"github.com/KamdynS/marathon/activity"
+	"github.com/KamdynS/marathon/converter"
 	"github.com/KamdynS/marathon/queue"
 	"github.com/KamdynS/marathon/state"
 )
 
-// Worker polls tasks from a queue and executes activities
+// maxTaskAttempts is how many times a failing task is delivered before it is
+// given up on. Activities that run are retried under their RetryPolicy
+// instead; this covers tasks that fail before that, e.g. workflow tasks or
+// activities this worker does not host.
+const maxTaskAttempts = 3
+
+// WorkflowExecutor runs workflow tasks with replay. *engine.Engine implements
+// it: a worker process builds an engine over the shared store and queue with
+// the workflow.Registry of the workflows it hosts and passes it here.
+type WorkflowExecutor interface {
+	ExecuteWorkflowTask(ctx context.Context, task *queue.Task) error
+}
+
+// Worker polls tasks from a queue and executes activities and workflow tasks
 type Worker struct {
 	id               string
 	queue            queue.Queue
 	queueName        string
 	activityRegistry *activity.Registry
+	workflowExecutor WorkflowExecutor
 	stateStore       state.Store
+	dataConverter    converter.DataConverter
+	taskTokenSecret  []byte
 	pollInterval     time.Duration
 	maxConcurrent    int
 	stopCh           chan struct{}
@@ -34,9 +52,18 @@ type Config struct {
 	Queue            queue.Queue
 	QueueName        string
 	ActivityRegistry *activity.Registry
+	// WorkflowExecutor runs workflow tasks; workers without one fail them
+	WorkflowExecutor WorkflowExecutor
 	StateStore       state.Store
 	PollInterval     time.Duration
 	MaxConcurrent    int
+	// DataConverter decodes activity inputs and encodes outputs; defaults to JSON
+	DataConverter converter.DataConverter
+	// TaskTokenSecret signs the task tokens handed to activities for
+	// asynchronous completion; it must match engine.Config.TaskTokenSecret.
+	// Without it activities get no task token and cannot return
+	// activity.ErrResultPending.
+	TaskTokenSecret []byte
 }
 
 // DefaultConfig returns a default worker configuration
@@ -53,8 +80,8 @@ func New(cfg Config) (*Worker, error) {
 	if cfg.Queue == nil {
 		return nil, fmt.Errorf("queue is required")
 	}
-	if cfg.ActivityRegistry == nil {
-		return nil, fmt.Errorf("activity registry is required")
+	if cfg.ActivityRegistry == nil && cfg.WorkflowExecutor == nil {
+		return nil, fmt.Errorf("activity registry or workflow executor is required")
 	}
 	if cfg.StateStore == nil {
 		return nil, fmt.Errorf("state store is required")
@@ -71,13 +98,19 @@ func New(cfg Config) (*Worker, error) {
 	if cfg.MaxConcurrent == 0 {
 		cfg.MaxConcurrent = DefaultConfig().MaxConcurrent
 	}
+	if cfg.DataConverter == nil {
+		cfg.DataConverter = converter.Default()
+	}
 
 	return &Worker{
 		id:               cfg.ID,
 		queue:            cfg.Queue,
 		queueName:        cfg.QueueName,
 		activityRegistry: cfg.ActivityRegistry,
+		workflowExecutor: cfg.WorkflowExecutor,
 		stateStore:       cfg.StateStore,
+		dataConverter:    cfg.DataConverter,
+		taskTokenSecret:  cfg.TaskTokenSecret,
 		pollInterval:     cfg.PollInterval,
 		maxConcurrent:    cfg.MaxConcurrent,
 		stopCh:           make(chan struct{}),
@@ -178,14 +211,14 @@ func (w *Worker) pollOnce(ctx context.Context, workerNum int) {
 	result := w.executeTask(ctx, task)
 
 	// Ack or Nack based on result
-	if result.Success {
+	if result.Success || result.Canceled || result.Retried || result.Pending {
 		if err := w.queue.Ack(ctx, w.queueName, task.ID); err != nil {
 			log.Printf("[Worker %s-%d] Failed to ack task %s: %v",
 				w.id, workerNum, task.ID, err)
 		}
 	} else {
-		// Nack and requeue if not max attempts
-		requeue := task.Attempts < 3 // TODO: make configurable
+		// Nack and requeue if not final or max attempts
+		requeue := !result.Final && task.Attempts < maxTaskAttempts
 		if err := w.queue.Nack(ctx, w.queueName, task.ID, requeue); err != nil {
 			log.Printf("[Worker %s-%d] Failed to nack task %s: %v",
 				w.id, workerNum, task.ID, err)
@@ -208,8 +241,7 @@ func (w *Worker) executeTask(ctx context.Context, task *queue.Task) *queue.TaskR
 	case queue.TaskTypeActivity:
 		result = w.executeActivity(ctx, task)
 	case queue.TaskTypeWorkflow:
-		// Workflow execution would be handled differently
-		result.Error = "workflow tasks not yet implemented"
+		result = w.executeWorkflowTask(ctx, task)
 	default:
 		result.Error = fmt.Sprintf("unknown task type: %s", task.Type)
 	}
@@ -222,6 +254,38 @@ func (w *Worker) executeTask(ctx context.Context, task *queue.Task) *queue.TaskR
 	return result
 }
 
+// executeWorkflowTask runs a workflow task through the workflow executor
+func (w *Worker) executeWorkflowTask(ctx context.Context, task *queue.Task) *queue.TaskResult {
+	result := &queue.TaskResult{
+		TaskID:     task.ID,
+		WorkflowID: task.WorkflowID,
+		Success:    false,
+	}
+	if w.workflowExecutor == nil {
+		result.Error = "no workflow executor configured"
+		return result
+	}
+
+	// Stopping the worker makes the executor hand the workflow back
+	taskCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-w.stopCh:
+			cancel()
+		case <-taskCtx.Done():
+		}
+	}()
+
+	if err := w.workflowExecutor.ExecuteWorkflowTask(taskCtx, task); err != nil {
+		result.Error = err.Error()
+		log.Printf("[Worker %s] Workflow task for %s failed: %v", w.id, task.WorkflowID, err)
+		return result
+	}
+	result.Success = true
+	return result
+}
+
 // executeActivity executes an activity task
 func (w *Worker) executeActivity(ctx context.Context, task *queue.Task) *queue.TaskResult {
 	result := &queue.TaskResult{
@@ -232,12 +296,23 @@ func (w *Worker) executeActivity(ctx context.Context, task *queue.Task) *queue.T
 	}
 
 	// Get activity from registry
+	if w.activityRegistry == nil {
+		result.Error = "no activity registry configured"
+		return result
+	}
 	reg, err := w.activityRegistry.Get(task.ActivityName)
 	if err != nil {
 		result.Error = fmt.Sprintf("activity not found: %v", err)
 		return result
 	}
 
+	// Activities of workflows that already closed are abandoned
+	if wf, err := w.stateStore.GetWorkflowState(ctx, task.WorkflowID); err == nil && wf.IsComplete() {
+		result.Error = fmt.Sprintf("workflow %s", wf.Status)
+		result.Canceled = true
+		return result
+	}
+
 	// Load existing activity state if any for idempotency
 	var activityState *state.ActivityState
 	existing, getErr := w.stateStore.GetActivityState(ctx, task.ActivityID)
@@ -250,7 +325,18 @@ func (w *Worker) executeActivity(ctx context.Context, task *queue.Task) *queue.T
 			result.Output = activityState.Output
 			return result
 		}
-		// Already started previously: do not emit duplicate ActivityStarted event
+		// A duplicate delivery of an activity that already failed for good
+		if activityState.Status == state.StatusFailed {
+			result.Error = activityState.Error
+			result.Final = true
+			return result
+		}
+		// Already started previously: do not emit duplicate ActivityStarted
+		// event, but count the attempt
+		activityState.Status = state.StatusRunning
+		activityState.Attempt = max(activityState.Attempt, 1) + 1
+		activityState.EndTime = nil
+		w.stateStore.SaveActivityState(ctx, activityState)
 	} else {
 		// No existing record; create running state and emit ActivityStarted once
 		activityState = &state.ActivityState{
@@ -260,7 +346,7 @@ func (w *Worker) executeActivity(ctx context.Context, task *queue.Task) *queue.T
 			Status:       state.StatusRunning,
 			Input:        task.Input,
 			StartTime:    time.Now().UTC(),
-			Attempt:      task.Attempts,
+			Attempt:      1,
 		}
 		w.stateStore.SaveActivityState(ctx, activityState)
 
@@ -281,57 +367,125 @@ func (w *Worker) executeActivity(ctx context.Context, task *queue.Task) *queue.T
 	}
 
 	// Execute the activity
-	// Inject an event emitter into the activity context so it can stream agent events
+	// Inject an event emitter into the activity context so it can stream
+	// agent events; their data is encoded like any other payload
 	execCtx = activity.WithEventEmitter(execCtx, func(eventType state.EventType, data map[string]interface{}) error {
-		evt := state.NewEvent(task.WorkflowID, eventType, data)
+		encoded := make(map[string]interface{}, len(data))
+		for k, v := range data {
+			ev, err := converter.Normalize(w.dataConverter, v)
+			if err != nil {
+				return fmt.Errorf("failed to encode event data %s: %w", k, err)
+			}
+			encoded[k] = ev
+		}
+		evt := state.NewEvent(task.WorkflowID, eventType, encoded)
 		return w.stateStore.AppendEvent(ctx, evt)
 	})
 	// Inject ActivityEventContext for idempotency-aware activities
 	execCtx = activity.WithActivityEventContext(execCtx, activity.ActivityEventContext{
-		Store:      w.stateStore,
-		WorkflowID: task.WorkflowID,
+		Store:         w.stateStore,
+		WorkflowID:    task.WorkflowID,
+		DataConverter: w.dataConverter,
 	})
-
-	// Derive a cancelable context that cancels when workflow is canceled
-	wfCtx, cancel := context.WithCancel(execCtx)
-	defer cancel()
-	go func() {
-		ticker := time.NewTicker(200 * time.Millisecond)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-wfCtx.Done():
-				return
-			case <-ticker.C:
-				st, err := w.stateStore.GetWorkflowState(context.Background(), task.WorkflowID)
-				if err == nil && st.Status == state.StatusCanceled {
-					cancel()
-					return
-				}
-			}
+	// Hand the last checkpoint of a previous attempt to this one
+	if activityState.HeartbeatDetails != nil {
+		if details, err := converter.Value(w.dataConverter, activityState.HeartbeatDetails); err == nil {
+			execCtx = activity.WithHeartbeatDetails(execCtx, details)
+		} else {
+			log.Printf("[Worker %s] Failed to decode heartbeat details of activity %s: %v", w.id, task.ActivityID, err)
 		}
-	}()
+	}
+	hb := w.newHeartbeats(ctx, activityState)
+	execCtx = activity.WithHeartbeatRecorder(execCtx, hb.record)
+	if len(w.taskTokenSecret) > 0 {
+		execCtx = activity.WithTaskToken(execCtx, activity.TaskToken{
+			WorkflowID: task.WorkflowID,
+			ActivityID: task.ActivityID,
+			Attempt:    activityState.Attempt,
+		}.Sign(w.taskTokenSecret))
+	}
+
+	// Derive a context that is canceled when the workflow closes, e.g.
+	// because it was canceled or timed out
+	wfCtx, cancel := context.WithCancelCause(execCtx)
+	defer cancel(nil)
+	workflowClosed := make(chan struct{})
+	w.watchWorkflowClose(wfCtx, task.WorkflowID, func(status state.WorkflowStatus) {
+		close(workflowClosed)
+		cancel(fmt.Errorf("workflow %s", status))
+	})
 
-	output, err := reg.Activity.Execute(wfCtx, task.Input)
+	input, err := converter.Value(w.dataConverter, task.Input)
+	var output interface{}
+	if err == nil {
+		output, err = w.runActivity(wfCtx, cancel, reg, input, hb)
+	}
+	if err == nil {
+		// Record the output in the same form every store hands it back
+		output, err = converter.Normalize(w.dataConverter, output)
+	}
 
+	// Late heartbeats of an abandoned attempt must not touch the state below
+	hb.close()
+	if errors.Is(err, activity.ErrResultPending) && len(w.taskTokenSecret) == 0 {
+		err = fmt.Errorf("activity returned ErrResultPending but the worker has no TaskTokenSecret")
+	}
+	if errors.Is(err, activity.ErrResultPending) {
+		// Completed later through its task token; the activity stays running
+		result.Pending = true
+		log.Printf("[Worker %s] Activity %s awaits asynchronous completion", w.id, task.ActivityName)
+		return result
+	}
 	now := time.Now().UTC()
 	activityState.EndTime = &now
 
+	var retryIn time.Duration
 	if err != nil {
 		// Activity failed
 		result.Error = err.Error()
-		activityState.Status = state.StatusFailed
 		activityState.Error = err.Error()
+		attempt := activityState.Attempt
+		policy := reg.Info.RetryPolicy
+		select {
+		case <-workflowClosed:
+			// Interrupted because the workflow closed; do not retry
+			result.Canceled = true
+			activityState.Status = state.StatusCanceled
+		default:
+		}
 
-		// Record failure event
-		event := state.NewEvent(task.WorkflowID, state.EventActivityFailed, map[string]interface{}{
-			"activity_id": task.ActivityID,
-			"error":       err.Error(),
-			"attempt":     task.Attempts,
-		})
-		w.stateStore.AppendEvent(ctx, event)
+		if !result.Canceled && policy != nil && attempt < policy.MaxAttempts && policy.IsRetryable(err) {
+			// Leave the activity pending and schedule its next attempt
+			retryIn = policy.GetBackoffDuration(attempt - 1)
+			result.Retried = true
+			activityState.Status = state.StatusPending
+			event := state.NewEventAt(task.WorkflowID, state.EventActivityRetrying, now, map[string]interface{}{
+				"activity_id":   task.ActivityID,
+				"activity_name": task.ActivityName,
+				"error":         err.Error(),
+				"attempt":       attempt,
+				"backoff":       retryIn.String(),
+				"retry_at":      now.Add(retryIn),
+			})
+			w.stateStore.AppendEvent(ctx, event)
+
+			log.Printf("[Worker %s] Activity %s attempt %d failed, retrying in %s: %v", w.id, task.ActivityName, attempt, retryIn, err)
+		} else {
+			if !result.Canceled {
+				result.Final = true
+				activityState.Status = state.StatusFailed
+			}
 
-		log.Printf("[Worker %s] Activity %s failed: %v", w.id, task.ActivityName, err)
+			// Record failure event
+			event := state.NewEventAt(task.WorkflowID, state.EventActivityFailed, now, map[string]interface{}{
+				"activity_id": task.ActivityID,
+				"error":       err.Error(),
+				"attempt":     attempt,
+			})
+			w.stateStore.AppendEvent(ctx, event)
+
+			log.Printf("[Worker %s] Activity %s failed: %v", w.id, task.ActivityName, err)
+		}
 	} else {
 		// Activity succeeded
 		result.Success = true
@@ -340,7 +494,7 @@ func (w *Worker) executeActivity(ctx context.Context, task *queue.Task) *queue.T
 			activityState.Status = state.StatusCompleted
 			activityState.Output = output
 			// Record completion event once
-			event := state.NewEvent(task.WorkflowID, state.EventActivityCompleted, map[string]interface{}{
+			event := state.NewEventAt(task.WorkflowID, state.EventActivityCompleted, now, map[string]interface{}{
 				"activity_id": task.ActivityID,
 				"output":      output,
 			})
@@ -352,6 +506,205 @@ func (w *Worker) executeActivity(ctx context.Context, task *queue.Task) *queue.T
 
 	// Save final activity state
 	w.stateStore.SaveActivityState(ctx, activityState)
+	if result.Retried {
+		if err := w.scheduleRetry(task, retryIn); err != nil {
+			// Leave the retry to the redelivery of this task
+			log.Printf("[Worker %s] Failed to enqueue retry of activity %s: %v", w.id, task.ActivityID, err)
+			result.Retried = false
+		}
+	}
+
+	// Wake a workflow that runs as workflow tasks once the activity closes
+	if wfQueue, _ := task.Metadata[queue.MetadataWorkflowTaskQueue].(string); wfQueue != "" &&
+		(activityState.Status == state.StatusCompleted || activityState.Status == state.StatusFailed) {
+		wake := queue.NewTask(queue.TaskTypeWorkflow, task.WorkflowID, nil)
+		wake.Priority = task.Priority
+		wake.FairnessKey = task.FairnessKey
+		if err := w.queue.Enqueue(ctx, wfQueue, wake); err != nil {
+			log.Printf("[Worker %s] Failed to wake workflow %s: %v", w.id, task.WorkflowID, err)
+		}
+	}
 
 	return result
 }
+
+// scheduleRetry enqueues the next attempt of a failed activity task, to
+// become visible once its backoff elapses
+func (w *Worker) scheduleRetry(task *queue.Task, backoff time.Duration) error {
+	retry := queue.NewTask(queue.TaskTypeActivity, task.WorkflowID, task.Input)
+	retry.ActivityID = task.ActivityID
+	retry.ActivityName = task.ActivityName
+	retry.Priority = task.Priority
+	retry.FairnessKey = task.FairnessKey
+	for k, v := range task.Metadata {
+		retry.Metadata[k] = v
+	}
+	return w.queue.EnqueueAt(context.Background(), w.queueName, retry, time.Now().Add(backoff))
+}
+
+// runActivity executes an activity. With a heartbeat timeout, an attempt
+// that stops heartbeating is canceled and failed with
+// activity.ErrHeartbeatTimeout without waiting for it to return, so a hung
+// activity cannot hold on to its task.
+func (w *Worker) runActivity(ctx context.Context, cancel context.CancelCauseFunc, reg *activity.Registration, input interface{}, hb *heartbeats) (interface{}, error) {
+	timeout := reg.Info.HeartbeatTimeout
+	if timeout <= 0 {
+		return reg.Activity.Execute(ctx, input)
+	}
+
+	type outcome struct {
+		output interface{}
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		output, err := reg.Activity.Execute(ctx, input)
+		done <- outcome{output, err}
+	}()
+
+	ticker := time.NewTicker(max(timeout/4, 10*time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case o := <-done:
+			return o.output, o.err
+		case <-ticker.C:
+			if since := time.Since(hb.lastBeat()); since > timeout {
+				err := fmt.Errorf("%w: no heartbeat for %s", activity.ErrHeartbeatTimeout, since.Round(time.Millisecond))
+				cancel(err)
+				return nil, err
+			}
+		}
+	}
+}
+
+// workflowClosePollInterval is how often a running activity's workflow is
+// checked for closing when its events cannot be watched.
+// workflowCloseFallbackInterval replaces it when they can, in case a close
+// event is dropped.
+const (
+	workflowClosePollInterval     = 200 * time.Millisecond
+	workflowCloseFallbackInterval = 5 * time.Second
+)
+
+// workflowCloseStatus maps the events that close a workflow to the status
+// they close it with
+var workflowCloseStatus = map[state.EventType]state.WorkflowStatus{
+	state.EventWorkflowCompleted:      state.StatusCompleted,
+	state.EventWorkflowFailed:         state.StatusFailed,
+	state.EventWorkflowCanceled:       state.StatusCanceled,
+	state.EventWorkflowTimedOut:       state.StatusTimedOut,
+	state.EventWorkflowContinuedAsNew: state.StatusContinuedAsNew,
+}
+
+// watchWorkflowClose calls closed with the workflow's status once it closes,
+// unless ctx is done first. Close events are watched if the store supports
+// it; the workflow state is re-read right after subscribing and then as a
+// fallback. It subscribes before returning so no close event slips past.
+func (w *Worker) watchWorkflowClose(ctx context.Context, workflowID string, closed func(state.WorkflowStatus)) {
+	var events <-chan *state.Event
+	interval := workflowClosePollInterval
+	if watcher, ok := w.stateStore.(state.EventWatcher); ok {
+		if ch, err := watcher.WatchEvents(ctx, workflowID); err == nil {
+			events, interval = ch, workflowCloseFallbackInterval
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		check := func() bool {
+			st, err := w.stateStore.GetWorkflowState(ctx, workflowID)
+			if err == nil && st.IsComplete() {
+				closed(st.Status)
+				return true
+			}
+			return false
+		}
+		if check() {
+			return
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case evt, ok := <-events:
+				if !ok {
+					events = nil
+					ticker.Reset(workflowClosePollInterval)
+					continue
+				}
+				if status, closes := workflowCloseStatus[evt.Type]; closes {
+					closed(status)
+					return
+				}
+			case <-ticker.C:
+				if check() {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// heartbeatSaveInterval bounds how often heartbeats are written to the state
+// store; the worker itself sees every heartbeat
+const heartbeatSaveInterval = time.Second
+
+// heartbeats tracks the heartbeats of a running activity attempt and
+// persists their details on its activity state
+type heartbeats struct {
+	w      *Worker
+	ctx    context.Context
+	mu     sync.Mutex
+	state  *state.ActivityState
+	last   time.Time
+	saved  time.Time
+	closed bool
+}
+
+func (w *Worker) newHeartbeats(ctx context.Context, activityState *state.ActivityState) *heartbeats {
+	return &heartbeats{w: w, ctx: ctx, state: activityState, last: time.Now()}
+}
+
+// record is the activity.HeartbeatRecorder handed to the activity
+func (h *heartbeats) record(details interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	now := time.Now()
+	h.last = now
+	if details != nil {
+		normalized, err := converter.Normalize(h.w.dataConverter, details)
+		if err != nil {
+			log.Printf("[Worker %s] Failed to encode heartbeat details of activity %s: %v", h.w.id, h.state.ActivityID, err)
+		} else {
+			h.state.HeartbeatDetails = normalized
+		}
+	}
+	beat := now.UTC()
+	h.state.LastHeartbeat = &beat
+	if now.Sub(h.saved) < heartbeatSaveInterval {
+		return
+	}
+	h.saved = now
+	if err := h.w.stateStore.SaveActivityState(h.ctx, h.state); err != nil {
+		log.Printf("[Worker %s] Failed to save heartbeat of activity %s: %v", h.w.id, h.state.ActivityID, err)
+	}
+}
+
+// lastBeat returns when the attempt last heartbeated, or started
+func (h *heartbeats) lastBeat() time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.last
+}
+
+// close stops recording heartbeats once the attempt's outcome is known
+func (h *heartbeats) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+}
@@ -1,11 +1,19 @@
 package worker
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/KamdynS/marathon/activity"
+	"github.com/KamdynS/marathon/converter"
 	"github.com/KamdynS/marathon/queue"
 	"github.com/KamdynS/marathon/state"
 )
@@ -136,6 +144,7 @@ func TestWorker_ActivityFailure(t *testing.T) {
 	registry.Register("failing-activity", failingActivity, activity.Info{
 		Description: "failing activity",
 		Timeout:     5 * time.Second,
+		RetryPolicy: &activity.RetryPolicy{MaxAttempts: 3, InitialInterval: 10 * time.Millisecond, BackoffCoefficient: 2},
 	})
 
 	cfg := Config{
@@ -256,3 +265,307 @@ func TestWorker_Activity_Idempotency_Table(t *testing.T) {
         })
     }
 }
+
+// unwatchedStore hides the EventWatcher of the store it wraps
+type unwatchedStore struct {
+	state.Store
+}
+
+func TestWorker_CancelsActivityWhenWorkflowCloses(t *testing.T) {
+	t.Run("watched", func(t *testing.T) {
+		store := state.NewInMemoryStore()
+		testCancelsActivityWhenWorkflowCloses(t, store, func(ctx context.Context, wf *state.WorkflowState) {
+			// Close the workflow the way the engine does
+			store.SaveWorkflowState(ctx, wf)
+			store.AppendEvent(ctx, state.NewEvent(wf.WorkflowID, state.EventWorkflowCanceled, nil))
+		})
+	})
+	t.Run("polled", func(t *testing.T) {
+		store := unwatchedStore{state.NewInMemoryStore()}
+		testCancelsActivityWhenWorkflowCloses(t, store, func(ctx context.Context, wf *state.WorkflowState) {
+			store.SaveWorkflowState(ctx, wf)
+		})
+	})
+}
+
+func testCancelsActivityWhenWorkflowCloses(t *testing.T, store state.Store, closeWorkflow func(context.Context, *state.WorkflowState)) {
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+
+	registry := activity.NewRegistry()
+	ctx := context.Background()
+
+	started := make(chan struct{})
+	registry.Register("blocking", activity.ActivityFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}), activity.Info{})
+
+	worker, err := New(Config{Queue: q, QueueName: "test-queue", ActivityRegistry: registry, StateStore: store, MaxConcurrent: 1, PollInterval: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("failed to create worker: %v", err)
+	}
+	worker.Start(ctx)
+	defer func() {
+		stopCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		worker.Stop(stopCtx)
+	}()
+
+	wf := &state.WorkflowState{WorkflowID: "wf-cancel", WorkflowName: "w", Status: state.StatusRunning, StartTime: time.Now().UTC()}
+	store.SaveWorkflowState(ctx, wf)
+	task := queue.NewTask(queue.TaskTypeActivity, "wf-cancel", nil)
+	task.ActivityID = "act-cancel"
+	task.ActivityName = "blocking"
+	q.Enqueue(ctx, "test-queue", task)
+
+	<-started
+	wf.Status = state.StatusCanceled
+	closeWorkflow(ctx, wf)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		st, err := store.GetActivityState(ctx, "act-cancel")
+		if err == nil && st.Status == state.StatusCanceled {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected activity to be canceled, got %+v (%v)", st, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	// The canceled task is acknowledged rather than redelivered
+	time.Sleep(200 * time.Millisecond)
+	if n, _ := q.Len(ctx, "test-queue"); n != 0 {
+		t.Fatalf("expected no redelivered tasks, got %d", n)
+	}
+}
+
+// recordingExecutor records the workflow tasks it is given
+type recordingExecutor struct {
+	tasks chan *queue.Task
+}
+
+func (e *recordingExecutor) ExecuteWorkflowTask(ctx context.Context, task *queue.Task) error {
+	e.tasks <- task
+	return nil
+}
+
+func TestWorker_WorkflowTasks(t *testing.T) {
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+	store := state.NewInMemoryStore()
+	registry := activity.NewRegistry()
+	registry.Register("noop", activity.ActivityFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		return "ok", nil
+	}), activity.Info{})
+	executor := &recordingExecutor{tasks: make(chan *queue.Task, 1)}
+
+	ctx := context.Background()
+	for _, cfg := range []Config{
+		{Queue: q, QueueName: "workflows", WorkflowExecutor: executor, StateStore: store, PollInterval: 50 * time.Millisecond},
+		{Queue: q, QueueName: "activities", ActivityRegistry: registry, StateStore: store, PollInterval: 50 * time.Millisecond},
+	} {
+		w, err := New(cfg)
+		if err != nil {
+			t.Fatalf("failed to create worker: %v", err)
+		}
+		w.Start(ctx)
+		defer w.Stop(ctx)
+	}
+
+	// Completing an activity of a workflow run as workflow tasks wakes it
+	task := queue.NewTask(queue.TaskTypeActivity, "wf-tasks", "in")
+	task.ActivityID = "act-tasks"
+	task.ActivityName = "noop"
+	task.Metadata[queue.MetadataWorkflowTaskQueue] = "workflows"
+	q.Enqueue(ctx, "activities", task)
+
+	select {
+	case got := <-executor.tasks:
+		if got.Type != queue.TaskTypeWorkflow || got.WorkflowID != "wf-tasks" {
+			t.Fatalf("unexpected workflow task %+v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a workflow task")
+	}
+
+	if _, err := New(Config{Queue: q, StateStore: store}); err == nil {
+		t.Fatal("expected error without an activity registry or workflow executor")
+	}
+}
+
+func TestWorker_HeartbeatTimeoutResumesFromDetails(t *testing.T) {
+	store := state.NewInMemoryStore()
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+	ctx := context.Background()
+
+	hang := make(chan struct{})
+	defer close(hang)
+	registry := activity.NewRegistry()
+	registry.Register("ingest", activity.ActivityFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		if details, ok := activity.GetHeartbeatDetails(ctx); ok {
+			return details, nil
+		}
+		activity.RecordHeartbeat(ctx, map[string]interface{}{"page": 2})
+		// Hangs without honoring ctx, like a stuck client call
+		<-hang
+		return nil, nil
+	}), activity.Info{HeartbeatTimeout: 100 * time.Millisecond})
+
+	w, err := New(Config{Queue: q, ActivityRegistry: registry, StateStore: store})
+	if err != nil {
+		t.Fatalf("new worker: %v", err)
+	}
+	task := queue.NewTask(queue.TaskTypeActivity, "wf-hb", nil)
+	task.ActivityID = "act-hb"
+	task.ActivityName = "ingest"
+	task.Attempts = 1
+
+	started := time.Now()
+	res := w.executeActivity(ctx, task)
+	if res.Success || !strings.Contains(res.Error, activity.ErrHeartbeatTimeout.Error()) {
+		t.Fatalf("expected heartbeat timeout, got %+v", res)
+	}
+	if time.Since(started) > 2*time.Second {
+		t.Fatalf("heartbeat timeout took %s", time.Since(started))
+	}
+	st, _ := store.GetActivityState(ctx, "act-hb")
+	if st.Status != state.StatusPending || st.LastHeartbeat == nil {
+		t.Fatalf("expected a pending activity with a heartbeat, got %+v", st)
+	}
+
+	// The retry attempt resumes from the last checkpoint
+	task.Attempts = 2
+	res = w.executeActivity(ctx, task)
+	if !res.Success {
+		t.Fatalf("retry failed: %s", res.Error)
+	}
+	if details, _ := res.Output.(map[string]interface{}); details["page"] != float64(2) {
+		t.Fatalf("expected the heartbeat details, got %#v", res.Output)
+	}
+}
+
+func TestWorker_RetriesActivitiesUnderRetryPolicy(t *testing.T) {
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+	store := state.NewInMemoryStore()
+	ctx := context.Background()
+
+	var calls sync.Map
+	registry := activity.NewRegistry()
+	policy := &activity.RetryPolicy{MaxAttempts: 4, InitialInterval: 20 * time.Millisecond, BackoffCoefficient: 2}
+	registry.Register("flaky", activity.ActivityFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		n, _ := calls.LoadOrStore(input, new(atomic.Int32))
+		if n.(*atomic.Int32).Add(1) < 3 {
+			return nil, errors.New("try again")
+		}
+		return "ok", nil
+	}), activity.Info{RetryPolicy: policy})
+	registry.Register("invalid", activity.ActivityFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		calls.Store("invalid", true)
+		return nil, fmt.Errorf("bad input: %w", activity.NewNonRetryableError(errors.New("malformed")))
+	}), activity.Info{RetryPolicy: policy})
+
+	w, err := New(Config{Queue: q, QueueName: "test-queue", ActivityRegistry: registry, StateStore: store, MaxConcurrent: 2, PollInterval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("new worker: %v", err)
+	}
+	w.Start(ctx)
+	defer w.Stop(ctx)
+
+	for _, name := range []string{"flaky", "invalid"} {
+		task := queue.NewTask(queue.TaskTypeActivity, "wf-retry", name)
+		task.ActivityID = "act-" + name
+		task.ActivityName = name
+		q.Enqueue(ctx, "test-queue", task)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		flaky, _ := store.GetActivityState(ctx, "act-flaky")
+		invalid, _ := store.GetActivityState(ctx, "act-invalid")
+		if flaky != nil && flaky.Status == state.StatusCompleted && invalid != nil && invalid.Status == state.StatusFailed {
+			if flaky.Attempt != 3 || invalid.Attempt != 1 {
+				t.Fatalf("expected 3 and 1 attempts, got %d and %d", flaky.Attempt, invalid.Attempt)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("activities did not settle: %+v %+v", flaky, invalid)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	events, _ := store.GetEvents(ctx, "wf-retry")
+	retrying := map[string]int{}
+	failed := 0
+	for _, e := range events {
+		switch e.Type {
+		case state.EventActivityRetrying:
+			retrying[e.Data["activity_id"].(string)]++
+		case state.EventActivityFailed:
+			failed++
+		}
+	}
+	if retrying["act-flaky"] != 2 || retrying["act-invalid"] != 0 || failed != 1 {
+		t.Fatalf("unexpected retry events %v and %d failures", retrying, failed)
+	}
+}
+
+func TestWorker_EncodesEmittedEventData(t *testing.T) {
+	q := queue.NewInMemoryQueue()
+	defer q.Close()
+	store := state.NewInMemoryStore()
+	codec, err := converter.NewEncryptionCodec("k1", map[string][]byte{"k1": bytes.Repeat([]byte{7}, 32)})
+	if err != nil {
+		t.Fatalf("codec: %v", err)
+	}
+	dc := converter.NewCodecConverter(nil, codec)
+
+	registry := activity.NewRegistry()
+	registry.Register("chat", activity.ActivityFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		emit, _ := activity.GetEventEmitter(ctx)
+		return nil, emit(state.EventAgentMessage, map[string]interface{}{"role": "assistant", "content": "the patient is jane"})
+	}), activity.Info{})
+
+	w, err := New(Config{Queue: q, QueueName: "default", ActivityRegistry: registry, StateStore: store, MaxConcurrent: 1, PollInterval: 20 * time.Millisecond, DataConverter: dc})
+	if err != nil {
+		t.Fatalf("worker: %v", err)
+	}
+	ctx := context.Background()
+	w.Start(ctx)
+	defer func() {
+		stopCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		w.Stop(stopCtx)
+	}()
+
+	task := queue.NewTask(queue.TaskTypeActivity, "wf-1", nil)
+	task.ActivityID = "act-1"
+	task.ActivityName = "chat"
+	q.Enqueue(ctx, "default", task)
+
+	var msg *state.Event
+	deadline := time.Now().Add(2 * time.Second)
+	for msg == nil && time.Now().Before(deadline) {
+		events, _ := store.GetEvents(ctx, "wf-1")
+		for _, e := range events {
+			if e.Type == state.EventAgentMessage {
+				msg = e
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if msg == nil {
+		t.Fatal("agent message not recorded")
+	}
+	if recorded, _ := json.Marshal(msg); strings.Contains(string(recorded), "jane") {
+		t.Fatalf("plaintext event data found in store: %s", recorded)
+	}
+	if content, err := converter.Value(dc, msg.Data["content"]); err != nil || content != "the patient is jane" {
+		t.Fatalf("expected content to decode, got %v (%v)", content, err)
+	}
+}
@@ -3,12 +3,20 @@ package workflow
 import (
 	"context"
 	"fmt"
+
+	"github.com/KamdynS/marathon/converter"
 )
 
 // AgentLoopInput configures the agent loop workflow.
 type AgentLoopInput struct {
 	Message       string `json:"message"`
 	MaxIterations int    `json:"max_iterations"`
+	// ContinueAsNewEvery bounds history growth by continuing as a new run
+	// after this many iterations; 0 disables it
+	ContinueAsNewEvery int `json:"continue_as_new_every,omitempty"`
+	// StartIteration is the first iteration number of this run, carried
+	// across continue-as-new so iteration IDs stay unique
+	StartIteration int `json:"start_iteration,omitempty"`
 }
 
 // AgentLoopWorkflow runs agent iterations as activities with stable IDs.
@@ -17,28 +25,26 @@ type AgentLoopWorkflow struct{}
 func (w *AgentLoopWorkflow) Name() string { return "agent-loop" }
 
 func (w *AgentLoopWorkflow) Execute(ctx Context, input interface{}) (interface{}, error) {
-	in := AgentLoopInput{Message: "", MaxIterations: 1}
-	switch v := input.(type) {
-	case AgentLoopInput:
-		in = v
-	case map[string]interface{}:
-		if m, ok := v["message"].(string); ok {
-			in.Message = m
-		}
-		if mi, ok := v["max_iterations"].(int); ok {
-			in.MaxIterations = mi
-		}
-		if mi64, ok := v["max_iterations"].(int64); ok && in.MaxIterations == 0 {
-			in.MaxIterations = int(mi64)
-		}
+	var in AgentLoopInput
+	if err := converter.Assign(nil, input, &in); err != nil {
+		return nil, fmt.Errorf("invalid agent loop input: %w", err)
 	}
 	if in.MaxIterations <= 0 {
 		in.MaxIterations = 1
 	}
+	if in.StartIteration <= 0 {
+		in.StartIteration = 1
+	}
 
 	current := in.Message
 	var final interface{}
-	for i := 1; i <= in.MaxIterations; i++ {
+	for i := in.StartIteration; i <= in.MaxIterations; i++ {
+		if in.ContinueAsNewEvery > 0 && i-in.StartIteration >= in.ContinueAsNewEvery {
+			next := in
+			next.Message = current
+			next.StartIteration = i
+			return nil, ctx.ContinueAsNew(next)
+		}
 		iterID := fmt.Sprintf("iteration-%d", i)
 		payload := map[string]interface{}{
 			"iteration_id": iterID,
@@ -57,4 +63,3 @@ func (w *AgentLoopWorkflow) Execute(ctx Context, input interface{}) (interface{}
 	return final, nil
 }
 
-
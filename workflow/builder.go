@@ -2,6 +2,7 @@ package workflow
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 )
@@ -13,6 +14,7 @@ type Builder struct {
 	version     string
 	steps       []Step
 	options     Options
+	sagaOptions SagaOptions
 }
 
 // Step represents a single step in a workflow
@@ -23,8 +25,17 @@ type Step interface {
 // ActivityStep executes an activity
 type ActivityStep struct {
 	ActivityName string
-	Input        interface{}
-	Timeout      time.Duration
+	// Input is passed to the activity after rendering any Templates in it
+	Input interface{}
+	// InputFunc, if set, computes the input from step data instead of Input
+	InputFunc InputMapper
+	// Name, if set, records the step's output in StepData.Steps
+	Name    string
+	Timeout time.Duration
+	// Compensation names an activity that undoes this one. It is registered
+	// with the workflow's saga once the step succeeds and receives a
+	// CompensationInput.
+	Compensation string
 }
 
 // Execute implements Step
@@ -37,14 +48,60 @@ func (s *ActivityStep) Execute(ctx Context) (interface{}, error) {
 		defer cancel()
 	}
 
-	future := ctx.ExecuteActivity(execCtx, s.ActivityName, s.Input)
+	input, err := s.resolveInput(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("activity %s input: %w", s.ActivityName, err)
+	}
+
+	future := ctx.ExecuteActivity(execCtx, s.ActivityName, input)
 	var result interface{}
 	if err := future.Get(execCtx, &result); err != nil {
 		return nil, err
 	}
+	if s.Name != "" {
+		asStepContext(ctx).record(s.Name, result)
+	}
+	if s.Compensation != "" {
+		if saga := sagaFrom(ctx); saga != nil {
+			saga.AddCompensation(s.Compensation, CompensationInput{Input: input, Output: result})
+		}
+	}
 	return result, nil
 }
 
+// resolveInput computes the activity input from InputFunc or Input
+func (s *ActivityStep) resolveInput(ctx Context) (interface{}, error) {
+	if s.InputFunc == nil && !hasTemplates(s.Input) {
+		return s.Input, nil
+	}
+	data := asStepContext(ctx).data()
+	if s.InputFunc != nil {
+		return s.InputFunc(data)
+	}
+	return renderInput(s.Input, data)
+}
+
+// hasTemplates reports whether v contains a Template in a nested map or list
+func hasTemplates(v interface{}) bool {
+	switch t := v.(type) {
+	case Template:
+		return true
+	case map[string]interface{}:
+		for _, item := range t {
+			if hasTemplates(item) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range t {
+			if hasTemplates(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // ParallelStep executes multiple steps in parallel
 type ParallelStep struct {
 	Steps []Step
@@ -86,22 +143,15 @@ func (s *ParallelStep) Execute(ctx Context) (interface{}, error) {
 	return results, nil
 }
 
-// SequenceStep executes steps in sequence
+// SequenceStep executes steps in sequence, feeding each step's output to
+// the next as StepData.Prev
 type SequenceStep struct {
 	Steps []Step
 }
 
 // Execute implements Step
 func (s *SequenceStep) Execute(ctx Context) (interface{}, error) {
-	var lastResult interface{}
-	for _, step := range s.Steps {
-		result, err := step.Execute(ctx)
-		if err != nil {
-			return nil, err
-		}
-		lastResult = result
-	}
-	return lastResult, nil
+	return runSteps(asStepContext(ctx), s.Steps)
 }
 
 // New creates a new workflow builder
@@ -142,6 +192,12 @@ func (b *Builder) Timeout(timeout time.Duration) *Builder {
 	return b
 }
 
+// RetryPolicy sets the workflow retry policy
+func (b *Builder) RetryPolicy(policy *RetryPolicy) *Builder {
+	b.options.RetryPolicy = policy
+	return b
+}
+
 // Activity adds an activity step
 func (b *Builder) Activity(name string, input interface{}) *Builder {
 	b.steps = append(b.steps, &ActivityStep{
@@ -161,6 +217,59 @@ func (b *Builder) ActivityWithTimeout(name string, input interface{}, timeout ti
 	return b
 }
 
+// ActivityWithCompensation adds an activity step that is undone by running
+// compensateActivity if a later step fails
+func (b *Builder) ActivityWithCompensation(name string, input interface{}, compensateActivity string) *Builder {
+	b.steps = append(b.steps, &ActivityStep{
+		ActivityName: name,
+		Input:        input,
+		Compensation: compensateActivity,
+	})
+	return b
+}
+
+// SagaOptions configures how compensations run when a step fails
+func (b *Builder) SagaOptions(opts SagaOptions) *Builder {
+	b.sagaOptions = opts
+	return b
+}
+
+// ActivityWithInput adds an activity step whose input is computed from the
+// workflow input and earlier step outputs
+func (b *Builder) ActivityWithInput(name string, mapper InputMapper) *Builder {
+	b.steps = append(b.steps, &ActivityStep{
+		ActivityName: name,
+		InputFunc:    mapper,
+	})
+	return b
+}
+
+// Step adds any step, such as a named ActivityStep
+func (b *Builder) Step(step Step) *Builder {
+	b.steps = append(b.steps, step)
+	return b
+}
+
+// If adds a conditional step; elseStep may be nil
+func (b *Builder) If(predicate Predicate, then Step, elseStep Step) *Builder {
+	b.steps = append(b.steps, &IfStep{Predicate: predicate, Then: then, Else: elseStep})
+	return b
+}
+
+// While adds a loop that runs body while condition holds, at most
+// maxIterations times
+func (b *Builder) While(condition Predicate, body Step, maxIterations int) *Builder {
+	b.steps = append(b.steps, &WhileStep{Condition: condition, Body: body, MaxIterations: maxIterations})
+	return b
+}
+
+// ForEach adds a loop that runs body for each element of the list returned
+// by items (the previous output if nil), failing on more than maxItems
+func (b *Builder) ForEach(items InputMapper, body Step, maxItems int) *Builder {
+	b.steps = append(b.steps, &ForEachStep{Items: items, Body: body, MaxItems: maxItems})
+	return b
+}
+
 // Parallel adds a parallel execution step
 func (b *Builder) Parallel(steps ...Step) *Builder {
 	b.steps = append(b.steps, &ParallelStep{Steps: steps})
@@ -186,15 +295,17 @@ func (b *Builder) Build() *Definition {
 
 func (b *Builder) buildWorkflow() Workflow {
 	steps := b.steps
+	sagaOptions := b.sagaOptions
 	return WorkflowFunc(func(ctx Context, input interface{}) (interface{}, error) {
-		var lastResult interface{}
-		for _, step := range steps {
-			result, err := step.Execute(ctx)
-			if err != nil {
-				return nil, err
+		saga := NewSaga(sagaOptions)
+		result, err := runSteps(newStepContext(ctx, saga, input), steps)
+		if err != nil {
+			// Undo completed steps, most recent first
+			if compErr := saga.Compensate(ctx); compErr != nil {
+				return nil, errors.Join(err, compErr)
 			}
-			lastResult = result
+			return nil, err
 		}
-		return lastResult, nil
+		return result, nil
 	})
 }
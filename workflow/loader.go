@@ -0,0 +1,508 @@
+package workflow
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Spec is the declarative form of a workflow definition, loaded from a YAML
+// or JSON document:
+//
+//	name: research
+//	task_queue: agents
+//	timeout: 15m
+//	retry_policy:
+//	  max_attempts: 5
+//	steps:
+//	  - activity: plan
+//	    name: plan
+//	    input: "{{.Input.question}}"
+//	  - for_each: "{{json .Prev}}"
+//	    do:
+//	      - activity: search
+//	        input: "{{.Item}}"
+//	        timeout: 30s
+//	  - parallel:
+//	      - activity: summarize
+//	      - activity: extract-citations
+//
+// String inputs containing "{{" are rendered as a Template against StepData.
+type Spec struct {
+	Name        string           `json:"name" yaml:"name"`
+	Description string           `json:"description,omitempty" yaml:"description"`
+	Version     string           `json:"version,omitempty" yaml:"version"`
+	TaskQueue   string           `json:"task_queue,omitempty" yaml:"task_queue"`
+	Timeout     string           `json:"timeout,omitempty" yaml:"timeout"`
+	RetryPolicy *RetryPolicySpec `json:"retry_policy,omitempty" yaml:"retry_policy"`
+	Steps       []StepSpec       `json:"steps" yaml:"steps"`
+}
+
+// RetryPolicySpec is the declarative form of a RetryPolicy. Unset fields
+// take their values from DefaultRetryPolicy.
+type RetryPolicySpec struct {
+	MaxAttempts        int      `json:"max_attempts,omitempty" yaml:"max_attempts"`
+	InitialInterval    string   `json:"initial_interval,omitempty" yaml:"initial_interval"`
+	BackoffCoefficient float64  `json:"backoff_coefficient,omitempty" yaml:"backoff_coefficient"`
+	MaxInterval        string   `json:"max_interval,omitempty" yaml:"max_interval"`
+	NonRetryableErrors []string `json:"non_retryable_errors,omitempty" yaml:"non_retryable_errors"`
+}
+
+// StepSpec is the declarative form of a step. Exactly one of Activity,
+// Parallel, Sequence, If, While or ForEach must be set.
+type StepSpec struct {
+	// Activity runs an activity step
+	Activity string `json:"activity,omitempty" yaml:"activity"`
+	// Name records the activity output in StepData.Steps
+	Name         string      `json:"name,omitempty" yaml:"name"`
+	Input        interface{} `json:"input,omitempty" yaml:"input"`
+	Timeout      string      `json:"timeout,omitempty" yaml:"timeout"`
+	Compensation string      `json:"compensation,omitempty" yaml:"compensation"`
+
+	// Parallel and Sequence run nested steps
+	Parallel []StepSpec `json:"parallel,omitempty" yaml:"parallel"`
+	Sequence []StepSpec `json:"sequence,omitempty" yaml:"sequence"`
+
+	// If is a condition template that must render to true or false
+	If   string     `json:"if,omitempty" yaml:"if"`
+	Then []StepSpec `json:"then,omitempty" yaml:"then"`
+	Else []StepSpec `json:"else,omitempty" yaml:"else"`
+
+	// While is a condition template evaluated before each iteration of Do
+	While string `json:"while,omitempty" yaml:"while"`
+	// ForEach is a template that must render to a JSON list; Do runs once
+	// per element
+	ForEach       string     `json:"for_each,omitempty" yaml:"for_each"`
+	Do            []StepSpec `json:"do,omitempty" yaml:"do"`
+	MaxIterations int        `json:"max_iterations,omitempty" yaml:"max_iterations"`
+
+	line int
+}
+
+// stepFields are the keys accepted in a YAML step mapping
+var stepFields = yamlFields(reflect.TypeOf(StepSpec{}))
+
+// UnmarshalYAML decodes a step strictly and remembers its line for errors
+func (s *StepSpec) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i < len(node.Content); i += 2 {
+			key := node.Content[i]
+			if !stepFields[key.Value] {
+				return fmt.Errorf("line %d: unknown step field %q", key.Line, key.Value)
+			}
+		}
+	}
+	type plain StepSpec
+	if err := node.Decode((*plain)(s)); err != nil {
+		return err
+	}
+	s.line = node.Line
+	return nil
+}
+
+func yamlFields(t reflect.Type) map[string]bool {
+	fields := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		if tag := t.Field(i).Tag.Get("yaml"); tag != "" {
+			fields[strings.Split(tag, ",")[0]] = true
+		}
+	}
+	return fields
+}
+
+// LoadOptions configure how workflow documents are turned into definitions
+type LoadOptions struct {
+	// Activities lists the registered activity names, e.g. from
+	// activity.Registry.List. When set, steps naming any other activity are
+	// rejected at load time.
+	Activities []string
+}
+
+// SpecError describes a problem with one element of a workflow document
+type SpecError struct {
+	// Path locates the element, e.g. "steps[2].parallel[0]"
+	Path string
+	// Step is the name of the offending step, if it has one
+	Step string
+	// Line is the step's line in a YAML document, or 0 if unknown
+	Line int
+	Msg  string
+}
+
+// Error implements error
+func (e *SpecError) Error() string {
+	var details []string
+	if e.Step != "" {
+		details = append(details, strconv.Quote(e.Step))
+	}
+	if e.Line > 0 {
+		details = append(details, fmt.Sprintf("line %d", e.Line))
+	}
+	loc := e.Path
+	if len(details) > 0 {
+		loc += " (" + strings.Join(details, ", ") + ")"
+	}
+	return loc + ": " + e.Msg
+}
+
+// ParseSpec decodes a YAML or JSON workflow document. Unknown fields are
+// rejected.
+func ParseSpec(data []byte) (*Spec, error) {
+	var spec Spec
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&spec); err != nil {
+			return nil, fmt.Errorf("parse workflow document: %w", err)
+		}
+		return &spec, nil
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&spec); err != nil {
+		return nil, fmt.Errorf("parse workflow document: %w", err)
+	}
+	return &spec, nil
+}
+
+// LoadDefinition parses and validates a YAML or JSON workflow document.
+// Validation errors are *SpecError values joined with errors.Join, one per
+// problem found.
+func LoadDefinition(data []byte, opts LoadOptions) (*Definition, error) {
+	spec, err := ParseSpec(data)
+	if err != nil {
+		return nil, err
+	}
+	return spec.Definition(opts)
+}
+
+// Load parses a workflow document and registers the resulting definition
+func (r *Registry) Load(data []byte, opts LoadOptions) (*Definition, error) {
+	def, err := LoadDefinition(data, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Register(def); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+// LoadFile reads a workflow document from path and registers it
+func (r *Registry) LoadFile(path string, opts LoadOptions) (*Definition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read workflow document: %w", err)
+	}
+	def, err := r.Load(data, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return def, nil
+}
+
+// Definition validates the spec and builds a workflow definition from it
+func (s *Spec) Definition(opts LoadOptions) (*Definition, error) {
+	l := &loader{names: make(map[string]string)}
+	if len(opts.Activities) > 0 {
+		l.activities = make(map[string]bool, len(opts.Activities))
+		for _, name := range opts.Activities {
+			l.activities[name] = true
+		}
+	}
+
+	if s.Name == "" {
+		l.fail("name", nil, "workflow name is required")
+	}
+	b := New(s.Name).Description(s.Description)
+	if s.Version != "" {
+		b.Version(s.Version)
+	}
+	if s.TaskQueue != "" {
+		b.TaskQueue(s.TaskQueue)
+	}
+	if timeout := l.duration("timeout", nil, s.Timeout); timeout > 0 {
+		b.Timeout(timeout)
+	}
+	if s.RetryPolicy != nil {
+		b.RetryPolicy(l.retryPolicy(s.RetryPolicy))
+	}
+
+	if len(s.Steps) == 0 {
+		l.fail("steps", nil, "at least one step is required")
+	}
+	for _, step := range l.steps("steps", s.Steps) {
+		b.Step(step)
+	}
+
+	if len(l.errs) > 0 {
+		return nil, errors.Join(l.errs...)
+	}
+	return b.Build(), nil
+}
+
+// loader validates a spec while converting it into steps
+type loader struct {
+	activities map[string]bool
+	// names maps step names to the path that first used them
+	names map[string]string
+	errs  []error
+}
+
+// fail records a problem at path within step s, which may be nil
+func (l *loader) fail(path string, s *StepSpec, format string, args ...interface{}) {
+	err := &SpecError{Path: path, Msg: fmt.Sprintf(format, args...)}
+	if s != nil {
+		err.Step = s.Name
+		err.Line = s.line
+	}
+	l.errs = append(l.errs, err)
+}
+
+func (l *loader) duration(path string, s *StepSpec, value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		l.fail(path, s, "invalid duration %q", value)
+		return 0
+	}
+	return d
+}
+
+func (l *loader) retryPolicy(spec *RetryPolicySpec) *RetryPolicy {
+	policy := DefaultRetryPolicy()
+	if spec.MaxAttempts < 0 {
+		l.fail("retry_policy.max_attempts", nil, "must not be negative")
+	} else if spec.MaxAttempts > 0 {
+		policy.MaxAttempts = spec.MaxAttempts
+	}
+	if spec.BackoffCoefficient != 0 {
+		if spec.BackoffCoefficient < 1 {
+			l.fail("retry_policy.backoff_coefficient", nil, "must be at least 1")
+		}
+		policy.BackoffCoefficient = spec.BackoffCoefficient
+	}
+	if d := l.duration("retry_policy.initial_interval", nil, spec.InitialInterval); d > 0 {
+		policy.InitialInterval = d
+	}
+	if d := l.duration("retry_policy.max_interval", nil, spec.MaxInterval); d > 0 {
+		policy.MaxInterval = d
+	}
+	policy.NonRetryableErrors = spec.NonRetryableErrors
+	return policy
+}
+
+func (l *loader) steps(path string, specs []StepSpec) []Step {
+	steps := make([]Step, 0, len(specs))
+	for i := range specs {
+		if step := l.step(fmt.Sprintf("%s[%d]", path, i), &specs[i]); step != nil {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
+// body builds a loop or branch body, wrapping several steps in a sequence
+func (l *loader) body(path string, s *StepSpec, specs []StepSpec) Step {
+	if len(specs) == 0 {
+		l.fail(path, s, "at least one step is required")
+		return nil
+	}
+	steps := l.steps(path, specs)
+	if len(steps) == 1 {
+		return steps[0]
+	}
+	return &SequenceStep{Steps: steps}
+}
+
+func (l *loader) step(path string, s *StepSpec) Step {
+	kinds := map[string]bool{
+		"activity": s.Activity != "",
+		"parallel": len(s.Parallel) > 0,
+		"sequence": len(s.Sequence) > 0,
+		"if":       s.If != "",
+		"while":    s.While != "",
+		"for_each": s.ForEach != "",
+	}
+	var kind string
+	for _, k := range []string{"activity", "parallel", "sequence", "if", "while", "for_each"} {
+		if !kinds[k] {
+			continue
+		}
+		if kind != "" {
+			l.fail(path, s, "step sets both %s and %s", kind, k)
+			return nil
+		}
+		kind = k
+	}
+	if kind == "" {
+		l.fail(path, s, "step must set one of activity, parallel, sequence, if, while or for_each")
+		return nil
+	}
+	allowed := map[string][]string{
+		"activity": {"name", "input", "timeout", "compensation"},
+		"if":       {"then", "else"},
+		"while":    {"do", "max_iterations"},
+		"for_each": {"do", "max_iterations"},
+	}[kind]
+	set := map[string]bool{
+		"name":           s.Name != "",
+		"input":          s.Input != nil,
+		"timeout":        s.Timeout != "",
+		"compensation":   s.Compensation != "",
+		"then":           len(s.Then) > 0,
+		"else":           len(s.Else) > 0,
+		"do":             len(s.Do) > 0,
+		"max_iterations": s.MaxIterations != 0,
+	}
+	for _, field := range []string{"name", "input", "timeout", "compensation", "then", "else", "do", "max_iterations"} {
+		if set[field] && !contains(allowed, field) {
+			l.fail(path, s, "%s is not valid in a %s step", field, kind)
+		}
+	}
+	if s.MaxIterations < 0 {
+		l.fail(path, s, "max_iterations must not be negative")
+	}
+
+	switch kind {
+	case "activity":
+		return l.activityStep(path, s)
+	case "parallel":
+		return &ParallelStep{Steps: l.steps(path+".parallel", s.Parallel)}
+	case "sequence":
+		return &SequenceStep{Steps: l.steps(path+".sequence", s.Sequence)}
+	case "if":
+		step := &IfStep{
+			Predicate: l.condition(path+".if", s, s.If),
+			Then:      l.body(path+".then", s, s.Then),
+		}
+		if len(s.Else) > 0 {
+			step.Else = l.body(path+".else", s, s.Else)
+		}
+		return step
+	case "while":
+		return &WhileStep{
+			Condition:     l.condition(path+".while", s, s.While),
+			Body:          l.body(path+".do", s, s.Do),
+			MaxIterations: s.MaxIterations,
+		}
+	default:
+		return &ForEachStep{
+			Items:    l.items(path+".for_each", s, s.ForEach),
+			Body:     l.body(path+".do", s, s.Do),
+			MaxItems: s.MaxIterations,
+		}
+	}
+}
+
+func (l *loader) activityStep(path string, s *StepSpec) Step {
+	l.checkActivity(path, s, s.Activity)
+	if s.Compensation != "" {
+		l.checkActivity(path+".compensation", s, s.Compensation)
+	}
+	if s.Name != "" {
+		if first, ok := l.names[s.Name]; ok {
+			l.fail(path, s, "step name %q already used by %s", s.Name, first)
+		} else {
+			l.names[s.Name] = path
+		}
+	}
+	return &ActivityStep{
+		ActivityName: s.Activity,
+		Name:         s.Name,
+		Input:        l.input(path+".input", s, s.Input),
+		Timeout:      l.duration(path+".timeout", s, s.Timeout),
+		Compensation: s.Compensation,
+	}
+}
+
+func (l *loader) checkActivity(path string, s *StepSpec, name string) {
+	if l.activities != nil && !l.activities[name] {
+		l.fail(path, s, "unknown activity %q", name)
+	}
+}
+
+// input converts strings containing "{{" into Templates, checking that they
+// parse
+func (l *loader) input(path string, s *StepSpec, v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		if !strings.Contains(t, "{{") {
+			return t
+		}
+		if _, err := Template(t).parse(); err != nil {
+			l.fail(path, s, "%v", err)
+		}
+		return Template(t)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, item := range t {
+			out[k] = l.input(path+"."+k, s, item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, item := range t {
+			out[i] = l.input(fmt.Sprintf("%s[%d]", path, i), s, item)
+		}
+		return out
+	}
+	return v
+}
+
+// condition builds a predicate from a template that renders to a boolean
+func (l *loader) condition(path string, s *StepSpec, text string) Predicate {
+	tmpl := Template(text)
+	if _, err := tmpl.parse(); err != nil {
+		l.fail(path, s, "%v", err)
+	}
+	return func(data StepData) (bool, error) {
+		out, err := tmpl.render(data)
+		if err != nil {
+			return false, err
+		}
+		ok, err := strconv.ParseBool(strings.TrimSpace(out))
+		if err != nil {
+			return false, fmt.Errorf("%s: condition rendered %q, want true or false", path, out)
+		}
+		return ok, nil
+	}
+}
+
+// items builds an item mapper from a template that renders to a JSON list
+func (l *loader) items(path string, s *StepSpec, text string) InputMapper {
+	tmpl := Template(text)
+	if _, err := tmpl.parse(); err != nil {
+		l.fail(path, s, "%v", err)
+	}
+	return func(data StepData) (interface{}, error) {
+		out, err := tmpl.render(data)
+		if err != nil {
+			return nil, err
+		}
+		var items []interface{}
+		if err := json.Unmarshal([]byte(out), &items); err != nil {
+			return nil, fmt.Errorf("%s: items must render to a JSON list: %w", path, err)
+		}
+		return items, nil
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package workflow
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const researchDoc = `
+name: research
+description: Plan, search and summarize
+version: "2.0"
+task_queue: agents
+timeout: 15m
+retry_policy:
+  max_attempts: 5
+  initial_interval: 2s
+  non_retryable_errors: [invalid question]
+steps:
+  - activity: plan
+    name: plan
+    input: "{{.Input.question}}"
+  - for_each: "{{json .Prev}}"
+    max_iterations: 10
+    do:
+      - activity: search
+        input:
+          query: "{{.Item}}"
+          limit: 3
+        timeout: 30s
+  - parallel:
+      - activity: summarize
+      - activity: extract-citations
+`
+
+func TestLoadDefinition_YAML(t *testing.T) {
+	reg := NewRegistry()
+	def, err := reg.Load([]byte(researchDoc), LoadOptions{
+		Activities: []string{"plan", "search", "summarize", "extract-citations"},
+	})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if _, err := reg.Get("research"); err != nil {
+		t.Fatalf("expected definition to be registered: %v", err)
+	}
+	if def.Version != "2.0" || def.Description != "Plan, search and summarize" {
+		t.Errorf("unexpected metadata %q %q", def.Version, def.Description)
+	}
+	if def.Options.TaskQueue != "agents" || def.Options.ExecutionTimeout != 15*time.Minute {
+		t.Errorf("unexpected options %+v", def.Options)
+	}
+	rp := def.Options.RetryPolicy
+	if rp.MaxAttempts != 5 || rp.InitialInterval != 2*time.Second || rp.MaxInterval != time.Minute ||
+		len(rp.NonRetryableErrors) != 1 || rp.NonRetryableErrors[0] != "invalid question" {
+		t.Errorf("unexpected retry policy %+v", rp)
+	}
+}
+
+func TestLoadDefinition_JSON(t *testing.T) {
+	doc := "{\n\t\"name\": \"echo\",\n\t\"steps\": [{\"activity\": \"echo\", \"input\": \"{{.Input}}\"}]\n}"
+	def, err := LoadDefinition([]byte(doc), LoadOptions{})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if def.Name != "echo" || def.Options.TaskQueue != "default" {
+		t.Errorf("unexpected definition %+v", def)
+	}
+
+	_, err = LoadDefinition([]byte(`{"name": "echo", "stepz": []}`), LoadOptions{})
+	if err == nil || !strings.Contains(err.Error(), "stepz") {
+		t.Errorf("expected unknown field error, got %v", err)
+	}
+}
+
+func TestLoadDefinition_ValidationErrors(t *testing.T) {
+	doc := `
+name: broken
+timeout: soon
+steps:
+  - activity: plan
+    name: plan
+  - parallel:
+      - activity: fetch
+        name: plan
+      - activity: plan
+        if: "{{.Prev}}"
+  - for_each: "{{json .Prev"
+    do:
+      - activity: plan
+  - while: "true"
+`
+	_, err := LoadDefinition([]byte(doc), LoadOptions{Activities: []string{"plan"}})
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+
+	want := []string{
+		`timeout: invalid duration "soon"`,
+		`steps[1].parallel[0] ("plan", line 8): unknown activity "fetch"`,
+		`steps[1].parallel[0] ("plan", line 8): step name "plan" already used by steps[0]`,
+		`steps[1].parallel[1] (line 10): step sets both activity and if`,
+		`steps[2].for_each (line 12): parse template`,
+		`steps[3].do (line 15): at least one step is required`,
+	}
+	for _, w := range want {
+		if !strings.Contains(err.Error(), w) {
+			t.Errorf("expected error containing %q, got:\n%v", w, err)
+		}
+	}
+
+	var specErr *SpecError
+	if !errors.As(err, &specErr) {
+		t.Errorf("expected *SpecError, got %T", err)
+	}
+}
+
+func TestLoadDefinition_UnknownStepField(t *testing.T) {
+	doc := `
+name: typo
+steps:
+  - activity: plan
+    inptu: hello
+`
+	_, err := LoadDefinition([]byte(doc), LoadOptions{})
+	if err == nil || !strings.Contains(err.Error(), `line 5: unknown step field "inptu"`) {
+		t.Errorf("expected unknown step field error, got %v", err)
+	}
+}
+
+func TestLoader_ConditionsAndItems(t *testing.T) {
+	l := &loader{names: make(map[string]string)}
+	pred := l.condition("if", nil, "{{gt (len .Prev) 1}}")
+	items := l.items("for_each", nil, "{{json .Steps.plan}}")
+	if len(l.errs) > 0 {
+		t.Fatalf("unexpected errors %v", l.errs)
+	}
+
+	data := StepData{Prev: []interface{}{"a", "b"}, Steps: map[string]interface{}{"plan": []string{"x"}}}
+	if ok, err := pred(data); err != nil || !ok {
+		t.Errorf("expected true, got %v (%v)", ok, err)
+	}
+	list, err := items(data)
+	if err != nil || len(list.([]interface{})) != 1 {
+		t.Errorf("unexpected items %v (%v)", list, err)
+	}
+
+	notBool := l.condition("if", nil, "{{.Prev}}")
+	if _, err := notBool(data); err == nil {
+		t.Error("expected error for non-boolean condition")
+	}
+}
@@ -0,0 +1,69 @@
+package workflow
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// LocalActivityFunc is a function run inline by Context.ExecuteLocalActivity
+type LocalActivityFunc func(ctx context.Context, input interface{}) (interface{}, error)
+
+// LocalActivityOptions configure local activities
+type LocalActivityOptions struct {
+	// Name identifies the function in the local activity's ID, so replays
+	// only return an outcome recorded for the same function. It defaults to
+	// the function's Go name; set it to keep IDs stable for closures, whose
+	// names change when closures are added before them.
+	Name string
+
+	// Timeout bounds each attempt; zero means no timeout
+	Timeout time.Duration
+
+	// RetryPolicy defines how failed attempts are retried in process;
+	// DefaultLocalActivityRetryPolicy is used if nil
+	RetryPolicy *RetryPolicy
+}
+
+// DefaultLocalActivityRetryPolicy returns the retry policy for local
+// activities without one. Its backoff is short since local activities are
+// retried while the workflow waits.
+func DefaultLocalActivityRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:        3,
+		InitialInterval:    100 * time.Millisecond,
+		BackoffCoefficient: 2.0,
+		MaxInterval:        time.Second,
+	}
+}
+
+type localActivityOptionsKey struct{}
+
+// WithLocalActivityOptions returns a context that applies opts to the local
+// activities executed with it
+func WithLocalActivityOptions(ctx context.Context, opts LocalActivityOptions) context.Context {
+	return context.WithValue(ctx, localActivityOptionsKey{}, opts)
+}
+
+// GetLocalActivityOptions returns the options attached to ctx by
+// WithLocalActivityOptions, if any
+func GetLocalActivityOptions(ctx context.Context) LocalActivityOptions {
+	opts, _ := ctx.Value(localActivityOptionsKey{}).(LocalActivityOptions)
+	return opts
+}
+
+// LocalActivityName returns the name identifying a local activity that runs
+// fn with ctx: the Name in ctx's local activity options, or else fn's Go name
+// without its package path
+func LocalActivityName(ctx context.Context, fn interface{}) string {
+	if name := GetLocalActivityOptions(ctx).Name; name != "" {
+		return name
+	}
+	name := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
@@ -2,19 +2,23 @@ package workflow
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 )
 
-// Registry stores workflow definitions
+// Registry stores workflow definitions. Several versions of a workflow may
+// be registered side by side; lookups without a version return the latest.
 type Registry struct {
 	mu        sync.RWMutex
-	workflows map[string]*Definition
+	workflows map[string][]*Definition // name -> definitions ordered by version
 }
 
 // NewRegistry creates a new workflow registry
 func NewRegistry() *Registry {
 	return &Registry{
-		workflows: make(map[string]*Definition),
+		workflows: make(map[string][]*Definition),
 	}
 }
 
@@ -27,25 +31,57 @@ func (r *Registry) Register(def *Definition) error {
 		return fmt.Errorf("workflow name cannot be empty")
 	}
 
-	if _, exists := r.workflows[def.Name]; exists {
-		return fmt.Errorf("workflow %s already registered", def.Name)
+	versions := r.workflows[def.Name]
+	for _, existing := range versions {
+		if existing.Version == def.Version {
+			return fmt.Errorf("workflow %s version %s already registered", def.Name, def.Version)
+		}
 	}
 
-	r.workflows[def.Name] = def
+	versions = append(versions, def)
+	sort.SliceStable(versions, func(i, j int) bool {
+		return CompareVersions(versions[i].Version, versions[j].Version) < 0
+	})
+	r.workflows[def.Name] = versions
 	return nil
 }
 
-// Get retrieves a workflow definition by name
+// Get retrieves the latest version of a workflow definition by name
 func (r *Registry) Get(name string) (*Definition, error) {
+	return r.GetVersion(name, "")
+}
+
+// GetVersion retrieves a specific version of a workflow definition. An empty
+// version returns the latest.
+func (r *Registry) GetVersion(name, version string) (*Definition, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	def, exists := r.workflows[name]
+	versions, exists := r.workflows[name]
 	if !exists {
 		return nil, fmt.Errorf("workflow %s not found", name)
 	}
+	if version == "" {
+		return versions[len(versions)-1], nil
+	}
+	for _, def := range versions {
+		if def.Version == version {
+			return def, nil
+		}
+	}
+	return nil, fmt.Errorf("workflow %s version %s not found", name, version)
+}
+
+// Versions returns the registered versions of a workflow, oldest first
+func (r *Registry) Versions(name string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
-	return def, nil
+	versions := make([]string, 0, len(r.workflows[name]))
+	for _, def := range r.workflows[name] {
+		versions = append(versions, def.Version)
+	}
+	return versions
 }
 
 // List returns all registered workflow names
@@ -60,6 +96,38 @@ func (r *Registry) List() []string {
 	return names
 }
 
+// CompareVersions orders version strings such as "1.2" and "v1.10".
+// Dot-separated numeric segments compare numerically, other segments
+// lexically, and a missing segment sorts before a present one. It returns
+// -1, 0 or 1.
+func CompareVersions(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				return compare(an < bn)
+			}
+		case as[i] != bs[i]:
+			return compare(as[i] < bs[i])
+		}
+	}
+	if len(as) != len(bs) {
+		return compare(len(as) < len(bs))
+	}
+	return 0
+}
+
+func compare(less bool) int {
+	if less {
+		return -1
+	}
+	return 1
+}
+
 // DefaultRegistry is a global registry for workflows
 var DefaultRegistry = NewRegistry()
 
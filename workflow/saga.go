@@ -0,0 +1,74 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// CompensationInput is passed to a compensation activity. It carries the
+// input and output of the activity being compensated.
+type CompensationInput struct {
+	Input  interface{} `json:"input"`
+	Output interface{} `json:"output"`
+}
+
+// SagaOptions configure compensation behavior
+type SagaOptions struct {
+	// StopOnError stops compensating at the first failed compensation
+	// instead of attempting the remaining ones
+	StopOnError bool
+}
+
+// Saga records compensations for completed steps and runs them in reverse
+// order when the workflow fails. Each compensation is a durable activity
+// with its own scheduled/started/completed events, so compensation resumes
+// correctly after a crash.
+type Saga struct {
+	opts          SagaOptions
+	compensations []compensation
+	mu            sync.Mutex
+}
+
+type compensation struct {
+	activity string
+	input    interface{}
+}
+
+// NewSaga creates an empty saga
+func NewSaga(opts SagaOptions) *Saga {
+	return &Saga{opts: opts}
+}
+
+// AddCompensation registers an activity to run if the saga is compensated
+func (s *Saga) AddCompensation(activity string, input interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.compensations = append(s.compensations, compensation{activity: activity, input: input})
+}
+
+// Compensate runs the registered compensations in reverse order of
+// registration. Compensations run on a disconnected context, so they run to
+// completion even if the workflow was canceled or timed out.
+func (s *Saga) Compensate(ctx Context) error {
+	s.mu.Lock()
+	pending := make([]compensation, len(s.compensations))
+	copy(pending, s.compensations)
+	s.compensations = nil
+	s.mu.Unlock()
+
+	cctx := NewDisconnectedContext(ctx)
+	var errs []error
+	for i := len(pending) - 1; i >= 0; i-- {
+		c := pending[i]
+		ctx.Logger().Info("running compensation", "activity", c.activity)
+		if err := ctx.ExecuteActivity(cctx, c.activity, c.input).Get(cctx, nil); err != nil {
+			ctx.Logger().Error("compensation failed", "activity", c.activity, "error", err)
+			errs = append(errs, fmt.Errorf("compensation %s: %w", c.activity, err))
+			if s.opts.StopOnError {
+				break
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
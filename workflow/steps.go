@@ -0,0 +1,309 @@
+package workflow
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"text/template"
+)
+
+// DefaultMaxIterations bounds WhileStep and ForEachStep when no limit is set
+const DefaultMaxIterations = 100
+
+// StepData is the data available to input templates, input mappers and
+// predicates while a builder workflow runs.
+type StepData struct {
+	// Input is the workflow input
+	Input interface{}
+	// Prev is the output of the previous step
+	Prev interface{}
+	// Steps holds the outputs of named steps that have completed
+	Steps map[string]interface{}
+	// Item is the current element inside a ForEachStep
+	Item interface{}
+	// Index is the current iteration inside a ForEachStep or WhileStep
+	Index int
+}
+
+// Predicate decides a branch or loop condition from step data
+type Predicate func(data StepData) (bool, error)
+
+// InputMapper computes a step input from step data
+type InputMapper func(data StepData) (interface{}, error)
+
+// Template is an ActivityStep input rendered with text/template against
+// StepData, e.g. Template("Summarize: {{.Prev.text}}"). Templates nested in
+// map[string]interface{} and []interface{} inputs are rendered too. The
+// json function renders a value as JSON.
+type Template string
+
+// parse compiles the template
+func (t Template) parse() (*template.Template, error) {
+	tmpl, err := template.New("input").
+		Option("missingkey=error").
+		Funcs(template.FuncMap{"json": toJSON}).
+		Parse(string(t))
+	if err != nil {
+		return nil, fmt.Errorf("parse template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// render executes the template against data
+func (t Template) render(data StepData) (string, error) {
+	tmpl, err := t.parse()
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("render template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// runState is shared by all steps of one builder workflow execution
+type runState struct {
+	saga  *Saga
+	input interface{}
+	mu    sync.Mutex
+	named map[string]interface{}
+}
+
+// stepContext carries the run state and the current step data to steps
+type stepContext struct {
+	Context
+	run   *runState
+	prev  interface{}
+	item  interface{}
+	index int
+}
+
+// newStepContext starts a builder run whose first step sees input as Prev
+func newStepContext(ctx Context, saga *Saga, input interface{}) *stepContext {
+	return &stepContext{
+		Context: ctx,
+		run:     &runState{saga: saga, input: input, named: make(map[string]interface{})},
+		prev:    input,
+	}
+}
+
+// asStepContext returns ctx as a stepContext, starting a fresh run for steps
+// executed outside a builder workflow.
+func asStepContext(ctx Context) *stepContext {
+	if sc, ok := ctx.(*stepContext); ok {
+		return sc
+	}
+	return newStepContext(ctx, nil, nil)
+}
+
+// withPrev returns a copy of sc whose steps see prev as the previous output
+func (sc *stepContext) withPrev(prev interface{}) *stepContext {
+	next := *sc
+	next.prev = prev
+	return &next
+}
+
+// withItem returns a copy of sc positioned at a loop iteration
+func (sc *stepContext) withItem(item interface{}, index int) *stepContext {
+	next := *sc
+	next.item = item
+	next.index = index
+	return &next
+}
+
+// data snapshots the step data visible to the current step
+func (sc *stepContext) data() StepData {
+	sc.run.mu.Lock()
+	named := make(map[string]interface{}, len(sc.run.named))
+	for k, v := range sc.run.named {
+		named[k] = v
+	}
+	sc.run.mu.Unlock()
+	return StepData{Input: sc.run.input, Prev: sc.prev, Steps: named, Item: sc.item, Index: sc.index}
+}
+
+// record stores the output of a named step
+func (sc *stepContext) record(name string, output interface{}) {
+	sc.run.mu.Lock()
+	sc.run.named[name] = output
+	sc.run.mu.Unlock()
+}
+
+// sagaFrom returns the saga of the builder run ctx belongs to, if any
+func sagaFrom(ctx Context) *Saga {
+	if sc, ok := ctx.(*stepContext); ok {
+		return sc.run.saga
+	}
+	return nil
+}
+
+// runSteps executes steps in order, feeding each step's output to the next
+func runSteps(sc *stepContext, steps []Step) (interface{}, error) {
+	var result interface{}
+	for _, step := range steps {
+		out, err := step.Execute(sc)
+		if err != nil {
+			return nil, err
+		}
+		result = out
+		sc = sc.withPrev(out)
+	}
+	return result, nil
+}
+
+// renderInput renders any Templates in v against data
+func renderInput(v interface{}, data StepData) (interface{}, error) {
+	switch t := v.(type) {
+	case Template:
+		return t.render(data)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, item := range t {
+			rendered, err := renderInput(item, data)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = rendered
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, item := range t {
+			rendered, err := renderInput(item, data)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = rendered
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// IfStep runs Then when Predicate holds and Else otherwise. Without a
+// matching branch the previous output passes through unchanged.
+type IfStep struct {
+	Predicate Predicate
+	Then      Step
+	Else      Step
+}
+
+// Execute implements Step
+func (s *IfStep) Execute(ctx Context) (interface{}, error) {
+	sc := asStepContext(ctx)
+	ok, err := s.Predicate(sc.data())
+	if err != nil {
+		return nil, fmt.Errorf("if predicate: %w", err)
+	}
+	branch := s.Else
+	if ok {
+		branch = s.Then
+	}
+	if branch == nil {
+		return sc.prev, nil
+	}
+	return branch.Execute(sc)
+}
+
+// WhileStep runs Body while Condition holds, up to MaxIterations times
+// (DefaultMaxIterations if zero). Each iteration sees the previous
+// iteration's output as Prev. The result is the last output.
+type WhileStep struct {
+	Condition     Predicate
+	Body          Step
+	MaxIterations int
+}
+
+// Execute implements Step
+func (s *WhileStep) Execute(ctx Context) (interface{}, error) {
+	limit := s.MaxIterations
+	if limit <= 0 {
+		limit = DefaultMaxIterations
+	}
+	sc := asStepContext(ctx)
+	result := sc.prev
+	for i := 0; i < limit; i++ {
+		iter := sc.withPrev(result).withItem(nil, i)
+		ok, err := s.Condition(iter.data())
+		if err != nil {
+			return nil, fmt.Errorf("while condition: %w", err)
+		}
+		if !ok {
+			break
+		}
+		if result, err = s.Body.Execute(iter); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// ForEachStep runs Body once per element of the list returned by Items
+// (the previous output if Items is nil), in order. Each iteration sees the
+// element as Item. Lists longer than MaxItems (DefaultMaxIterations if
+// zero) fail the step. The result is the list of iteration outputs.
+type ForEachStep struct {
+	Items    InputMapper
+	Body     Step
+	MaxItems int
+}
+
+// Execute implements Step
+func (s *ForEachStep) Execute(ctx Context) (interface{}, error) {
+	sc := asStepContext(ctx)
+	list := sc.prev
+	if s.Items != nil {
+		var err error
+		if list, err = s.Items(sc.data()); err != nil {
+			return nil, fmt.Errorf("for-each items: %w", err)
+		}
+	}
+	items, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	limit := s.MaxItems
+	if limit <= 0 {
+		limit = DefaultMaxIterations
+	}
+	if len(items) > limit {
+		return nil, fmt.Errorf("for-each over %d items exceeds limit of %d", len(items), limit)
+	}
+
+	results := make([]interface{}, len(items))
+	for i, item := range items {
+		out, err := s.Body.Execute(sc.withItem(item, i))
+		if err != nil {
+			return nil, err
+		}
+		results[i] = out
+	}
+	return results, nil
+}
+
+// toList converts a slice or array of any element type to []interface{}
+func toList(v interface{}) ([]interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if list, ok := v.([]interface{}); ok {
+		return list, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("for-each expects a list, got %T", v)
+	}
+	out := make([]interface{}, rv.Len())
+	for i := range out {
+		out[i] = rv.Index(i).Interface()
+	}
+	return out, nil
+}
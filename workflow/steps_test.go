@@ -0,0 +1,51 @@
+package workflow
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderInput(t *testing.T) {
+	data := StepData{
+		Input: map[string]interface{}{"user": "ada"},
+		Prev:  map[string]interface{}{"text": "hello"},
+		Steps: map[string]interface{}{"plan": []interface{}{"a", "b"}},
+	}
+	in := map[string]interface{}{
+		"prompt": Template("{{.Input.user}} said {{.Prev.text}}"),
+		"plan":   []interface{}{Template("{{json .Steps.plan}}"), 42},
+		"static": "{{not rendered}}",
+	}
+
+	out, err := renderInput(in, data)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	m := out.(map[string]interface{})
+	if m["prompt"] != "ada said hello" {
+		t.Errorf("unexpected prompt %q", m["prompt"])
+	}
+	if plan := m["plan"].([]interface{}); plan[0] != `["a","b"]` || plan[1] != 42 {
+		t.Errorf("unexpected plan %v", plan)
+	}
+	if m["static"] != "{{not rendered}}" {
+		t.Errorf("plain strings must not be rendered, got %q", m["static"])
+	}
+	if _, ok := in["prompt"].(Template); !ok {
+		t.Error("expected input to be left untouched")
+	}
+
+	if _, err := renderInput(Template("{{.Prev.missing}}"), data); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("expected missing key error, got %v", err)
+	}
+}
+
+func TestToList(t *testing.T) {
+	list, err := toList([]string{"x", "y"})
+	if err != nil || len(list) != 2 || list[1] != "y" {
+		t.Fatalf("unexpected list %v (%v)", list, err)
+	}
+	if _, err := toList("not a list"); err == nil {
+		t.Fatal("expected error for non-list")
+	}
+}
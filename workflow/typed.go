@@ -0,0 +1,56 @@
+package workflow
+
+import "context"
+
+// TypedFuture is a Future whose result decodes to T
+type TypedFuture[T any] interface {
+	Future
+
+	// Result blocks until the result is available and returns it as T
+	Result(ctx context.Context) (T, error)
+}
+
+// typedFuture adapts a Future to TypedFuture
+type typedFuture[T any] struct {
+	Future
+}
+
+// Result implements TypedFuture
+func (f typedFuture[T]) Result(ctx context.Context) (T, error) {
+	var out T
+	err := f.Get(ctx, &out)
+	return out, err
+}
+
+// NewTypedFuture wraps a Future so its result is decoded as T, for example
+// NewTypedFuture[Approval](ctx.ReceiveSignal("approve")).
+func NewTypedFuture[T any](f Future) TypedFuture[T] {
+	return typedFuture[T]{Future: f}
+}
+
+// ExecuteActivity schedules an activity with a typed input and returns a
+// future whose result is decoded as Out.
+func ExecuteActivity[In, Out any](ctx Context, activity string, input In) TypedFuture[Out] {
+	return NewTypedFuture[Out](ctx.ExecuteActivity(ctx, activity, input))
+}
+
+// ExecuteActivityWithID is the typed form of Context.ExecuteActivityWithID
+func ExecuteActivityWithID[In, Out any](ctx Context, activity string, input In, activityID string) TypedFuture[Out] {
+	return NewTypedFuture[Out](ctx.ExecuteActivityWithID(ctx, activity, input, activityID))
+}
+
+// ExecuteChildWorkflow is the typed form of Context.ExecuteChildWorkflow
+func ExecuteChildWorkflow[In, Out any](ctx Context, workflowName string, input In, opts ChildWorkflowOptions) TypedFuture[Out] {
+	return NewTypedFuture[Out](ctx.ExecuteChildWorkflow(ctx, workflowName, input, opts))
+}
+
+// ExecuteLocalActivity is the typed form of Context.ExecuteLocalActivity
+func ExecuteLocalActivity[In, Out any](ctx Context, fn func(ctx context.Context, input In) (Out, error), input In) TypedFuture[Out] {
+	// Name the local activity after fn rather than the wrapper below
+	opts := GetLocalActivityOptions(ctx)
+	opts.Name = LocalActivityName(ctx, fn)
+	return NewTypedFuture[Out](ctx.ExecuteLocalActivity(WithLocalActivityOptions(ctx, opts), func(ctx context.Context, in interface{}) (interface{}, error) {
+		typed, _ := in.(In)
+		return fn(ctx, typed)
+	}, input))
+}
@@ -4,6 +4,8 @@ package workflow
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 )
 
@@ -29,9 +31,43 @@ type Context interface {
 	// If an activity with the same ID is already completed, returns the cached result.
 	ExecuteActivityWithID(ctx context.Context, activity string, input interface{}, activityID string) Future
 
+	// ExecuteLocalActivity runs fn in the workflow's process rather than on a
+	// worker, retrying it under the LocalActivityOptions attached to ctx. Its
+	// outcome is recorded as a marker event, so replays return the recorded
+	// result without calling fn again. Use it for short, cheap steps.
+	ExecuteLocalActivity(ctx context.Context, fn LocalActivityFunc, input interface{}) Future
+
+	// ExecuteChildWorkflow starts another registered workflow as a child of
+	// this one. The returned future resolves with the child's output.
+	ExecuteChildWorkflow(ctx context.Context, workflowName string, input interface{}, opts ChildWorkflowOptions) Future
+
 	// Sleep pauses workflow execution for the specified duration
 	Sleep(duration time.Duration) Future
 
+	// ReceiveSignal returns a future that resolves with the payload of the next
+	// signal with the given name. Each call consumes one signal, in the order
+	// the signals were received.
+	ReceiveSignal(name string) Future
+
+	// ContinueAsNew returns an error that, when returned from the workflow
+	// function, completes the current run and atomically starts a fresh run
+	// of the same workflow with the given input and an empty event history.
+	ContinueAsNew(input interface{}) error
+
+	// GetVersion guards a change to workflow code so runs started before
+	// the change keep replaying the old code path. The first call for a
+	// changeID records the version in history: maxSupported when the run
+	// reaches the call for the first time, DefaultVersion when replaying a
+	// run whose history predates the change. Later calls and replays return
+	// the recorded version. An error is returned if the recorded version is
+	// outside [minSupported, maxSupported].
+	GetVersion(changeID string, minSupported, maxSupported int) (int, error)
+
+	// SetQueryHandler registers a handler that answers queries with the given
+	// name from the workflow's in-memory state. Handlers may be invoked
+	// concurrently with workflow code and must not block or mutate state.
+	SetQueryHandler(name string, handler QueryHandler) error
+
 	// Now returns the current workflow time (for determinism)
 	Now() time.Time
 
@@ -51,6 +87,52 @@ type Future interface {
 	IsReady() bool
 }
 
+// ParentClosePolicy determines what happens to a running child workflow when
+// its parent completes, fails or is canceled.
+type ParentClosePolicy string
+
+const (
+	// ParentClosePolicyTerminate cancels the child immediately (default)
+	ParentClosePolicyTerminate ParentClosePolicy = "terminate"
+	// ParentClosePolicyAbandon lets the child keep running independently
+	ParentClosePolicyAbandon ParentClosePolicy = "abandon"
+	// ParentClosePolicyRequestCancel sends the child a CancelRequestedSignal
+	// so it can clean up and finish on its own terms
+	ParentClosePolicyRequestCancel ParentClosePolicy = "request_cancel"
+)
+
+// CancelRequestedSignal is the signal delivered to a child workflow whose
+// parent closed with ParentClosePolicyRequestCancel.
+const CancelRequestedSignal = "__cancel_requested"
+
+// ChildWorkflowOptions configure a child workflow execution
+type ChildWorkflowOptions struct {
+	// WorkflowID sets the child's ID; a deterministic ID is derived if empty
+	WorkflowID string
+
+	// ParentClosePolicy defaults to ParentClosePolicyTerminate
+	ParentClosePolicy ParentClosePolicy
+}
+
+// DefaultVersion is returned by Context.GetVersion for runs that reached the
+// guarded code before GetVersion was added
+const DefaultVersion = -1
+
+// ContinueAsNewError is returned by a workflow to continue as a new run.
+// Use Context.ContinueAsNew to create it.
+type ContinueAsNewError struct {
+	Input interface{}
+}
+
+// Error implements error
+func (e *ContinueAsNewError) Error() string {
+	return "workflow continued as new"
+}
+
+// QueryHandler answers a workflow query. It receives the caller-supplied
+// arguments and returns a result that is serialized back to the caller.
+type QueryHandler func(args interface{}) (interface{}, error)
+
 // Logger provides structured logging for workflows
 type Logger interface {
 	Debug(msg string, keyvals ...interface{})
@@ -86,7 +168,9 @@ type Options struct {
 	// TaskQueue specifies which queue to send activities to
 	TaskQueue string
 
-	// ExecutionTimeout is the maximum time a workflow can run
+	// ExecutionTimeout is the maximum time a workflow can run, measured from
+	// its start and covering all retry attempts. When it elapses the
+	// workflow's context is canceled with a TimeoutError.
 	ExecutionTimeout time.Duration
 
 	// RetryPolicy defines how to retry failed workflows
@@ -95,7 +179,8 @@ type Options struct {
 
 // RetryPolicy defines retry behavior for workflows and activities
 type RetryPolicy struct {
-	// MaxAttempts is the maximum number of retry attempts
+	// MaxAttempts is the maximum number of attempts, including the first.
+	// Values below 2 disable retries.
 	MaxAttempts int
 
 	// InitialInterval is the backoff duration for the first retry
@@ -106,6 +191,112 @@ type RetryPolicy struct {
 
 	// MaxInterval caps the backoff duration
 	MaxInterval time.Duration
+
+	// NonRetryableErrors lists error messages that fail the workflow without
+	// retrying, in addition to errors wrapped by NewNonRetryableError
+	NonRetryableErrors []string
+}
+
+// IsRetryable reports whether a failed attempt may be retried under the policy
+func (p *RetryPolicy) IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var nonRetryable *NonRetryableError
+	var timeout *TimeoutError
+	if errors.As(err, &nonRetryable) || errors.As(err, &timeout) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	msg := err.Error()
+	for _, s := range p.NonRetryableErrors {
+		if msg == s {
+			return false
+		}
+	}
+	return true
+}
+
+// Backoff returns the delay before the given attempt, where attempt 2 is the
+// first retry
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	d := p.InitialInterval
+	for i := 2; i < attempt && (p.MaxInterval <= 0 || d < p.MaxInterval); i++ {
+		d = time.Duration(float64(d) * p.BackoffCoefficient)
+	}
+	if p.MaxInterval > 0 && d > p.MaxInterval {
+		return p.MaxInterval
+	}
+	return d
+}
+
+// NonRetryableError fails a workflow without retrying it, regardless of its
+// retry policy
+type NonRetryableError struct {
+	Err error
+}
+
+// NewNonRetryableError wraps err so that returning it from a workflow fails
+// the workflow without retrying
+func NewNonRetryableError(err error) error {
+	return &NonRetryableError{Err: err}
+}
+
+// Error implements error
+func (e *NonRetryableError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error
+func (e *NonRetryableError) Unwrap() error {
+	return e.Err
+}
+
+// CanceledError is the cause of a workflow context's cancellation when the
+// workflow is canceled. Pending futures fail with it. It matches
+// context.Canceled with errors.Is.
+type CanceledError struct{}
+
+// Error implements error
+func (e *CanceledError) Error() string {
+	return "workflow canceled"
+}
+
+// Is reports whether target is context.Canceled
+func (e *CanceledError) Is(target error) bool {
+	return target == context.Canceled
+}
+
+// TimeoutError is the cause of a workflow context's cancellation when the
+// workflow exceeds its ExecutionTimeout. Pending futures fail with it. It
+// matches context.DeadlineExceeded with errors.Is.
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+// Error implements error
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("workflow timed out after %s", e.Timeout)
+}
+
+// Is reports whether target is context.DeadlineExceeded
+func (e *TimeoutError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}
+
+type disconnectedKey struct{}
+
+// NewDisconnectedContext returns a context with the values of ctx but not its
+// cancellation or deadline. Activities executed and futures waited on with it
+// keep running after the workflow is canceled or times out, and the workflow
+// stays open until they finish. Use it for cleanup such as compensations.
+func NewDisconnectedContext(ctx context.Context) context.Context {
+	return context.WithValue(context.WithoutCancel(ctx), disconnectedKey{}, true)
+}
+
+// IsDisconnected reports whether ctx was created by NewDisconnectedContext
+func IsDisconnected(ctx context.Context) bool {
+	disconnected, _ := ctx.Value(disconnectedKey{}).(bool)
+	return disconnected
 }
 
 // DefaultRetryPolicy returns a sensible default retry policy
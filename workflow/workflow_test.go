@@ -1,6 +1,9 @@
 package workflow
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 )
@@ -61,6 +64,54 @@ func TestRegistry(t *testing.T) {
 	}
 }
 
+func TestRegistry_Versions(t *testing.T) {
+	registry := NewRegistry()
+	for _, v := range []string{"1.2", "1.10", "1.9"} {
+		if err := registry.Register(New("versioned").Version(v).Build()); err != nil {
+			t.Fatalf("failed to register version %s: %v", v, err)
+		}
+	}
+
+	latest, err := registry.Get("versioned")
+	if err != nil || latest.Version != "1.10" {
+		t.Fatalf("expected latest version 1.10, got %v (%v)", latest, err)
+	}
+	pinned, err := registry.GetVersion("versioned", "1.2")
+	if err != nil || pinned.Version != "1.2" {
+		t.Fatalf("expected version 1.2, got %v (%v)", pinned, err)
+	}
+	if _, err := registry.GetVersion("versioned", "2.0"); err == nil {
+		t.Error("expected error for unknown version")
+	}
+	if got := registry.Versions("versioned"); len(got) != 3 || got[0] != "1.2" || got[2] != "1.10" {
+		t.Errorf("expected versions oldest first, got %v", got)
+	}
+	if err := registry.Register(New("versioned").Version("1.9").Build()); err == nil {
+		t.Error("expected error when registering duplicate version")
+	}
+	if names := registry.List(); len(names) != 1 {
+		t.Errorf("expected one workflow name, got %v", names)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.9", "1.10", -1},
+		{"v2", "1.10", 1},
+		{"1.0", "1.0.1", -1},
+		{"1.0-beta", "1.0-alpha", 1},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
 func TestDefaultRetryPolicy(t *testing.T) {
 	policy := DefaultRetryPolicy()
 
@@ -76,3 +127,26 @@ func TestDefaultRetryPolicy(t *testing.T) {
 		t.Errorf("expected backoff coefficient 2.0, got %f", policy.BackoffCoefficient)
 	}
 }
+
+func TestRetryPolicy_BackoffAndRetryable(t *testing.T) {
+	policy := DefaultRetryPolicy()
+	for attempt, want := range map[int]time.Duration{2: time.Second, 3: 2 * time.Second, 4: 4 * time.Second, 10: time.Minute} {
+		if got := policy.Backoff(attempt); got != want {
+			t.Errorf("attempt %d: expected backoff %v, got %v", attempt, want, got)
+		}
+	}
+
+	policy.NonRetryableErrors = []string{"invalid input"}
+	if !policy.IsRetryable(errors.New("timeout")) {
+		t.Error("expected plain error to be retryable")
+	}
+	if policy.IsRetryable(errors.New("invalid input")) {
+		t.Error("expected listed error message not to be retryable")
+	}
+	if policy.IsRetryable(fmt.Errorf("step: %w", NewNonRetryableError(errors.New("bad")))) {
+		t.Error("expected wrapped NonRetryableError not to be retryable")
+	}
+	if policy.IsRetryable(context.Canceled) {
+		t.Error("expected cancellation not to be retryable")
+	}
+}